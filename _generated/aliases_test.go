@@ -0,0 +1,28 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRuneByteUintptrRoundTrip(t *testing.T) {
+	in := Aliases{
+		R:  'λ',
+		B:  0xfe,
+		P:  1 << 31,
+		Rs: []rune("héllo"),
+		Ps: []uintptr{1, 2, 3},
+		Pa: [2]uintptr{4, 5},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Aliases
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %#v; want %#v", out, in)
+	}
+}
@@ -0,0 +1,72 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestFixedArraysRoundTrip(t *testing.T) {
+	in := FixedArrays{
+		Quad:  [4]uint8{1, 2, 3, 4},
+		Names: [3]string{"a", "", "c"},
+		Eight: [eight]int{0, 1, 2, 3, 4, 5, 6, -7},
+	}
+	for i := range in.Hash {
+		in.Hash[i] = byte(i * 7)
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg and MarshalMsg disagree:\n%x\n%x", buf.Bytes(), bts)
+	}
+
+	var out FixedArrays
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+	out = FixedArrays{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
+
+func TestFixedArraysWrongLength(t *testing.T) {
+	for _, short := range []msgp.Marshaler{
+		&ShortHash{},
+		&ShortNames{Names: [2]string{"a", "b"}},
+	} {
+		bts, err := short.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out FixedArrays
+		_, err = out.UnmarshalMsg(bts)
+		if _, ok := err.(msgp.ArrayError); !ok {
+			t.Errorf("UnmarshalMsg: expected an ArrayError; got %v", err)
+		}
+		err = msgp.Decode(bytes.NewReader(bts), &out)
+		if _, ok := err.(msgp.ArrayError); !ok {
+			t.Errorf("DecodeMsg: expected an ArrayError; got %v", err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestAsArray(t *testing.T) {
+	in := AsArray{ID: 7, Cache: "not sent", Name: "gopher", Tags: []string{"a", "b"}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+
+	// the fields go by position, with no keys and no Cache
+	if typ := msgp.NextType(bts); typ != msgp.ArrayType {
+		t.Fatalf("MarshalMsg wrote a %s; want an array", typ)
+	}
+	var nbs *msgp.NilBitsStack
+	sz, rest, err := nbs.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != 3 {
+		t.Fatalf("array of %d; want 3", sz)
+	}
+	id, rest, err := nbs.ReadInt64Bytes(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := nbs.ReadStringBytes(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 || name != "gopher" {
+		t.Errorf("array starts %d, %q; want 7, \"gopher\"", id, name)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg wrote %x; MarshalMsg wrote %x", buf.Bytes(), bts)
+	}
+
+	want := in
+	want.Cache = ""
+	var out AsArray
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, want)
+	}
+	out = AsArray{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, want)
+	}
+}
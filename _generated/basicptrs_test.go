@@ -0,0 +1,98 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// decodeBoth decodes bts into a copy of start
+// with both UnmarshalMsg and DecodeMsg.
+func decodeBoth(t *testing.T, bts []byte, start BasicPtrs) (um, dm BasicPtrs) {
+	um = start
+	left, err := um.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("UnmarshalMsg left %d bytes", len(left))
+	}
+	dm = start
+	if err := msgp.Decode(bytes.NewReader(bts), &dm); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestBasicPtrsNil(t *testing.T) {
+	// nil pointers are left out when encoding,
+	// so write the nils by hand
+	i, s, tm := 5, "old", time.Unix(1, 0)
+	full, err := (&BasicPtrs{I: &i, S: &s, T: &tm}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := wireKeys(t, full)
+	bts := msgp.AppendMapHeader(nil, uint32(len(keys)))
+	for _, k := range keys {
+		bts = msgp.AppendString(bts, k)
+		bts = msgp.AppendNil(bts)
+	}
+
+	// nil to nil
+	um, dm := decodeBoth(t, bts, BasicPtrs{})
+	for how, out := range map[string]BasicPtrs{"UnmarshalMsg": um, "DecodeMsg": dm} {
+		if out.I != nil || out.S != nil || out.T != nil {
+			t.Errorf("%s: nil into nil pointers gave %+v", how, out)
+		}
+	}
+
+	// an existing pointer is reset to nil, and
+	// what it pointed to is left alone
+	um, dm = decodeBoth(t, bts, BasicPtrs{I: &i, S: &s, T: &tm})
+	for how, out := range map[string]BasicPtrs{"UnmarshalMsg": um, "DecodeMsg": dm} {
+		if out.I != nil || out.S != nil || out.T != nil {
+			t.Errorf("%s: nil into set pointers gave %+v", how, out)
+		}
+	}
+	if i != 5 || s != "old" || !tm.Equal(time.Unix(1, 0)) {
+		t.Error("decoding a nil wrote through the old pointers")
+	}
+}
+
+func TestBasicPtrsValue(t *testing.T) {
+	i, s, tm := 7, "new", time.Unix(2, 0).UTC()
+	bts, err := (&BasicPtrs{I: &i, S: &s, T: &tm}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a value into a nil pointer allocates
+	um, dm := decodeBoth(t, bts, BasicPtrs{})
+	for how, out := range map[string]BasicPtrs{"UnmarshalMsg": um, "DecodeMsg": dm} {
+		if out.I == nil || *out.I != 7 || out.S == nil || *out.S != "new" || out.T == nil || !out.T.Equal(tm) {
+			t.Errorf("%s: value into nil pointers gave %+v", how, out)
+			continue
+		}
+		if out.I == &i || out.S == &s || out.T == &tm {
+			t.Errorf("%s: expected freshly allocated pointers", how)
+		}
+	}
+}
+
+func TestBasicPtrsMissing(t *testing.T) {
+	// a missing field is read as if nil, but like
+	// other re-used pointers, keeps its pointer
+	// and has the value zeroed
+	bts := msgp.AppendMapHeader(nil, 0)
+
+	i, s := 5, "old"
+	um, dm := decodeBoth(t, bts, BasicPtrs{I: &i, S: &s})
+	for how, out := range map[string]BasicPtrs{"UnmarshalMsg": um, "DecodeMsg": dm} {
+		if out.I == nil || *out.I != 0 || out.S == nil || *out.S != "" || out.T != nil {
+			t.Errorf("%s: missing fields gave %+v", how, out)
+		}
+	}
+}
@@ -315,3 +315,371 @@ type Tree struct {
 	Element  int
 	Parent   *Wrapper
 }
+
+//msgp:patch Patchable
+
+// test Diff and ApplyPatch
+type Patchable struct {
+	Name  string
+	Count int
+	Tags  []string
+	Attrs map[string]string
+	Ptr   *float64
+	When  time.Time
+	Inner Moose
+	Blob  []byte
+}
+
+// test msg:",nilwhen=zero"
+//msgp:tuple NilWhenTuple
+
+type NilWhen struct {
+	When  time.Time `msg:",nilwhen=zero"`
+	Count int       `msg:",nilwhen=zero"`
+}
+
+type NilWhenTuple struct {
+	When  time.Time `msg:",nilwhen=zero"`
+	Count int       `msg:",nilwhen=zero"`
+}
+
+// test map[K]struct{} sets, which go
+// on the wire as arrays of keys
+type Sets struct {
+	Names map[string]struct{}
+	IDs   map[int]struct{}
+	Flags map[bool]struct{}
+	Small map[uint16]struct{}
+}
+
+// test msg:",enumcheck"
+type Color int
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+type Paint struct {
+	Name  string
+	Color Color `msg:",enumcheck"`
+}
+
+// test //msgp:enum; Medium is written by the
+// names of its constants
+//msgp:enum Medium
+
+type Medium uint8
+
+const (
+	Oil Medium = iota + 1
+	Watercolor
+	Tempera
+	Acrylic
+	Egg = Tempera // an alias, decoded but never written
+)
+
+type Canvas struct {
+	Title   string
+	Medium  Medium
+	Layers  []Medium
+	Primary *Medium
+}
+
+// test fields of a named slice and map that
+// have no methods of their own
+//msgp:ignore Labels Attrs
+
+type Labels []string
+type Attrs map[string]string
+
+type Labeled struct {
+	L Labels
+	A Attrs
+}
+
+// test msg:",required"
+type Required struct {
+	ID   string `msg:",required"`
+	Note string
+}
+
+// test a msg:",required" field of a struct held by value
+type RequiredOuter struct {
+	In   Required
+	Note string
+}
+
+// test several msg:",required" fields missing at once
+type RequiredPair struct {
+	Name  string `msg:",required"`
+	Note  string
+	Count int `msg:",required"`
+}
+
+// test msg:",extras"
+type WithExtras struct {
+	Name  string
+	Count int
+	Rest  map[string]interface{} `msg:",extras"`
+}
+
+// test msg:",inline"
+type WithInline struct {
+	Name   string
+	Scores map[string]float64 `msg:",inline"`
+}
+
+// test msg:",inline" with an unexported value type,
+// which gets no methods and must be inlined
+type point struct {
+	X, Y int
+}
+
+type WithInlineHidden struct {
+	Name   string
+	Points map[string]point `msg:",inline"`
+}
+
+// test msg:",inline" with an anonymous struct value
+type WithInlineAnon struct {
+	Name  string
+	Extra map[string]struct {
+		A int
+		B string
+	} `msg:",inline"`
+}
+
+// test maps with keys other than string
+type MapKeys struct {
+	ByID   map[int64]string
+	Flags  map[uint32]bool
+	Bits   map[bool]uint8
+	Nested map[string]map[string]int
+}
+
+// test msg:",truncate=N"
+type Truncated struct {
+	Short string `msg:",truncate=8"`
+	Both  string `msg:",truncate=4,nilwhen=zero"`
+	Named Tag    `msg:",truncate=5"`
+}
+
+type Tag string
+
+// test maps with values other than string and interface{}
+type MapValues struct {
+	Ints    map[string]int
+	Floats  map[string]float64
+	Bytes   map[string][]byte
+	Ptrs    map[string]*MapInner
+	Structs map[string]MapInner
+	Chans   map[string]chan int // unsupported; ignored
+}
+
+type MapInner struct {
+	A int
+	B string
+}
+
+// test fixed-size arrays
+type FixedArrays struct {
+	Hash  [32]byte
+	Quad  [4]uint8
+	Names [3]string
+	Eight [eight]int
+}
+
+// FixedArrays fields with the wrong lengths
+type ShortHash struct {
+	Hash [16]byte
+}
+
+type ShortNames struct {
+	Names [2]string
+}
+
+// test named types defined on basic types,
+// which are written just like the basic type
+type UserID uint64
+type UserName string
+
+type Account struct {
+	ID   UserID
+	Name UserName
+}
+
+// test msg:",keyorder"
+type KeyOrdered struct {
+	Attrs map[string]int
+	Order []string `msg:",keyorder"`
+}
+
+type KeyOrderedNamed struct {
+	Attrs map[string]int
+	Other map[string]KeyOrdered
+	Seq   []string `msg:",keyorder=Other"`
+}
+
+// test interface{} fields, which hold any value
+type Dynamic struct {
+	One  interface{}
+	Many []interface{}
+}
+
+// test rune, byte and uintptr fields
+type Aliases struct {
+	R  rune
+	B  byte
+	P  uintptr
+	Rs []rune
+	Ps []uintptr
+	Pa [2]uintptr
+}
+
+// test slices and arrays of pointers, which
+// may hold nils, and pointers to slices
+type PtrElems struct {
+	Elems    []*PtrElem
+	Fixed    [3]*PtrElem
+	Ints     []*int
+	SlicePtr *[]PtrElem
+}
+
+type PtrElem struct {
+	Name string
+	N    int
+}
+
+// test anonymous struct fields
+type InlineMeta struct {
+	Meta struct {
+		A int
+		B string `msg:"-"`
+		C string `msg:"c,omitempty"`
+		D struct {
+			E []string
+		}
+	}
+	Name string
+}
+
+// test nil and non-nil pointers to basic
+// types; as a tuple, a nil goes on the wire
+//msgp:tuple NilPtrsTuple
+
+type NilPtrs struct {
+	Set   *int
+	Unset *int
+}
+
+type NilPtrsTuple struct {
+	Set   *int
+	Unset *int
+}
+
+// test an embedded pointer to a struct,
+// both nil and not
+type EmbedPtrBase struct {
+	ID    int64
+	Label string
+}
+
+type EmbedPtr struct {
+	*EmbedPtrBase
+	Note string
+}
+
+// test msg:",extension" on a named type
+// that implements msgp.Extension
+//msgp:ignore ExtUUID
+
+type ExtUUID [16]byte
+
+func (u *ExtUUID) ExtensionType() int8 { return 43 }
+
+func (u *ExtUUID) Len() int { return len(u) }
+
+func (u *ExtUUID) MarshalBinaryTo(b []byte) error {
+	copy(b, u[:])
+	return nil
+}
+
+func (u *ExtUUID) UnmarshalBinary(b []byte) error {
+	if len(b) != len(u) {
+		return msgp.ErrShortBytes
+	}
+	copy(u[:], b)
+	return nil
+}
+
+type ExtTagged struct {
+	ID    ExtUUID  `msg:"id,extension"`
+	Maybe *ExtUUID `msg:"maybe,extension,omitempty"`
+	Name  string
+}
+
+// test reads of narrow integers
+// that overflow their fields
+type NarrowInts struct {
+	I8  int8
+	U8  uint8
+	I16 int16
+}
+
+// test decoding into re-used slices
+type ReuseSlices struct {
+	Ints   []int64
+	Points []ReusePoint
+	Raw    []byte
+}
+
+type ReusePoint struct {
+	X, Y float64
+}
+
+// test decoding a nil into fields that
+// aren't pointers
+type NilScalars struct {
+	Count int
+	Ratio float64
+	On    bool
+	Raw   []byte
+	Tags  map[string]string
+	Point ReusePoint
+	Name  string
+}
+
+// test msg:",readonly" fields, which are
+// encoded but never assigned on decode
+type ReadOnly struct {
+	ID   int64    `msg:"id,readonly"`
+	Tags []string `msg:",readonly,omitempty"`
+	Name string
+}
+
+//msgp:tuple ReadOnlyTuple
+type ReadOnlyTuple struct {
+	ID   int64 `msg:",readonly"`
+	Name string
+}
+
+// test //msgp:asarray, the other name for
+// //msgp:tuple; a skipped field takes no place
+//
+//msgp:asarray AsArray
+type AsArray struct {
+	ID    int64
+	Cache string `msg:"-"`
+	Name  string
+	Tags  []string
+}
+
+// test pointers to basic types decoding
+// a nil, a value, and a missing field
+type BasicPtrs struct {
+	I *int
+	S *string
+	T *time.Time
+}
@@ -0,0 +1,48 @@
+package _generated
+
+import (
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestDefinedBasicTypes(t *testing.T) {
+	in := Account{ID: 1 << 40, Name: "gopher"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values are written as their basic types
+	var nbs *msgp.NilBitsStack
+	rest := bts
+	sz, rest, err := nbs.ReadMapHeaderBytes(rest)
+	if err != nil || sz != 2 {
+		t.Fatalf("ReadMapHeaderBytes: %d, %v", sz, err)
+	}
+	_, rest, err = nbs.ReadMapKeyZC(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, rest, err := nbs.ReadUint64Bytes(rest)
+	if err != nil || id != 1<<40 {
+		t.Errorf("ID: %d, %v", id, err)
+	}
+	_, rest, err = nbs.ReadMapKeyZC(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := nbs.ReadStringBytes(rest)
+	if err != nil || name != "gopher" {
+		t.Errorf("Name: %q, %v", name, err)
+	}
+
+	var out Account
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("got %#v; want %#v", out, in)
+	}
+}
@@ -0,0 +1,46 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestInterfaceFieldsRoundTrip(t *testing.T) {
+	in := Dynamic{
+		One:  map[string]interface{}{"k": "v"},
+		Many: []interface{}{int64(-3), "two", true, nil, []interface{}{1.5}},
+	}
+
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	if err := in.EncodeMsg(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Fatal("EncodeMsg and MarshalMsg disagree")
+	}
+
+	var out Dynamic
+	if _, err := out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	out = Dynamic{}
+	if err := out.DecodeMsg(msgp.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
@@ -0,0 +1,78 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestEmbedPtr(t *testing.T) {
+	for _, in := range []EmbedPtr{
+		{Note: "nil base"},
+		{EmbedPtrBase: &EmbedPtrBase{ID: 7, Label: "base"}, Note: "with base"},
+	} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("%s: EncodeMsg and MarshalMsg disagree", in.Note)
+		}
+
+		// a nil embedded pointer is left out, like any other
+		want := []string{"Note__str"}
+		if in.EmbedPtrBase != nil {
+			want = []string{"EmbedPtrBase__ptr", "Note__str"}
+		}
+		if keys := wireKeys(t, bts); !reflect.DeepEqual(keys, want) {
+			t.Errorf("%s: wrote keys %v; want %v", in.Note, keys, want)
+		}
+
+		// and decoding allocates it if it is there,
+		// and resets it if it isn't
+		out := EmbedPtr{EmbedPtrBase: &EmbedPtrBase{ID: 99}}
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("%s: UnmarshalMsg got %+v (base %+v)", in.Note, out, out.EmbedPtrBase)
+		}
+		out = EmbedPtr{EmbedPtrBase: &EmbedPtrBase{ID: 99}}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("%s: DecodeMsg got %+v (base %+v)", in.Note, out, out.EmbedPtrBase)
+		}
+	}
+
+	// an explicit nil resets it too
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "EmbedPtrBase__ptr")
+	bts = msgp.AppendNil(bts)
+	out := EmbedPtr{EmbedPtrBase: &EmbedPtrBase{ID: 99}}
+	_, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.EmbedPtrBase != nil {
+		t.Errorf("UnmarshalMsg of a nil: got base %+v; want nil", out.EmbedPtrBase)
+	}
+	out = EmbedPtr{EmbedPtrBase: &EmbedPtrBase{ID: 99}}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.EmbedPtrBase != nil {
+		t.Errorf("DecodeMsg of a nil: got base %+v; want nil", out.EmbedPtrBase)
+	}
+}
@@ -0,0 +1,133 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestEnumByName(t *testing.T) {
+	tempera := Tempera
+	in := Canvas{
+		Title:   "annunciation",
+		Medium:  Egg,
+		Layers:  []Medium{Oil, Watercolor, Acrylic},
+		Primary: &tempera,
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz := in.Msgsize(); sz < len(bts) {
+		t.Errorf("Msgsize %d is less than the %d bytes written", sz, len(bts))
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg and MarshalMsg disagree")
+	}
+
+	var nbs *msgp.NilBitsStack
+	var name string
+	name, _, err = nbs.ReadStringBytes(fieldValue(t, bts, "Medium__rct"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Tempera" {
+		t.Errorf("expected Medium on the wire as %q; got %q", "Tempera", name)
+	}
+
+	check := func(how string, out Canvas) {
+		if out.Title != in.Title || out.Medium != Tempera || len(out.Layers) != 3 ||
+			out.Layers[0] != Oil || out.Layers[1] != Watercolor || out.Layers[2] != Acrylic ||
+			out.Primary == nil || *out.Primary != Tempera {
+			t.Errorf("%s: %v in; %v out", how, in, out)
+		}
+	}
+	var out Canvas
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("UnmarshalMsg", out)
+	out = Canvas{}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("DecodeMsg", out)
+
+	// an alias decodes to the value it names
+	bts = msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Medium__rct")
+	bts = msgp.AppendString(bts, "Egg")
+	out = Canvas{}
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil || out.Medium != Tempera {
+		t.Errorf("UnmarshalMsg of Egg: got %v, %v", out.Medium, err)
+	}
+	out = Canvas{}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil || out.Medium != Tempera {
+		t.Errorf("DecodeMsg of Egg: got %v, %v", out.Medium, err)
+	}
+}
+
+func TestEnumZero(t *testing.T) {
+	in := Canvas{Title: "sketch", Layers: []Medium{0, Oil}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Canvas
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Layers) != 2 || out.Layers[0] != 0 || out.Layers[1] != Oil {
+		t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+	}
+}
+
+func TestEnumUnknown(t *testing.T) {
+	in := Canvas{Title: "fresco", Medium: Acrylic + 1}
+	_, err := in.MarshalMsg(nil)
+	want := msgp.EnumNameError{Type: "Medium", Value: 5}
+	if err != want {
+		t.Errorf("MarshalMsg: expected %v; got %v", want, err)
+	}
+	err = msgp.Encode(&bytes.Buffer{}, &in)
+	if err != want {
+		t.Errorf("EncodeMsg: expected %v; got %v", want, err)
+	}
+
+	// the Writer keeps the error, so Flush
+	// can't write the half-encoded Canvas
+	var buf bytes.Buffer
+	wr := msgp.NewWriter(&buf)
+	in.EncodeMsg(wr)
+	if err = wr.Flush(); err != want {
+		t.Errorf("Flush: expected %v; got %v", want, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Flush wrote %d bytes", buf.Len())
+	}
+
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Medium__rct")
+	bts = msgp.AppendString(bts, "Fresco")
+	want = msgp.EnumNameError{Type: "Medium", Name: "Fresco"}
+	var out Canvas
+	_, err = out.UnmarshalMsg(bts)
+	if err != want {
+		t.Errorf("UnmarshalMsg: expected %v; got %v", want, err)
+	}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != want {
+		t.Errorf("DecodeMsg: expected %v; got %v", want, err)
+	}
+}
@@ -0,0 +1,52 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestEnumCheck(t *testing.T) {
+	for _, in := range []Paint{{Name: "sky", Color: Blue}, {Name: "grass", Color: Green}, {Name: "none"}} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out Paint
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+		}
+		out = Paint{}
+		err = msgp.Decode(bytes.NewReader(bts), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Errorf("DecodeMsg: %v in; %v out", in, out)
+		}
+	}
+}
+
+func TestEnumCheckOutOfRange(t *testing.T) {
+	in := Paint{Name: "ultraviolet", Color: Blue + 4}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := msgp.EnumRangeError{Type: "Color", Value: 6, Min: 0, Max: 2}
+
+	var out Paint
+	_, err = out.UnmarshalMsg(bts)
+	if err != want {
+		t.Errorf("UnmarshalMsg: expected %v; got %v", want, err)
+	}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != want {
+		t.Errorf("DecodeMsg: expected %v; got %v", want, err)
+	}
+}
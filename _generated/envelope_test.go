@@ -0,0 +1,86 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func (z *NilWhen) TypeName() string      { return "NilWhen" }
+func (z *NilWhen) SchemaVersion() uint64 { return 2 }
+func (z *Sets) TypeName() string         { return "Sets" }
+func (z *Sets) SchemaVersion() uint64    { return 1 }
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	when := &NilWhen{When: time.Unix(1500000000, 0).UTC(), Count: 5}
+	sets := &Sets{Names: map[string]struct{}{"x": {}}}
+
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	for _, v := range []msgp.Versioned{when, sets} {
+		err := msgp.WriteEnvelope(w, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+
+	r := msgp.NewReader(&buf)
+	var got []msgp.Unmarshaler
+	for i := 0; i < 2; i++ {
+		name, version, body, err := msgp.ReadEnvelope(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// dispatch on the type name
+		var u interface {
+			msgp.Unmarshaler
+			SchemaVersion() uint64
+		}
+		switch name {
+		case "NilWhen":
+			u = new(NilWhen)
+		case "Sets":
+			u = new(Sets)
+		default:
+			t.Fatalf("unexpected type name %q", name)
+		}
+		if version != u.SchemaVersion() {
+			t.Errorf("%s: got version %d; want %d", name, version, u.SchemaVersion())
+		}
+		left, err := u.UnmarshalMsg(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != 0 {
+			t.Errorf("%s: %d bytes left over in the body", name, len(left))
+		}
+		got = append(got, u)
+	}
+
+	w2, ok := got[0].(*NilWhen)
+	if !ok || !w2.When.Equal(when.When) || w2.Count != when.Count {
+		t.Errorf("NilWhen: %v in; %v out", when, got[0])
+	}
+	s2, ok := got[1].(*Sets)
+	if !ok || !sameSets(*sets, *s2) {
+		t.Errorf("Sets: %v in; %v out", sets, got[1])
+	}
+}
+
+func TestEnvelopeMissingField(t *testing.T) {
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	w.WriteMapHeader(1)
+	w.WriteString("t")
+	w.WriteString("NilWhen")
+	w.Flush()
+
+	_, _, _, err := msgp.ReadEnvelope(msgp.NewReader(&buf))
+	if err != msgp.ErrBadEnvelope {
+		t.Errorf("expected ErrBadEnvelope; got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestExtrasRoundTrip(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 6)
+	bts = msgp.AppendString(bts, "Name__str")
+	bts = msgp.AppendString(bts, "gopher")
+	bts = msgp.AppendString(bts, "flag")
+	bts = msgp.AppendBool(bts, true)
+	bts = msgp.AppendString(bts, "Count__int")
+	bts = msgp.AppendInt(bts, 3)
+	bts = msgp.AppendString(bts, "n")
+	bts = msgp.AppendInt64(bts, -7)
+	bts = msgp.AppendString(bts, "list")
+	bts, _ = msgp.AppendIntf(bts, []interface{}{"a", 1.5})
+	bts = msgp.AppendString(bts, "sub")
+	bts = msgp.AppendMapStrStr(bts, map[string]string{"k": "v"})
+
+	want := WithExtras{
+		Name:  "gopher",
+		Count: 3,
+		Rest: map[string]interface{}{
+			"flag": true,
+			"n":    int64(-7),
+			"list": []interface{}{"a", 1.5},
+			"sub":  map[string]interface{}{"k": "v"},
+		},
+	}
+
+	// stale extras must be dropped
+	out := WithExtras{Rest: map[string]interface{}{"stale": 1}}
+	_, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, want)
+	}
+	out = WithExtras{Rest: map[string]interface{}{"stale": 1}}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, want)
+	}
+
+	// the extras are merged back in when encoding
+	again, err := want.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) > want.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", want.Msgsize(), len(again))
+	}
+	out = WithExtras{}
+	_, err = out.UnmarshalMsg(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("after MarshalMsg: got %#v; want %#v", out, want)
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = WithExtras{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("after EncodeMsg: got %#v; want %#v", out, want)
+	}
+}
+
+func TestExtrasHeaderCount(t *testing.T) {
+	in := WithExtras{
+		Name:  "gopher",
+		Count: 3,
+		Rest: map[string]interface{}{
+			"color": "blue",
+			"ratio": 0.5,
+		},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the header counts the known fields plus each extra
+	for name, enc := range map[string][]byte{"MarshalMsg": bts, "EncodeMsg": buf.Bytes()} {
+		var nbs *msgp.NilBitsStack
+		sz, _, err := nbs.ReadMapHeaderBytes(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sz != 4 {
+			t.Errorf("%s: map header = %d; want 4", name, sz)
+		}
+		want := []string{"Count__int", "Name__str", "color", "ratio"}
+		if keys := wireKeys(t, enc); !reflect.DeepEqual(keys, want) {
+			t.Errorf("%s: wrote keys %v; want %v", name, keys, want)
+		}
+	}
+
+	out := WithExtras{}
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	// with no extras only the known fields are counted
+	in.Rest = nil
+	bts, err = in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nbs *msgp.NilBitsStack
+	sz, _, err := nbs.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != 2 {
+		t.Errorf("nil extras: map header = %d; want 2", sz)
+	}
+}
@@ -0,0 +1,62 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestExtensionTag(t *testing.T) {
+	id := ExtUUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for _, in := range []ExtTagged{
+		{ID: id, Name: "n"},
+		{ID: id, Maybe: &ExtUUID{0xff}},
+	} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// ID goes on the wire as extension 43
+		raw := msgp.RawExtension{Type: 43}
+		var nbs *msgp.NilBitsStack
+		_, err = nbs.ReadExtensionBytes(fieldValue(t, bts, "id__rct"), &raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw.Data, id[:]) {
+			t.Errorf("wrote % x", raw.Data)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("EncodeMsg and MarshalMsg disagree")
+		}
+
+		check := func(how string, out ExtTagged) {
+			if out.ID != in.ID || out.Name != in.Name || (out.Maybe == nil) != (in.Maybe == nil) ||
+				(out.Maybe != nil && *out.Maybe != *in.Maybe) {
+				t.Errorf("%s: got %+v; want %+v", how, out, in)
+			}
+		}
+		// decode over stale values
+		stale := func() ExtTagged { return ExtTagged{ID: ExtUUID{9}, Maybe: &ExtUUID{9}, Name: "stale"} }
+		out := stale()
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("UnmarshalMsg", out)
+		out = stale()
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("DecodeMsg", out)
+	}
+}
@@ -0,0 +1,11 @@
+package _generated
+
+//go:generate truepack -fast-strings -o faststrings_gen.go
+
+// Under -fast-strings, UnmarshalMsg points the
+// strings it reads into the buffer it was given.
+
+type FastStrings struct {
+	Name string
+	Tags []string
+}
@@ -0,0 +1,107 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// scribble overwrites the first copy of old
+// in bts, which must hold one
+func scribble(t testing.TB, bts []byte, old, new string) {
+	i := bytes.Index(bts, []byte(old))
+	if i < 0 {
+		t.Fatalf("%q not found in the encoding", old)
+	}
+	copy(bts[i:], new)
+}
+
+func TestFastStringsAlias(t *testing.T) {
+	in := FastStrings{Name: "gopher", Tags: []string{"blue"}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// under -fast-strings the strings are views of bts,
+	// so changing bts afterwards changes them too
+	var out FastStrings
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, bts, "gopher", "GOPHER")
+	scribble(t, bts, "blue", "BLUE")
+	if out.Name != "GOPHER" || out.Tags[0] != "BLUE" {
+		t.Errorf("-fast-strings: got %q, %q after changing the buffer; want them aliased", out.Name, out.Tags[0])
+	}
+
+	// DecodeMsg reads from a stream, and always copies
+	bts, _ = in.MarshalMsg(nil)
+	err = out.DecodeMsg(msgp.NewReader(bytes.NewReader(bts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, bts, "gopher", "GOPHER")
+	if out.Name != "gopher" {
+		t.Errorf("DecodeMsg: Name = %q after changing the buffer; want a copy", out.Name)
+	}
+}
+
+func TestUnsafeZeroCopyAlias(t *testing.T) {
+	in := NilScalars{Name: "gopher"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// by default the strings are copied out of bts
+	var out NilScalars
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, bts, "gopher", "GOPHER")
+	if out.Name != "gopher" {
+		t.Errorf("UnmarshalMsg: Name = %q after changing the buffer; want a copy", out.Name)
+	}
+
+	// UnsafeZeroCopy does for one call what -fast-strings
+	// does for all of them
+	bts, _ = in.MarshalMsg(nil)
+	_, err = out.UnmarshalMsgWithCfg(bts, &msgp.RuntimeConfig{UnsafeZeroCopy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, bts, "gopher", "GOPHER")
+	if out.Name != "GOPHER" {
+		t.Errorf("UnsafeZeroCopy: Name = %q after changing the buffer; want it aliased", out.Name)
+	}
+}
+
+func benchmarkUnmarshalStrings(b *testing.B, cfg *msgp.RuntimeConfig) {
+	in := NilScalars{Name: "a string long enough to be worth copying"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var out NilScalars
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = out.UnmarshalMsgWithCfg(bts, cfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStringsCopy(b *testing.B) {
+	benchmarkUnmarshalStrings(b, nil)
+}
+
+func BenchmarkUnmarshalStringsZeroCopy(b *testing.B) {
+	benchmarkUnmarshalStrings(b, &msgp.RuntimeConfig{UnsafeZeroCopy: true})
+}
@@ -0,0 +1,16 @@
+package _generated
+
+//go:generate truepack -field-docs -o fielddocs_gen.go
+
+// Under -field-docs, the doc comments of the
+// fields are repeated in EncodeMsg and MarshalMsg.
+
+type FieldDocs struct {
+	// Widgets counts the widgets
+	// made so far.
+	Widgets int
+
+	Label string // shown to the user
+
+	Plain bool
+}
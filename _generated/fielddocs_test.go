@@ -0,0 +1,38 @@
+package _generated
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFieldDocs(t *testing.T) {
+	src, err := ioutil.ReadFile("fielddocs_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, meth := range []string{"EncodeMsg", "MarshalMsg"} {
+		start := strings.Index(code, ") "+meth+"(")
+		if start < 0 {
+			t.Fatalf("no %s in fielddocs_gen.go", meth)
+		}
+		body := code[start:]
+		body = body[:strings.Index(body, "\n}\n")]
+
+		// each comment comes before the code that writes its field
+		for _, doc := range []string{
+			"// Widgets counts the widgets\n",
+			"// made so far.\n",
+			"// shown to the user\n",
+		} {
+			if !strings.Contains(body, doc) {
+				t.Errorf("%s lacks the comment %q", meth, doc)
+			}
+		}
+		widgets := strings.Index(body, "made so far")
+		if widgets < 0 || strings.Index(body[widgets:], "z.Widgets") < 0 {
+			t.Errorf("%s: the doc of Widgets isn't followed by the code writing it", meth)
+		}
+	}
+}
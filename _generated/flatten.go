@@ -0,0 +1,25 @@
+package _generated
+
+//go:generate truepack -flatten-embedded -o flatten_gen.go
+
+// Under -flatten-embedded, the fields of FlatBase
+// are written as fields of FlatOuter.
+
+type FlatBase struct {
+	ID    int64
+	Label string
+	Note  string
+}
+
+type FlatStamp struct {
+	Created string
+	Label   string
+}
+
+type FlatOuter struct {
+	FlatBase
+	*FlatStamp
+	FlatStampCopy FlatStamp
+	Note          string
+	Count         int
+}
@@ -0,0 +1,69 @@
+package _generated
+
+import (
+	"testing"
+)
+
+func TestFlattenEmbedded(t *testing.T) {
+	in := FlatOuter{
+		FlatBase:      FlatBase{ID: 7, Label: "base", Note: "hidden by outer"},
+		FlatStamp:     &FlatStamp{Created: "today"},
+		FlatStampCopy: FlatStamp{Created: "yesterday"},
+		Note:          "outer",
+		Count:         3,
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the promoted fields of FlatBase sit next to Note and
+	// Count; the outer Note wins over FlatBase.Note. Pointer
+	// and named embeddings stay nested.
+	want := []string{"Count__int", "FlatStampCopy__rct", "FlatStamp__ptr", "ID__i64", "Label__str", "Note__str"}
+	keys := wireKeys(t, bts)
+	if len(keys) != len(want) {
+		t.Fatalf("wrote keys %v; want %v", keys, want)
+	}
+	for i := range keys {
+		if keys[i] != want[i] {
+			t.Fatalf("wrote keys %v; want %v", keys, want)
+		}
+	}
+
+	var out FlatOuter
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 7 || out.FlatBase.Label != "base" || out.Note != "outer" || out.Count != 3 {
+		t.Errorf("got %+v", out)
+	}
+	if out.FlatBase.Note != "" {
+		t.Errorf("FlatBase.Note is shadowed by Note, but read back %q", out.FlatBase.Note)
+	}
+	if out.FlatStamp == nil || out.FlatStamp.Created != "today" || out.FlatStampCopy.Created != "yesterday" {
+		t.Errorf("nested fields: got %+v and %+v", out.FlatStamp, out.FlatStampCopy)
+	}
+}
+
+func TestFlattenEmbeddedNilPtr(t *testing.T) {
+	in := FlatOuter{FlatBase: FlatBase{ID: 7}, Note: "outer"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range wireKeys(t, bts) {
+		if key == "FlatStamp__ptr" {
+			t.Errorf("nil *FlatStamp was written")
+		}
+	}
+	out := FlatOuter{FlatStamp: &FlatStamp{Created: "stale"}}
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.FlatStamp != nil || out.ID != 7 {
+		t.Errorf("got %+v; want ID 7 and a nil FlatStamp", out)
+	}
+}
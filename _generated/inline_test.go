@@ -0,0 +1,88 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// fieldValue returns the bytes of the value
+// under key in the map at the front of bts.
+func fieldValue(t *testing.T, bts []byte, key string) []byte {
+	var nbs *msgp.NilBitsStack
+	sz, bts, err := nbs.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ; sz > 0; sz-- {
+		var k []byte
+		k, bts, err = nbs.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(k) == key {
+			return bts
+		}
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Fatalf("no key %q", key)
+	return nil
+}
+
+func TestAnonymousStructField(t *testing.T) {
+	for _, c := range []struct {
+		c    string
+		keys []string
+	}{
+		{"", []string{"A__int", "D__rct"}},
+		{"see", []string{"A__int", "D__rct", "c__str"}},
+	} {
+		in := InlineMeta{Name: "n"}
+		in.Meta.A = 1
+		in.Meta.B = "not written"
+		in.Meta.C = c.c
+		in.Meta.D.E = []string{"e"}
+
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := wireKeys(t, fieldValue(t, bts, "Meta__rct"))
+		if !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("Meta: wrote keys %v; want %v", keys, c.keys)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("EncodeMsg and MarshalMsg disagree")
+		}
+
+		want := in
+		want.Meta.B = ""
+		var out InlineMeta
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("UnmarshalMsg: got %+v; want %+v", out, want)
+		}
+		out = InlineMeta{}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("DecodeMsg: got %+v; want %+v", out, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestInlineMapMerged(t *testing.T) {
+	in := WithInline{
+		Name:   "gopher",
+		Scores: map[string]float64{"math": 9.5, "art": 7},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+
+	// the entries sit next to Name, not under a key of their own
+	keys := wireKeys(t, bts)
+	sort.Strings(keys)
+	want := []string{"Name__str", "art", "math"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("MarshalMsg: wrote keys %v; want %v", keys, want)
+	}
+	var nbs *msgp.NilBitsStack
+	f, _, err := nbs.ReadFloat64Bytes(fieldValue(t, bts, "math"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != 9.5 {
+		t.Errorf("math = %v; want 9.5", f)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = wireKeys(t, buf.Bytes())
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("EncodeMsg: wrote keys %v; want %v", keys, want)
+	}
+}
+
+func TestInlineMapCollects(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 3)
+	bts = msgp.AppendString(bts, "art")
+	bts = msgp.AppendFloat64(bts, 7)
+	bts = msgp.AppendString(bts, "Name__str")
+	bts = msgp.AppendString(bts, "gopher")
+	bts = msgp.AppendString(bts, "math")
+	bts = msgp.AppendFloat64(bts, 9.5)
+
+	want := WithInline{
+		Name:   "gopher",
+		Scores: map[string]float64{"math": 9.5, "art": 7},
+	}
+
+	// stale entries must be dropped
+	out := WithInline{Scores: map[string]float64{"stale": 1}}
+	_, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, want)
+	}
+	out = WithInline{Scores: map[string]float64{"stale": 1}}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, want)
+	}
+
+	// unknown keys must hold values of the map's type
+	bad := msgp.AppendMapHeader(nil, 1)
+	bad = msgp.AppendString(bad, "art")
+	bad = msgp.AppendString(bad, "seven")
+	_, err = out.UnmarshalMsg(bad)
+	if err == nil {
+		t.Error("UnmarshalMsg of a str into Scores: expected an error")
+	}
+}
+
+func TestInlineMapHiddenValue(t *testing.T) {
+	in := WithInlineHidden{
+		Name:   "path",
+		Points: map[string]point{"start": {X: 1, Y: 2}, "end": {X: -3}},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	want := []string{"Name__str", "end", "start"}
+	if keys := wireKeys(t, bts); !reflect.DeepEqual(keys, want) {
+		t.Errorf("MarshalMsg: wrote keys %v; want %v", keys, want)
+	}
+
+	var out WithInlineHidden
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = WithInlineHidden{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
+
+func TestInlineMapAnonValue(t *testing.T) {
+	var in WithInlineAnon
+	in.Name = "anon"
+	in.Extra = map[string]struct {
+		A int
+		B string
+	}{"x": {A: 1}, "y": {A: 2, B: "two"}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	want := []string{"Name__str", "x", "y"}
+	if keys := wireKeys(t, bts); !reflect.DeepEqual(keys, want) {
+		t.Errorf("MarshalMsg: wrote keys %v; want %v", keys, want)
+	}
+
+	var out WithInlineAnon
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = WithInlineAnon{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
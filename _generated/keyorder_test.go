@@ -0,0 +1,138 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// a KeyOrdered whose keys are in an order
+// that ranging over a map is unlikely to match
+func keyOrderedWire(keys []string) []byte {
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Attrs__map")
+	bts = msgp.AppendMapHeader(bts, uint32(len(keys)))
+	for i, k := range keys {
+		bts = msgp.AppendString(bts, k)
+		bts = msgp.AppendInt(bts, i)
+	}
+	return bts
+}
+
+func TestKeyOrderRoundTrip(t *testing.T) {
+	keys := []string{"z", "y", "x", "a", "m", "b", "q", "c", "p", "d"}
+	wire := keyOrderedWire(keys)
+
+	var ko KeyOrdered
+	_, err := ko.UnmarshalMsg(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ko.Order, keys) {
+		t.Fatalf("UnmarshalMsg recorded order %v; want %v", ko.Order, keys)
+	}
+	again, err := ko.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, wire) {
+		t.Errorf("MarshalMsg changed the key order:\n%x\n%x", again, wire)
+	}
+
+	ko = KeyOrdered{Order: []string{"stale"}}
+	err = msgp.Decode(bytes.NewReader(wire), &ko)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ko.Order, keys) {
+		t.Fatalf("DecodeMsg recorded order %v; want %v", ko.Order, keys)
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &ko)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), wire) {
+		t.Errorf("EncodeMsg changed the key order:\n%x\n%x", buf.Bytes(), wire)
+	}
+
+	// once the map no longer matches the
+	// order, it is written in any order
+	delete(ko.Attrs, "z")
+	ko.Attrs["new"] = 99
+	bts, err := ko.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out KeyOrdered
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Attrs, ko.Attrs) {
+		t.Errorf("got %v; want %v", out.Attrs, ko.Attrs)
+	}
+}
+
+func TestKeyOrderDuplicates(t *testing.T) {
+	// as long as the map, but "a" twice and no "b"
+	short := KeyOrdered{
+		Attrs: map[string]int{"a": 1, "b": 2},
+		Order: []string{"a", "a"},
+	}
+	// likewise, past the length that is
+	// checked pair by pair
+	long := KeyOrdered{Attrs: map[string]int{}}
+	for i := 0; i < 20; i++ {
+		k := string(rune('a' + i))
+		long.Attrs[k] = i
+		long.Order = append(long.Order, k)
+	}
+	long.Order[19] = "a"
+	for _, in := range []KeyOrdered{short, long} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, enc := range map[string][]byte{"MarshalMsg": bts, "EncodeMsg": buf.Bytes()} {
+			var out KeyOrdered
+			_, err = out.UnmarshalMsg(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out.Attrs, in.Attrs) {
+				t.Errorf("%s: got %v; want %v", name, out.Attrs, in.Attrs)
+			}
+		}
+	}
+}
+
+func TestKeyOrderNamed(t *testing.T) {
+	in := KeyOrderedNamed{
+		Other: map[string]KeyOrdered{
+			"b": {Attrs: map[string]int{"x": 1}},
+			"a": {Attrs: map[string]int{"y": 2}},
+			"c": {Attrs: map[string]int{"z": 3}},
+		},
+		Seq: []string{"c", "a", "b"},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out KeyOrderedNamed
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Seq, in.Seq) {
+		t.Errorf("got order %v; want %v", out.Seq, in.Seq)
+	}
+}
@@ -0,0 +1,53 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestLenientBin(t *testing.T) {
+	// Raw sent as a str, the way some encoders write byte slices
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Raw__bin")
+	bts = msgp.AppendString(bts, "abc")
+
+	var out NilScalars
+	_, err := out.UnmarshalMsg(bts)
+	if _, ok := err.(msgp.TypeError); !ok {
+		t.Errorf("UnmarshalMsg: got %v; want a TypeError", err)
+	}
+	err = out.DecodeMsg(msgp.NewReader(bytes.NewReader(bts)))
+	if _, ok := err.(msgp.TypeError); !ok {
+		t.Errorf("DecodeMsg: got %v; want a TypeError", err)
+	}
+
+	out = NilScalars{}
+	_, err = out.UnmarshalMsgWithCfg(bts, &msgp.RuntimeConfig{LenientBin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Raw) != "abc" {
+		t.Errorf("lenient UnmarshalMsg: Raw = %q; want \"abc\"", out.Raw)
+	}
+	out = NilScalars{}
+	dc := msgp.NewReader(bytes.NewReader(bts))
+	dc.SetLenientBin(true)
+	err = out.DecodeMsg(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Raw) != "abc" {
+		t.Errorf("lenient DecodeMsg: Raw = %q; want \"abc\"", out.Raw)
+	}
+
+	// and Raw still goes out as a bin
+	again, err := out.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := msgp.NextType(fieldValue(t, again, "Raw__bin")); typ != msgp.BinType {
+		t.Errorf("MarshalMsg wrote Raw as %s; want bin", typ)
+	}
+}
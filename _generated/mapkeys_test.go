@@ -0,0 +1,71 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestMapKeysRoundTrip(t *testing.T) {
+	in := MapKeys{
+		ByID:   map[int64]string{-1: "neg", 0: "zero", 1 << 40: "big"},
+		Flags:  map[uint32]bool{7: true, 1 << 31: false},
+		Bits:   map[bool]uint8{true: 1, false: 0},
+		Nested: map[string]map[string]int{"a": {"x": 1, "y": -2}, "b": {"z": 0}},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	var out MapKeys
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = MapKeys{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
+
+func TestMapKeysWrongKeyType(t *testing.T) {
+	// ByID with a str key where an int64 is declared
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "ByID__map")
+	bts = msgp.AppendMapHeader(bts, 1)
+	bts = msgp.AppendString(bts, "1")
+	bts = msgp.AppendString(bts, "one")
+
+	var out MapKeys
+	_, err := out.UnmarshalMsg(bts)
+	if te, ok := err.(msgp.TypeError); !ok {
+		t.Errorf("UnmarshalMsg: got %v; want a TypeError", err)
+	} else if te.Method != msgp.Int64Type || te.Encoded != msgp.StrType {
+		t.Errorf("UnmarshalMsg: got %v; want int64 for str", te)
+	}
+	out = MapKeys{}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if te, ok := err.(msgp.TypeError); !ok {
+		t.Errorf("DecodeMsg: got %v; want a TypeError", err)
+	} else if te.Method != msgp.Int64Type || te.Encoded != msgp.StrType {
+		t.Errorf("DecodeMsg: got %v; want int64 for str", te)
+	}
+}
@@ -0,0 +1,48 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestMapValuesRoundTrip(t *testing.T) {
+	in := MapValues{
+		Ints:    map[string]int{"a": 1, "b": -2},
+		Floats:  map[string]float64{"pi": 3.14159},
+		Bytes:   map[string][]byte{"x": []byte("hello"), "y": []byte{0}},
+		Ptrs:    map[string]*MapInner{"p": {A: 1, B: "one"}, "nil": nil},
+		Structs: map[string]MapInner{"s": {A: 2, B: "two"}},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	var out MapValues
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = MapValues{}
+	err = msgp.Decode(&buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+	}
+}
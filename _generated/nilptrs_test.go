@@ -0,0 +1,76 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestNilPtrs(t *testing.T) {
+	seven := 7
+	check := func(how string, set, unset *int) {
+		if set == nil || *set != 7 || unset != nil {
+			t.Errorf("%s: got Set=%v, Unset=%v", how, set, unset)
+		}
+	}
+
+	in := NilPtrs{Set: &seven}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out NilPtrs
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("UnmarshalMsg", out.Set, out.Unset)
+	out = NilPtrs{}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("DecodeMsg", out.Set, out.Unset)
+
+	tin := NilPtrsTuple{Set: &seven}
+	bts, err = tin.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &tin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg and MarshalMsg disagree")
+	}
+
+	// the nil pointer is a nil on the wire
+	var nbs *msgp.NilBitsStack
+	_, rest, err := nbs.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err = msgp.Skip(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msgp.IsNil(rest) || len(rest) != 1 {
+		t.Errorf("expected a lone nil for Unset; got % x", rest)
+	}
+
+	var tout NilPtrsTuple
+	_, err = tout.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("tuple UnmarshalMsg", tout.Set, tout.Unset)
+	tout = NilPtrsTuple{}
+	err = msgp.Decode(&buf, &tout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("tuple DecodeMsg", tout.Set, tout.Unset)
+}
@@ -0,0 +1,70 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestNilWhenZero(t *testing.T) {
+	now := time.Now().Round(0)
+	for _, in := range []NilWhenTuple{{}, {When: now, Count: 3}} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// check the wire format: a zero value is a nil
+		var nbs *msgp.NilBitsStack
+		_, rest, err := nbs.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgp.IsNil(rest) != in.When.IsZero() {
+			t.Errorf("for When=%v, expected nil on the wire to be %v", in.When, in.When.IsZero())
+		}
+
+		out := NilWhenTuple{When: time.Unix(1, 0), Count: 99}
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.When.Equal(in.When) || out.Count != in.Count {
+			t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("EncodeMsg and MarshalMsg disagree")
+		}
+		out = NilWhenTuple{When: time.Unix(1, 0), Count: 99}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.When.Equal(in.When) || out.Count != in.Count {
+			t.Errorf("DecodeMsg: %v in; %v out", in, out)
+		}
+	}
+
+	// the map form also reads a nil back as zero
+	var z NilWhen
+	nw := NilWhen{When: now, Count: 1}
+	bts, err := z.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nw.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nw.When.IsZero() || nw.Count != 0 {
+		t.Errorf("expected zero values; got %v", nw)
+	}
+}
@@ -0,0 +1,69 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// A nil on the wire leaves a field that isn't a pointer
+// at its zero value, as a missing key does, rather than
+// being a TypeError.
+func TestNilDecodesToZero(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 7)
+	for _, key := range []string{"Count__int", "Ratio__f64", "On__boo", "Raw__bin", "Tags__map", "Point__rct"} {
+		bts = msgp.AppendString(bts, key)
+		bts = msgp.AppendNil(bts)
+	}
+	// the nils must have been consumed to get here
+	bts = msgp.AppendString(bts, "Name__str")
+	bts = msgp.AppendString(bts, "after")
+
+	full := func() NilScalars {
+		return NilScalars{
+			Count: 7,
+			Ratio: 0.5,
+			On:    true,
+			Raw:   []byte("raw"),
+			Tags:  map[string]string{"k": "v"},
+			Point: ReusePoint{X: 1, Y: 2},
+			Name:  "before",
+		}
+	}
+	want := NilScalars{Name: "after"}
+
+	out := full()
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("UnmarshalMsg left %d bytes", len(left))
+	}
+	if !reflect.DeepEqual(zeroEmpty(out), want) {
+		t.Errorf("UnmarshalMsg: got %#v; want %#v", out, want)
+	}
+
+	out = full()
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(zeroEmpty(out), want) {
+		t.Errorf("DecodeMsg: got %#v; want %#v", out, want)
+	}
+}
+
+// zeroEmpty sets the empty slice and map
+// left for reuse in n to nil, for DeepEqual.
+func zeroEmpty(n NilScalars) NilScalars {
+	if len(n.Raw) == 0 {
+		n.Raw = nil
+	}
+	if len(n.Tags) == 0 {
+		n.Tags = nil
+	}
+	return n
+}
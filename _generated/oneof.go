@@ -0,0 +1,20 @@
+package _generated
+
+//go:generate truepack -o oneof_gen.go -tests=false
+
+// test msg:",oneof=group". These live apart from
+// def.go because the generated tests round-trip
+// the zero value, which a oneof group rejects.
+
+type OneOfRequest struct {
+	ID     string
+	ByName *string           `msg:",oneof=key"`
+	ByTags []string          `msg:",oneof=key"`
+	ByMeta map[string]string `msg:",oneof=key"`
+	ByBlob []byte            `msg:",oneof=key"`
+}
+
+type OneOfOuter struct {
+	Req   OneOfRequest
+	Other *OneOfRequest
+}
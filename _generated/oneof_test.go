@@ -0,0 +1,151 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestOneOf(t *testing.T) {
+	name := "gopher"
+	cases := []struct {
+		in  OneOfRequest
+		set int // members of the group that are set
+	}{
+		{OneOfRequest{ID: "none"}, 0},
+		{OneOfRequest{ID: "name", ByName: &name}, 1},
+		{OneOfRequest{ID: "tags", ByTags: []string{"a", "b"}}, 1},
+		{OneOfRequest{ID: "meta", ByMeta: map[string]string{"k": "v"}}, 1},
+		{OneOfRequest{ID: "no tags", ByTags: []string{}}, 1},
+		{OneOfRequest{ID: "no meta", ByMeta: map[string]string{}}, 1},
+		{OneOfRequest{ID: "blob", ByBlob: []byte("x")}, 1},
+		{OneOfRequest{ID: "no blob", ByBlob: []byte{}}, 1},
+		{OneOfRequest{ID: "two", ByName: &name, ByTags: []string{"a"}}, 2},
+	}
+	for _, c := range cases {
+		bts, err := c.in.MarshalMsg(nil)
+		var buf bytes.Buffer
+		err2 := msgp.Encode(&buf, &c.in)
+		if c.set != 1 {
+			want := msgp.OneOfError{Group: "key", Set: c.set}
+			if err != want {
+				t.Errorf("%s: MarshalMsg: got error %v; want %v", c.in.ID, err, want)
+			}
+			if err2 != want {
+				t.Errorf("%s: EncodeMsg: got error %v; want %v", c.in.ID, err2, want)
+			}
+			continue
+		}
+		if err != nil || err2 != nil {
+			t.Fatalf("%s: %v, %v", c.in.ID, err, err2)
+		}
+
+		// members that weren't sent must come
+		// back nil, even in a re-used struct
+		stale := "stale"
+		out := OneOfRequest{ByName: &stale, ByTags: []string{"stale"}}
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, c.in) {
+			t.Errorf("UnmarshalMsg: got %#v; want %#v", out, c.in)
+		}
+		stale = "stale"
+		out = OneOfRequest{ByName: &stale, ByTags: []string{"stale"}}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, c.in) {
+			t.Errorf("DecodeMsg: got %#v; want %#v", out, c.in)
+		}
+	}
+}
+
+func TestOneOfEmptyMember(t *testing.T) {
+	// an empty slice, map or []byte is still the
+	// set member, and comes back empty, not nil
+	for _, in := range []OneOfRequest{
+		{ID: "no tags", ByTags: []string{}},
+		{ID: "no meta", ByMeta: map[string]string{}},
+		{ID: "no blob", ByBlob: []byte{}},
+	} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out OneOfRequest
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatalf("%s: UnmarshalMsg: %v", in.ID, err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("UnmarshalMsg: got %#v; want %#v", out, in)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = OneOfRequest{}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatalf("%s: DecodeMsg: %v", in.ID, err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("DecodeMsg: got %#v; want %#v", out, in)
+		}
+	}
+}
+
+func TestOneOfDecodeChecks(t *testing.T) {
+	// messages with none or two of the group
+	// set, as a type without the check sends them
+	none := msgp.AppendMapHeader(nil, 1)
+	none = msgp.AppendString(none, "ID__str")
+	none = msgp.AppendString(none, "x")
+
+	two := msgp.AppendMapHeader(nil, 2)
+	two = msgp.AppendString(two, "ByName__ptr")
+	two = msgp.AppendString(two, "x")
+	two = msgp.AppendString(two, "ByTags__slc")
+	two = msgp.AppendArrayHeader(two, 1)
+	two = msgp.AppendString(two, "a")
+
+	for _, c := range []struct {
+		bts []byte
+		set int
+	}{{none, 0}, {two, 2}} {
+		want := msgp.OneOfError{Group: "key", Set: c.set}
+		var out OneOfRequest
+		_, err := out.UnmarshalMsg(c.bts)
+		if err != want {
+			t.Errorf("UnmarshalMsg: got error %v; want %v", err, want)
+		}
+		err = msgp.Decode(bytes.NewReader(c.bts), &out)
+		if err != want {
+			t.Errorf("DecodeMsg: got error %v; want %v", err, want)
+		}
+	}
+
+	// a nested struct that isn't there at
+	// all is not held to the check
+	name := "gopher"
+	in := OneOfOuter{Req: OneOfRequest{ByName: &name}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out OneOfOuter
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %#v; want %#v", out, in)
+	}
+}
@@ -0,0 +1,53 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestNarrowIntOverflow(t *testing.T) {
+	bts, err := (&NarrowInts{I8: 1, U8: 1, I16: 1}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := wireKeys(t, bts) // I16, I8, U8
+
+	for _, c := range []struct {
+		key  string
+		val  []byte
+		want error
+	}{
+		{keys[1], msgp.AppendInt(nil, 300), msgp.IntOverflow{Value: 300, FailedBitsize: 8}},
+		{keys[1], msgp.AppendInt(nil, -129), msgp.IntOverflow{Value: -129, FailedBitsize: 8}},
+		{keys[2], msgp.AppendUint(nil, 256), msgp.UintOverflow{Value: 256, FailedBitsize: 8}},
+		{keys[0], msgp.AppendInt(nil, 1<<15), msgp.IntOverflow{Value: 1 << 15, FailedBitsize: 16}},
+	} {
+		msg := msgp.AppendMapHeader(nil, 1)
+		msg = msgp.AppendString(msg, c.key)
+		msg = append(msg, c.val...)
+
+		var out NarrowInts
+		_, err = out.UnmarshalMsg(msg)
+		if err != c.want {
+			t.Errorf("UnmarshalMsg of %s: got error %v; want %v", c.key, err, c.want)
+		}
+		err = msgp.Decode(bytes.NewReader(msg), &out)
+		if err != c.want {
+			t.Errorf("DecodeMsg of %s: got error %v; want %v", c.key, err, c.want)
+		}
+	}
+
+	// values at the limits fit
+	in := NarrowInts{I8: -128, U8: 255, I16: -1 << 15}
+	bts, err = in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out NarrowInts
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil || out != in {
+		t.Errorf("UnmarshalMsg: got %+v, %v; want %+v", out, err, in)
+	}
+}
@@ -0,0 +1,103 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchRoundTrip(t *testing.T) {
+	f := 3.5
+	now := time.Now().Round(0)
+	a := Patchable{
+		Name:  "a",
+		Count: 1,
+		Tags:  []string{"x", "y"},
+		Attrs: map[string]string{"k": "v"},
+		When:  now,
+		Inner: Moose{Trees: []int{1}, Id: 1},
+	}
+	b := a
+	b.Count = 2
+	b.Tags = []string{"x", "z"}
+	b.Ptr = &f
+	b.Inner = Moose{Trees: []int{1, 2}, Sayings: map[string]string{"hi": "there"}, Id: 2}
+
+	patch, err := a.Diff(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := b.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) >= len(full) {
+		t.Errorf("expected the patch (%d bytes) to be smaller than the object (%d bytes)", len(patch), len(full))
+	}
+
+	err = a.ApplyPatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("after ApplyPatch: expected %#v; got %#v", b, a)
+	}
+
+	// no differences means an empty patch
+	patch, err = a.Diff(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) != 1 {
+		t.Errorf("expected an empty map; got %d bytes", len(patch))
+	}
+}
+
+func TestPatchNilAndEmpty(t *testing.T) {
+	// nil and empty collections look the same
+	// on the wire, so neither Diff nor a round
+	// trip through ApplyPatch may tell them apart
+	nils := Patchable{Name: "n"}
+	empties := Patchable{
+		Name:  "n",
+		Tags:  []string{},
+		Attrs: map[string]string{},
+		Inner: Moose{Trees: []int{}, Sayings: map[string]string{}},
+		Blob:  []byte{},
+	}
+	full := Patchable{
+		Name:  "f",
+		Tags:  []string{"x"},
+		Attrs: map[string]string{"k": "v"},
+		Inner: Moose{Trees: []int{1}},
+		Blob:  []byte("b"),
+	}
+	for _, c := range []struct {
+		name string
+		a, b Patchable
+	}{
+		{"nil to empty", nils, empties},
+		{"empty to nil", empties, nils},
+		{"nil to full", nils, full},
+		{"empty to full", empties, full},
+		{"full to nil", full, nils},
+		{"full to empty", full, empties},
+	} {
+		a := c.a
+		patch, err := a.Diff(&c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = a.ApplyPatch(patch)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		patch, err = a.Diff(&c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(patch) != 1 {
+			t.Errorf("%s: expected an empty patch after ApplyPatch; got %d bytes", c.name, len(patch))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package _generated
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestLyingHeaderDoesNotPreallocate(t *testing.T) {
+	// an Object tuple whose Slice1, or whose
+	// MapMap, claims as many elements as the
+	// limits allow, and has none of them
+	lyingSlice := msgp.AppendArrayHeader(nil, 4)
+	lyingSlice = msgp.AppendString(lyingSlice, "x")
+	lyingSlice = msgp.AppendArrayHeader(lyingSlice, msgp.DefaultMaxArraySize)
+
+	lyingMap := msgp.AppendArrayHeader(nil, 4)
+	lyingMap = msgp.AppendString(lyingMap, "x")
+	lyingMap = msgp.AppendArrayHeader(lyingMap, 0)
+	lyingMap = msgp.AppendArrayHeader(lyingMap, 0)
+	lyingMap = msgp.AppendMapHeader(lyingMap, msgp.DefaultMaxMapSize)
+
+	allocated := func(f func() error) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := f(); err == nil {
+			t.Error("expected an error for a header with no elements after it")
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	for _, msg := range [][]byte{lyingSlice, lyingMap} {
+		n := allocated(func() error {
+			var out Object
+			_, err := out.UnmarshalMsg(msg)
+			return err
+		})
+		if n > 1<<20 {
+			t.Errorf("UnmarshalMsg allocated %d bytes for % x", n, msg)
+		}
+		n = allocated(func() error {
+			var out Object
+			return msgp.Decode(bytes.NewReader(msg), &out)
+		})
+		if n > 1<<20 {
+			t.Errorf("DecodeMsg allocated %d bytes for % x", n, msg)
+		}
+	}
+
+	// and a slice longer than what's made
+	// up front still reads back whole
+	in := Object{ObjectNo: "x", Slice1: make([]string, 3*msgp.MaxPrealloc+1)}
+	for i := range in.Slice1 {
+		in.Slice1[i] = "s"
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Object
+	if _, err = out.UnmarshalMsg(bts); err != nil || len(out.Slice1) != len(in.Slice1) || out.Slice1[len(in.Slice1)-1] != "s" {
+		t.Errorf("UnmarshalMsg: got %d elements, %v; want %d", len(out.Slice1), err, len(in.Slice1))
+	}
+	out = Object{}
+	if err = msgp.Decode(bytes.NewReader(bts), &out); err != nil || len(out.Slice1) != len(in.Slice1) || out.Slice1[len(in.Slice1)-1] != "s" {
+		t.Errorf("DecodeMsg: got %d elements, %v; want %d", len(out.Slice1), err, len(in.Slice1))
+	}
+}
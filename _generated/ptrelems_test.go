@@ -0,0 +1,72 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestPtrElemsKeepNils(t *testing.T) {
+	seven := 7
+	in := PtrElems{
+		Elems:    []*PtrElem{{Name: "a", N: 1}, nil, {Name: "c", N: 3}},
+		Fixed:    [3]*PtrElem{nil, {Name: "b", N: 2}, nil},
+		Ints:     []*int{nil, &seven},
+		SlicePtr: &[]PtrElem{{Name: "d"}, {N: 4}},
+	}
+	check := func(how string, out *PtrElems) {
+		if len(out.Elems) != 3 || out.Elems[1] != nil ||
+			out.Elems[0] == nil || *out.Elems[0] != *in.Elems[0] ||
+			out.Elems[2] == nil || *out.Elems[2] != *in.Elems[2] {
+			t.Errorf("%s: Elems = %v", how, out.Elems)
+		}
+		if out.Fixed[0] != nil || out.Fixed[2] != nil || out.Fixed[1] == nil || *out.Fixed[1] != *in.Fixed[1] {
+			t.Errorf("%s: Fixed = %v", how, out.Fixed)
+		}
+		if len(out.Ints) != 2 || out.Ints[0] != nil || out.Ints[1] == nil || *out.Ints[1] != 7 {
+			t.Errorf("%s: Ints = %v", how, out.Ints)
+		}
+		if out.SlicePtr == nil || len(*out.SlicePtr) != 2 || (*out.SlicePtr)[0] != (*in.SlicePtr)[0] || (*out.SlicePtr)[1] != (*in.SlicePtr)[1] {
+			t.Errorf("%s: SlicePtr = %v", how, out.SlicePtr)
+		}
+	}
+	// a value to decode into, whose elements are
+	// all set, so that the nils must overwrite them
+	reused := func() *PtrElems {
+		one := 1
+		return &PtrElems{
+			Elems: []*PtrElem{{Name: "x"}, {Name: "y"}, {Name: "z"}},
+			Fixed: [3]*PtrElem{{Name: "x"}, {Name: "y"}, {Name: "z"}},
+			Ints:  []*int{&one, &one},
+		}
+	}
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []*PtrElems{{}, reused()} {
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("UnmarshalMsg", out)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg and MarshalMsg disagree")
+	}
+	for _, out := range []*PtrElems{{}, reused()} {
+		err = msgp.Decode(bytes.NewReader(bts), out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("DecodeMsg", out)
+	}
+}
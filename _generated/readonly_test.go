@@ -0,0 +1,100 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestReadOnlyFieldsAreEncoded(t *testing.T) {
+	in := ReadOnly{ID: 7, Tags: []string{"a", "b"}, Name: "sent"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := wireKeys(t, bts)
+	want := []string{"Name__str", "Tags__slc", "id__i64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v; want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Error("EncodeMsg and MarshalMsg disagree")
+	}
+}
+
+func TestReadOnlyFieldsKeepTheirValue(t *testing.T) {
+	in := ReadOnly{ID: 7, Tags: []string{"a", "b"}, Name: "sent"}
+	full, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the readonly keys missing, and then nil
+	missing := msgp.AppendMapHeader(nil, 1)
+	missing = msgp.AppendString(missing, "Name__str")
+	missing = msgp.AppendString(missing, "sent")
+
+	nils := msgp.AppendMapHeader(nil, 3)
+	nils = msgp.AppendString(nils, "id__i64")
+	nils = msgp.AppendNil(nils)
+	nils = msgp.AppendString(nils, "Tags__slc")
+	nils = msgp.AppendNil(nils)
+	nils = msgp.AppendString(nils, "Name__str")
+	nils = msgp.AppendString(nils, "sent")
+
+	want := ReadOnly{ID: 99, Tags: []string{"keep"}, Name: "sent"}
+	for name, bts := range map[string][]byte{"full": full, "missing": missing, "nil": nils} {
+		out := ReadOnly{ID: 99, Tags: []string{"keep"}}
+		left, err := out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatalf("%s: UnmarshalMsg: %s", name, err)
+		}
+		if len(left) != 0 {
+			t.Errorf("%s: UnmarshalMsg left %d bytes", name, len(left))
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("%s: UnmarshalMsg got %+v; want %+v", name, out, want)
+		}
+
+		out = ReadOnly{ID: 99, Tags: []string{"keep"}}
+		if err := msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+			t.Fatalf("%s: DecodeMsg: %s", name, err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("%s: DecodeMsg got %+v; want %+v", name, out, want)
+		}
+	}
+}
+
+func TestReadOnlyTuple(t *testing.T) {
+	in := ReadOnlyTuple{ID: 7, Name: "sent"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReadOnlyTuple{ID: 99, Name: "sent"}
+
+	out := ReadOnlyTuple{ID: 99}
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 || out != want {
+		t.Errorf("UnmarshalMsg got %+v with %d bytes left; want %+v", out, len(left), want)
+	}
+
+	out = ReadOnlyTuple{ID: 99}
+	if err := msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("DecodeMsg got %+v; want %+v", out, want)
+	}
+}
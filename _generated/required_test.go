@@ -0,0 +1,146 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestRequiredPresent(t *testing.T) {
+	// a required field is written even when it is empty
+	in := Required{Note: "hi"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Required
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+	}
+	out = Required{}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("DecodeMsg: %v in; %v out", in, out)
+	}
+}
+
+func TestRequiredMissing(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Note__str")
+	bts = msgp.AppendString(bts, "no ID here")
+	want := msgp.ErrMissingField{Keys: []string{"ID__str"}}
+
+	var out Required
+	_, err := out.UnmarshalMsg(bts)
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("UnmarshalMsg: expected %v; got %v", want, err)
+	}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("DecodeMsg: expected %v; got %v", want, err)
+	}
+}
+
+func TestRequiredMissingResumes(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Note__str")
+	bts = msgp.AppendString(bts, "no ID here")
+	bts = msgp.AppendString(bts, "next")
+
+	// the error is resumable, so the Reader must
+	// be left ready to read what follows
+	rd := msgp.NewReader(bytes.NewReader(bts))
+	var out Required
+	err := out.DecodeMsg(rd)
+	if !reflect.DeepEqual(err, msgp.ErrMissingField{Keys: []string{"ID__str"}}) {
+		t.Fatalf("DecodeMsg: got %v", err)
+	}
+	if !err.(msgp.Error).Resumable() {
+		t.Errorf("%v is not resumable", err)
+	}
+	s, err := rd.ReadString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "next" {
+		t.Errorf("read %q after the error; want \"next\"", s)
+	}
+}
+
+func TestRequiredMissingAll(t *testing.T) {
+	bts := msgp.AppendMapHeader(nil, 1)
+	bts = msgp.AppendString(bts, "Note__str")
+	bts = msgp.AppendString(bts, "neither here")
+	want := msgp.ErrMissingField{Keys: []string{"Name__str", "Count__int"}}
+
+	var out RequiredPair
+	_, err := out.UnmarshalMsg(bts)
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("UnmarshalMsg: expected %v; got %v", want, err)
+	}
+	err = msgp.Decode(bytes.NewReader(bts), &out)
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("DecodeMsg: expected %v; got %v", want, err)
+	}
+}
+
+func TestRequiredNilThenValid(t *testing.T) {
+	// a nil on the wire lacks every field, required
+	// ones included; the next message must still
+	// decode from real bytes, not as more nils
+	in := Required{ID: "id", Note: "second"}
+	bts := msgp.AppendNil(nil)
+	bts, err := in.MarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := msgp.NewReader(bytes.NewReader(bts))
+	var out Required
+	err = out.DecodeMsg(rd)
+	if !reflect.DeepEqual(err, msgp.ErrMissingField{Keys: []string{"ID__str"}}) {
+		t.Fatalf("DecodeMsg of nil: got %v", err)
+	}
+	out = Required{}
+	if err = out.DecodeMsg(rd); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("second DecodeMsg: %v in; %v out", in, out)
+	}
+}
+
+func TestRequiredNestedNilThenValid(t *testing.T) {
+	// the required field is a level down; the
+	// nils pushed for the outer struct must be
+	// dropped too when the inner one fails
+	in := RequiredOuter{In: Required{ID: "id"}, Note: "second"}
+	bts := msgp.AppendNil(nil)
+	bts, err := in.MarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := msgp.NewReader(bytes.NewReader(bts))
+	var out RequiredOuter
+	err = out.DecodeMsg(rd)
+	if !reflect.DeepEqual(err, msgp.ErrMissingField{Keys: []string{"ID__str"}}) {
+		t.Fatalf("DecodeMsg of nil: got %v", err)
+	}
+	out = RequiredOuter{}
+	if err = out.DecodeMsg(rd); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("second DecodeMsg: %v in; %v out", in, out)
+	}
+}
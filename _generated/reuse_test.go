@@ -0,0 +1,108 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestReuseSlicesShorter(t *testing.T) {
+	long := ReuseSlices{
+		Ints:   []int64{1, 2, 3, 4},
+		Points: []ReusePoint{{1, 1}, {2, 2}, {3, 3}},
+		Raw:    []byte("long raw bytes"),
+	}
+	short := ReuseSlices{
+		Ints:   []int64{9},
+		Points: []ReusePoint{{X: 5}},
+		Raw:    []byte("s"),
+	}
+	lb, err := long.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := short.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out ReuseSlices
+	_, err = out.UnmarshalMsg(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ints, points := &out.Ints[0], &out.Points[0]
+	_, err = out.UnmarshalMsg(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, short) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, short)
+	}
+	if &out.Ints[0] != ints || &out.Points[0] != points {
+		t.Error("UnmarshalMsg: expected the slices to be re-used")
+	}
+
+	out = ReuseSlices{}
+	err = msgp.Decode(bytes.NewReader(lb), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ints, points = &out.Ints[0], &out.Points[0]
+	err = msgp.Decode(bytes.NewReader(sb), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, short) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, short)
+	}
+	if &out.Ints[0] != ints || &out.Points[0] != points {
+		t.Error("DecodeMsg: expected the slices to be re-used")
+	}
+}
+
+func reuseSlicesMsg(b *testing.B) []byte {
+	v := ReuseSlices{
+		Ints:   []int64{1, 2, 3, 4, 5, 6, 7, 8},
+		Points: []ReusePoint{{1, 2}, {3, 4}, {5, 6}},
+		Raw:    []byte("some raw bytes"),
+	}
+	bts, err := v.MarshalMsg(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return bts
+}
+
+// repeated decodes into the same value
+// re-use its slices, and don't allocate
+func BenchmarkReuseSlicesUnmarshal(b *testing.B) {
+	bts := reuseSlicesMsg(b)
+	var v ReuseSlices
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := v.UnmarshalMsg(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReuseSlicesDecode(b *testing.B) {
+	bts := reuseSlicesMsg(b)
+	var v ReuseSlices
+	dc := msgp.NewReader(msgp.NewEndlessReader(bts, b))
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := v.DecodeMsg(dc)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func sameSets(a Sets, b Sets) bool {
+	if len(a.Names) != len(b.Names) || len(a.IDs) != len(b.IDs) ||
+		len(a.Flags) != len(b.Flags) || len(a.Small) != len(b.Small) {
+		return false
+	}
+	for k := range a.Names {
+		if _, ok := b.Names[k]; !ok {
+			return false
+		}
+	}
+	for k := range a.IDs {
+		if _, ok := b.IDs[k]; !ok {
+			return false
+		}
+	}
+	for k := range a.Flags {
+		if _, ok := b.Flags[k]; !ok {
+			return false
+		}
+	}
+	for k := range a.Small {
+		if _, ok := b.Small[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSetsRoundTrip(t *testing.T) {
+	ins := []Sets{
+		{},
+		{Names: map[string]struct{}{}, IDs: map[int]struct{}{}},
+		{
+			Names: map[string]struct{}{"a": {}, "bb": {}, "ccc": {}},
+			IDs:   map[int]struct{}{-1: {}, 0: {}, 1 << 40: {}},
+			Flags: map[bool]struct{}{true: {}, false: {}},
+			Small: map[uint16]struct{}{0: {}, 1 << 15: {}},
+		},
+	}
+	for _, in := range ins {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bts) > in.Msgsize() {
+			t.Errorf("Msgsize() = %d; encoded %d bytes", in.Msgsize(), len(bts))
+		}
+
+		// stale entries must not survive decoding
+		out := Sets{Names: map[string]struct{}{"stale": {}}, IDs: map[int]struct{}{7: {}}}
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameSets(in, out) {
+			t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = Sets{Names: map[string]struct{}{"stale": {}}, IDs: map[int]struct{}{7: {}}}
+		err = msgp.Decode(&buf, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameSets(in, out) {
+			t.Errorf("DecodeMsg: %v in; %v out", in, out)
+		}
+	}
+}
+
+func TestSetsWireFormat(t *testing.T) {
+	in := Sets{Names: map[string]struct{}{"x": {}}, IDs: map[int]struct{}{3: {}, 4: {}}}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nbs *msgp.NilBitsStack
+	sz, bts, err := nbs.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ; sz > 0; sz-- {
+		_, bts, err = nbs.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := msgp.NextType(bts); typ != msgp.ArrayType {
+			t.Fatalf("expected a set to be written as an array, not %s", typ)
+		}
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package _generated
+
+//go:generate truepack -sort-map-keys -o sortkeys_gen.go
+
+// Under -sort-map-keys, maps with string keys
+// are written in order of their keys.
+
+type SortedMaps struct {
+	Tags   map[string]string
+	Nested map[string]map[string]int
+	Rest   map[string]interface{} `msg:",extras"`
+}
@@ -0,0 +1,80 @@
+package _generated
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+// keysInOrder returns the keys of the map at the
+// front of bts in the order they were written.
+func keysInOrder(t *testing.T, bts []byte) []string {
+	var nbs *msgp.NilBitsStack
+	sz, bts, err := nbs.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for ; sz > 0; sz-- {
+		var key []byte
+		key, bts, err = nbs.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(key))
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestSortMapKeys(t *testing.T) {
+	in := SortedMaps{
+		Tags:   make(map[string]string),
+		Nested: map[string]map[string]int{"b": {}, "a": {}},
+		Rest:   make(map[string]interface{}),
+	}
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("k%02d", 19-i)
+		in.Tags[k] = k
+		in.Nested["a"][k] = i
+		in.Rest[k] = i
+	}
+
+	first, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, first) {
+			t.Fatal("MarshalMsg wrote the same value two ways")
+		}
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatal("EncodeMsg and MarshalMsg disagree")
+		}
+	}
+
+	for _, keys := range [][]string{
+		keysInOrder(t, fieldValue(t, first, "Tags__map")),
+		keysInOrder(t, fieldValue(t, fieldValue(t, first, "Nested__map"), "a")),
+		keysInOrder(t, first)[2:],
+	} {
+		if len(keys) != 20 || !sort.StringsAreSorted(keys) {
+			t.Errorf("keys written as %v; want the 20 keys in order", keys)
+		}
+	}
+}
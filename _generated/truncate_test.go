@@ -0,0 +1,49 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in   Truncated
+		want Truncated
+	}{
+		// under the limit: unchanged
+		{Truncated{Short: "abc", Both: "ab", Named: "xy"}, Truncated{Short: "abc", Both: "ab", Named: "xy"}},
+		// over the limit: cut at the limit
+		{Truncated{Short: "abcdefghijk", Both: "abcdef", Named: "uvwxyz"}, Truncated{Short: "abcdefgh", Both: "abcd", Named: "uvwxy"}},
+		// "é" is two bytes and "日" is three, so the
+		// last rune that would be split is dropped
+		{Truncated{Short: "abcdefgé", Both: "a日b", Named: "abcd日"}, Truncated{Short: "abcdefg", Both: "a日", Named: "abcd"}},
+	}
+	for _, c := range cases {
+		bts, err := c.in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bts) > c.in.Msgsize() {
+			t.Errorf("Msgsize() = %d; encoded %d bytes", c.in.Msgsize(), len(bts))
+		}
+		var out Truncated
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != c.want {
+			t.Errorf("UnmarshalMsg: got %#v; want %#v", out, c.want)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("EncodeMsg and MarshalMsg disagree: %x vs %x", buf.Bytes(), bts)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func TestTypeErrorOffset(t *testing.T) {
+	// {"Note__str": "x", "Count__int": "oops"}
+	var bts []byte
+	bts = msgp.AppendMapHeader(bts, 2)
+	bts = msgp.AppendString(bts, "Note__str")
+	bts = msgp.AppendString(bts, "x")
+	bts = msgp.AppendString(bts, "Count__int")
+	want := len(bts)
+	bts = msgp.AppendString(bts, "oops")
+
+	var out FlatOuter
+	_, err := out.UnmarshalMsg(bts)
+	if te, ok := err.(msgp.TypeError); !ok || te.Offset != want {
+		t.Errorf("UnmarshalMsg: got %v; want a TypeError at offset %d", err, want)
+	}
+	err = out.DecodeMsg(msgp.NewReader(bytes.NewReader(bts)))
+	if te, ok := err.(msgp.TypeError); !ok || te.Offset != want {
+		t.Errorf("DecodeMsg: got %v; want a TypeError at offset %d", err, want)
+	}
+
+	// the offset is from the start of the
+	// buffer passed to UnmarshalMsg
+	pre := msgp.AppendString(nil, "before")
+	_, err = out.UnmarshalMsg(append(pre, bts...)[len(pre):])
+	if te, ok := err.(msgp.TypeError); !ok || te.Offset != want {
+		t.Errorf("UnmarshalMsg of a sub-slice: got %v; want a TypeError at offset %d", err, want)
+	}
+}
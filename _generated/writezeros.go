@@ -0,0 +1,12 @@
+package _generated
+
+//go:generate truepack -write-zeros -o writezeros_gen.go
+
+// Under -write-zeros, only fields tagged
+// omitempty are left out when they are zero.
+
+type WriteZeros struct {
+	Name  string `msg:"name,omitempty"`
+	Alt   string `msg:",omitempty"`
+	Plain string `msg:"plain"`
+}
@@ -0,0 +1,65 @@
+package _generated
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/glycerine/truepack/msgp"
+)
+
+func wireKeys(t *testing.T, bts []byte) []string {
+	var nbs *msgp.NilBitsStack
+	sz, bts, err := nbs.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for ; sz > 0; sz-- {
+		var key []byte
+		key, bts, err = nbs.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(key))
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestWriteZerosHonorsOmitEmpty(t *testing.T) {
+	for _, c := range []struct {
+		in   WriteZeros
+		keys []string
+	}{
+		{WriteZeros{}, []string{"plain__str"}},
+		{WriteZeros{Name: "n"}, []string{"name__str", "plain__str"}},
+		{WriteZeros{Name: "n", Alt: "a", Plain: "p"}, []string{"Alt__str", "name__str", "plain__str"}},
+	} {
+		bts, err := c.in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := wireKeys(t, bts)
+		if len(keys) != len(c.keys) {
+			t.Fatalf("%#v: wrote keys %v; want %v", c.in, keys, c.keys)
+		}
+		for i := range keys {
+			if keys[i] != c.keys[i] {
+				t.Errorf("%#v: wrote keys %v; want %v", c.in, keys, c.keys)
+				break
+			}
+		}
+		var out WriteZeros
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != c.in {
+			t.Errorf("got %#v; want %#v", out, c.in)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cfg
 
 import (
 	"flag"
+	"strings"
 )
 
 type GreenConfig struct {
@@ -23,6 +24,57 @@ type GreenConfig struct {
 
 	ShowVersion bool
 	TrueInt     bool
+
+	TagName string // struct tag key to read; "msg" if empty
+
+	FlattenEmbedded bool
+	JSONTagFallback bool // read the name from a json tag if there is no msg tag
+
+	// SortFields orders each struct's fields by
+	// their tag rather than by declaration, so the
+	// output stays the same when fields are moved.
+	// Structs with zid tags keep their zid order.
+	SortFields bool
+
+	// SortMapKeys makes the generated EncodeMsg and
+	// MarshalMsg write maps with string keys in byte
+	// order of their keys, so the same value always
+	// encodes to the same bytes.
+	SortMapKeys bool
+
+	// Strict makes a struct field that would be
+	// left out because its type isn't supported
+	// an error, instead of a warning.
+	Strict bool
+
+	// FieldDocs makes the generated EncodeMsg and
+	// MarshalMsg repeat each field's doc comment
+	// above the code that writes the field.
+	FieldDocs bool
+
+	// Logger, if set, receives the parser's progress
+	// notes and warnings instead of stdout.
+	Logger Logger
+}
+
+// Diagnostic is one progress note or warning
+// from the parser.
+type Diagnostic struct {
+	Level   string   // "info", "warn" or "fatal"
+	Context []string // the file, type and field being parsed, outermost first
+	Msg     string
+}
+
+// String formats d the way the parser
+// prints it when no Logger is set.
+func (d Diagnostic) String() string {
+	return strings.Join(append(d.Context[:len(d.Context):len(d.Context)], d.Msg), ": ")
+}
+
+// Logger receives Diagnostics from the parser.
+// Set GreenConfig.Logger to capture or silence them.
+type Logger interface {
+	Log(d Diagnostic)
 }
 
 // call DefineFlags before myflags.Parse()
@@ -42,6 +94,13 @@ func (c *GreenConfig) DefineFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.Msgpack2, "msgpack2", false, "(alias for -omit-clue) don't append zid and clue to field name (makes things just like msgpack2 traditional encoding, without version + type clue)")
 	fs.BoolVar(&c.ShowVersion, "version", false, "print version info and exit")
 	fs.BoolVar(&c.TrueInt, "true-int", false, "use true type when encoding integers, not smallest possible type for the value")
+	fs.BoolVar(&c.FlattenEmbedded, "flatten-embedded", false, "write the fields of an embedded struct as fields of the outer struct, the way encoding/json does, instead of under the embedded type's name")
+	fs.BoolVar(&c.JSONTagFallback, "json-tags", false, "for fields with no msg tag, take the field name (or \"-\" to skip it) from the json tag; the json tag's options, like omitempty, are ignored")
+	fs.BoolVar(&c.SortFields, "sort-fields", false, "write each struct's fields in order of their tags instead of their declaration order, so reordering fields in the source does not change the output; structs with zid tags keep their zid order. Tuples are written in this order too")
+	fs.BoolVar(&c.SortMapKeys, "sort-map-keys", false, "write the entries of maps with string keys in sorted key order instead of Go's random map order, so that encoding the same value twice gives the same bytes; costs a sort per map")
+	fs.BoolVar(&c.Strict, "strict", false, "fail when a struct field would be left out because its type is not supported, instead of warning and generating code without it")
+	fs.BoolVar(&c.FieldDocs, "field-docs", false, "copy the doc comment of each struct field into the generated EncodeMsg and MarshalMsg, above the code that writes the field")
+	fs.StringVar(&c.TagName, "tag", "msg", "struct tag key to read field names and options from, e.g. -tag=codec to use `codec:\"name,omitempty\"` tags")
 }
 
 // call c.ValidateConfig() after myflags.Parse()
@@ -90,6 +90,17 @@ func (d *decodeGen) Execute(p Elem) error {
 	d.p.printf("\nfunc (%s %s) %sDecodeMsg(dc *msgp.Reader) (err error) {\n", p.Varname(), methodReceiver(p), d.cfg.MethodPrefix)
 
 	if !d.cfg.AllTuple {
+		if failsOnNil(p) {
+			// an error can leave nils pushed, at this
+			// level or below; drop them on the way out
+			d.p.print(`topNils := dc.NilDepth()
+  defer func() {
+    if err != nil {
+      dc.UnwindNils(topNils)
+    }
+  }()
+`)
+		}
 		d.p.printf(`var sawTopNil bool
   if dc.IsNil() {
     sawTopNil = true
@@ -136,6 +147,9 @@ func (d *decodeGen) gStruct(s *Struct) {
 	} else {
 		d.structAsMap(s)
 	}
+	// a struct that was missing from the
+	// message as a whole isn't checked
+	d.p.oneofCheck(s, "!dc.AlwaysNil")
 	return
 }
 
@@ -161,7 +175,7 @@ func (d *decodeGen) structAsTuple(s *Struct) {
 		if !d.p.ok() {
 			return
 		}
-		next(d, s.Fields[i].FieldElem)
+		d.field(&s.Fields[i])
 	}
 }
 
@@ -196,7 +210,7 @@ func (d *decodeGen) structAsMap(s *Struct) {
 	fieldOrder := fmt.Sprintf("\n var decodeMsgFieldOrder%s = []string{", nStr)
 	fieldSkip := fmt.Sprintf("\n var decodeMsgFieldSkip%s = []bool{", nStr)
 	for i := range s.Fields {
-		if s.Fields[i].Skip {
+		if s.Fields[i].Skip || s.Fields[i].ReadOnly {
 			fieldSkip += fmt.Sprintf("true,")
 		} else {
 			fieldSkip += fmt.Sprintf("false,")
@@ -217,6 +231,13 @@ func (d *decodeGen) structAsMap(s *Struct) {
 	d.p.printf("\n const maxFields%s = %d\n", nStr, n)
 
 	found := "found" + nStr
+	extras := s.ExtrasName()
+	if extras != "" {
+		d.p.clearMap(extras)
+	}
+	if hasRequired(s) {
+		d.p.printf("\nvar missing%s []string", nStr)
+	}
 	d.p.printf(tmpl)
 	// after printing tmpl, we are at this point:
 	// switch curField_ {
@@ -233,20 +254,39 @@ func (d *decodeGen) structAsMap(s *Struct) {
 
 		d.p.printf("\ncase \"%s\":", fld)
 		d.p.printf("\n%s[%d]=true;", found, i)
+		d.p.requiredCheck(&s.Fields[i], fld, nStr)
 		//d.p.printf("\n fmt.Printf(\"I found field '%s' at depth=%d. dc.AlwaysNil = %%v\", dc.AlwaysNil);\n", fld, d.depth)
 		d.depth++
-		next(d, s.Fields[i].FieldElem)
+		d.field(&s.Fields[i])
 		d.depth--
 		if !d.p.ok() {
 			return
 		}
 	}
-	d.p.print("\ndefault:\nerr = dc.Skip()")
+	if m := s.Inline; m != nil {
+		// field points into the reader's
+		// buffer, so take a copy first
+		d.p.printf("\ndefault:\n%s := string(field)", m.Keyidx)
+		d.p.printf("\nif %s == nil { %s = make(%s) }", extras, extras, m.TypeName())
+		d.p.declare(m.Validx, m.Value.TypeName())
+		next(d, m.Value)
+		d.p.mapAssign(m)
+	} else if extras != "" {
+		// field points into the reader's
+		// buffer, so take a copy first
+		key := gensym()
+		d.p.printf("\ndefault:\n%s := string(field)", key)
+		d.p.printf("\nif %s == nil { %s = make(map[string]interface{}) }", extras, extras)
+		d.p.printf("\n%s[%s], err = dc.ReadIntf()", extras, key)
+	} else {
+		d.p.print("\ndefault:\nerr = dc.Skip()")
+	}
 	d.p.print(errcheck)
 	d.p.closeblock() // close switch
 	d.p.closeblock() // close for loop
 
 	d.p.printf("\n if nextMiss%s != -1 {dc.PopAlwaysNil(); }\n", nStr)
+	d.p.requiredFail(s, nStr)
 }
 
 func (d *decodeGen) gBase(b *BaseElem) {
@@ -254,6 +294,15 @@ func (d *decodeGen) gBase(b *BaseElem) {
 		return
 	}
 
+	if b.Enum != nil {
+		name := gensym()
+		d.p.printf("\n{\nvar %s string\n%s, err = dc.ReadString()", name, name)
+		d.p.print(errcheck)
+		d.p.enumValue(b.Enum, name, b.Varname())
+		d.p.closeblock()
+		return
+	}
+
 	// open block for 'tmp'
 	var tmp string
 	if b.Convert {
@@ -277,7 +326,11 @@ func (d *decodeGen) gBase(b *BaseElem) {
 		d.p.printf("\nerr = %s.%sDecodeMsg(dc)", vname, d.cfg.MethodPrefix)
 	case Ext:
 		d.p.printf("\n if !dc.IsNil() {")
-		d.p.printf("\nerr = dc.ReadExtension(%s)\n} else { err = dc.ReadNil() }\n", vname)
+		d.p.printf("\nerr = dc.ReadExtension(%s)\n} else { err = dc.ReadNil()", vname)
+		if strings.HasPrefix(vname, "&") {
+			d.p.printf("\n%s", b.ZeroLiteral(vname[1:]))
+		}
+		d.p.print("\n}\n")
 	default:
 		if b.Convert {
 			d.p.printf("\n%s, err = dc.Read%s()", tmp, bname)
@@ -305,10 +358,25 @@ func (d *decodeGen) gMap(m *Map) {
 	}
 	sz := gensym()
 
+	if m.IsSet {
+		d.p.declare(sz, u32)
+		d.assignAndCheck(sz, arrayHeader)
+		d.p.resizeMap(sz, m)
+		d.p.printf("\nfor %s > 0 {\n%s--", sz, sz)
+		d.p.declare(m.Keyidx, m.KeyDeclTyp)
+		d.assignAndCheck(m.Keyidx, m.KeyTyp)
+		d.p.setAdd(m)
+		d.p.closeblock()
+		return
+	}
+
 	// resize or allocate map
 	d.p.declare(sz, u32)
 	d.assignAndCheck(sz, mapHeader)
 	d.p.resizeMap(sz, m)
+	if m.KeyOrder != "" {
+		d.p.printf("\n%s = %s[:0]", m.KeyOrder, m.KeyOrder)
+	}
 
 	// for element in map, read string/value
 	// pair and assign
@@ -317,6 +385,7 @@ func (d *decodeGen) gMap(m *Map) {
 	d.p.declare(m.Validx, m.Value.TypeName())
 	d.assignAndCheck(m.Keyidx, m.KeyTyp)
 	next(d, m.Value)
+	d.p.keyOrderAdd(m)
 	d.p.mapAssign(m)
 	d.p.closeblock()
 }
@@ -329,7 +398,8 @@ func (d *decodeGen) gSlice(s *Slice) {
 	d.p.declare(sz, u32)
 	d.assignAndCheck(sz, arrayHeader)
 	d.p.resizeSlice(sz, s)
-	d.p.rangeBlock(s.Index, s.Varname(), d, s.Els)
+	d.readElem(s.Els)
+	d.p.closeblock()
 }
 
 func (d *decodeGen) gArray(a *Array) {
@@ -359,13 +429,48 @@ func (d *decodeGen) gArray(a *Array) {
 	d.assignAndCheck(sz, arrayHeader)
 	d.p.arrayCheck(a.SizeResolved, sz, "!dc.IsNil() && ")
 	d.p.closeblock()
-	d.p.rangeBlock(a.Index, a.Varname(), d, a.Els)
+	d.rangeElems(a.Index, a.Varname(), a.Els)
+}
+
+// rangeElems reads the elements of a slice or
+// array, honoring nilElem.
+func (d *decodeGen) rangeElems(idx, iter string, e Elem) {
+	d.p.printf("\n for %s := range %s {", idx, iter)
+	d.readElem(e)
+	d.p.closeblock()
+}
+
+// readElem reads one element of a slice
+// or an array, as rangeElems describes
+func (d *decodeGen) readElem(e Elem) {
+	zero := nilElem(e)
+	if zero == "" {
+		next(d, e)
+		return
+	}
+	d.p.print("\nif dc.IsNil() {\nerr = dc.ReadNil()")
+	d.p.print(errcheck)
+	d.p.printf("\n%s\n} else {", zero)
+	next(d, e)
+	d.p.closeblock()
 }
 
 func (d *decodeGen) gPtr(p *Ptr) {
 	if !d.p.ok() {
 		return
 	}
+	if basicPtr(p) {
+		// a nil on the wire resets the pointer; a missing
+		// field keeps it, but zeroes what it points to
+		vname := p.Varname()
+		d.p.printf("\nif !dc.AlwaysNil && dc.IsNil() {\nerr = dc.ReadNil()")
+		d.p.print(errcheck)
+		d.p.printf("\n%s = nil\n} else if !dc.AlwaysNil || %s != nil {", vname, vname)
+		d.p.initPtr(p)
+		next(d, p.Value)
+		d.p.closeblock()
+		return
+	}
 
 	d.p.printf(`
                 if dc.IsNil() {
@@ -396,12 +501,8 @@ func (d *decodeGen) gPtr(p *Ptr) {
                // not Nil, we have something to read
 `, vname, vname, d.cfg.MethodPrefix)
 		case Ext:
-			d.p.printf("\n // we have an base.Value of Ext: replace the Ext iff already allocated")
-			d.p.printf("\nif %s != nil {\n  %s = new(msgp.RawExtension) } \n"+
-				" } else {\n // we have bytes in dc to read\n", vname, vname)
-		default:
-			//d.p.printf("\n // we have an unknown base.Value type= %T/val=%#v: \n", base.Value, base.Value)
-			d.p.printf("\n } else { \n")
+			d.p.printf("\n // we have an base.Value of Ext: don't try to re-use extension pointers")
+			d.p.printf("\n%s = nil\n } else {\n // we have bytes in dc to read\n", vname)
 		}
 	} else {
 		// !isBase
@@ -411,3 +512,31 @@ func (d *decodeGen) gPtr(p *Ptr) {
 	next(d, p.Value)
 	d.p.closeblock()
 }
+
+// field reads a struct field, honoring
+// msg:",nilwhen=zero": a nil on the wire
+// sets the field to its zero value, and
+// msg:",oneof=group": a nil on the wire
+// sets the field to nil.
+func (d *decodeGen) field(f *StructField) {
+	if f.ReadOnly {
+		// consume the value, but keep the field as it was
+		d.p.print("\nif !dc.AlwaysNil {\nerr = dc.Skip()")
+		d.p.print(errcheck)
+		d.p.closeblock()
+		return
+	}
+	zero := nilZero(f)
+	if zero == "" {
+		next(d, f.FieldElem)
+		d.p.enumCheck(f, "dc.AlwaysNil")
+		return
+	}
+	d.p.print("\nif dc.IsNil() {\nerr = dc.ReadNil()")
+	d.p.print(errcheck)
+	d.p.printf("\n%s\n} else {", zero)
+	next(d, f.FieldElem)
+	d.p.printf("\n%s", oneofSet(f))
+	d.p.closeblock()
+	d.p.enumCheck(f, "dc.AlwaysNil")
+}
@@ -97,6 +97,7 @@ var primitives = map[string]Primitive{
 	"uint32":         Uint32,
 	"uint64":         Uint64,
 	"byte":           Byte,
+	"rune":           Int32,
 	"int":            Int,
 	"int8":           Int8,
 	"int16":          Int16,
@@ -238,6 +239,15 @@ type Elem interface {
 // Ident returns the *BaseElem that corresponds
 // to the provided identity.
 func Ident(id string) *BaseElem {
+	// uintptr is written as a uint64 and converted
+	// back when read. Its size depends on the platform,
+	// so a value from a 64-bit machine may not fit
+	// in the uintptr of a 32-bit one.
+	if id == "uintptr" {
+		be := &BaseElem{Value: Uint64}
+		be.Alias(id)
+		return be
+	}
 	p, ok := primitives[id]
 	if ok {
 		return &BaseElem{Value: p}
@@ -319,10 +329,25 @@ type Map struct {
 	common
 	Keyidx string // key variable name
 	Validx string // value variable name
+	Key    Elem   // key element
 	Value  Elem   // value element
 
+	// KeyTyp is the msgp method suffix for
+	// the key (e.g. "String", "Uint32"), and
+	// KeyDeclTyp is its Go type.
 	KeyTyp     string
 	KeyDeclTyp string
+
+	// IsSet is true for map[K]struct{}, which
+	// is written as an array of its keys. Value
+	// is then a placeholder that is never visited.
+	IsSet bool
+
+	// KeyOrder is the expression for the []string
+	// that keeps the order of the map's keys on the
+	// wire, if the struct holding the map has a
+	// msg:",keyorder" field for it.
+	KeyOrder string
 }
 
 func (m *Map) TypeClue() string {
@@ -377,6 +402,9 @@ func (m *Map) TypeName() string {
 
 func (m *Map) Copy() Elem {
 	g := *m
+	if m.Key != nil {
+		g.Key = m.Key.Copy()
+	}
 	g.Value = m.Value.Copy()
 	return &g
 }
@@ -518,6 +546,10 @@ type Struct struct {
 	common
 	Fields           []StructField // field list
 	AsTuple          bool          // write as an array instead of a map
+	Patch            bool          // generate Diff and ApplyPatch (//msgp:patch)
+	Extras           string        // name of the msg:",extras" or msg:",inline" field, if any
+	Inline           *Map          // the msg:",inline" map, whose values are written with their own type
+	Anonymous        bool          // declared inline, as in struct{ Meta struct{ A int } }
 	hasOmitEmptyTags bool
 	KeyTyp           string
 
@@ -554,9 +586,37 @@ func (s *Struct) TypeName() string {
 	return s.common.alias
 }
 
+// ExtrasName returns the expression for the
+// struct's extras map, or "" if it has none.
+func (s *Struct) ExtrasName() string {
+	if s.Extras == "" {
+		return ""
+	}
+	return s.Varname() + "." + s.Extras
+}
+
+// OneOfGroups returns the names of the
+// msg:",oneof=group" groups of s, in the
+// order they first appear.
+func (s *Struct) OneOfGroups() []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for i := range s.Fields {
+		g := s.Fields[i].OneOf
+		if g != "" && !s.Fields[i].Skip && !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
 func (s *Struct) SetVarname(a string) {
 	s.common.SetVarname(a)
 	writeStructFields(s.Fields, a)
+	if s.Inline != nil {
+		s.Inline.SetVarname(a + "." + s.Extras)
+	}
 }
 
 func (s *Struct) Copy() Elem {
@@ -570,6 +630,9 @@ func (s *Struct) Copy() Elem {
 		}
 		g.Fields[i].FieldElem = s.Fields[i].FieldElem.Copy()
 	}
+	if s.Inline != nil {
+		g.Inline = s.Inline.Copy().(*Map)
+	}
 	return &g
 }
 
@@ -592,6 +655,75 @@ type StructField struct {
 	Deprecated bool   // if the tag `deprecated:"true"` was found
 	Skip       bool   // if msg:"-" or field is type struct{}
 	ShowZero   bool   // if msg:",showzero" tag was found.
+	Embedded   bool   // if the field is anonymous, e.g. struct{ Base }
+
+	// Doc is the field's doc comment, followed by the
+	// comment at the end of its line, if any, with the
+	// comment markers removed and each line trimmed.
+	// It is "" for an undocumented field.
+	Doc string
+
+	// NilWhenZero is set by the tag `msg:",nilwhen=zero"`. The
+	// field is written as nil when it holds its zero value, and
+	// a nil on the wire is read back as the zero value.
+	NilWhenZero bool
+
+	// Extras is set by the tag `msg:",extras"` on a
+	// map[string]interface{} field, which then collects
+	// the keys of a decoded map that match no other field,
+	// and is merged back into the map when encoding.
+	// It is not written under a key of its own, so it
+	// is also marked Skip.
+	Extras bool
+
+	// Inline is set by the tag `msg:",inline"` on a
+	// map[string]T field. It works like Extras, but
+	// the values are read and written as a T rather
+	// than with ReadIntf and WriteIntf. A struct may
+	// have only one Extras or Inline field.
+	Inline bool
+
+	// Truncate is set by the tag `msg:",truncate=N"` on a
+	// string field. Longer values are cut to at most N bytes,
+	// on a rune boundary, when encoding. Zero means no limit.
+	Truncate int
+
+	// OneOf is the group named by the tag `msg:",oneof=group"`.
+	// Exactly one field of a group may be non-nil when the
+	// struct is encoded or decoded; the others are omitted.
+	OneOf string
+
+	// KeyOrder, on a map[string]T field, names the []string
+	// field tagged `msg:",keyorder"` that keeps its keys in
+	// the order they were decoded. Encoding writes them back
+	// in that order, as long as it still matches the map.
+	KeyOrder string
+
+	// IsKeyOrder is set by the tag `msg:",keyorder"` or
+	// `msg:",keyorder=Field"`, and KeyOrderOf is the map
+	// field named, if any. Such a field is not written
+	// under a key of its own, so it is also marked Skip.
+	IsKeyOrder bool
+	KeyOrderOf string
+
+	// ReadOnly is set by the tag `msg:",readonly"`. The
+	// field is written as usual, but decoding skips its
+	// value on the wire and never assigns to the field,
+	// even when the key is missing or nil.
+	ReadOnly bool
+
+	// Required is set by the tag `msg:",required"`. The
+	// field is always written, and decoding a map that
+	// lacks its key fails with msgp.ErrMissingField.
+	Required bool
+
+	// EnumCheck is set by the tag `msg:",enumcheck"` on
+	// a field whose type has a block of constants. Decoding
+	// a value outside [EnumMin, EnumMax] is an error.
+	EnumCheck bool
+	EnumType  string
+	EnumMin   int64
+	EnumMax   int64
 
 	// ZebraId defaults to -1, meaning not-tagged with a zebra id.
 	// if ZebraId >= 0, then the tag `zebra:"N"` was found, with ZebraId == N.
@@ -611,10 +743,36 @@ type BaseElem struct {
 	Convert      bool      // should we do an explicit conversion?
 	mustinline   bool      // must inline; not printable
 	needsref     bool      // needs reference for shim
+	Enum         *Enum     // encode as constant names, or nil
+}
+
+// Enum holds the constants of an integer type
+// given in a //msgp:enum directive, in the order
+// they were declared. Such a type is encoded as
+// the name of its constant rather than its value.
+type Enum struct {
+	Type   string
+	Names  []string
+	Values []int64
+}
+
+// longest returns the length of the longest name.
+func (e *Enum) longest() int {
+	n := 0
+	for _, nm := range e.Names {
+		if len(nm) > n {
+			n = len(nm)
+		}
+	}
+	return n
 }
 
 func (s *BaseElem) GetZtype() (r green.Ztype) {
 	r.Kind = green.Zkind(s.Value)
+	if s.Enum != nil {
+		// written as the names of its constants
+		r.Kind = green.Zkind(String)
+	}
 	if r.Kind != 22 {
 		r.Str = r.Kind.String()
 		return
@@ -757,7 +915,7 @@ func (s *BaseElem) ZeroLiteral(v string) string {
 		return fmt.Sprintf(`%s = nil`, v)
 	case Time:
 		return fmt.Sprintf(`%s = time.Time{}`, v)
-	case IDENT:
+	case IDENT, Ext:
 		return fmt.Sprintf(`%s = %s{}`, v, s.TypeName())
 	case Bytes:
 		return fmt.Sprintf(`%s = %s[:0]`, v, v)
@@ -827,6 +985,9 @@ func writeStructFields(s []StructField, name string) {
 	for i := range s {
 		if !s[i].Skip {
 			s[i].FieldElem.SetVarname(fmt.Sprintf("%s.%s", name, s[i].FieldName))
+			if m, ok := s[i].FieldElem.(*Map); ok && s[i].KeyOrder != "" {
+				m.KeyOrder = fmt.Sprintf("%s.%s", name, s[i].KeyOrder)
+			}
 		}
 	}
 }
@@ -67,6 +67,9 @@ func (e *encodeGen) Execute(p Elem) error {
 	e.p.comment(fmt.Sprintf("%sEncodeMsg implements msgp.Encodable", e.cfg.MethodPrefix))
 
 	e.p.printf("\nfunc (%s %s) %sEncodeMsg(en *msgp.Writer) (err error) {", p.Varname(), imutMethodReceiver(p), e.cfg.MethodPrefix)
+	// errors of our own, such as an unknown enum
+	// value, must stop the Writer as its own do
+	e.p.print("\ndefer func() {\nen.Fail(err)\n}()")
 	e.p.preSaveHook()
 	next(e, p)
 	e.p.nakedReturn()
@@ -78,6 +81,11 @@ func (e *encodeGen) gStruct(s *Struct) {
 		return
 	}
 
+	if len(s.OneOfGroups()) > 0 {
+		e.fuseHook()
+		e.p.oneofCheck(s, "")
+	}
+
 	if e.cfg.AllTuple || s.AsTuple {
 		e.tuple(s)
 	} else {
@@ -98,7 +106,7 @@ func (e *encodeGen) tuple(s *Struct) {
 		if !e.p.ok() {
 			return
 		}
-		next(e, s.Fields[i].FieldElem)
+		e.field(&s.Fields[i])
 	}
 }
 
@@ -122,15 +130,25 @@ func (e *encodeGen) structmap(s *Struct) {
 	allOmitEmpty := !e.cfg.SerzEmpty
 	skipclue := e.cfg.SkipZidClue || e.cfg.Msgpack2
 
+	if s.Anonymous {
+		s.hasOmitEmptyTags = omitsFields(s, e.cfg)
+	}
 	if allOmitEmpty || s.hasOmitEmptyTags {
 		e.p.printf("\n\n// honor the omitempty tags\n")
 		e.p.printf("var %s [%d]bool\n", empty, len(s.Fields))
-		e.p.printf("%s := %s.fieldsNotEmpty(%s[:])\n",
-			inUse, s.vname, empty)
+		e.p.fieldsInUse(s, e.cfg, empty, inUse)
 		e.p.printf("\n// map header\n")
+		if extras := s.ExtrasName(); extras != "" {
+			e.p.printf("%s += uint32(len(%s))\n", inUse, extras)
+		}
 		e.p.printf("	err = en.WriteMapHeader(%s)\n", inUse)
 		e.p.printf("	if err != nil {\n")
 		e.p.printf("		return err\n}\n")
+	} else if extras := s.ExtrasName(); extras != "" {
+		e.fuseHook()
+		e.p.printf("\n// map header, size %d plus extras", nfields)
+		e.p.printf("\nerr = en.WriteMapHeader(%d + uint32(len(%s)))", nfields, extras)
+		e.p.print(errcheck)
 	} else {
 		data = msgp.AppendMapHeader(nil, uint32(nfields))
 		e.p.printf("\n// map header, size %d", nfields)
@@ -158,12 +176,29 @@ func (e *encodeGen) structmap(s *Struct) {
 		e.p.printf("\n// write %q", fld)
 		e.Fuse(data)
 		e.fuseHook()
-		next(e, s.Fields[i].FieldElem)
+		e.field(&s.Fields[i])
 
 		if allOmitEmpty || (s.hasOmitEmptyTags && s.Fields[i].OmitEmpty) {
 			e.p.printf("\n }\n")
 		}
 	}
+
+	if m := s.Inline; m != nil {
+		e.fuseHook()
+		e.p.rangeMap(m.Keyidx, m.Validx, m.Varname(), e.cfg.SortMapKeys)
+		e.writeAndCheck(m.KeyTyp, literalFmt, m.Keyidx)
+		next(e, m.Value)
+		e.p.closeblock()
+	} else if extras := s.ExtrasName(); extras != "" {
+		e.fuseHook()
+		k, v := gensym(), gensym()
+		e.p.rangeMap(k, v, extras, e.cfg.SortMapKeys)
+		e.p.printf("\nerr = en.WriteString(%s)", k)
+		e.p.print(errcheck)
+		e.p.printf("\nerr = en.WriteIntf(%s)", v)
+		e.p.print(errcheck)
+		e.p.closeblock()
+	}
 }
 
 func (e *encodeGen) gMap(m *Map) {
@@ -172,12 +207,31 @@ func (e *encodeGen) gMap(m *Map) {
 	}
 	e.fuseHook()
 	vname := m.Varname()
+	if m.IsSet {
+		e.writeAndCheck(arrayHeader, lenAsUint32, vname)
+		e.p.printf("\nfor %s := range %s {", m.Keyidx, vname)
+		e.writeAndCheck(m.KeyTyp, literalFmt, m.Keyidx)
+		e.p.closeblock()
+		return
+	}
 	e.writeAndCheck(mapHeader, lenAsUint32, vname)
 
-	e.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, vname)
+	if m.KeyOrder != "" {
+		ok := e.p.keyOrderValid(m)
+		e.p.printf("\nif %s {", ok)
+		e.p.printf("\nfor _, %s := range %s {\n%s := %s[%s]", m.Keyidx, m.KeyOrder, m.Validx, vname, m.Keyidx)
+		e.writeAndCheck(m.KeyTyp, literalFmt, m.Keyidx)
+		next(e, m.Value)
+		e.p.closeblock()
+		e.p.print("\n} else {")
+	}
+	e.p.rangeMap(m.Keyidx, m.Validx, vname, e.cfg.SortMapKeys && m.KeyTyp == "String")
 	e.writeAndCheck(m.KeyTyp, literalFmt, m.Keyidx)
 	next(e, m.Value)
 	e.p.closeblock()
+	if m.KeyOrder != "" {
+		e.p.closeblock()
+	}
 }
 
 func (e *encodeGen) gPtr(s *Ptr) {
@@ -220,6 +274,13 @@ func (e *encodeGen) gBase(b *BaseElem) {
 		return
 	}
 	e.fuseHook()
+	if b.Enum != nil {
+		name := gensym()
+		e.p.printf("\nvar %s string", name)
+		e.p.enumName(b.Enum, b.Varname(), name)
+		e.writeAndCheck(stringTyp, literalFmt, name)
+		return
+	}
 	vname := b.Varname()
 	if b.Convert {
 		vname = tobaseConvert(b)
@@ -232,3 +293,27 @@ func (e *encodeGen) gBase(b *BaseElem) {
 		e.writeAndCheck(b.BaseName(), literalFmt, vname)
 	}
 }
+
+// field writes a struct field, honoring
+// msg:",nilwhen=zero": a zero value is
+// written as nil, and msg:",truncate=N".
+func (e *encodeGen) field(f *StructField) {
+	if e.cfg.FieldDocs && f.Doc != "" {
+		e.fuseHook()
+		e.p.fieldDoc(f)
+	}
+	el := truncated(f)
+	if !f.NilWhenZero {
+		next(e, el)
+		return
+	}
+	e.fuseHook()
+	isZero := gensym()
+	e.p.printf("\nvar %s bool\n%s = ", isZero, isZero)
+	next(emptyOmitter(&e.p, ""), f.FieldElem)
+	e.p.printf("if %s {\nerr = en.WriteNil()", isZero)
+	e.p.print(errcheck)
+	e.p.print("\n} else {")
+	next(e, el)
+	e.p.closeblock()
+}
@@ -58,50 +58,69 @@ func (e *fieldsEmpty) gStruct(s *Struct) {
 	e.p.printf("func (%s) %sfieldsNotEmpty(isempty []bool) uint32 {",
 		e.recvr, e.cfg.MethodPrefix)
 
-	allFieldsEmpty := !e.cfg.SerzEmpty
-
 	nfields := len(s.Fields) - s.SkipCount
-	numOE := 0
-	for i := range s.Fields {
-		if s.Fields[i].OmitEmpty {
-			numOE++
-		}
-	}
-
-	// default is SerzEmpty false, so by
-	// default we will treat all as being omitempty.
-	// This is safe since we will zero any re-used
-	// struct's fields when reading.
-	//
-	if e.cfg.SerzEmpty {
-		// even under SerzEmpty, we still respect the specific ,omitempty tag:
-		if numOE == 0 {
-			// no fields tagged with omitempty, just return the full field count.
-			e.p.printf("\nreturn %d }\n", nfields)
-			return
-		}
+	if !omitsFields(s, e.cfg) {
+		// no fields tagged with omitempty, just return the full field count.
+		e.p.printf("\nreturn %d }\n", nfields)
+		return
 	}
 	// remember this to avoid recomputing it in other passes.
 	s.hasOmitEmptyTags = true
 
-	om := emptyOmitter(&e.p, s.vname)
-
 	e.p.printf("if len(isempty) == 0 { return %d }\n", nfields)
 	e.p.printf("var fieldsInUse uint32 = %d\n", nfields)
+	countEmpty(&e.p, s, e.cfg, "isempty", "fieldsInUse")
+	//e.p.printf("\n fmt.Printf(\"\\n\\n fieldsInUse=%%v\", fieldsInUse) \n\n")
+	e.p.printf("\n return fieldsInUse \n}\n")
+}
+
+// omitsFields reports whether any of the fields
+// of s may be left out.
+//
+// default is SerzEmpty false, so by
+// default we will treat all as being omitempty.
+// This is safe since we will zero any re-used
+// struct's fields when reading.
+// Even under SerzEmpty, we still respect the
+// specific ,omitempty tag.
+func omitsFields(s *Struct, cfg *cfg.GreenConfig) bool {
+	if !cfg.SerzEmpty {
+		return true
+	}
+	for i := range s.Fields {
+		if s.Fields[i].OmitEmpty {
+			return true
+		}
+	}
+	return false
+}
+
+// countEmpty prints the statements that set
+// isempty[i] for each field of s that may be
+// omitted, and take those that are empty off
+// the count in inUse.
+func countEmpty(p *printer, s *Struct, cfg *cfg.GreenConfig, isempty, inUse string) {
+	allFieldsEmpty := !cfg.SerzEmpty
+	om := emptyOmitter(p, s.vname)
 	for i := range s.Fields {
 		if s.Fields[i].Skip {
 			continue
 		}
-		if allFieldsEmpty || s.Fields[i].OmitEmpty {
-			e.p.printf("isempty[%d] = ", i)
+		// required fields are always written, and the
+		// set member of a oneof group is, even if empty
+		if s.Fields[i].OneOf != "" && !s.Fields[i].Required {
+			p.printf("%s[%d] = (%s == nil) // oneof member\n", isempty, i, s.Fields[i].FieldElem.Varname())
+			p.printf("if %s[%d] { %s-- ; }\n", isempty, i, inUse)
+			continue
+		}
+		if (allFieldsEmpty || s.Fields[i].OmitEmpty) && !s.Fields[i].Required {
+			p.printf("%s[%d] = ", isempty, i)
 			next(om, s.Fields[i].FieldElem)
 
-			e.p.printf("if isempty[%d] { fieldsInUse-- ; }\n", i)
-			//or: e.p.printf("if isempty[%d] { fieldsInUse-- ; fmt.Printf(\"\\n %s is not in use!\\n \")}\n", i, s.Fields[i].FieldTagZidClue)
+			p.printf("if %s[%d] { %s-- ; }\n", isempty, i, inUse)
+			//or: p.printf("if isempty[%d] { fieldsInUse-- ; fmt.Printf(\"\\n %s is not in use!\\n \")}\n", i, s.Fields[i].FieldTagZidClue)
 		}
 	}
-	//e.p.printf("\n fmt.Printf(\"\\n\\n fieldsInUse=%%v\", fieldsInUse) \n\n")
-	e.p.printf("\n return fieldsInUse \n}\n")
 }
 
 func (e *fieldsEmpty) gPtr(p *Ptr) {
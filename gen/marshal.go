@@ -83,6 +83,11 @@ func (m *marshalGen) gStruct(s *Struct) {
 		return
 	}
 
+	if len(s.OneOfGroups()) > 0 {
+		m.fuseHook()
+		m.p.oneofCheck(s, "")
+	}
+
 	if m.cfg.AllTuple || s.AsTuple {
 		m.tuple(s)
 	} else {
@@ -103,7 +108,7 @@ func (m *marshalGen) tuple(s *Struct) {
 		if !m.p.ok() {
 			return
 		}
-		next(m, s.Fields[i].FieldElem)
+		m.field(&s.Fields[i])
 	}
 }
 
@@ -115,11 +120,21 @@ func (m *marshalGen) mapstruct(s *Struct) {
 	allOmitEmpty := !m.cfg.SerzEmpty
 	skipclue := m.cfg.SkipZidClue || m.cfg.Msgpack2
 
+	if s.Anonymous {
+		s.hasOmitEmptyTags = omitsFields(s, m.cfg)
+	}
 	if allOmitEmpty || s.hasOmitEmptyTags {
 		m.p.printf("\n\n// honor the omitempty tags\n")
 		m.p.printf("var empty [%d]bool\n", len(s.Fields))
-		m.p.printf("fieldsInUse := %s.fieldsNotEmpty(empty[:])\n", s.vname)
+		m.p.fieldsInUse(s, m.cfg, "empty", "fieldsInUse")
+		if extras := s.ExtrasName(); extras != "" {
+			m.p.printf("fieldsInUse += uint32(len(%s))\n", extras)
+		}
 		m.p.printf("	o = msgp.AppendMapHeader(o, fieldsInUse)\n")
+	} else if extras := s.ExtrasName(); extras != "" {
+		m.fuseHook()
+		m.p.printf("\n// map header, size %d plus extras", nfields)
+		m.p.printf("\no = msgp.AppendMapHeader(o, %d + uint32(len(%s)))", nfields, extras)
 	} else {
 		data = msgp.AppendMapHeader(data, uint32(nfields))
 		m.p.printf("\n// map header, size %d", nfields)
@@ -153,12 +168,28 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		m.p.printf("\n// string %q", fld)
 		m.Fuse(data)
 		m.fuseHook()
-		next(m, s.Fields[i].FieldElem)
+		m.field(&s.Fields[i])
 
 		if allOmitEmpty || (s.hasOmitEmptyTags && s.Fields[i].OmitEmpty) {
 			m.p.printf("\n }\n")
 		}
 	}
+
+	if mp := s.Inline; mp != nil {
+		m.fuseHook()
+		m.p.rangeMap(mp.Keyidx, mp.Validx, mp.Varname(), m.cfg.SortMapKeys)
+		m.rawAppend(mp.KeyTyp, literalFmt, mp.Keyidx)
+		next(m, mp.Value)
+		m.p.closeblock()
+	} else if extras := s.ExtrasName(); extras != "" {
+		m.fuseHook()
+		k, v := gensym(), gensym()
+		m.p.rangeMap(k, v, extras, m.cfg.SortMapKeys)
+		m.p.printf("\no = msgp.AppendString(o, %s)", k)
+		m.p.printf("\no, err = msgp.AppendIntf(o, %s)", v)
+		m.p.print(errcheck)
+		m.p.closeblock()
+	}
 }
 
 // append raw data
@@ -176,11 +207,30 @@ func (m *marshalGen) gMap(s *Map) {
 	}
 	m.fuseHook()
 	vname := s.Varname()
+	if s.IsSet {
+		m.rawAppend(arrayHeader, lenAsUint32, vname)
+		m.p.printf("\nfor %s := range %s {", s.Keyidx, vname)
+		m.rawAppend(s.KeyTyp, literalFmt, s.Keyidx)
+		m.p.closeblock()
+		return
+	}
 	m.rawAppend(mapHeader, lenAsUint32, vname)
-	m.p.printf("\nfor %s, %s := range %s {", s.Keyidx, s.Validx, vname)
+	if s.KeyOrder != "" {
+		ok := m.p.keyOrderValid(s)
+		m.p.printf("\nif %s {", ok)
+		m.p.printf("\nfor _, %s := range %s {\n%s := %s[%s]", s.Keyidx, s.KeyOrder, s.Validx, vname, s.Keyidx)
+		m.rawAppend(s.KeyTyp, literalFmt, s.Keyidx)
+		next(m, s.Value)
+		m.p.closeblock()
+		m.p.print("\n} else {")
+	}
+	m.p.rangeMap(s.Keyidx, s.Validx, vname, m.cfg.SortMapKeys && s.KeyTyp == "String")
 	m.rawAppend(s.KeyTyp, literalFmt, s.Keyidx)
 	next(m, s.Value)
 	m.p.closeblock()
+	if s.KeyOrder != "" {
+		m.p.closeblock()
+	}
 }
 
 func (m *marshalGen) gSlice(s *Slice) {
@@ -198,7 +248,7 @@ func (m *marshalGen) gArray(a *Array) {
 		return
 	}
 	m.fuseHook()
-	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+	if be, ok := a.Els.(*BaseElem); ok && (be.Value == Byte || be.Value == Uint8) {
 		m.rawAppend("Bytes", "%s[:]", a.Varname())
 		return
 	}
@@ -222,6 +272,13 @@ func (m *marshalGen) gBase(b *BaseElem) {
 		return
 	}
 	m.fuseHook()
+	if b.Enum != nil {
+		name := gensym()
+		m.p.printf("\nvar %s string", name)
+		m.p.enumName(b.Enum, b.Varname(), name)
+		m.rawAppend(stringTyp, literalFmt, name)
+		return
+	}
 	vname := b.Varname()
 
 	if b.Convert {
@@ -244,3 +301,25 @@ func (m *marshalGen) gBase(b *BaseElem) {
 		m.p.print(errcheck)
 	}
 }
+
+// field appends a struct field, honoring
+// msg:",nilwhen=zero": a zero value is
+// appended as nil, and msg:",truncate=N".
+func (m *marshalGen) field(f *StructField) {
+	if m.cfg.FieldDocs && f.Doc != "" {
+		m.fuseHook()
+		m.p.fieldDoc(f)
+	}
+	el := truncated(f)
+	if !f.NilWhenZero {
+		next(m, el)
+		return
+	}
+	m.fuseHook()
+	isZero := gensym()
+	m.p.printf("\nvar %s bool\n%s = ", isZero, isZero)
+	next(emptyOmitter(&m.p, ""), f.FieldElem)
+	m.p.printf("if %s {\no = msgp.AppendNil(o)\n} else {", isZero)
+	next(m, el)
+	m.p.closeblock()
+}
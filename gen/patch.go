@@ -0,0 +1,148 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/glycerine/truepack/cfg"
+)
+
+// patch generates Diff and ApplyPatch for
+// structs marked with //msgp:patch. A patch is
+// a msgpack map holding only the fields that
+// changed, keyed the same way MarshalMsg keys them.
+func patch(w io.Writer, cfg *cfg.GreenConfig) *patchGen {
+	return &patchGen{
+		p:   printer{w: w},
+		cfg: cfg,
+	}
+}
+
+type patchGen struct {
+	passes
+	p   printer
+	cfg *cfg.GreenConfig
+}
+
+func (g *patchGen) MethodPrefix() string {
+	return g.cfg.MethodPrefix
+}
+
+func (g *patchGen) Method() Method { return Marshal | Unmarshal }
+
+func (g *patchGen) Execute(p Elem) error {
+	if !g.p.ok() {
+		return g.p.err
+	}
+	p = g.applyall(p)
+	if p == nil {
+		return nil
+	}
+	s, ok := p.(*Struct)
+	if !ok || !s.Patch {
+		return nil
+	}
+	g.diff(s)
+	g.apply(s)
+	return g.p.err
+}
+
+// the map key for field i, as written by MarshalMsg
+func (g *patchGen) fieldKey(s *Struct, i int) string {
+	if g.cfg.SkipZidClue || g.cfg.Msgpack2 {
+		return s.Fields[i].FieldTag
+	}
+	return s.Fields[i].FieldTagZidClue
+}
+
+// differs returns an expression that is true
+// when the named field of a and b differ. Slices,
+// maps, pointers and anything else that can't be
+// compared with == are compared with
+// msgp.WireEqual, so that a nil slice or map
+// doesn't differ from an empty one: the wire
+// doesn't tell them apart.
+func differs(f *StructField, a string, b string) string {
+	x := a + "." + f.FieldName
+	y := b + "." + f.FieldName
+	if be, ok := f.FieldElem.(*BaseElem); ok {
+		switch be.Value {
+		case Bytes, Intf, Ext, IDENT:
+		case Time:
+			return fmt.Sprintf("!%s.Equal(%s)", x, y)
+		default:
+			return fmt.Sprintf("%s != %s", x, y)
+		}
+	}
+	return fmt.Sprintf("!msgp.WireEqual(%s, %s)", x, y)
+}
+
+func (g *patchGen) diff(s *Struct) {
+	g.p.comment(fmt.Sprintf("%sDiff returns a msgpack map holding only the fields", g.cfg.MethodPrefix))
+	g.p.comment("of other that differ from those of z. Applying it to z")
+	g.p.comment(fmt.Sprintf("with %sApplyPatch makes z equal to other.", g.cfg.MethodPrefix))
+	g.p.printf("\nfunc (z *%s) %sDiff(other *%s) (o []byte, err error) {", s.TypeName(), g.cfg.MethodPrefix, s.TypeName())
+	g.p.printf("\nvar differs [%d]bool", len(s.Fields))
+	g.p.printf("\nvar n uint32")
+	for i := range s.Fields {
+		if s.Fields[i].Skip {
+			continue
+		}
+		g.p.printf("\nif %s { differs[%d] = true; n++ }", differs(&s.Fields[i], "z", "other"), i)
+	}
+	g.p.printf("\no = msgp.AppendMapHeader(o, n)")
+
+	m := marshal(g.p.w, g.cfg)
+	for i := range s.Fields {
+		if s.Fields[i].Skip {
+			continue
+		}
+		g.p.printf("\nif differs[%d] {", i)
+		g.p.printf("\no = msgp.AppendString(o, %q)", g.fieldKey(s, i))
+		el := s.Fields[i].FieldElem.Copy()
+		el.SetVarname("other." + s.Fields[i].FieldName)
+		next(m, el)
+		if !m.p.ok() {
+			g.p.err = m.p.err
+			return
+		}
+		g.p.closeblock()
+	}
+	g.p.nakedReturn()
+}
+
+func (g *patchGen) apply(s *Struct) {
+	g.p.comment(fmt.Sprintf("%sApplyPatch updates z with the fields present in bts,", g.cfg.MethodPrefix))
+	g.p.comment(fmt.Sprintf("a patch made by %sDiff. Fields absent from the patch", g.cfg.MethodPrefix))
+	g.p.comment("are left alone, and unknown keys are skipped.")
+	g.p.printf("\nfunc (z *%s) %sApplyPatch(bts []byte) (err error) {", s.TypeName(), g.cfg.MethodPrefix)
+	g.p.printf("\nvar nbs msgp.NilBitsStack")
+	g.p.printf("\nvar sz uint32")
+	g.p.printf("\nsz, bts, err = nbs.ReadMapHeaderBytes(bts)")
+	g.p.print(errcheck)
+	g.p.printf("\nvar field []byte")
+	g.p.printf("\nfor ; sz > 0; sz-- {")
+	g.p.printf("\nfield, bts, err = nbs.ReadMapKeyZC(bts)")
+	g.p.print(errcheck)
+	g.p.printf("\nswitch msgp.UnsafeString(field) {")
+
+	u := unmarshal(g.p.w, g.cfg)
+	u.hasfield = true // we declared field above
+	for i := range s.Fields {
+		if s.Fields[i].Skip {
+			continue
+		}
+		g.p.printf("\ncase %q:", g.fieldKey(s, i))
+		u.field(&s.Fields[i])
+		if !u.p.ok() {
+			g.p.err = u.p.err
+			return
+		}
+	}
+	g.p.print("\ndefault:\nbts, err = msgp.Skip(bts)")
+	g.p.print(errcheck)
+	g.p.closeblock() // close switch
+	g.p.closeblock() // close for loop
+	g.p.nakedReturn()
+	u.postLines()
+}
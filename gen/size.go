@@ -128,6 +128,21 @@ func (s *sizeGen) gStruct(st *Struct) {
 			s.addConstant(strconv.Itoa(len(data)))
 			next(s, st.Fields[i].FieldElem)
 		}
+		if m := st.Inline; m != nil {
+			s.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, m.Varname())
+			s.p.printf("\n_ = %s", m.Validx)
+			s.p.printf("\ns += msgp.StringPrefixSize + len(%s)", m.Keyidx)
+			s.state = expr
+			next(s, m.Value)
+			s.p.closeblock()
+			s.state = add
+		} else if extras := st.ExtrasName(); extras != "" {
+			k, v := gensym(), gensym()
+			s.p.printf("\nfor %s, %s := range %s {", k, v, extras)
+			s.p.printf("\ns += msgp.StringPrefixSize + len(%s) + msgp.GuessSize(%s)", k, v)
+			s.p.closeblock()
+			s.state = add
+		}
 	}
 }
 
@@ -181,8 +196,20 @@ func (s *sizeGen) gArray(a *Array) {
 }
 
 func (s *sizeGen) gMap(m *Map) {
-	s.addConstant(builtinSize(mapHeader))
 	vn := m.Varname()
+	if m.IsSet {
+		s.addConstant(builtinSize(arrayHeader))
+		if m.KeyTyp != "String" {
+			s.addConstant(fmt.Sprintf("(len(%s) * msgp.%sSize)", vn, m.KeyTyp))
+			return
+		}
+		s.p.printf("\nfor %s := range %s {", m.Keyidx, vn)
+		s.p.printf("\ns += msgp.StringPrefixSize + len(%s)", m.Keyidx)
+		s.p.closeblock()
+		s.state = add
+		return
+	}
+	s.addConstant(builtinSize(mapHeader))
 	s.p.printf("\nif %s != nil {", vn)
 	s.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, vn)
 	s.p.printf("\n_ = %s", m.Validx) // we may not use the value
@@ -241,6 +268,9 @@ func fixedsizeExpr(e Elem) (string, bool) {
 			return fmt.Sprintf("(%s * (%s))", e.SizeResolved, str), true
 		}
 	case *BaseElem:
+		if e.Enum != nil {
+			return fmt.Sprintf("msgp.StringPrefixSize + %d", e.Enum.longest()), true
+		}
 		if fixedSize(e.Value) {
 			return builtinSize(e.BaseName()), true
 		}
@@ -279,6 +309,9 @@ func fixedsizeExpr(e Elem) (string, bool) {
 
 // print size expression of a variable name
 func basesizeExpr(b *BaseElem, s *sizeGen) string {
+	if b.Enum != nil {
+		return fmt.Sprintf("msgp.StringPrefixSize + %d", b.Enum.longest())
+	}
 	vname := b.Varname()
 	if b.Convert {
 		vname = tobaseConvert(b)
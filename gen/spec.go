@@ -3,6 +3,7 @@ package gen
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/glycerine/truepack/cfg"
 )
@@ -130,6 +131,9 @@ func NewPrinter(m Method, out io.Writer, tests io.Writer, cfg *cfg.GreenConfig)
 	if m.isset(Unmarshal) {
 		gens = append(gens, unmarshal(out, cfg))
 	}
+	if m.isset(Marshal | Unmarshal) {
+		gens = append(gens, patch(out, cfg))
+	}
 	if m.isset(Size) {
 		gens = append(gens, sizes(out, cfg))
 	}
@@ -184,6 +188,21 @@ func (p *Printer) Print(e Elem) error {
 	return nil
 }
 
+// PrintOnly prints an Elem using only
+// the generator for the given method.
+func (p *Printer) PrintOnly(e Elem, m Method) error {
+	for _, g := range p.gens {
+		if g.Method() != m {
+			continue
+		}
+		err := g.Execute(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // generator is the interface through
 // which code is generated.
 type generator interface {
@@ -313,7 +332,7 @@ func (p *printer) declare(name string, typ string) {
 // does:
 //
 // if m == nil && size > 0 {
-//     m = make(type, size)
+//     m = make(type, msgp.Prealloc(size))
 // } else if len(m) > 0 {
 //     for key, _ := range m { delete(m, key) }
 // }
@@ -324,7 +343,7 @@ func (p *printer) resizeMap(size string, m *Map) {
 		return
 	}
 	p.printf("\nif %s == nil && %s > 0 {", vn, size)
-	p.printf("\n%s = make(%s, %s)", vn, m.TypeName(), size)
+	p.printf("\n%s = make(%s, msgp.Prealloc(%s))", vn, m.TypeName(), size)
 	p.printf("\n} else if len(%s) > 0 {", vn)
 	p.clearMap(vn)
 	p.closeblock()
@@ -338,13 +357,230 @@ func (p *printer) mapAssign(m *Map) {
 	p.printf("\n%s[%s] = %s", m.Varname(), m.Keyidx, m.Validx)
 }
 
+// rangeMap opens a loop over the map vname with
+// key and val bound to each entry. If sorted, the
+// string keys are gathered and visited in byte order,
+// so that the same map always encodes the same way.
+func (p *printer) rangeMap(key, val, vname string, sorted bool) {
+	if !sorted {
+		p.printf("\nfor %s, %s := range %s {", key, val, vname)
+		return
+	}
+	keys := gensym()
+	p.printf("\n%s := make([]string, 0, len(%s))", keys, vname)
+	p.printf("\nfor %s := range %s {\n%s = append(%s, %s)\n}", key, vname, keys, keys, key)
+	p.printf("\nsort.Strings(%s)", keys)
+	p.printf("\nfor _, %s := range %s {\n%s := %s[%s]", key, keys, val, vname, key)
+}
+
+// record a decoded key in the map's msg:",keyorder"
+// field; keys repeated on the wire are recorded once.
+func (p *printer) keyOrderAdd(m *Map) {
+	if m.KeyOrder == "" || !p.ok() {
+		return
+	}
+	p.printf("\nif _, dup := %s[%s]; !dup {", m.Varname(), m.Keyidx)
+	p.printf("\n%s = append(%s, %s)\n}", m.KeyOrder, m.KeyOrder, m.Keyidx)
+}
+
+// declare a bool that says whether the map's
+// msg:",keyorder" field still holds exactly
+// its keys, each of them once, so that it can
+// be written in that order, and return the
+// bool's name. Short key orders are checked for
+// repeats pairwise, so that encoding them
+// doesn't allocate; only long ones use a set.
+func (p *printer) keyOrderValid(m *Map) string {
+	ok := gensym()
+	i := gensym()
+	j := gensym()
+	seen := gensym()
+	order := m.KeyOrder
+	p.printf("\n%s := len(%s) == len(%s)", ok, order, m.Varname())
+	p.printf("\nfor %s := 0; %s && %s < len(%s); %s++ {", i, ok, i, order, i)
+	p.printf("\n_, %s = %s[%s[%s]]", ok, m.Varname(), order, i)
+	p.closeblock()
+	p.printf("\nif %s && len(%s) <= %d {", ok, order, keyOrderPairwise)
+	p.printf("\nfor %s := 1; %s && %s < len(%s); %s++ {", i, ok, i, order, i)
+	p.printf("\nfor %s := 0; %s && %s < %s; %s++ {", j, ok, j, i, j)
+	p.printf("\n%s = %s[%s] != %s[%s]", ok, order, i, order, j)
+	p.closeblock()
+	p.closeblock()
+	p.printf("\n} else if %s {", ok)
+	p.printf("\n%s := make(map[string]struct{}, len(%s))", seen, order)
+	p.printf("\nfor %s := 0; %s && %s < len(%s); %s++ {", i, ok, i, order, i)
+	p.printf("\nif _, dup := %s[%s[%s]]; dup {\n%s = false\n}", seen, order, i, ok)
+	p.printf("\n%s[%s[%s]] = struct{}{}", seen, order, i)
+	p.closeblock()
+	p.closeblock()
+	return ok
+}
+
+// the longest msg:",keyorder" field that
+// keyOrderValid checks without allocating
+const keyOrderPairwise = 16
+
+// hasRequired reports whether any field of s
+// is tagged `msg:",required"`.
+func hasRequired(s *Struct) bool {
+	for i := range s.Fields {
+		if s.Fields[i].Required && !s.Fields[i].Skip {
+			return true
+		}
+	}
+	return false
+}
+
+// failsOnNil reports whether decoding e from
+// a nil, as DecodeMsg does for a missing field,
+// can fail, so that the nils pushed for it must
+// be unwound on error: e holds by value a struct
+// with msg:",required" fields or one encoded as
+// an array, or a named type whose decoder can't
+// be seen from here.
+func failsOnNil(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		if e.AsTuple || hasRequired(e) {
+			return true
+		}
+		for i := range e.Fields {
+			if !e.Fields[i].Skip && failsOnNil(e.Fields[i].FieldElem) {
+				return true
+			}
+		}
+	case *Array:
+		return failsOnNil(e.Els)
+	case *BaseElem:
+		return e.Value == IDENT
+	}
+	return false
+}
+
+// note a required field that is being filled in
+// because it was missing from the map decoded,
+// and move on to the next missing field.
+func (p *printer) requiredCheck(f *StructField, key string, nStr string) {
+	if !f.Required || !p.ok() {
+		return
+	}
+	p.printf("\nif nextMiss%s != -1 {\nmissing%s = append(missing%s, %q)\ncontinue\n}", nStr, nStr, nStr, key)
+}
+
+// fail with all the required keys that
+// requiredCheck found missing. It runs after
+// the missing-field pass has ended, so that
+// the caller can keep using its reader.
+func (p *printer) requiredFail(s *Struct, nStr string) {
+	if !hasRequired(s) || !p.ok() {
+		return
+	}
+	p.printf("\nif missing%s != nil {\nerr = msgp.ErrMissingField{Keys: missing%s}\nreturn\n}", nStr, nStr)
+}
+
+// check that an enum field decoded to one of its
+// declared values. Fields that were missing from the
+// message (signalled by 'alwaysNil') are not checked.
+func (p *printer) enumCheck(f *StructField, alwaysNil string) {
+	if !f.EnumCheck || !p.ok() {
+		return
+	}
+	vn := f.FieldElem.Varname()
+	p.printf("\nif !%s && (int64(%s) < %d || int64(%s) > %d) {", alwaysNil, vn, f.EnumMin, vn, f.EnumMax)
+	p.printf("\nerr = msgp.EnumRangeError{Type: %q, Value: int64(%s), Min: %d, Max: %d}", f.EnumType, vn, f.EnumMin, f.EnumMax)
+	p.print("\nreturn\n}")
+}
+
+// set 'dst', a string, to the name of the constant
+// that 'vname' holds, for a //msgp:enum type. When
+// constants share a value, the first one declared
+// names it. A zero without a name of its own is
+// written as "", which enumValue reads back as zero.
+func (p *printer) enumName(e *Enum, vname string, dst string) {
+	if !p.ok() {
+		return
+	}
+	seen := make(map[int64]bool)
+	p.printf("\nswitch %s {", vname)
+	for i, nm := range e.Names {
+		if seen[e.Values[i]] {
+			continue
+		}
+		seen[e.Values[i]] = true
+		p.printf("\ncase %s:\n%s = %q", nm, dst, nm)
+	}
+	if !seen[0] {
+		p.printf("\ncase 0:\n%s = \"\"", dst)
+	}
+	p.printf("\ndefault:\nerr = msgp.EnumNameError{Type: %q, Value: int64(%s)}\nreturn\n}", e.Type, vname)
+}
+
+// set 'vname' from 'src', the name of one of the
+// constants of a //msgp:enum type. An empty name,
+// as read from nil or a missing field, is zero.
+func (p *printer) enumValue(e *Enum, src string, vname string) {
+	if !p.ok() {
+		return
+	}
+	p.printf("\nswitch %s {", src)
+	for _, nm := range e.Names {
+		p.printf("\ncase %q:\n%s = %s", nm, vname, nm)
+	}
+	p.printf("\ncase \"\":\n%s = 0", vname)
+	p.printf("\ndefault:\nerr = msgp.EnumNameError{Type: %q, Name: %s}\nreturn\n}", e.Type, src)
+}
+
+// check that each msg:",oneof=group" group of
+// s has exactly one member set. The check is
+// skipped unless 'guard' (if any) holds.
+func (p *printer) oneofCheck(s *Struct, guard string) {
+	if !p.ok() {
+		return
+	}
+	for _, g := range s.OneOfGroups() {
+		n := gensym()
+		if guard != "" {
+			p.printf("\nif %s {", guard)
+		} else {
+			p.print("\n{")
+		}
+		p.printf("\nvar %s int", n)
+		for i := range s.Fields {
+			if s.Fields[i].OneOf == g && !s.Fields[i].Skip {
+				p.printf("\nif %s != nil { %s++ }", s.Fields[i].FieldElem.Varname(), n)
+			}
+		}
+		p.printf("\nif %s != 1 {\nerr = msgp.OneOfError{Group: %q, Set: %s}\nreturn\n}", n, g, n)
+		p.closeblock()
+	}
+}
+
+// add key to a map[K]struct{} set
+func (p *printer) setAdd(m *Map) {
+	if !p.ok() {
+		return
+	}
+	p.printf("\n%s[%s] = struct{}{}", m.Varname(), m.Keyidx)
+}
+
 // clear map keys
 func (p *printer) clearMap(name string) {
 	p.printf("\nfor key, _ := range %[1]s { delete(%[1]s, key) }", name)
 }
 
+// does:
+//
+// if cap(s) >= int(size) { s = s[:size] } else { s = make(type, msgp.Prealloc(size)) }
+// for idx := 0; idx < int(size); idx++ {
+//     if idx == len(s) { s = append(s, make(type, msgp.Prealloc(size-uint32(idx)))...) }
+//
+// so that room is made for the elements as
+// they arrive, not all at once on the word of
+// the header; the caller closes the loop.
 func (p *printer) resizeSlice(size string, s *Slice) {
-	p.printf("\nif cap(%[1]s) >= int(%[2]s) { %[1]s = (%[1]s)[:%[2]s] } else { %[1]s = make(%[3]s, %[2]s) }", s.Varname(), size, s.TypeName())
+	p.printf("\nif cap(%[1]s) >= int(%[2]s) { %[1]s = (%[1]s)[:%[2]s] } else { %[1]s = make(%[3]s, msgp.Prealloc(%[2]s)) }", s.Varname(), size, s.TypeName())
+	p.printf("\n for %[4]s := 0; %[4]s < int(%[2]s); %[4]s++ {", s.Varname(), size, s.TypeName(), s.Index)
+	p.printf("\nif %[4]s == len(%[1]s) { %[1]s = append(%[1]s, make(%[3]s, msgp.Prealloc(%[2]s-uint32(%[4]s)))...) }", s.Varname(), size, s.TypeName(), s.Index)
 }
 
 func (p *printer) arrayCheck(want string, got string, additionalGuard string) {
@@ -387,6 +623,14 @@ func (p *printer) comment(s string) {
 	p.print("\n// " + s)
 }
 
+// fieldDoc prints the doc comment
+// of f, for -field-docs
+func (p *printer) fieldDoc(f *StructField) {
+	for _, line := range strings.Split(f.Doc, "\n") {
+		p.comment(line)
+	}
+}
+
 func (p *printer) printf(format string, args ...interface{}) {
 	if p.err == nil {
 		_, p.err = fmt.Fprintf(p.w, format, args...)
@@ -408,6 +652,97 @@ func (p *printer) initPtr(pt *Ptr) {
 
 func (p *printer) ok() bool { return p.err == nil }
 
+// oneofSet returns the statement that a decoder
+// runs after reading f from a non-nil value on
+// the wire, if f needs one. The set member of a
+// oneof group is sent even when empty, and must
+// not read back as nil, or the group would look
+// unset.
+func oneofSet(f *StructField) string {
+	if f.OneOf == "" {
+		return ""
+	}
+	vn := f.FieldElem.Varname()
+	switch e := f.FieldElem.(type) {
+	case *Slice, *Map:
+		return fmt.Sprintf("if %s == nil { %s = %s{} }", vn, vn, f.FieldElem.TypeName())
+	case *BaseElem:
+		if e.Value == Bytes && !e.Convert {
+			return fmt.Sprintf("if %s == nil { %s = []byte{} }", vn, vn)
+		}
+	}
+	return ""
+}
+
 func tobaseConvert(b *BaseElem) string {
 	return b.ToBase() + "(" + b.Varname() + ")"
 }
+
+// nilZero returns the statement that a decoder
+// runs when f is nil on the wire, if f needs one
+// other than the usual handling of nils.
+func nilZero(f *StructField) string {
+	vn := f.FieldElem.Varname()
+	switch {
+	case f.OneOf != "":
+		// a member of the group that wasn't sent
+		// must read back as nil, not as an empty
+		// value in a re-used pointer, slice or map.
+		return vn + " = nil"
+	case f.NilWhenZero:
+		return f.FieldElem.ZeroLiteral(vn)
+	}
+	return ""
+}
+
+// fieldsInUse prints the declaration of inUse, the
+// number of fields of s to write, and marks the ones
+// left out in the bool array named empty. The count
+// comes from the fieldsNotEmpty method, except for an
+// anonymous struct, which has no methods; its count
+// is made inline.
+func (p *printer) fieldsInUse(s *Struct, cfg *cfg.GreenConfig, empty, inUse string) {
+	if !s.Anonymous {
+		p.printf("%s := %s.fieldsNotEmpty(%s[:])\n", inUse, s.vname, empty)
+		return
+	}
+	p.printf("var %s uint32 = %d\n", inUse, len(s.Fields)-s.SkipCount)
+	countEmpty(p, s, cfg, empty, inUse)
+}
+
+// nilElem returns the statement that a decoder
+// runs when a slice or array element e is nil on
+// the wire. A pointer element reads back as nil,
+// not as an empty value in a re-used pointer.
+func nilElem(e Elem) string {
+	if _, ok := e.(*Ptr); ok {
+		return e.Varname() + " = nil"
+	}
+	return ""
+}
+
+// basicPtr reports whether p points to a basic
+// type, such as *int or *time.Time, rather than
+// to a type with its own methods or an extension.
+func basicPtr(p *Ptr) bool {
+	b, ok := p.Value.(*BaseElem)
+	return ok && b.Value != IDENT && b.Value != Ext
+}
+
+// truncated returns the element to write for f,
+// which for a msg:",truncate=N" field is a copy
+// that reads the value through msgp.TruncateString.
+func truncated(f *StructField) Elem {
+	b, ok := f.FieldElem.(*BaseElem)
+	if f.Truncate <= 0 || !ok || b.Value != String {
+		return f.FieldElem
+	}
+	vname := b.Varname()
+	if b.Convert {
+		vname = tobaseConvert(b)
+	}
+	c := b.Copy().(*BaseElem)
+	c.Convert = false
+	c.SetVarname(fmt.Sprintf("msgp.TruncateString(%s, %d)", vname, f.Truncate))
+	return c
+}
@@ -59,11 +59,14 @@ func (u *unmarshalGen) Execute(p Elem) error {
 	vname := p.Varname()
 	methRcvr := methodReceiver(p)
 	if u.cfg.ReadStringsFast {
-		u.p.printf("\nfunc (%s %s) %sUnmarshalMsg(bts []byte) (o []byte, err error) {\n cfg := &msgp.RuntimeConfig{UnsafeZeroCopy:true}; return %s.%sUnmarshalMsgWithCfg(bts, cfg)\n}", vname, methRcvr, u.cfg.MethodPrefix, vname, u.cfg.MethodPrefix)
+		u.p.printf("\nfunc (%s %s) %sUnmarshalMsg(bts []byte) (o []byte, err error) {\n cfg := &msgp.RuntimeConfig{UnsafeZeroCopy:true}\n o, err = %s.%sUnmarshalMsgWithCfg(bts, cfg)\n return o, msgp.WithOffset(err, bts, o)\n}", vname, methRcvr, u.cfg.MethodPrefix, vname, u.cfg.MethodPrefix)
 	} else {
-		u.p.printf("\nfunc (%s %s) %sUnmarshalMsg(bts []byte) (o []byte, err error) {\n return %s.%sUnmarshalMsgWithCfg(bts, nil)\n}", vname, methRcvr, u.cfg.MethodPrefix, vname, u.cfg.MethodPrefix)
+		u.p.printf("\nfunc (%s %s) %sUnmarshalMsg(bts []byte) (o []byte, err error) {\n o, err = %s.%sUnmarshalMsgWithCfg(bts, nil)\n return o, msgp.WithOffset(err, bts, o)\n}", vname, methRcvr, u.cfg.MethodPrefix, vname, u.cfg.MethodPrefix)
 	}
 	u.p.printf("\nfunc (%s %s) %sUnmarshalMsgWithCfg(bts []byte, cfg *msgp.RuntimeConfig) (o []byte, err error) {", vname, methRcvr, u.cfg.MethodPrefix)
+	// on error, hand back the bytes from where
+	// decoding stopped, for UnmarshalMsg's WithOffset
+	u.p.print("\ndefer func() {\nif err != nil {\no = bts\n}\n}()")
 	// u.p.printf("\nvar nbs msgp.NilBitsStack;\nvar sawTopNil bool\n if msgp.IsNil(bts) {\n 	sawTopNil = true\n fmt.Printf(\"len of bts pre push: %%v\\n\", len(bts));	bts = nbs.PushAlwaysNil(bts[1:]);\n	fmt.Printf(\"len of bts post push: %%v\\n\", len(bts));\n   }\n")
 	u.p.printf("\nvar nbs msgp.NilBitsStack;\nnbs.Init(cfg)\nvar sawTopNil bool\n if msgp.IsNil(bts) {\n 	sawTopNil = true\n  bts = nbs.PushAlwaysNil(bts[1:]);\n	}\n")
 	next(u, p)
@@ -99,6 +102,9 @@ func (u *unmarshalGen) gStruct(s *Struct) {
 	} else {
 		u.mapstruct(s)
 	}
+	// a struct that was missing from the
+	// message as a whole isn't checked
+	u.p.oneofCheck(s, "!nbs.AlwaysNil")
 	return
 }
 
@@ -117,7 +123,7 @@ func (u *unmarshalGen) tuple(s *Struct) {
 		if !u.p.ok() {
 			return
 		}
-		next(u, s.Fields[i].FieldElem)
+		u.field(&s.Fields[i])
 	}
 }
 
@@ -136,7 +142,7 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	fieldOrder := fmt.Sprintf("\n var unmarshalMsgFieldOrder%s = []string{", nStr)
 	fieldSkip := fmt.Sprintf("\n var unmarshalMsgFieldSkip%s = []bool{", nStr)
 	for i := range s.Fields {
-		if s.Fields[i].Skip {
+		if s.Fields[i].Skip || s.Fields[i].ReadOnly {
 			fieldSkip += fmt.Sprintf("true,")
 		} else {
 			fieldSkip += fmt.Sprintf("false,")
@@ -157,6 +163,13 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.p.printf("\n const maxFields%s = %d\n", nStr, n)
 
 	found := "found" + nStr
+	extras := s.ExtrasName()
+	if extras != "" {
+		u.p.clearMap(extras)
+	}
+	if hasRequired(s) {
+		u.p.printf("\nvar missing%s []string", nStr)
+	}
 	u.p.printf(tmpl)
 
 	for i := range s.Fields {
@@ -170,18 +183,33 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 
 		u.p.printf("\ncase \"%s\":", fld)
 		u.p.printf("\n%s[%d]=true;", found, i)
+		u.p.requiredCheck(&s.Fields[i], fld, nStr)
 		u.depth++
-		next(u, s.Fields[i].FieldElem)
+		u.field(&s.Fields[i])
 		u.depth--
 		if !u.p.ok() {
 			return
 		}
 	}
-	u.p.print("\ndefault:\nbts, err = msgp.Skip(bts)")
+	if m := s.Inline; m != nil {
+		u.p.printf("\ndefault:\n%s := string(field)", m.Keyidx)
+		u.p.printf("\nif %s == nil { %s = make(%s) }", extras, extras, m.TypeName())
+		u.p.declare(m.Validx, m.Value.TypeName())
+		next(u, m.Value)
+		u.p.mapAssign(m)
+	} else if extras != "" {
+		key := gensym()
+		u.p.printf("\ndefault:\n%s := string(field)", key)
+		u.p.printf("\nif %s == nil { %s = make(map[string]interface{}) }", extras, extras)
+		u.p.printf("\n%s[%s], bts, err = nbs.ReadIntfBytes(bts)", extras, key)
+	} else {
+		u.p.print("\ndefault:\nbts, err = msgp.Skip(bts)")
+	}
 	u.p.print(errcheck)
 	u.p.print("\n}\n}") // close switch and for loop
 
 	u.p.printf("\n if nextMiss%s != -1 { bts = nbs.PopAlwaysNil(); }\n", nStr)
+	u.p.requiredFail(s, nStr)
 }
 
 func (u *unmarshalGen) gBase(b *BaseElem) {
@@ -189,6 +217,15 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 		return
 	}
 
+	if b.Enum != nil {
+		name := gensym()
+		u.p.printf("\n{\nvar %s string\n%s, bts, err = nbs.ReadStringBytes(bts)", name, name)
+		u.p.print(errcheck)
+		u.p.enumValue(b.Enum, name, b.Varname())
+		u.p.closeblock()
+		return
+	}
+
 	refname := b.Varname() // assigned to
 	lowered := b.Varname() // passed as argument
 	if b.Convert {
@@ -205,7 +242,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 		u.p.closeblock()
 	case Ext:
 		vn := b.Varname()[1:]
-		u.p.printf("\n if nbs.AlwaysNil || msgp.IsNil(bts) { if !nbs.AlwaysNil { bts = bts[1:] }\n    %s = msgp.RawExtension{}  \n} else {\n bts, err = nbs.ReadExtensionBytes(bts, %s) \n", vn, lowered)
+		u.p.printf("\n if nbs.AlwaysNil || msgp.IsNil(bts) { if !nbs.AlwaysNil { bts = bts[1:] }\n    %s  \n} else {\n bts, err = nbs.ReadExtensionBytes(bts, %s) \n", b.ZeroLiteral(vn), lowered)
 		u.p.print(errcheck)
 		u.p.closeblock()
 	case IDENT:
@@ -229,7 +266,7 @@ func (u *unmarshalGen) gArray(a *Array) {
 
 	// special case for [const]byte objects
 	// see decode.go for symmetry
-	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+	if be, ok := a.Els.(*BaseElem); ok && (be.Value == Byte || be.Value == Uint8) {
 		u.p.printf("\nbts, err = nbs.ReadExactBytes(bts, %s[:])", a.Varname())
 		u.p.print(errcheck)
 		return
@@ -239,7 +276,28 @@ func (u *unmarshalGen) gArray(a *Array) {
 	u.p.declare(sz, u32)
 	u.assignAndCheck(sz, arrayHeader)
 	u.p.arrayCheck(a.SizeResolved, sz, "!nbs.IsNil(bts) && ")
-	u.p.rangeBlock(a.Index, a.Varname(), u, a.Els)
+	u.rangeElems(a.Index, a.Varname(), a.Els)
+}
+
+// rangeElems reads the elements of a slice or
+// array, honoring nilElem.
+func (u *unmarshalGen) rangeElems(idx, iter string, e Elem) {
+	u.p.printf("\n for %s := range %s {", idx, iter)
+	u.readElem(e)
+	u.p.closeblock()
+}
+
+// readElem reads one element of a slice
+// or an array, as rangeElems describes
+func (u *unmarshalGen) readElem(e Elem) {
+	zero := nilElem(e)
+	if zero == "" {
+		next(u, e)
+		return
+	}
+	u.p.printf("\nif nbs.AlwaysNil || msgp.IsNil(bts) {\nif !nbs.AlwaysNil { bts = bts[1:] }\n%s\n} else {", zero)
+	next(u, e)
+	u.p.closeblock()
 }
 
 func (u *unmarshalGen) gSlice(s *Slice) {
@@ -252,7 +310,8 @@ func (u *unmarshalGen) gSlice(s *Slice) {
 	u.p.declare(sz, u32)
 	u.assignAndCheck(sz, arrayHeader)
 	u.p.resizeSlice(sz, s)
-	u.p.rangeBlock(s.Index, s.Varname(), u, s.Els)
+	u.readElem(s.Els)
+	u.p.closeblock()
 	u.p.closeblock()
 }
 
@@ -265,10 +324,24 @@ func (u *unmarshalGen) gMap(m *Map) {
 	if !u.p.ok() {
 		return
 	}
+	if m.KeyOrder != "" {
+		u.p.printf("\n%s = %s[:0]", m.KeyOrder, m.KeyOrder)
+	}
 	u.p.printf("\n if nbs.AlwaysNil { %s \n} else {\n",
 		m.ZeroLiteral(m.Varname()))
 	sz := gensym()
 	u.p.declare(sz, u32)
+	if m.IsSet {
+		u.assignAndCheck(sz, arrayHeader)
+		u.p.resizeMap(sz, m)
+		u.p.printf("\nfor %s > 0 {", sz)
+		u.p.printf("\nvar %s %s; %s--", m.Keyidx, m.KeyDeclTyp, sz)
+		u.assignAndCheck(m.Keyidx, m.KeyTyp)
+		u.p.setAdd(m)
+		u.p.closeblock()
+		u.p.closeblock()
+		return
+	}
 	u.assignAndCheck(sz, mapHeader)
 
 	// allocate or clear map
@@ -279,6 +352,7 @@ func (u *unmarshalGen) gMap(m *Map) {
 	u.p.printf("\nvar %s %s; var %s %s; %s--", m.Keyidx, m.KeyDeclTyp, m.Validx, m.Value.TypeName(), sz)
 	u.assignAndCheck(m.Keyidx, m.KeyTyp)
 	next(u, m.Value)
+	u.p.keyOrderAdd(m)
 	u.p.mapAssign(m)
 	u.p.closeblock()
 	u.p.closeblock()
@@ -286,6 +360,14 @@ func (u *unmarshalGen) gMap(m *Map) {
 
 func (u *unmarshalGen) gPtr(p *Ptr) {
 	vname := p.Varname()
+	if basicPtr(p) {
+		// as in DecodeMsg
+		u.p.printf("\nif !nbs.AlwaysNil && msgp.IsNil(bts) {\nbts = bts[1:]\n%s = nil\n} else if !nbs.AlwaysNil || %s != nil {", vname, vname)
+		u.p.initPtr(p)
+		next(u, p.Value)
+		u.p.closeblock()
+		return
+	}
 
 	base, isBase := p.Value.(*BaseElem)
 	if isBase {
@@ -317,6 +399,15 @@ func (u *unmarshalGen) gPtr(p *Ptr) {
 			u.p.closeblock()
 			return
 		}
+	} else {
+		// as in DecodeMsg, a nil on the wire or a missing
+		// field resets a pointer to a struct, slice or map,
+		// embedded or not
+		u.p.printf("\nif nbs.AlwaysNil || msgp.IsNil(bts) {\nif !nbs.AlwaysNil { bts = bts[1:] }\n%s = nil\n} else {", vname)
+		u.p.initPtr(p)
+		next(u, p.Value)
+		u.p.closeblock()
+		return
 	}
 
 	u.p.printf("\n // default gPtr logic.")
@@ -325,3 +416,29 @@ func (u *unmarshalGen) gPtr(p *Ptr) {
 	next(u, p.Value)
 	u.p.closeblock()
 }
+
+// field reads a struct field, honoring
+// msg:",nilwhen=zero": a nil on the wire
+// sets the field to its zero value, and
+// msg:",oneof=group": a nil on the wire
+// sets the field to nil.
+func (u *unmarshalGen) field(f *StructField) {
+	if f.ReadOnly {
+		// consume the value, but keep the field as it was
+		u.p.print("\nif !nbs.AlwaysNil {\nbts, err = msgp.Skip(bts)")
+		u.p.print(errcheck)
+		u.p.closeblock()
+		return
+	}
+	zero := nilZero(f)
+	if zero == "" {
+		next(u, f.FieldElem)
+		u.p.enumCheck(f, "nbs.AlwaysNil")
+		return
+	}
+	u.p.printf("\nif nbs.AlwaysNil || msgp.IsNil(bts) {\nif !nbs.AlwaysNil { bts = bts[1:] }\n%s\n} else {", zero)
+	next(u, f.FieldElem)
+	u.p.printf("\n%s", oneofSet(f))
+	u.p.closeblock()
+	u.p.enumCheck(f, "nbs.AlwaysNil")
+}
@@ -0,0 +1,104 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+)
+
+// ErrChecksumMismatch is returned by (*ChecksumReader).ReadMessage
+// when a message does not match the checksum that follows it.
+var ErrChecksumMismatch = errors.New("msgp: checksum mismatch")
+
+// ChecksumWriter is a *Writer that follows each
+// message with a checksum of the message's bytes.
+//
+// The layout on the wire is simply one object for
+// the message, followed by a 'bin' object holding
+// the checksum:
+//
+//	<message> <bin: hash.Sum() of the message's bytes>
+//
+// so a stream of checked messages is still a valid
+// stream of MessagePack objects. Which checksum is
+// used (CRC32, xxhash, ...) is up to the hash.Hash
+// handed to NewChecksumWriter; the reading side
+// must use the same kind of hash.
+type ChecksumWriter struct {
+	*Writer
+	w io.Writer
+	h hash.Hash
+}
+
+// NewChecksumWriter returns a ChecksumWriter that
+// writes to 'w', using 'h' to checksum each message.
+func NewChecksumWriter(w io.Writer, h hash.Hash) *ChecksumWriter {
+	h.Reset()
+	return &ChecksumWriter{
+		Writer: NewWriter(io.MultiWriter(w, h)),
+		w:      w,
+		h:      h,
+	}
+}
+
+// FinishMessage ends the current message: it
+// flushes everything written since the last call
+// to FinishMessage, then writes the checksum of
+// those bytes. FinishMessage also flushes the
+// checksum, so there is no need to call Flush.
+func (c *ChecksumWriter) FinishMessage() error {
+	err := c.Writer.Flush()
+	if err != nil {
+		return err
+	}
+	// the checksum goes straight to the
+	// underlying writer, so that it isn't
+	// hashed along with the next message.
+	_, err = c.w.Write(AppendBytes(nil, c.h.Sum(nil)))
+	c.h.Reset()
+	return err
+}
+
+// ChecksumReader reads messages written
+// by a ChecksumWriter, verifying each one.
+type ChecksumReader struct {
+	*Reader
+	h   hash.Hash
+	raw []byte
+	sum []byte
+}
+
+// NewChecksumReader returns a ChecksumReader that
+// reads from 'r', using 'h' to verify each message.
+func NewChecksumReader(r io.Reader, h hash.Hash) *ChecksumReader {
+	return &ChecksumReader{
+		Reader: NewReader(r),
+		h:      h,
+	}
+}
+
+// ReadMessage reads the next message and its
+// checksum, and decodes the message into 'd' only if
+// the checksum matches. Otherwise, it returns
+// ErrChecksumMismatch and leaves 'd' untouched.
+func (c *ChecksumReader) ReadMessage(d Decodable) error {
+	c.raw = c.raw[:0]
+	err := appendNext(c.Reader, &c.raw)
+	if err != nil {
+		return err
+	}
+	c.sum, err = c.Reader.ReadBytes(c.sum)
+	if err != nil {
+		return err
+	}
+	c.h.Reset()
+	c.h.Write(c.raw)
+	if !bytes.Equal(c.h.Sum(nil), c.sum) {
+		return ErrChecksumMismatch
+	}
+	rd := NewReaderBytes(c.raw)
+	err = d.DecodeMsg(rd)
+	freeR(rd)
+	return err
+}
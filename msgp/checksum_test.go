@@ -0,0 +1,45 @@
+package msgp
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+)
+
+func TestChecksumRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewChecksumWriter(&buf, crc32.NewIEEE())
+	for _, s := range []string{"one", "two"} {
+		err := cw.WriteMapStrStr(map[string]string{"name": s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cw.FinishMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	good := append([]byte(nil), buf.Bytes()...)
+
+	cr := NewChecksumReader(bytes.NewReader(good), crc32.NewIEEE())
+	for _, s := range []string{"one", "two"} {
+		var r Raw
+		err := cr.ReadMessage(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r, AppendMapStrStr(nil, map[string]string{"name": s})) {
+			t.Errorf("expected message %q; got %v", s, []byte(r))
+		}
+	}
+
+	// flip a byte inside the first message's value
+	bad := append([]byte(nil), good...)
+	bad[len(bad)/4] ^= 0x01
+	cr = NewChecksumReader(bytes.NewReader(bad), crc32.NewIEEE())
+	var r Raw
+	err := cr.ReadMessage(&r)
+	if err != ErrChecksumMismatch {
+		t.Errorf("expected ErrChecksumMismatch; got %v", err)
+	}
+}
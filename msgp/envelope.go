@@ -0,0 +1,99 @@
+package msgp
+
+import (
+	"errors"
+)
+
+// ErrBadEnvelope is returned by ReadEnvelope
+// when the object read is a map that lacks one
+// of the envelope's fields.
+var ErrBadEnvelope = errors.New("msgp: envelope is missing a field")
+
+// Versioned is implemented by types that
+// can be wrapped in an envelope by WriteEnvelope.
+// TypeName should be unique among the types sent
+// over the same stream, and SchemaVersion should
+// change whenever the type's encoding does.
+type Versioned interface {
+	Encodable
+	TypeName() string
+	SchemaVersion() uint64
+}
+
+// WriteEnvelope writes 'v' wrapped in an envelope,
+// which is a map of three fields:
+//
+//	{"v": v.SchemaVersion(), "t": v.TypeName(), "d": <v>}
+//
+// so that the reading side can find out what it
+// has been sent before decoding it.
+func WriteEnvelope(w *Writer, v Versioned) error {
+	err := w.WriteMapHeader(3)
+	if err != nil {
+		return err
+	}
+	err = w.WriteString("v")
+	if err != nil {
+		return err
+	}
+	err = w.WriteUint64(v.SchemaVersion())
+	if err != nil {
+		return err
+	}
+	err = w.WriteString("t")
+	if err != nil {
+		return err
+	}
+	err = w.WriteString(v.TypeName())
+	if err != nil {
+		return err
+	}
+	err = w.WriteString("d")
+	if err != nil {
+		return err
+	}
+	return v.EncodeMsg(w)
+}
+
+// ReadEnvelope reads an envelope written by WriteEnvelope.
+// It returns the type name and schema version found in it,
+// along with the raw bytes of the body, which the caller
+// can hand to the UnmarshalMsg method of the type named.
+// The fields of the envelope may be in any order, and
+// unknown fields are skipped.
+func ReadEnvelope(r *Reader) (typename string, version uint64, body []byte, err error) {
+	var sz uint32
+	sz, err = r.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	var key []byte
+	var seen uint8
+	for ; sz > 0; sz-- {
+		key, err = r.ReadMapKey(key[:0])
+		if err != nil {
+			return
+		}
+		switch UnsafeString(key) {
+		case "v":
+			version, err = r.ReadUint64()
+			seen |= 1
+		case "t":
+			typename, err = r.ReadString()
+			seen |= 2
+		case "d":
+			body = body[:0]
+			err = appendNext(r, &body)
+			seen |= 4
+		default:
+			err = r.Skip()
+		}
+		if err != nil {
+			return
+		}
+	}
+	if seen != 7 {
+		err = ErrBadEnvelope
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package msgp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWireEqual(t *testing.T) {
+	type inner struct {
+		S      []int
+		M      map[string][]byte
+		hidden int
+	}
+	type outer struct {
+		In   inner
+		P    *inner
+		I    interface{}
+		When time.Time
+	}
+	now := time.Now()
+	for _, c := range []struct {
+		a, b interface{}
+		eq   bool
+	}{
+		{nil, nil, true},
+		{nil, 0, false},
+		{1, 1, true},
+		{1, int64(1), false},
+		{[]int(nil), []int{}, true},
+		{[]byte(nil), []byte{}, true},
+		{[]byte("a"), []byte("b"), false},
+		{map[string]int(nil), map[string]int{}, true},
+		{map[string]int{"a": 1}, map[string]int{"b": 1}, false},
+		{[][]int{nil}, [][]int{{}}, true},
+		{[2][]int{}, [2][]int{{}, nil}, true},
+		{inner{S: nil, hidden: 1}, inner{S: []int{}, hidden: 2}, true},
+		{inner{M: map[string][]byte{"k": nil}}, inner{M: map[string][]byte{"k": {}}}, true},
+		{inner{S: []int{1}}, inner{S: []int{2}}, false},
+		{outer{P: &inner{}}, outer{P: &inner{S: []int{}}}, true},
+		{outer{P: &inner{}}, outer{}, false},
+		{outer{I: []int{}}, outer{I: []int(nil)}, true},
+		{outer{I: []int{}}, outer{}, false},
+		{outer{I: 1}, outer{I: "1"}, false},
+		{outer{When: now}, outer{When: now.UTC()}, true},
+		{outer{When: now}, outer{When: now.Add(1)}, false},
+	} {
+		if got := WireEqual(c.a, c.b); got != c.eq {
+			t.Errorf("WireEqual(%#v, %#v) = %v; want %v", c.a, c.b, got, c.eq)
+		}
+	}
+}
@@ -11,6 +11,18 @@ var (
 	// contain the contents of the message
 	ErrShortBytes error = errShort{}
 
+	// ErrMaxDepth is returned when an object
+	// has maps and arrays nested more deeply
+	// than allowed (see MaxNestingDepth), which
+	// could otherwise overflow the stack.
+	ErrMaxDepth error = errMaxDepth{}
+
+	// ErrBadHeaderToken is returned when a
+	// Writer is asked to fill in a header
+	// that isn't pending on it, or to fill
+	// an array header as a map or vice versa.
+	ErrBadHeaderToken error = errBadHeaderToken{}
+
 	// this error is only returned
 	// if we reach code that should
 	// be unreachable
@@ -30,11 +42,57 @@ type Error interface {
 	Resumable() bool
 }
 
+type errBadHeaderToken struct{}
+
+func (e errBadHeaderToken) Error() string   { return "msgp: header token is not pending on this Writer" }
+func (e errBadHeaderToken) Resumable() bool { return false }
+
 type errShort struct{}
 
 func (e errShort) Error() string   { return "msgp: too few bytes left to read object" }
 func (e errShort) Resumable() bool { return false }
 
+// MaxNestingDepth is the deepest that maps
+// and arrays may be nested in an object
+// that is skipped or read generically,
+// unless a Reader is told otherwise with
+// SetMaxDepth.
+const MaxNestingDepth = 10000
+
+// DefaultMaxMapSize and DefaultMaxArraySize are
+// the largest maps and arrays that are decoded
+// unless the decoder is told otherwise, and
+// DefaultMaxStringSize the longest str or bin,
+// in bytes.
+const (
+	DefaultMaxMapSize    = 1 << 26
+	DefaultMaxArraySize  = 1 << 26
+	DefaultMaxStringSize = 1 << 30
+)
+
+// MaxPrealloc is the most elements that are
+// allocated for a map or an array before they
+// are read; past it, room is made as they
+// arrive. A header within the size limits can
+// still be a lie, and a short message mustn't
+// get a large allocation out of one.
+const MaxPrealloc = 1 << 10
+
+// Prealloc returns how many of the sz elements
+// a map or array header promises to allocate
+// room for up front. Generated code uses it.
+func Prealloc(sz uint32) int {
+	if sz > MaxPrealloc {
+		return MaxPrealloc
+	}
+	return int(sz)
+}
+
+type errMaxDepth struct{}
+
+func (e errMaxDepth) Error() string   { return "msgp: object is nested too deeply" }
+func (e errMaxDepth) Resumable() bool { return false }
+
 type errFatal struct{}
 
 func (f errFatal) Error() string   { return "msgp: fatal decoding error (unreachable code)" }
@@ -56,6 +114,56 @@ func (a ArrayError) Error() string {
 // Resumable is always 'true' for ArrayErrors
 func (a ArrayError) Resumable() bool { return true }
 
+// SizeLimitError is returned when a map or array
+// header declares more elements than the decoder
+// allows, or a str or bin header more bytes, so
+// that a few forged bytes can't make it allocate
+// gigabytes. See (*Reader).SetMaxMapSize,
+// (*Reader).SetMaxArraySize and
+// (*Reader).SetMaxStringSize.
+type SizeLimitError struct {
+	Type  Type   // MapType, ArrayType, StrType or BinType
+	Size  uint32 // the size declared on the wire
+	Limit int    // the largest size allowed
+}
+
+// Error implements the error interface
+func (s SizeLimitError) Error() string {
+	unit := "elements"
+	if s.Type == StrType || s.Type == BinType {
+		unit = "bytes"
+	}
+	return fmt.Sprintf("msgp: %s of %d %s exceeds the limit of %d", s.Type, s.Size, unit, s.Limit)
+}
+
+// Resumable is always 'false' for SizeLimitErrors,
+// since the elements that follow haven't been read.
+func (s SizeLimitError) Resumable() bool { return false }
+
+// checkSize returns a SizeLimitError
+// if sz is more than limit
+func checkSize(t Type, sz uint32, limit int) error {
+	if int64(sz) > int64(limit) {
+		return SizeLimitError{Type: t, Size: sz, Limit: limit}
+	}
+	return nil
+}
+
+// checkBytes returns a SizeLimitError if a str
+// or bin of sz bytes is longer than limit, or
+// ErrShortBytes if fewer than sz bytes are left.
+// The comparison is done in 64 bits, since sz
+// may not fit in an int on 32-bit platforms.
+func checkBytes(t Type, sz uint32, left int, limit int) error {
+	if err := checkSize(t, sz, limit); err != nil {
+		return err
+	}
+	if int64(sz) > int64(left) {
+		return ErrShortBytes
+	}
+	return nil
+}
+
 // IntOverflow is returned when a call
 // would downcast an integer to a type
 // with too few bits to hold its value.
@@ -88,17 +196,146 @@ func (u UintOverflow) Error() string {
 // Resumable is always 'true' for overflows
 func (u UintOverflow) Resumable() bool { return true }
 
+// EnumRangeError is returned when a field tagged
+// `msg:",enumcheck"` is decoded to a value outside
+// the range of the constants declared for its type.
+type EnumRangeError struct {
+	Type  string // the name of the enum type
+	Value int64  // the value decoded
+	Min   int64  // the smallest declared constant
+	Max   int64  // the largest declared constant
+}
+
+// Error implements the error interface
+func (e EnumRangeError) Error() string {
+	return fmt.Sprintf("msgp: %d is out of range [%d, %d] for %s", e.Value, e.Min, e.Max, e.Type)
+}
+
+// Resumable is always 'true' for EnumRangeErrors
+func (e EnumRangeError) Resumable() bool { return true }
+
+// EnumNameError is returned by the methods of a type
+// given in a //msgp:enum directive when encoding a
+// value that has no constant, or when decoding a
+// name that isn't one of its constants.
+type EnumNameError struct {
+	Type  string // the name of the enum type
+	Name  string // the name decoded, if decoding
+	Value int64  // the value encoded, if encoding
+}
+
+// Error implements the error interface
+func (e EnumNameError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("msgp: %q is not a constant of %s", e.Name, e.Type)
+	}
+	return fmt.Sprintf("msgp: %d is not a constant of %s", e.Value, e.Type)
+}
+
+// Resumable is always 'true' for EnumNameErrors
+func (e EnumNameError) Resumable() bool { return true }
+
+// ErrMissingField is returned when decoding a
+// map into a struct that has fields tagged
+// `msg:",required"`, and the map lacks their keys.
+type ErrMissingField struct {
+	Keys []string // the keys of the missing fields, in field order
+}
+
+// Error implements the error interface
+func (e ErrMissingField) Error() string {
+	if len(e.Keys) == 1 {
+		return fmt.Sprintf("msgp: required field %q is missing", e.Keys[0])
+	}
+	return fmt.Sprintf("msgp: required fields %q are missing", e.Keys)
+}
+
+// Resumable is always 'true' for ErrMissingField
+func (e ErrMissingField) Resumable() bool { return true }
+
+// ErrTrailingBytes is returned by UnmarshalExact
+// when bytes are left over after the object.
+type ErrTrailingBytes struct {
+	N int // how many bytes were left
+}
+
+// Error implements the error interface
+func (e ErrTrailingBytes) Error() string {
+	return fmt.Sprintf("msgp: %d trailing bytes after the object", e.N)
+}
+
+// Resumable is always 'true' for ErrTrailingBytes,
+// since the object itself was read in full
+func (e ErrTrailingBytes) Resumable() bool { return true }
+
+// OneOfError is returned when encoding or decoding
+// a struct whose fields tagged `msg:",oneof=group"`
+// don't have exactly one member of the group set.
+type OneOfError struct {
+	Group string // the name of the group
+	Set   int    // how many of its fields were set
+}
+
+// Error implements the error interface
+func (e OneOfError) Error() string {
+	return fmt.Sprintf("msgp: %d fields of oneof group %q are set; want exactly 1", e.Set, e.Group)
+}
+
+// Resumable is always 'true' for OneOfErrors
+func (e OneOfError) Resumable() bool { return true }
+
 // A TypeError is returned when a particular
 // decoding method is unsuitable for decoding
 // a particular MessagePack value.
 type TypeError struct {
 	Method  Type // Type expected by method
 	Encoded Type // Type actually encoded
+
+	// Offset is where the value starts in the input:
+	// the number of bytes a Reader had consumed before
+	// it, or its position in the buffer passed to
+	// UnmarshalMsg (see WithOffset). It is only set
+	// when HasOffset is true.
+	Offset    int
+	HasOffset bool
+}
+
+// atOffset returns t at offset 'off',
+// unless 'off' is -1 for unknown
+func (t TypeError) atOffset(off int) TypeError {
+	if off >= 0 {
+		t.Offset, t.HasOffset = off, true
+	}
+	return t
 }
 
 // Error implements the error interface
 func (t TypeError) Error() string {
-	return fmt.Sprintf("msgp: attempted to decode type %q with method for %q", t.Encoded, t.Method)
+	if !t.HasOffset {
+		return fmt.Sprintf("msgp: attempted to decode type %q with method for %q", t.Encoded, t.Method)
+	}
+	return fmt.Sprintf("msgp: attempted to decode type %q with method for %q at offset %d", t.Encoded, t.Method, t.Offset)
+}
+
+// WithOffset fills in the Offset of err, if it
+// is a TypeError returned while decoding 'b' with
+// the Read*Bytes functions. 'left' is the slice
+// that the failed call returned, which starts
+// at the value that had the wrong type; its
+// position in 'b' is the Offset. Any other error,
+// or a 'left' that isn't the tail of 'b', is
+// returned unchanged. The generated UnmarshalMsg
+// methods do this themselves.
+func WithOffset(err error, b, left []byte) error {
+	t, ok := err.(TypeError)
+	if !ok || len(left) == 0 || len(left) > len(b) {
+		return err
+	}
+	at := len(b) - len(left)
+	if &b[at] != &left[0] {
+		return err
+	}
+	return t.atOffset(at)
 }
 
 // Resumable returns 'true' for TypeErrors
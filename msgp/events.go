@@ -0,0 +1,295 @@
+package msgp
+
+import (
+	"errors"
+	"time"
+)
+
+// SkipValue may be returned by a Handler to skip
+// part of the input without decoding it. Returned
+// from OnMapKey, it skips the value for that key,
+// as it does from the event for a key that isn't a
+// string (the OnMapEnd or OnArrayEnd of a key that
+// is a map or array); returned from OnMapStart or
+// OnArrayStart, it skips the contents of the map or
+// array, and the matching OnMapEnd or OnArrayEnd is
+// not called. Returned from any other method, it is
+// treated like a nil error.
+var SkipValue = errors.New("msgp: skip this value")
+
+// Handler receives the events produced by
+// DecodeEvents as it walks an object.
+//
+// Strings, []byte values and map keys passed
+// to a Handler point into a scratch buffer
+// that is re-used for the next event, so they
+// are only valid until the method returns.
+// Copy them to keep them.
+//
+// Returning a non-nil error other than SkipValue
+// stops DecodeEvents, which returns that error.
+type Handler interface {
+	OnNil() error
+	OnBool(b bool) error
+	OnInt(i int64) error
+	OnUint(u uint64) error
+	OnFloat(f float64) error
+	OnComplex(c complex128) error
+	OnString(s string) error
+	OnBytes(b []byte) error
+	OnTime(t time.Time) error
+	OnExtension(e *RawExtension) error
+
+	OnMapStart(n uint32) error
+	OnMapKey(key string) error
+	OnMapEnd() error
+
+	OnArrayStart(n uint32) error
+	OnArrayEnd() error
+}
+
+// NopHandler implements every Handler method
+// by doing nothing. Embed it in a struct to
+// write a Handler that only cares about a
+// few kinds of event.
+type NopHandler struct{}
+
+func (NopHandler) OnNil() error                      { return nil }
+func (NopHandler) OnBool(b bool) error               { return nil }
+func (NopHandler) OnInt(i int64) error               { return nil }
+func (NopHandler) OnUint(u uint64) error             { return nil }
+func (NopHandler) OnFloat(f float64) error           { return nil }
+func (NopHandler) OnComplex(c complex128) error      { return nil }
+func (NopHandler) OnString(s string) error           { return nil }
+func (NopHandler) OnBytes(b []byte) error            { return nil }
+func (NopHandler) OnTime(t time.Time) error          { return nil }
+func (NopHandler) OnExtension(e *RawExtension) error { return nil }
+func (NopHandler) OnMapStart(n uint32) error         { return nil }
+func (NopHandler) OnMapKey(key string) error         { return nil }
+func (NopHandler) OnMapEnd() error                   { return nil }
+func (NopHandler) OnArrayStart(n uint32) error       { return nil }
+func (NopHandler) OnArrayEnd() error                 { return nil }
+
+// DecodeEvents reads the next object from r and
+// calls the methods of h for each value in it, in
+// the order they appear on the wire, without building
+// the object in memory. Maps and arrays produce a start
+// event, then events for their contents, then an end
+// event. Map keys that are a 'str' or 'bin' are passed
+// to OnMapKey; any other key produces the same event(s)
+// it would as a value.
+//
+// Integers are passed to OnInt and unsigned integers
+// to OnUint, whatever their size on the wire. Float32s
+// are widened and passed to OnFloat, and likewise
+// complex64s to OnComplex. Extensions other than
+// time.Time and complex numbers are passed to OnExtension
+// undecoded, even if their type is registered.
+//
+// Maps and arrays nested more deeply than r allows
+// (see SetMaxDepth) return ErrMaxDepth.
+func DecodeEvents(r *Reader, h Handler) error {
+	var scratch []byte
+	return r.nextEvent(h, &scratch, 0)
+}
+
+// nextEvent calls the methods of h for
+// the next object, at nesting depth 'depth'
+func (m *Reader) nextEvent(h Handler, scratch *[]byte, depth int) error {
+	err := m.event(h, scratch, depth)
+	if err == SkipValue {
+		err = nil
+	}
+	return err
+}
+
+// event is nextEvent, except that it passes
+// on a SkipValue from the last method of h
+// that it called, for a map key
+func (m *Reader) event(h Handler, scratch *[]byte, depth int) (err error) {
+	var t Type
+	t, err = m.NextType()
+	if err != nil {
+		return
+	}
+	switch t {
+	case NilType:
+		err = m.ReadNil()
+		if err == nil {
+			err = h.OnNil()
+		}
+
+	case BoolType:
+		var b bool
+		b, err = m.ReadBool()
+		if err == nil {
+			err = h.OnBool(b)
+		}
+
+	case Int8Type, Int16Type, Int32Type, Int64Type:
+		var i int64
+		i, err = m.ReadInt64()
+		if err == nil {
+			err = h.OnInt(i)
+		}
+
+	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
+		var u uint64
+		u, err = m.ReadUint64()
+		if err == nil {
+			err = h.OnUint(u)
+		}
+
+	case Float32Type:
+		var f float32
+		f, err = m.ReadFloat32()
+		if err == nil {
+			err = h.OnFloat(float64(f))
+		}
+
+	case Float64Type:
+		var f float64
+		f, err = m.ReadFloat64()
+		if err == nil {
+			err = h.OnFloat(f)
+		}
+
+	case Complex64Type:
+		var c complex64
+		c, err = m.ReadComplex64()
+		if err == nil {
+			err = h.OnComplex(complex128(c))
+		}
+
+	case Complex128Type:
+		var c complex128
+		c, err = m.ReadComplex128()
+		if err == nil {
+			err = h.OnComplex(c)
+		}
+
+	case StrType:
+		*scratch, err = m.ReadStringAsBytes((*scratch)[:0])
+		if err == nil {
+			err = h.OnString(UnsafeString(*scratch))
+		}
+
+	case BinType:
+		*scratch, err = m.ReadBytes((*scratch)[:0])
+		if err == nil {
+			err = h.OnBytes(*scratch)
+		}
+
+	case TimeType:
+		var tm time.Time
+		tm, err = m.ReadTime()
+		if err == nil {
+			err = h.OnTime(tm)
+		}
+
+	case ExtensionType:
+		var e RawExtension
+		e.Type, err = m.peekExtensionType()
+		if err != nil {
+			return
+		}
+		err = m.ReadExtension(&e)
+		if err == nil {
+			err = h.OnExtension(&e)
+		}
+
+	case MapType:
+		return m.mapEvents(h, scratch, depth)
+
+	case ArrayType:
+		return m.arrayEvents(h, scratch, depth)
+
+	default:
+		return fatal
+	}
+	return
+}
+
+func (m *Reader) mapEvents(h Handler, scratch *[]byte, depth int) error {
+	sz, err := m.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	if sz > 0 && depth >= m.depthLimit() {
+		return ErrMaxDepth
+	}
+	err = h.OnMapStart(sz)
+	if err == SkipValue {
+		return m.skipN(2*uint64(sz), depth+1)
+	}
+	if err != nil {
+		return err
+	}
+	var t Type
+	for i := uint32(0); i < sz; i++ {
+		t, err = m.NextType()
+		if err != nil {
+			return err
+		}
+		if t == StrType || t == BinType {
+			*scratch, err = m.ReadMapKey((*scratch)[:0])
+			if err != nil {
+				return err
+			}
+			err = h.OnMapKey(UnsafeString(*scratch))
+		} else {
+			err = m.event(h, scratch, depth+1)
+		}
+		if err == SkipValue {
+			err = m.skip(depth + 1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = m.nextEvent(h, scratch, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return h.OnMapEnd()
+}
+
+func (m *Reader) arrayEvents(h Handler, scratch *[]byte, depth int) error {
+	sz, err := m.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz > 0 && depth >= m.depthLimit() {
+		return ErrMaxDepth
+	}
+	err = h.OnArrayStart(sz)
+	if err == SkipValue {
+		return m.skipN(uint64(sz), depth+1)
+	}
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < sz; i++ {
+		err = m.nextEvent(h, scratch, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return h.OnArrayEnd()
+}
+
+// skipN skips the next n objects,
+// which are at nesting depth 'depth'
+func (m *Reader) skipN(n uint64, depth int) error {
+	for ; n > 0; n-- {
+		err := m.skip(depth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
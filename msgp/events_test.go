@@ -0,0 +1,181 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// collects the "name" of every element
+// of "users", skipping "blob" entirely
+type namesHandler struct {
+	NopHandler
+	depth   int
+	key     string
+	inUsers bool
+	names   []string
+	ages    []int64
+}
+
+func (h *namesHandler) OnMapStart(n uint32) error {
+	h.depth++
+	return nil
+}
+
+func (h *namesHandler) OnMapEnd() error {
+	h.depth--
+	return nil
+}
+
+func (h *namesHandler) OnMapKey(key string) error {
+	if key == "blob" {
+		return SkipValue
+	}
+	h.key = string([]byte(key))
+	if h.depth == 1 {
+		h.inUsers = key == "users"
+	}
+	return nil
+}
+
+func (h *namesHandler) OnString(s string) error {
+	if h.inUsers && h.depth == 2 && h.key == "name" {
+		h.names = append(h.names, string([]byte(s)))
+	}
+	return nil
+}
+
+func (h *namesHandler) OnInt(i int64) error {
+	if h.inUsers && h.depth == 2 && h.key == "age" {
+		h.ages = append(h.ages, i)
+	}
+	return nil
+}
+
+func (h *namesHandler) OnBytes(b []byte) error {
+	panic("blob should have been skipped")
+}
+
+func TestDecodeEvents(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(3)
+	en.WriteString("blob")
+	en.WriteBytes(make([]byte, 1024))
+	en.WriteString("users")
+	en.WriteArrayHeader(2)
+	for i, name := range []string{"alice", "bob"} {
+		en.WriteMapHeader(3)
+		en.WriteString("name")
+		en.WriteString(name)
+		en.WriteString("age")
+		en.WriteInt(30 + i)
+		en.WriteString("tags")
+		en.WriteArrayHeader(1)
+		en.WriteString("not-a-name")
+	}
+	en.WriteString("name")
+	en.WriteString("top-level, not a user")
+	en.Flush()
+
+	var h namesHandler
+	err := DecodeEvents(NewReader(&buf), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.names) != 2 || h.names[0] != "alice" || h.names[1] != "bob" {
+		t.Errorf("got names %q", h.names)
+	}
+	if len(h.ages) != 2 || h.ages[0] != 30 || h.ages[1] != 31 {
+		t.Errorf("got ages %v", h.ages)
+	}
+	if h.depth != 0 {
+		t.Errorf("unbalanced map events; depth %d at the end", h.depth)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left unread", buf.Len())
+	}
+}
+
+// returns SkipValue from every End event,
+// and for the int keys it is told to
+type skipHandler struct {
+	NopHandler
+	skipKey int64
+	ints    []int64
+	strs    []string
+}
+
+func (h *skipHandler) OnMapEnd() error   { return SkipValue }
+func (h *skipHandler) OnArrayEnd() error { return SkipValue }
+
+func (h *skipHandler) OnInt(i int64) error {
+	if i == h.skipKey {
+		return SkipValue
+	}
+	h.ints = append(h.ints, i)
+	return nil
+}
+
+func (h *skipHandler) OnString(s string) error {
+	h.strs = append(h.strs, string([]byte(s)))
+	return nil
+}
+
+func TestDecodeEventsSkipValue(t *testing.T) {
+	// {1: "one", 2: "two", [3]: "three", "k": "v"}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(4)
+	en.WriteInt64(1)
+	en.WriteString("one")
+	en.WriteInt64(2)
+	en.WriteString("two")
+	en.WriteArrayHeader(1)
+	en.WriteInt64(3)
+	en.WriteString("three")
+	en.WriteString("k")
+	en.WriteString("v")
+	en.Flush()
+
+	// SkipValue from the event for a key skips
+	// its value, whether the key is a scalar or
+	// an array; from the end of the outer map,
+	// it is no error
+	h := skipHandler{skipKey: 2}
+	err := DecodeEvents(NewReader(&buf), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.ints) != 2 || h.ints[0] != 1 || h.ints[1] != 3 {
+		t.Errorf("got ints %v", h.ints)
+	}
+	if len(h.strs) != 2 || h.strs[0] != "one" || h.strs[1] != "v" {
+		t.Errorf("got strings %q", h.strs)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left unread", buf.Len())
+	}
+}
+
+func TestDecodeEventsMaxDepth(t *testing.T) {
+	// arrays nested one deeper than the limit
+	const limit = 10
+	var b []byte
+	for i := 0; i <= limit; i++ {
+		b = AppendArrayHeader(b, 1)
+	}
+	b = AppendNil(b)
+
+	rd := NewReaderBytes(b)
+	rd.SetMaxDepth(limit)
+	if err := DecodeEvents(rd, NopHandler{}); err != ErrMaxDepth {
+		t.Errorf("got %v; want ErrMaxDepth", err)
+	}
+
+	// and just within it
+	rd = NewReaderBytes(b[1:])
+	rd.SetMaxDepth(limit)
+	if err := DecodeEvents(rd, NopHandler{}); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
@@ -14,6 +14,11 @@ const (
 
 	// TimeExtension is the extension number used for time.Time
 	TimeExtension = 5
+
+	// TimestampExtension is the extension number that the
+	// MessagePack spec sets aside for timestamps, which
+	// WriteTimeExt and AppendTimeExt use for time.Time
+	TimestampExtension = -1
 )
 
 // our extensions live here
@@ -30,14 +35,14 @@ var extensionReg = make(map[int8]func() Extension)
 //
 // For example, if you wanted to register a user-defined struct:
 //
-//  msgp.RegisterExtension(10, func() msgp.Extension { &MyExtension{} })
+//  msgp.RegisterExtension(10, func() msgp.Extension { return &MyExtension{} })
 //
 // RegisterExtension will panic if you call it multiple times
 // with the same 'typ' argument, or if you use a reserved
 // type (3, 4, or 5).
 func RegisterExtension(typ int8, f func() Extension) {
 	switch typ {
-	case Complex64Extension, Complex128Extension, TimeExtension:
+	case Complex64Extension, Complex128Extension, TimeExtension, TimestampExtension:
 		panic(fmt.Sprint("msgp: forbidden extension type:", typ))
 	}
 	if _, ok := extensionReg[typ]; ok {
@@ -199,12 +204,16 @@ func (mw *Writer) WriteExtension(e Extension) error {
 	// we can only write directly to the
 	// buffer if we're sure that it
 	// fits the object
+	if len(mw.pending) > 0 && mw.avail() < l {
+		// a reserved header pins the buffer
+		mw.grow(l)
+	}
 	if l <= mw.bufsize() {
 		o, err := mw.require(l)
 		if err != nil {
 			return err
 		}
-		return e.MarshalBinaryTo(mw.buf[o:])
+		return mw.Fail(e.MarshalBinaryTo(mw.buf[o:]))
 	}
 	// here we create a new buffer
 	// just large enough for the body
@@ -216,7 +225,7 @@ func (mw *Writer) WriteExtension(e Extension) error {
 	buf := make([]byte, l)
 	err = e.MarshalBinaryTo(buf)
 	if err != nil {
-		return err
+		return mw.Fail(err)
 	}
 	mw.buf = buf
 	mw.wloc = l
@@ -232,7 +241,7 @@ func (m *Reader) peekExtensionType() (int8, error) {
 	}
 	spec := sizes[p[0]]
 	if spec.typ != ExtensionType {
-		return 0, badPrefix(ExtensionType, p[0])
+		return 0, m.badPrefix(ExtensionType, p[0])
 	}
 	if spec.extra == constsize {
 		return int8(p[1]), nil
@@ -393,7 +402,7 @@ func (m *Reader) ReadExtension(e Extension) (err error) {
 		off = 6
 
 	default:
-		err = badPrefix(ExtensionType, lead)
+		err = m.badPrefix(ExtensionType, lead)
 		return
 	}
 
@@ -445,26 +454,27 @@ func AppendExtension(b []byte, e Extension) ([]byte, error) {
 		o[n] = mfixext16
 		o[n+1] = byte(e.ExtensionType())
 		n += 2
-	}
-	switch {
-	case l < math.MaxUint8:
-		o, n = ensure(b, l+3)
-		o[n] = mext8
-		o[n+1] = byte(uint8(l))
-		o[n+2] = byte(e.ExtensionType())
-		n += 3
-	case l < math.MaxUint16:
-		o, n = ensure(b, l+4)
-		o[n] = mext16
-		big.PutUint16(o[n+1:], uint16(l))
-		o[n+3] = byte(e.ExtensionType())
-		n += 4
 	default:
-		o, n = ensure(b, l+6)
-		o[n] = mext32
-		big.PutUint32(o[n+1:], uint32(l))
-		o[n+5] = byte(e.ExtensionType())
-		n += 6
+		switch {
+		case l < math.MaxUint8:
+			o, n = ensure(b, l+3)
+			o[n] = mext8
+			o[n+1] = byte(uint8(l))
+			o[n+2] = byte(e.ExtensionType())
+			n += 3
+		case l < math.MaxUint16:
+			o, n = ensure(b, l+4)
+			o[n] = mext16
+			big.PutUint16(o[n+1:], uint16(l))
+			o[n+3] = byte(e.ExtensionType())
+			n += 4
+		default:
+			o, n = ensure(b, l+6)
+			o[n] = mext32
+			big.PutUint32(o[n+1:], uint32(l))
+			o[n+5] = byte(e.ExtensionType())
+			n += 6
+		}
 	}
 	return o, e.MarshalBinaryTo(o[n:])
 }
@@ -535,7 +545,7 @@ func (nbs *NilBitsStack) ReadExtensionBytes(b []byte, e Extension) ([]byte, erro
 		typ = int8(b[5])
 		off = 6
 	default:
-		return b, badPrefix(ExtensionType, lead)
+		return b, badPrefix(ExtensionType, b[0])
 	}
 
 	if typ != e.ExtensionType() {
@@ -2,7 +2,9 @@ package msgp
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -49,3 +51,95 @@ func TestReadWriteExtensionBytes(t *testing.T) {
 		}
 	}
 }
+
+// uuid is an example of a user-defined extension:
+// a 16-byte UUID, registered as extension type 42
+type uuid [16]byte
+
+const uuidExtension = 42
+
+func init() {
+	RegisterExtension(uuidExtension, func() Extension { return new(uuid) })
+}
+
+func (u *uuid) ExtensionType() int8 { return uuidExtension }
+
+func (u *uuid) Len() int { return 16 }
+
+func (u *uuid) MarshalBinaryTo(b []byte) error {
+	copy(b, u[:])
+	return nil
+}
+
+func (u *uuid) UnmarshalBinary(b []byte) error {
+	if len(b) != 16 {
+		return errors.New("uuid: need 16 bytes")
+	}
+	copy(u[:], b)
+	return nil
+}
+
+func TestRegisteredExtension(t *testing.T) {
+	in := uuid{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	if err := en.WriteExtension(&in); err != nil {
+		t.Fatal(err)
+	}
+	en.Flush()
+	bts := buf.Bytes()
+	// 16 bytes of data fit a fixext16
+	if len(bts) != 18 || bts[0] != mfixext16 || int8(bts[1]) != uuidExtension {
+		t.Fatalf("wrote % x", bts)
+	}
+
+	var out uuid
+	if err := NewReaderBytes(bts).ReadExtension(&out); err != nil || out != in {
+		t.Errorf("ReadExtension: got %x, %v", out, err)
+	}
+	out = uuid{}
+	if _, err := nbs.ReadExtensionBytes(bts, &out); err != nil || out != in {
+		t.Errorf("ReadExtensionBytes: got %x, %v", out, err)
+	}
+	if app, err := AppendExtension(nil, &in); err != nil || !bytes.Equal(app, bts) {
+		t.Errorf("AppendExtension wrote % x, %v", app, err)
+	}
+
+	// a registered extension is decoded
+	// by type when read generically
+	v, err := NewReaderBytes(bts).ReadIntf()
+	if err != nil || !reflect.DeepEqual(v, &in) {
+		t.Errorf("ReadIntf: got %#v, %v", v, err)
+	}
+	v, _, err = nbs.ReadIntfBytes(bts)
+	if err != nil || !reflect.DeepEqual(v, &in) {
+		t.Errorf("ReadIntfBytes: got %#v, %v", v, err)
+	}
+
+	// and reading it as another extension fails
+	var raw RawExtension
+	raw.Type = uuidExtension + 1
+	err = NewReaderBytes(bts).ReadExtension(&raw)
+	if _, ok := err.(ExtensionTypeError); !ok {
+		t.Errorf("got %v; want an ExtensionTypeError", err)
+	}
+}
+
+func TestAppendExtensionMatchesWrite(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	for _, sz := range extSizes {
+		e := RawExtension{Type: 9, Data: RandBytes(sz)}
+		buf.Reset()
+		en.WriteExtension(&e)
+		en.Flush()
+		app, err := AppendExtension(nil, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(app, buf.Bytes()) {
+			t.Errorf("size %d: AppendExtension and WriteExtension disagree", sz)
+		}
+	}
+}
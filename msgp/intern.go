@@ -0,0 +1,69 @@
+package msgp
+
+// DefaultMaxInterned is the number of strings
+// an Interner from NewInterner(0) holds.
+const DefaultMaxInterned = 4096
+
+// maxInternLen is the longest string an Interner
+// keeps; longer ones are seldom repeated, and
+// would make the Interner costly to hold on to.
+const maxInternLen = 64
+
+// Interner hands out one shared copy of each
+// distinct string it is given, so that decoding
+// many messages with the same map keys, or the
+// same few string values, allocates each of them
+// once rather than once per message. Give one to
+// a Reader with SetInterner, or to UnmarshalMsgWithCfg
+// in RuntimeConfig.Interner. See DecodeStats for
+// whether it is likely to pay off.
+//
+// An Interner is bounded: once it holds its
+// maximum number of strings, others are copied
+// as if there were no Interner, until Reset
+// empties it. Strings longer than 64 bytes are
+// never kept. An Interner is not safe for
+// concurrent use.
+type Interner struct {
+	max  int
+	strs map[string]string
+}
+
+// NewInterner returns an Interner that holds at
+// most max strings, or DefaultMaxInterned if max
+// is 0 or less.
+func NewInterner(max int) *Interner {
+	if max <= 0 {
+		max = DefaultMaxInterned
+	}
+	return &Interner{max: max, strs: make(map[string]string)}
+}
+
+// Intern returns a string equal to b, which is
+// the one returned before for the same bytes if
+// the Interner holds it. 'b' is not retained.
+func (in *Interner) Intern(b []byte) string {
+	// the compiler doesn't allocate for
+	// a map lookup by string(b)
+	if s, ok := in.strs[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(b) <= maxInternLen && len(in.strs) < in.max {
+		in.strs[s] = s
+	}
+	return s
+}
+
+// Len returns the number of strings held.
+func (in *Interner) Len() int {
+	return len(in.strs)
+}
+
+// Reset empties the Interner, so that it can
+// take in a new set of strings.
+func (in *Interner) Reset() {
+	for s := range in.strs {
+		delete(in.strs, s)
+	}
+}
@@ -0,0 +1,176 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// sameString returns whether a and b share their bytes
+func sameString(a, b string) bool {
+	ha := (*reflect.StringHeader)(unsafe.Pointer(&a))
+	hb := (*reflect.StringHeader)(unsafe.Pointer(&b))
+	return ha.Data == hb.Data && ha.Len == hb.Len
+}
+
+func TestInterner(t *testing.T) {
+	in := NewInterner(2)
+	first := in.Intern([]byte("key"))
+	again := in.Intern([]byte("key"))
+	if first != "key" || !sameString(first, again) {
+		t.Errorf("Intern gave %q and then a separate %q", first, again)
+	}
+
+	// equal strings from distinct buffers are one string
+	other := in.Intern(append([]byte(nil), 'k', 'e', 'y'))
+	if !sameString(first, other) {
+		t.Error("equal bytes from another buffer were not interned")
+	}
+
+	// the bytes passed in are not kept
+	b := []byte("mutable")
+	s := in.Intern(b)
+	copy(b, "CHANGED")
+	if s != "mutable" {
+		t.Errorf("changing the input changed the interned string to %q", s)
+	}
+
+	// once full, new strings are copied but not kept
+	if n := in.Len(); n != 2 {
+		t.Fatalf("Len() = %d; want 2", n)
+	}
+	full := in.Intern([]byte("third"))
+	if full != "third" || in.Len() != 2 {
+		t.Errorf("a full Interner gave %q and grew to %d", full, in.Len())
+	}
+
+	in.Reset()
+	if in.Len() != 0 {
+		t.Errorf("Len() = %d after Reset", in.Len())
+	}
+	long := bytes.Repeat([]byte("x"), maxInternLen+1)
+	if s := in.Intern(long); s != string(long) || in.Len() != 0 {
+		t.Errorf("a %d-byte string was kept", len(long))
+	}
+}
+
+func TestReaderInterner(t *testing.T) {
+	words := []string{"alpha", "beta", "alpha", "", "beta", "alpha"}
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteArrayHeader(uint32(len(words)))
+	for _, w := range words {
+		wr.WriteString(w)
+	}
+	long := string(bytes.Repeat([]byte("y"), 100))
+	wr.WriteString(long)
+	wr.Flush()
+	data := buf.Bytes()
+
+	in := NewInterner(0)
+	check := func(how string, read func() (string, error)) {
+		var got []string
+		for range words {
+			s, err := read()
+			if err != nil {
+				t.Fatalf("%s: %v", how, err)
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, words) {
+			t.Errorf("%s: got %q; want %q", how, got, words)
+		}
+		if !sameString(got[0], got[2]) || !sameString(got[1], got[4]) {
+			t.Errorf("%s: repeated strings were not shared", how)
+		}
+		s, err := read()
+		if err != nil || s != long {
+			t.Errorf("%s: the long string read back as %q, %v", how, s, err)
+		}
+	}
+
+	rd := NewReaderBytes(data)
+	rd.SetInterner(in)
+	if _, err := rd.ReadArrayHeader(); err != nil {
+		t.Fatal(err)
+	}
+	check("ReadString", rd.ReadString)
+
+	nbs := &NilBitsStack{Interner: in}
+	_, rest, err := nbs.ReadArrayHeaderBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("ReadStringBytes", func() (s string, err error) {
+		s, rest, err = nbs.ReadStringBytes(rest)
+		return
+	})
+
+	// the Reader and the NilBitsStack share the same copies
+	rd.ResetBytes(data)
+	rd.ReadArrayHeader()
+	a, _ := rd.ReadString()
+	_, rest, _ = nbs.ReadArrayHeaderBytes(data)
+	b, _, _ := nbs.ReadStringBytes(rest)
+	if !sameString(a, b) {
+		t.Error("ReadString and ReadStringBytes gave separate copies")
+	}
+}
+
+func TestRecycleDropsInterner(t *testing.T) {
+	data := AppendString(nil, "pooled")
+	in := NewInterner(0)
+	rd := NewReaderBytes(data)
+	rd.SetInterner(in)
+	if _, err := rd.ReadString(); err != nil {
+		t.Fatal(err)
+	}
+	rd.Recycle()
+	if rd.interner != nil {
+		t.Error("Recycle kept the Interner")
+	}
+	in.Reset()
+
+	// whichever Reader the pool hands out next
+	// must not intern into the old one's Interner
+	for i := 0; i < 4; i++ {
+		rd = NewReaderBytes(data)
+		if _, err := rd.ReadString(); err != nil {
+			t.Fatal(err)
+		}
+		rd.Recycle()
+	}
+	if in.Len() != 0 {
+		t.Errorf("a pooled Reader interned %d strings after Recycle", in.Len())
+	}
+}
+
+func benchmarkReadStringInterner(b *testing.B, in *Interner) {
+	keys := []string{"id", "name", "created_at", "updated_at", "owner", "status", "tags", "kind"}
+	var data []byte
+	for _, k := range keys {
+		data = AppendString(data, k)
+	}
+	rd := NewReaderBytes(data)
+	rd.SetInterner(in)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rd.ResetBytes(data)
+		for range keys {
+			if _, err := rd.ReadString(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkReadStringNoInterner(b *testing.B) {
+	benchmarkReadStringInterner(b, nil)
+}
+
+func BenchmarkReadStringInterner(b *testing.B) {
+	benchmarkReadStringInterner(b, NewInterner(0))
+}
@@ -55,7 +55,11 @@ type jsWriter interface {
 }
 
 // CopyToJSON reads MessagePack from 'src' and copies it
-// as JSON to 'dst' until EOF.
+// as JSON to 'dst' until EOF. 'bin' objects are written
+// as base64 strings. Map keys that are numbers, bools or
+// nil are written as strings, since JSON has no other
+// kind of key; a key that is a map, array, time or
+// extension is an error.
 func CopyToJSON(dst io.Writer, src io.Reader) (n int64, err error) {
 	r := NewReader(src)
 	n, err = r.WriteToJSON(dst)
@@ -130,11 +134,7 @@ func rwMap(dst jsWriter, src *Reader) (n int, err error) {
 			n++
 		}
 
-		field, err = src.ReadMapKeyPtr()
-		if err != nil {
-			return
-		}
-		nn, err = rwquoted(dst, field)
+		field, nn, err = rwMapKey(dst, src, field)
 		n += nn
 		if err != nil {
 			return
@@ -163,6 +163,42 @@ func rwMap(dst jsWriter, src *Reader) (n int, err error) {
 	return
 }
 
+// rwMapKey writes the next map key as a JSON
+// object key. JSON keys are always strings, so
+// numbers, bools and nil are written in quotes,
+// like encoding/json does for map[int]T; any other
+// kind of key returns a TypeError. 'scratch'
+// is returned for re-use.
+func rwMapKey(dst jsWriter, src *Reader, scratch []byte) ([]byte, int, error) {
+	t, err := src.NextType()
+	if err != nil {
+		return scratch, 0, err
+	}
+	switch t {
+	case StrType, BinType:
+		scratch, err = src.ReadMapKey(scratch[:0])
+		if err != nil {
+			return scratch, 0, err
+		}
+		n, err := rwquoted(dst, scratch)
+		return scratch, n, err
+	case Int8Type, Int16Type, Int32Type, Int64Type,
+		Uint8Type, Uint16Type, Uint32Type, Uint64Type,
+		Float32Type, Float64Type, BoolType, NilType:
+		err = dst.WriteByte('"')
+		if err != nil {
+			return scratch, 0, err
+		}
+		n, err := defuns[t](dst, src)
+		if err != nil {
+			return scratch, n + 1, err
+		}
+		return scratch, n + 2, dst.WriteByte('"')
+	default:
+		return scratch, 0, TypeError{Method: StrType, Encoded: t}.atOffset(src.offset())
+	}
+}
+
 func rwArray(dst jsWriter, src *Reader) (n int, err error) {
 	err = dst.WriteByte('[')
 	if err != nil {
@@ -212,7 +248,10 @@ func rwFloat32(dst jsWriter, src *Reader) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	src.scratch = strconv.AppendFloat(src.scratch[:0], float64(f), 'f', -1, 64)
+	if !finite(float64(f)) {
+		return rwNonFinite(dst)
+	}
+	src.scratch = strconv.AppendFloat(src.scratch[:0], float64(f), 'f', -1, 32)
 	return dst.Write(src.scratch)
 }
 
@@ -221,10 +260,22 @@ func rwFloat64(dst jsWriter, src *Reader) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	src.scratch = strconv.AppendFloat(src.scratch[:0], f, 'f', -1, 32)
+	if !finite(f) {
+		return rwNonFinite(dst)
+	}
+	src.scratch = strconv.AppendFloat(src.scratch[:0], f, 'f', -1, 64)
 	return dst.Write(src.scratch)
 }
 
+// rwNonFinite writes a NaN or an infinity
+// as NonFiniteJSON says to
+func rwNonFinite(dst jsWriter) (int, error) {
+	if NonFiniteJSON == NonFiniteError {
+		return 0, ErrNonFiniteJSON
+	}
+	return dst.Write(null)
+}
+
 func rwInt(dst jsWriter, src *Reader) (int, error) {
 	i, err := src.ReadInt64()
 	if err != nil {
@@ -372,7 +423,7 @@ func rwString(dst jsWriter, src *Reader) (n int, err error) {
 		}
 		read = int(big.Uint32(p[1:]))
 	default:
-		err = badPrefix(StrType, lead)
+		err = src.badPrefix(StrType, lead)
 		return
 	}
 write:
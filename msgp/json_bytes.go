@@ -79,7 +79,7 @@ func writeNext(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, error) {
 		if err != nil {
 			return nil, scratch, err
 		}
-		if et == TimeExtension {
+		if et == TimeExtension || et == TimestampExtension {
 			t = TimeType
 		}
 	}
@@ -311,7 +311,7 @@ func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, e
 	}
 
 	// if it's time.Time
-	if et == TimeExtension {
+	if et == TimeExtension || et == TimestampExtension {
 		var tm time.Time
 		tm, msg, err = nbs.ReadTimeBytes(msg)
 		if err != nil {
@@ -0,0 +1,178 @@
+package msgp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONSyntaxError is returned when JSON
+// being translated to MessagePack is malformed.
+type JSONSyntaxError struct {
+	Err error // the error reported by encoding/json
+}
+
+// Error implements the error interface
+func (j JSONSyntaxError) Error() string {
+	return fmt.Sprintf("msgp: invalid JSON: %s", j.Err)
+}
+
+// Resumable is always 'false' for JSONSyntaxErrors
+func (j JSONSyntaxError) Resumable() bool { return false }
+
+// WriteRawJSON translates the JSON document 'js'
+// and writes it as the equivalent MessagePack at the
+// current position, so that pre-existing JSON can be
+// spliced into a MessagePack stream. Objects become
+// maps, and numbers become ints, uints or float64s,
+// whichever is the narrowest that holds them exactly.
+// If 'js' isn't a single valid JSON value, a
+// JSONSyntaxError is returned, nothing is written,
+// and the Writer keeps the error, as for any
+// failed write.
+func (mw *Writer) WriteRawJSON(js []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	o, err := appendJSONValue(nil, dec)
+	if err != nil {
+		return mw.Fail(err)
+	}
+	// there must be nothing but
+	// whitespace after the value
+	if _, err = dec.Token(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("unexpected data after the top-level value")
+		}
+		return mw.Fail(JSONSyntaxError{Err: err})
+	}
+	_, err = mw.Write(o)
+	return err
+}
+
+// CopyFromJSON reads JSON values from 'src' until EOF
+// and writes each one to 'dst' as MessagePack, the same
+// way WriteRawJSON does, so that it undoes CopyToJSON.
+// The values may be separated by whitespace. It returns
+// the number of bytes written. If the JSON is malformed,
+// the error is a JSONSyntaxError, and the values before
+// the bad one have already been written.
+func CopyFromJSON(dst io.Writer, src io.Reader) (n int64, err error) {
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	var o []byte
+	var nn int
+	for dec.More() {
+		o, err = appendJSONValue(o[:0], dec)
+		if err != nil {
+			return
+		}
+		nn, err = dst.Write(o)
+		n += int64(nn)
+		if err != nil {
+			return
+		}
+	}
+	// More also stops at a stray ']' or '}'
+	if _, err = dec.Token(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("unexpected delimiter")
+		}
+		return n, JSONSyntaxError{Err: err}
+	}
+	return n, nil
+}
+
+// appendJSONValue appends the next JSON value
+// from dec as MessagePack. dec must have been
+// set to UseNumber.
+func appendJSONValue(b []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return b, JSONSyntaxError{Err: err}
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			return appendJSONObject(b, dec)
+		case '[':
+			return appendJSONArray(b, dec)
+		}
+		return b, JSONSyntaxError{Err: fmt.Errorf("unexpected %q", rune(tok))}
+	case nil:
+		return AppendNil(b), nil
+	case bool:
+		return AppendBool(b, tok), nil
+	case string:
+		return AppendString(b, tok), nil
+	case json.Number:
+		return appendJSONNumber(b, tok)
+	}
+	return b, JSONSyntaxError{Err: fmt.Errorf("unexpected token %v", tok)}
+}
+
+// appendJSONNumber leaves it to Number.SetString
+// to choose between an int, a uint and a float64
+func appendJSONNumber(b []byte, n json.Number) ([]byte, error) {
+	var num Number
+	err := num.SetString(string(n))
+	if err != nil {
+		return b, JSONSyntaxError{Err: err}
+	}
+	return num.MarshalMsg(b)
+}
+
+// the size of a map or array has to be written
+// before its contents, so they are staged in
+// a separate buffer while they are counted
+func appendJSONObject(b []byte, dec *json.Decoder) ([]byte, error) {
+	var body []byte
+	var sz uint32
+	var err error
+	for dec.More() {
+		var tok json.Token
+		tok, err = dec.Token()
+		if err != nil {
+			return b, JSONSyntaxError{Err: err}
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return b, JSONSyntaxError{Err: fmt.Errorf("unexpected %v for object key", tok)}
+		}
+		body = AppendString(body, key)
+		body, err = appendJSONValue(body, dec)
+		if err != nil {
+			return b, err
+		}
+		sz++
+	}
+	// consume the closing '}'
+	if _, err = dec.Token(); err != nil {
+		return b, JSONSyntaxError{Err: err}
+	}
+	b = AppendMapHeader(b, sz)
+	return append(b, body...), nil
+}
+
+func appendJSONArray(b []byte, dec *json.Decoder) ([]byte, error) {
+	var body []byte
+	var sz uint32
+	var err error
+	for dec.More() {
+		body, err = appendJSONValue(body, dec)
+		if err != nil {
+			return b, err
+		}
+		sz++
+	}
+	// consume the closing ']'
+	if _, err = dec.Token(); err != nil {
+		return b, JSONSyntaxError{Err: err}
+	}
+	b = AppendArrayHeader(b, sz)
+	return append(b, body...), nil
+}
@@ -0,0 +1,110 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRawJSON(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(3)
+	en.WriteString("before")
+	en.WriteInt(1)
+	en.WriteString("spliced")
+	err := en.WriteRawJSON([]byte(` {"name": "x", "n": -3, "big": 18446744073709551615,
+		"pi": 3.5, "ok": true, "none": null, "list": [1, "two", {}]} `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	en.WriteString("after")
+	en.WriteString("end")
+	en.Flush()
+
+	v, err := NewReader(&buf).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"before": int64(1),
+		"spliced": map[string]interface{}{
+			"name": "x",
+			"n":    int64(-3),
+			"big":  uint64(18446744073709551615),
+			"pi":   3.5,
+			"ok":   true,
+			"none": nil,
+			"list": []interface{}{int64(1), "two", map[string]interface{}{}},
+		},
+		"after": "end",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %#v;\nwant %#v", v, want)
+	}
+}
+
+func TestWriteRawJSONInvalid(t *testing.T) {
+	for _, js := range []string{`{"a": }`, `[1, 2`, `{"a": 1} {}`, ``} {
+		var buf bytes.Buffer
+		en := NewWriter(&buf)
+		err := en.WriteRawJSON([]byte(js))
+		if _, ok := err.(JSONSyntaxError); !ok {
+			t.Errorf("%q: expected a JSONSyntaxError; got %v", js, err)
+		}
+		en.Flush()
+		if buf.Len() != 0 {
+			t.Errorf("%q: wrote %d bytes of invalid JSON", js, buf.Len())
+		}
+	}
+}
+
+func TestCopyFromJSON(t *testing.T) {
+	in := `{"name":"x \u003c\"y\"","n":-3,"zero":0,"big":18446744073709551615,"pi":3.5,"huge":1000000000000000000000,` +
+		`"ok":true,"none":null,"list":[1,"two",{},[]],"nested":{"a":{"b":[false]}}}`
+
+	var mp bytes.Buffer
+	n, err := CopyFromJSON(&mp, strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(mp.Len()) {
+		t.Errorf("returned %d; wrote %d bytes", n, mp.Len())
+	}
+
+	var out bytes.Buffer
+	if _, err = CopyToJSON(&out, &mp); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != in {
+		t.Errorf("got  %s\nwant %s", out.String(), in)
+	}
+
+	// a stream of values
+	mp.Reset()
+	if _, err = CopyFromJSON(&mp, strings.NewReader(" {\"a\": 1}\n[2] \n\"three\" 4.5\n")); err != nil {
+		t.Fatal(err)
+	}
+	rd := NewReader(&mp)
+	for _, want := range []interface{}{
+		map[string]interface{}{"a": int64(1)},
+		[]interface{}{int64(2)},
+		"three",
+		4.5,
+	} {
+		v, err := rd.ReadIntf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("got %#v; want %#v", v, want)
+		}
+	}
+
+	for _, js := range []string{`{"a": }`, `[1, 2`, `{} ]`, `1 x`} {
+		if _, err := CopyFromJSON(&mp, strings.NewReader(js)); err == nil {
+			t.Errorf("%q: expected an error", js)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package msgp
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -140,3 +141,92 @@ func BenchmarkStdlibJSON(b *testing.B) {
 		json.NewEncoder(&js).Encode(&obj)
 	}
 }
+
+func TestCopyJSONNonFinite(t *testing.T) {
+	defer func(p NonFinitePolicy) { NonFiniteJSON = p }(NonFiniteJSON)
+
+	var b []byte
+	b = AppendArrayHeader(b, 3)
+	b = AppendFloat64(b, math.NaN())
+	b = AppendFloat32(b, float32(math.Inf(-1)))
+	b = AppendFloat64(b, 1.5)
+
+	NonFiniteJSON = NonFiniteNull
+	var js bytes.Buffer
+	if _, err := CopyToJSON(&js, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != "[null,null,1.5]" {
+		t.Errorf("got %s", js.String())
+	}
+
+	NonFiniteJSON = NonFiniteError
+	js.Reset()
+	if _, err := CopyToJSON(&js, bytes.NewReader(b)); err != ErrNonFiniteJSON {
+		t.Errorf("got %v; want ErrNonFiniteJSON", err)
+	}
+}
+
+func TestCopyJSONFloatDigits(t *testing.T) {
+	var b []byte
+	b = AppendArrayHeader(b, 2)
+	b = AppendFloat32(b, 0.1)
+	tenth := 0.1
+	b = AppendFloat64(b, tenth+0.2)
+
+	var js bytes.Buffer
+	if _, err := CopyToJSON(&js, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if js.String() != "[0.1,0.30000000000000004]" {
+		t.Errorf("got %s", js.String())
+	}
+}
+
+func TestCopyJSONNested(t *testing.T) {
+	var b []byte
+	b = AppendMapHeader(b, 5)
+	b = AppendString(b, "name")
+	b = AppendString(b, "tab\there \"quoted\" <html>")
+	b = AppendString(b, "")
+	b = AppendBool(b, false)
+	b = AppendString(b, "list")
+	b = AppendArrayHeader(b, 4)
+	b = AppendInt64(b, -1)
+	b = AppendUint64(b, 1<<63)
+	b = AppendFloat64(b, 2.5)
+	b = AppendNil(b)
+	b = AppendString(b, "raw")
+	b = AppendBytes(b, []byte{0, 1, 2, 0xff})
+	b = AppendString(b, "byid")
+	b = AppendMapHeader(b, 4)
+	b = AppendInt64(b, 7)
+	b = AppendArrayHeader(b, 0)
+	b = AppendUint64(b, 8)
+	b = AppendMapHeader(b, 0)
+	b = AppendBool(b, true)
+	b = AppendString(b, "yes")
+	b = AppendNil(b)
+	b = AppendString(b, "none")
+
+	var js bytes.Buffer
+	if _, err := CopyToJSON(&js, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"tab\u0009here \"quoted\" \u003chtml\u003e","":false,"list":[-1,9223372036854775808,2.5,null],"raw":"AAEC/w==","byid":{"7":[],"8":{},"true":"yes","null":"none"}}`
+	if js.String() != want {
+		t.Errorf("got  %s\nwant %s", js.String(), want)
+	}
+	if !json.Valid(js.Bytes()) {
+		t.Error("output is not valid JSON")
+	}
+
+	// a key that can't be made into a string is an error
+	b = AppendMapHeader(b[:0], 1)
+	b = AppendArrayHeader(b, 0)
+	b = AppendNil(b)
+	_, err := CopyToJSON(&js, bytes.NewReader(b))
+	if te, ok := err.(TypeError); !ok || te.Encoded != ArrayType {
+		t.Errorf("got %v for an array key; want a TypeError", err)
+	}
+}
@@ -25,12 +25,67 @@ type NilBitsStack struct {
 	// without re-using any part of a message (or making a copy of strings explicitly with copy()
 	// if you must) then we can avoid all allocations for strings.
 	UnsafeZeroCopy bool
+
+	// MaxMapSize and MaxArraySize are the largest maps
+	// and arrays that ReadMapHeaderBytes and
+	// ReadArrayHeaderBytes will accept; a larger one
+	// returns a SizeLimitError. Zero means
+	// DefaultMaxMapSize and DefaultMaxArraySize.
+	MaxMapSize   int
+	MaxArraySize int
+
+	// MaxStringSize is the longest str or bin, in
+	// bytes, that the string and bytes readers will
+	// accept; a longer one returns a SizeLimitError.
+	// Zero means DefaultMaxStringSize.
+	MaxStringSize int
+
+	// LenientBin makes ReadBytesBytes and ReadBytesZC
+	// accept a 'str' where they expect a 'bin'. By
+	// default they return a TypeError for it.
+	LenientBin bool
+
+	// Interner, if set, supplies the strings that
+	// ReadStringBytes returns; see Interner.
+	Interner *Interner
 }
 
 func (r *NilBitsStack) Init(cfg *RuntimeConfig) {
 	if cfg != nil {
 		r.UnsafeZeroCopy = cfg.UnsafeZeroCopy
+		r.MaxMapSize = cfg.MaxMapSize
+		r.MaxArraySize = cfg.MaxArraySize
+		r.MaxStringSize = cfg.MaxStringSize
+		r.LenientBin = cfg.LenientBin
+		r.Interner = cfg.Interner
+	}
+}
+
+func (r *NilBitsStack) mapLimit() int {
+	if r != nil && r.MaxMapSize > 0 {
+		return r.MaxMapSize
+	}
+	return DefaultMaxMapSize
+}
+
+func (r *NilBitsStack) arrayLimit() int {
+	if r != nil && r.MaxArraySize > 0 {
+		return r.MaxArraySize
+	}
+	return DefaultMaxArraySize
+}
+
+func (r *NilBitsStack) stringLimit() int {
+	if r != nil && r.MaxStringSize > 0 {
+		return r.MaxStringSize
 	}
+	return DefaultMaxStringSize
+}
+
+// lenientStr returns whether b holds a 'str'
+// that LenientBin lets stand in for a 'bin'
+func (r *NilBitsStack) lenientStr(b []byte) bool {
+	return r != nil && r.LenientBin && NextType(b) == StrType
 }
 
 func (r *NilBitsStack) IsNil(bts []byte) bool {
@@ -1,23 +1,45 @@
 package msgp
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"math/cmplx"
 	"strconv"
+	"strings"
 )
 
 // The portable parts of the Number implementation
 
 // Number can be
 // an int64, uint64, float32,
-// or float64 internally.
+// float64, complex64 or
+// complex128 internally.
 // It can decode itself
 // from any of the native
 // messagepack number types.
-// The zero-value of Number
-// is Int(0). Using the equality
+// Using the equality
 // operator with Number compares
 // both the type and the value
-// of the number.
+// of the number; use Equal or
+// Cmp to compare only values.
+//
+// The zero value of Number is the
+// int64 0, and AsInt(0) sets a Number
+// to exactly that value, so that it is
+// == to Number{}. AsUint(0) gives the
+// uint64 0 instead, which is Equal to
+// Number{} but not ==. Either way, Type
+// reports the type that was set, and
+// Int and Uint succeed just when Type
+// is Int64Type or Uint64Type, zero or
+// not:
+//
+//	Number{}, AsInt(0):  Int64Type,  Int() = 0, true;  Uint() = 0, false
+//	AsUint(0):           Uint64Type, Int() = 0, false; Uint() = 0, true
 type Number struct {
 	// internally, this
 	// is just a tagged union.
@@ -25,9 +47,14 @@ type Number struct {
 	// are stored the same way regardless.
 	bits uint64
 	typ  Type
+
+	// the imaginary part of a complex
+	// number, stored like bits
+	ibits uint64
 }
 
 // AsInt sets the number to an int64.
+// AsInt(0) makes it the zero Number.
 func (n *Number) AsInt(i int64) {
 
 	// we always store int(0)
@@ -37,17 +64,21 @@ func (n *Number) AsInt(i int64) {
 	if i == 0 {
 		n.typ = InvalidType
 		n.bits = 0
+		n.ibits = 0
 		return
 	}
 
 	n.typ = Int64Type
 	n.bits = uint64(i)
+	n.ibits = 0
 }
 
-// AsUint sets the number to a uint64.
+// AsUint sets the number to a uint64,
+// even for 0; see Number.
 func (n *Number) AsUint(u uint64) {
 	n.typ = Uint64Type
 	n.bits = u
+	n.ibits = 0
 }
 
 // AsFloat32 sets the value of the number
@@ -55,6 +86,7 @@ func (n *Number) AsUint(u uint64) {
 func (n *Number) AsFloat32(f float32) {
 	n.typ = Float32Type
 	n.bits = uint64(math.Float32bits(f))
+	n.ibits = 0
 }
 
 // AsFloat64 sets the value of the
@@ -62,19 +94,39 @@ func (n *Number) AsFloat32(f float32) {
 func (n *Number) AsFloat64(f float64) {
 	n.typ = Float64Type
 	n.bits = math.Float64bits(f)
+	n.ibits = 0
+}
+
+// AsComplex64 sets the value of the
+// number to a complex64.
+func (n *Number) AsComplex64(c complex64) {
+	n.typ = Complex64Type
+	n.bits = uint64(math.Float32bits(real(c)))
+	n.ibits = uint64(math.Float32bits(imag(c)))
+}
+
+// AsComplex128 sets the value of the
+// number to a complex128.
+func (n *Number) AsComplex128(c complex128) {
+	n.typ = Complex128Type
+	n.bits = math.Float64bits(real(c))
+	n.ibits = math.Float64bits(imag(c))
 }
 
 // Int casts the number as an int64, and
 // returns whether or not that was the
-// underlying type.
+// underlying type, which is so for the
+// zero Number.
 func (n *Number) Int() (int64, bool) {
-	return int64(n.bits), n.typ == Int64Type || n.typ == InvalidType
+	return int64(n.bits), n.Type() == Int64Type
 }
 
 // Uint casts the number as a uint64, and returns
-// whether or not that was the underlying type.
+// whether or not that was the underlying type,
+// which is so for the uint64 0 set by AsUint(0)
+// but not for the zero Number.
 func (n *Number) Uint() (uint64, bool) {
-	return n.bits, n.typ == Uint64Type
+	return n.bits, n.Type() == Uint64Type
 }
 
 // Float casts the number to a float64, and
@@ -91,8 +143,24 @@ func (n *Number) Float() (float64, bool) {
 	}
 }
 
+// Complex casts the number to a complex128, and
+// returns whether or not that was the underlying
+// type (either a complex128 or a complex64).
+func (n *Number) Complex() (complex128, bool) {
+	switch n.typ {
+	case Complex64Type:
+		return complex(float64(math.Float32frombits(uint32(n.bits))), float64(math.Float32frombits(uint32(n.ibits)))), true
+	case Complex128Type:
+		return complex(math.Float64frombits(n.bits), math.Float64frombits(n.ibits)), true
+	default:
+		return 0, false
+	}
+}
+
 // Type will return one of:
-// Float64Type, Float32Type, UintType, or IntType.
+// Float64Type, Float32Type, Uint64Type, Int64Type,
+// Complex64Type or Complex128Type. It is
+// Int64Type for the zero Number.
 func (n *Number) Type() Type {
 	if n.typ == InvalidType {
 		return Int64Type
@@ -100,83 +168,374 @@ func (n *Number) Type() Type {
 	return n.typ
 }
 
-// DecodeMsg implements msgp.Decodable
-func (n *Number) DecodeMsg(r *Reader) error {
-	typ, err := r.NextType()
-	if err != nil {
-		return err
+// Equal returns whether n and o have the same
+// numeric value, whatever their types, so that
+// an int64 5, a uint64 5 and a float64 5.0 are
+// all equal. This is unlike the == operator,
+// which also compares the types. As with ==
+// on floats, NaN is not equal to anything.
+func (n *Number) Equal(o Number) bool {
+	if n.isNaN() || o.isNaN() {
+		return false
 	}
-	switch typ {
+	return n.Cmp(o) == 0
+}
+
+// Cmp compares the numeric values of n and o,
+// whatever their types, and returns -1, 0 or +1
+// as n is less than, equal to or greater than o.
+// Integers and floats are compared exactly: a
+// uint64 above math.MaxInt64 is greater than any
+// int64, and 1<<53 + 1 is greater than 1<<53 as a
+// float64, even though converting it to a float64
+// would make them equal.
+//
+// Complex numbers are ordered by their real part,
+// then their imaginary part; any other number is
+// treated as having an imaginary part of 0. To
+// give a total order, NaN compares equal to NaN
+// and less than any other value.
+func (n *Number) Cmp(o Number) int {
+	if n.isComplex() || o.isComplex() {
+		nr, ni := n.parts()
+		or, oi := o.parts()
+		if c := cmpReal(&nr, &or); c != 0 {
+			return c
+		}
+		return cmpReal(&ni, &oi)
+	}
+	return cmpReal(n, &o)
+}
+
+// IsZero returns whether the value of n is 0,
+// whatever its type: the zero Number, a 0 set
+// by any of the As methods, or a float that is
+// -0. It is the same as n.Equal(Number{}).
+func (n *Number) IsZero() bool {
+	switch n.typ {
+	case Float32Type, Float64Type:
+		f, _ := n.Float()
+		return f == 0
+	case Complex64Type, Complex128Type:
+		c, _ := n.Complex()
+		return c == 0
+	}
+	return n.bits == 0
+}
+
+// IsInteger returns whether the value of n is a
+// whole number: always for an int64 or a uint64,
+// and for a float (or a complex with no imaginary
+// part) if it has no fractional part, like 3.0.
+// NaN and the infinities are not integers.
+func (n *Number) IsInteger() bool {
+	re, im := n.parts()
+	if f, ok := im.Float(); ok && f != 0 {
+		return false
+	}
+	f, ok := re.Float()
+	if !ok {
+		return true
+	}
+	return !math.IsInf(f, 0) && f == math.Trunc(f)
+}
+
+// ErrNegOverflow is returned by Number.Neg for a
+// uint64 whose negative is below math.MinInt64.
+var ErrNegOverflow = errors.New("msgp: the negative of a uint64 above 1<<63 overflows int64")
+
+// Neg negates n in place. An int64 stays an int64,
+// except that -math.MinInt64 becomes the uint64
+// 1<<63. A uint64 becomes an int64, or the zero
+// Number for 0; one above 1<<63 has no negative
+// that fits, so Neg leaves it alone and returns
+// ErrNegOverflow. A float or complex keeps its
+// type and has its sign bits flipped, so that 0
+// becomes -0, as with the - operator.
+func (n *Number) Neg() error {
+	switch n.Type() {
+	case Int64Type:
+		if i := int64(n.bits); i == math.MinInt64 {
+			n.AsUint(1 << 63)
+		} else {
+			n.AsInt(-i)
+		}
+	case Uint64Type:
+		if n.bits > 1<<63 {
+			return ErrNegOverflow
+		}
+		n.AsInt(-int64(n.bits))
 	case Float32Type:
-		f, err := r.ReadFloat32()
-		if err != nil {
-			return err
+		n.bits ^= 1 << 31
+	case Float64Type:
+		n.bits ^= 1 << 63
+	case Complex64Type:
+		n.bits ^= 1 << 31
+		n.ibits ^= 1 << 31
+	case Complex128Type:
+		n.bits ^= 1 << 63
+		n.ibits ^= 1 << 63
+	}
+	return nil
+}
+
+// Abs sets n to its absolute value, in place.
+// A negative int64 is negated, and becomes the
+// uint64 1<<63 for math.MinInt64; a uint64 is
+// left alone; a float has its sign bit cleared,
+// so that -0 becomes 0. A complex becomes its
+// magnitude, as by cmplx.Abs, in a float of the
+// same precision.
+func (n *Number) Abs() {
+	switch n.Type() {
+	case Int64Type:
+		if int64(n.bits) < 0 {
+			n.Neg()
 		}
-		n.AsFloat32(f)
-		return nil
+	case Float32Type:
+		n.bits &^= 1 << 31
 	case Float64Type:
-		f, err := r.ReadFloat64()
-		if err != nil {
-			return err
+		n.bits &^= 1 << 63
+	case Complex64Type:
+		c, _ := n.Complex()
+		n.AsFloat32(float32(cmplx.Abs(c)))
+	case Complex128Type:
+		c, _ := n.Complex()
+		n.AsFloat64(cmplx.Abs(c))
+	}
+}
+
+func (n *Number) isComplex() bool {
+	return n.typ == Complex64Type || n.typ == Complex128Type
+}
+
+func (n *Number) isNaN() bool {
+	if f, ok := n.Float(); ok {
+		return f != f
+	}
+	c, ok := n.Complex()
+	return ok && c != c
+}
+
+// parts splits n into its real and
+// imaginary parts, as non-complex Numbers
+func (n *Number) parts() (re, im Number) {
+	c, ok := n.Complex()
+	if !ok {
+		return *n, Number{}
+	}
+	re.AsFloat64(real(c))
+	im.AsFloat64(imag(c))
+	return
+}
+
+// cmpReal compares two Numbers
+// that aren't complex
+func cmpReal(a, b *Number) int {
+	af, aflt := a.Float()
+	bf, bflt := b.Float()
+	switch {
+	case aflt && bflt:
+		return cmpFloat(af, bf)
+	case aflt:
+		return cmpFloatInt(af, b)
+	case bflt:
+		return -cmpFloatInt(bf, a)
+	}
+	ai, aint := a.Int()
+	bi, bint := b.Int()
+	switch {
+	case aint && bint:
+		return cmpInt(ai, bi)
+	case aint:
+		// b is a uint64
+		if ai < 0 {
+			return -1
 		}
-		n.AsFloat64(f)
-		return nil
+		return cmpUint(uint64(ai), b.bits)
+	case bint:
+		if bi < 0 {
+			return 1
+		}
+		return cmpUint(a.bits, uint64(bi))
+	}
+	return cmpUint(a.bits, b.bits)
+}
 
-	case Int8Type, Int16Type, Int32Type, Int64Type:
-		i, err := r.ReadInt64()
-		if err != nil {
-			return err
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	case a != a && b != b:
+		return 0
+	case a != a:
+		return -1
+	}
+	return 1
+}
+
+// cmpFloatInt compares f with the int64 or
+// uint64 held in b without rounding either:
+// the integer part of f is compared as an
+// integer, then the fraction breaks any tie
+func cmpFloatInt(f float64, b *Number) int {
+	if f != f {
+		return -1
+	}
+	t := math.Trunc(f)
+	frac := cmpFloat(f, t)
+	if i, ok := b.Int(); ok {
+		switch {
+		case t < math.MinInt64:
+			return -1
+		case t >= math.MaxInt64: // i.e. 1<<63
+			return 1
 		}
-		n.AsInt(i)
-		return nil
-	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
-		u, err := r.ReadUint64()
-		if err != nil {
-			return err
+		if c := cmpInt(int64(t), i); c != 0 {
+			return c
 		}
-		n.AsUint(u)
-		return nil
-	default:
-		return TypeError{Encoded: typ, Method: Int64Type}
+		return frac
+	}
+	switch {
+	case t < 0:
+		return -1
+	case t >= math.MaxUint64: // i.e. 1<<64
+		return 1
 	}
+	if c := cmpUint(uint64(t), b.bits); c != 0 {
+		return c
+	}
+	return frac
+}
+
+// DecodeMsg implements msgp.Decodable
+func (n *Number) DecodeMsg(r *Reader) error {
+	num, err := r.ReadNumber()
+	if err != nil {
+		return err
+	}
+	*n = num
+	return nil
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
 func (n *Number) UnmarshalMsg(b []byte) ([]byte, error) {
-	var nbs *NilBitsStack
-	typ := NextType(b)
+	// a zero NilBitsStack, rather than a nil
+	// *NilBitsStack, so that the Read*Bytes
+	// methods are never called on a nil receiver
+	var nbs NilBitsStack
+	num, o, err := nbs.ReadNumberBytes(b)
+	if err != nil {
+		return b, err
+	}
+	*n = num
+	return o, nil
+}
+
+// ReadNumber reads any int, uint, float or
+// complex as a Number, keeping its type:
+// signed ints of every width read as an
+// int64, unsigned ones as a uint64, and
+// floats and complexes as their own size.
+// Anything else is a TypeError.
+func (m *Reader) ReadNumber() (n Number, err error) {
+	typ, err := m.NextType()
+	if err != nil {
+		return
+	}
 	switch typ {
 	case Int8Type, Int16Type, Int32Type, Int64Type:
-		i, o, err := nbs.ReadInt64Bytes(b)
-		if err != nil {
-			return b, err
-		}
+		var i int64
+		i, err = m.ReadInt64()
 		n.AsInt(i)
-		return o, nil
 	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
-		u, o, err := nbs.ReadUint64Bytes(b)
-		if err != nil {
-			return b, err
-		}
+		var u uint64
+		u, err = m.ReadUint64()
 		n.AsUint(u)
-		return o, nil
+	case Float32Type:
+		var f float32
+		f, err = m.ReadFloat32()
+		n.AsFloat32(f)
 	case Float64Type:
-		f, o, err := nbs.ReadFloat64Bytes(b)
-		if err != nil {
-			return b, err
-		}
+		var f float64
+		f, err = m.ReadFloat64()
 		n.AsFloat64(f)
-		return o, nil
+	case Complex64Type:
+		var c complex64
+		c, err = m.ReadComplex64()
+		n.AsComplex64(c)
+	case Complex128Type:
+		var c complex128
+		c, err = m.ReadComplex128()
+		n.AsComplex128(c)
+	default:
+		err = TypeError{Encoded: typ, Method: Int64Type}.atOffset(m.offset())
+	}
+	if err != nil {
+		return Number{}, err
+	}
+	return
+}
+
+// ReadNumberBytes is the byte-slice
+// counterpart of (*Reader).ReadNumber.
+func (nbs *NilBitsStack) ReadNumberBytes(b []byte) (n Number, o []byte, err error) {
+	switch typ := NextType(b); typ {
+	case Int8Type, Int16Type, Int32Type, Int64Type:
+		var i int64
+		i, o, err = nbs.ReadInt64Bytes(b)
+		n.AsInt(i)
+	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
+		var u uint64
+		u, o, err = nbs.ReadUint64Bytes(b)
+		n.AsUint(u)
 	case Float32Type:
-		f, o, err := nbs.ReadFloat32Bytes(b)
-		if err != nil {
-			return b, err
-		}
+		var f float32
+		f, o, err = nbs.ReadFloat32Bytes(b)
 		n.AsFloat32(f)
-		return o, nil
+	case Float64Type:
+		var f float64
+		f, o, err = nbs.ReadFloat64Bytes(b)
+		n.AsFloat64(f)
+	case Complex64Type:
+		var c complex64
+		c, o, err = nbs.ReadComplex64Bytes(b)
+		n.AsComplex64(c)
+	case Complex128Type:
+		var c complex128
+		c, o, err = nbs.ReadComplex128Bytes(b)
+		n.AsComplex128(c)
 	default:
-		return b, TypeError{Method: Int64Type, Encoded: typ}
+		err = TypeError{Method: Int64Type, Encoded: typ}
 	}
+	if err != nil {
+		return Number{}, b, err
+	}
+	return
 }
 
 // MarshalMsg implements msgp.Marshaler
@@ -190,11 +549,113 @@ func (n *Number) MarshalMsg(b []byte) ([]byte, error) {
 		return AppendFloat64(b, math.Float64frombits(n.bits)), nil
 	case Float32Type:
 		return AppendFloat32(b, math.Float32frombits(uint32(n.bits))), nil
+	case Complex64Type, Complex128Type:
+		c, _ := n.Complex()
+		if n.typ == Complex64Type {
+			return AppendComplex64(b, complex64(c)), nil
+		}
+		return AppendComplex128(b, c), nil
 	default:
 		return AppendInt64(b, 0), nil
 	}
 }
 
+// AppendCompact appends the narrowest MessagePack
+// encoding of the value of n to b. Unlike MarshalMsg,
+// which preserves the type of n, AppendCompact only
+// preserves its value:
+//  - A float with an integral value that fits in an
+//    int64 or uint64 is written as an integer. (So -0.0
+//    is written as 0.)
+//  - Any other float is written as a float32 if that
+//    loses nothing, and as a float64 otherwise.
+//  - A non-negative integer is written as a positive
+//    fixint or the narrowest 'uint' that holds it, and
+//    a negative one as a negative fixint or the narrowest
+//    'int' that holds it.
+//
+// Two Numbers with the same value therefore always
+// produce the same bytes.
+func (n *Number) AppendCompact(b []byte) []byte {
+	switch n.typ {
+	case Int8Type, Int16Type, Int32Type, Int64Type:
+		return appendCompactInt(b, int64(n.bits))
+	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
+		return appendCompactUint(b, n.bits)
+	case Float32Type, Float64Type:
+		f, _ := n.Float()
+		if f == math.Trunc(f) {
+			if f >= math.MinInt64 && f < math.MaxInt64 {
+				return appendCompactInt(b, int64(f))
+			}
+			if f > 0 && f < math.MaxUint64 {
+				return appendCompactUint(b, uint64(f))
+			}
+		}
+		if float64(float32(f)) == f || f != f {
+			return AppendFloat32(b, float32(f))
+		}
+		return AppendFloat64(b, f)
+	case Complex64Type, Complex128Type:
+		c, _ := n.Complex()
+		if complex128(complex64(c)) == c || c != c {
+			return AppendComplex64(b, complex64(c))
+		}
+		return AppendComplex128(b, c)
+	default:
+		return append(b, wfixint(0))
+	}
+}
+
+func appendCompactInt(b []byte, i int64) []byte {
+	if i >= 0 {
+		return appendCompactUint(b, uint64(i))
+	}
+	switch {
+	case i >= -32:
+		return append(b, wnfixint(int8(i)))
+	case i >= math.MinInt8:
+		o, n := ensure(b, 2)
+		putMint8(o[n:], int8(i))
+		return o
+	case i >= math.MinInt16:
+		o, n := ensure(b, 3)
+		putMint16(o[n:], int16(i))
+		return o
+	case i >= math.MinInt32:
+		o, n := ensure(b, 5)
+		putMint32(o[n:], int32(i))
+		return o
+	default:
+		o, n := ensure(b, 9)
+		putMint64(o[n:], i)
+		return o
+	}
+}
+
+func appendCompactUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= (1<<7)-1:
+		return append(b, wfixint(uint8(u)))
+	case u <= math.MaxUint8:
+		o, n := ensure(b, 2)
+		putMuint8(o[n:], uint8(u))
+		return o
+	case u <= math.MaxUint16:
+		o, n := ensure(b, 3)
+		putMuint16(o[n:], uint16(u))
+		return o
+	case u <= math.MaxUint32:
+		o, n := ensure(b, 5)
+		putMuint32(o[n:], uint32(u))
+		return o
+	default:
+		o, n := ensure(b, 9)
+		putMuint64(o[n:], u)
+		return o
+	}
+}
+
 // EncodeMsg implements msgp.Encodable
 func (n *Number) EncodeMsg(w *Writer) error {
 	switch n.typ {
@@ -206,6 +667,12 @@ func (n *Number) EncodeMsg(w *Writer) error {
 		return w.WriteFloat64(math.Float64frombits(n.bits))
 	case Float32Type:
 		return w.WriteFloat32(math.Float32frombits(uint32(n.bits)))
+	case Complex64Type, Complex128Type:
+		c, _ := n.Complex()
+		if n.typ == Complex64Type {
+			return w.WriteComplex64(complex64(c))
+		}
+		return w.WriteComplex128(c)
 	default:
 		return w.WriteInt64(0)
 	}
@@ -222,11 +689,38 @@ func (n *Number) Msgsize() int {
 		return Int64Size
 	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
 		return Uint64Size
+	case Complex64Type:
+		return Complex64Size
+	case Complex128Type:
+		return Complex128Size
 	default:
 		return 1 // fixint(0)
 	}
 }
 
+// NonFiniteJSON is what Number.MarshalJSON does
+// with a NaN or an infinity, which JSON has no
+// way to write: either write null, which is the
+// default, or fail with ErrNonFiniteJSON.
+var NonFiniteJSON = NonFiniteNull
+
+// NonFinitePolicy is the type of NonFiniteJSON.
+type NonFinitePolicy int
+
+const (
+	NonFiniteNull  NonFinitePolicy = iota // write null
+	NonFiniteError                        // return ErrNonFiniteJSON
+)
+
+// ErrNonFiniteJSON is returned by Number.MarshalJSON
+// for a NaN or an infinity when NonFiniteJSON is
+// NonFiniteError.
+var ErrNonFiniteJSON = errors.New("msgp: NaN and infinities can't be written as JSON")
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
 // MarshalJSON implements json.Marshaler
 func (n *Number) MarshalJSON() ([]byte, error) {
 	t := n.Type()
@@ -237,32 +731,212 @@ func (n *Number) MarshalJSON() ([]byte, error) {
 	switch t {
 	case Float32Type, Float64Type:
 		f, _ := n.Float()
-		return strconv.AppendFloat(out, f, 'f', -1, 64), nil
+		if !finite(f) {
+			return nonFiniteJSON()
+		}
+		return strconv.AppendFloat(out, f, 'f', -1, n.bitSize()), nil
 	case Int8Type, Int16Type, Int32Type, Int64Type:
 		i, _ := n.Int()
 		return strconv.AppendInt(out, i, 10), nil
 	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
 		u, _ := n.Uint()
 		return strconv.AppendUint(out, u, 10), nil
+	case Complex64Type, Complex128Type:
+		// JSON has no complex numbers; write [re, im]
+		c, _ := n.Complex()
+		if !finite(real(c)) || !finite(imag(c)) {
+			return nonFiniteJSON()
+		}
+		out = append(out, '[')
+		out = strconv.AppendFloat(out, real(c), 'f', -1, n.bitSize())
+		out = append(out, ',')
+		out = strconv.AppendFloat(out, imag(c), 'f', -1, n.bitSize())
+		return append(out, ']'), nil
 	default:
 		panic("(*Number).typ is invalid")
 	}
 }
 
-// String implements fmt.Stringer
+// bitSize is the size of a float, or of each
+// part of a complex number, for strconv; float32s
+// must be formatted as such, or they print with
+// the noise of being widened to float64.
+func (n *Number) bitSize() int {
+	if n.typ == Float32Type || n.typ == Complex64Type {
+		return 32
+	}
+	return 64
+}
+
+func nonFiniteJSON() ([]byte, error) {
+	if NonFiniteJSON == NonFiniteError {
+		return nil, ErrNonFiniteJSON
+	}
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It reads
+// what MarshalJSON writes: an integer becomes an int64,
+// or a uint64 if it is too large for one, a number with
+// a fraction or an exponent becomes a float64, and a
+// [re, im] pair becomes a complex128. A JSON null
+// leaves n unchanged.
+func (n *Number) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err == nil && dec.More() {
+		err = fmt.Errorf("unexpected data after the number")
+	}
+	if err != nil {
+		return fmt.Errorf("msgp: cannot unmarshal %q into a Number: %s", b, err)
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		return n.SetString(string(v))
+	case []interface{}:
+		if len(v) == 2 {
+			re, ok1 := v[0].(json.Number)
+			im, ok2 := v[1].(json.Number)
+			if ok1 && ok2 {
+				r, err1 := re.Float64()
+				i, err2 := im.Float64()
+				if err1 == nil && err2 == nil {
+					n.AsComplex128(complex(r, i))
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("msgp: cannot unmarshal %s into a Number", b)
+}
+
+// String implements fmt.Stringer. It is not
+// JSON, and NonFiniteJSON doesn't apply to it:
+// NaN and the infinities are always written
+// as "NaN", "+Inf" and "-Inf", which SetString
+// and Scan read back.
 func (n *Number) String() string {
 	switch n.typ {
 	case InvalidType:
 		return "0"
 	case Float32Type, Float64Type:
 		f, _ := n.Float()
-		return strconv.FormatFloat(f, 'f', -1, 64)
+		return strconv.FormatFloat(f, 'f', -1, n.bitSize())
 	case Int8Type, Int16Type, Int32Type, Int64Type:
 		i, _ := n.Int()
 		return strconv.FormatInt(i, 10)
 	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
 		u, _ := n.Uint()
 		return strconv.FormatUint(u, 10)
+	case Complex64Type, Complex128Type:
+		c, _ := n.Complex()
+		return strconv.FormatComplex(c, 'f', -1, 2*n.bitSize())
+	default:
+		panic("(*Number).typ is invalid")
+	}
+}
+
+// SetString sets the number from its text, as
+// written by String: an integer becomes an int64,
+// or a uint64 if it is too large for one, a number
+// with a fraction or an exponent (or NaN, +Inf or
+// -Inf) becomes a float64, and a complex number
+// such as "(1+2i)" becomes a complex128. Anything
+// else is an error, and leaves n unchanged.
+func (n *Number) SetString(s string) error {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		n.AsInt(i)
+		return nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		n.AsUint(u)
+		return nil
+	}
+	if strings.HasPrefix(s, "(") {
+		c, err := strconv.ParseComplex(s, 128)
+		if err != nil {
+			return fmt.Errorf("msgp: cannot parse %q as a Number", s)
+		}
+		n.AsComplex128(c)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("msgp: cannot parse %q as a Number", s)
+	}
+	n.AsFloat64(f)
+	return nil
+}
+
+// sqlNull marks, in the ibits of an
+// otherwise zero Number, that Scan
+// read it from a NULL
+const sqlNull = 1
+
+// Scan implements sql.Scanner. The source may be an
+// int64, a uint64, a float64, or the decimal text of a
+// number as a []byte or string. A NULL sets the
+// number to zero, but one that Value hands back as
+// a NULL; it is Equal to Number{}, but not ==.
+func (n *Number) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*n = Number{ibits: sqlNull}
+		return nil
+	case int64:
+		n.AsInt(v)
+		return nil
+	case uint64:
+		n.AsUint(v)
+		return nil
+	case float64:
+		n.AsFloat64(v)
+		return nil
+	case []byte:
+		return n.SetString(string(v))
+	case string:
+		return n.SetString(v)
+	default:
+		return fmt.Errorf("msgp: cannot scan %T into a Number", src)
+	}
+}
+
+// Value implements driver.Valuer. Integers are
+// handed to the driver as int64 and floats as
+// float64, those being the only numeric types
+// a driver.Value may hold. A uint64 too large
+// for an int64 is handed over as its decimal
+// string rather than being truncated.
+// A Number that Scan read from a NULL is
+// handed back as a NULL, and any other zero
+// as int64(0).
+// Complex numbers have no driver.Value,
+// so they return an error.
+func (n *Number) Value() (driver.Value, error) {
+	switch n.typ {
+	case InvalidType:
+		if n.ibits == sqlNull {
+			return nil, nil
+		}
+		return int64(0), nil
+	case Float32Type, Float64Type:
+		f, _ := n.Float()
+		return f, nil
+	case Int8Type, Int16Type, Int32Type, Int64Type:
+		i, _ := n.Int()
+		return i, nil
+	case Uint8Type, Uint16Type, Uint32Type, Uint64Type:
+		u, _ := n.Uint()
+		if u > math.MaxInt64 {
+			return strconv.FormatUint(u, 10), nil
+		}
+		return int64(u), nil
+	case Complex64Type, Complex128Type:
+		return nil, fmt.Errorf("msgp: a complex Number has no driver.Value")
 	default:
 		panic("(*Number).typ is invalid")
 	}
@@ -2,6 +2,8 @@ package msgp
 
 import (
 	"bytes"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -92,3 +94,770 @@ func TestNumber(t *testing.T) {
 	}
 
 }
+
+func TestNumberZero(t *testing.T) {
+	var zero, asInt, asUint Number
+	asInt.AsInt(0)
+	asUint.AsUint(0)
+
+	for _, tt := range []struct {
+		name   string
+		n      Number
+		typ    Type
+		intOK  bool
+		uintOK bool
+	}{
+		{"Number{}", zero, Int64Type, true, false},
+		{"AsInt(0)", asInt, Int64Type, true, false},
+		{"AsUint(0)", asUint, Uint64Type, false, true},
+	} {
+		if tt.n.Type() != tt.typ {
+			t.Errorf("%s: Type() = %s; want %s", tt.name, tt.n.Type(), tt.typ)
+		}
+		i, ok := tt.n.Int()
+		if i != 0 || ok != tt.intOK {
+			t.Errorf("%s: Int() = %d, %t; want 0, %t", tt.name, i, ok, tt.intOK)
+		}
+		u, ok := tt.n.Uint()
+		if u != 0 || ok != tt.uintOK {
+			t.Errorf("%s: Uint() = %d, %t; want 0, %t", tt.name, u, ok, tt.uintOK)
+		}
+		if !tt.n.Equal(zero) {
+			t.Errorf("%s is not Equal to Number{}", tt.name)
+		}
+	}
+
+	if asInt != zero {
+		t.Error("AsInt(0) is not == Number{}")
+	}
+	if asUint == zero {
+		t.Error("AsUint(0) is == Number{}")
+	}
+
+	// setting 0 must clear whatever was there before
+	asInt.AsComplex128(complex(1, 2))
+	asInt.AsInt(0)
+	if asInt != zero {
+		t.Errorf("AsInt(0) after AsComplex128 = %#v; want Number{}", asInt)
+	}
+}
+
+func TestNumberExtremesRoundTrip(t *testing.T) {
+	var negZero, maxUint Number
+	negZero.AsFloat64(math.Copysign(0, -1))
+	maxUint.AsUint(math.MaxUint64)
+
+	for _, n := range []Number{negZero, maxUint} {
+		bts, err := n.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out Number
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != n {
+			t.Errorf("UnmarshalMsg: %#v in; %#v out", n, out)
+		}
+		err = out.DecodeMsg(NewReader(bytes.NewReader(bts)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != n {
+			t.Errorf("DecodeMsg: %#v in; %#v out", n, out)
+		}
+	}
+
+	f, _ := negZero.Float()
+	if !math.Signbit(f) || negZero.String() != "-0" {
+		t.Errorf("-0 came back as %s", negZero.String())
+	}
+	if _, ok := maxUint.Int(); ok {
+		t.Error("Int() of math.MaxUint64 succeeded")
+	}
+	if u, ok := maxUint.Uint(); !ok || u != math.MaxUint64 || maxUint.String() != "18446744073709551615" {
+		t.Errorf("Uint() of math.MaxUint64 = %d, %t", u, ok)
+	}
+}
+
+// num returns the Number that set makes of Number{}
+func num(set func(n *Number)) Number {
+	var n Number
+	set(&n)
+	return n
+}
+
+func TestNumberPredicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       Number
+		zero    bool
+		integer bool
+	}{
+		{"Number{}", Number{}, true, true},
+		{"int 0", num(func(n *Number) { n.AsInt(0) }), true, true},
+		{"int -3", num(func(n *Number) { n.AsInt(-3) }), false, true},
+		{"uint 0", num(func(n *Number) { n.AsUint(0) }), true, true},
+		{"uint max", num(func(n *Number) { n.AsUint(math.MaxUint64) }), false, true},
+		{"float64 0", num(func(n *Number) { n.AsFloat64(0) }), true, true},
+		{"float64 -0", num(func(n *Number) { n.AsFloat64(math.Copysign(0, -1)) }), true, true},
+		{"float64 3.0", num(func(n *Number) { n.AsFloat64(3.0) }), false, true},
+		{"float64 3.5", num(func(n *Number) { n.AsFloat64(3.5) }), false, false},
+		{"float64 1e300", num(func(n *Number) { n.AsFloat64(1e300) }), false, true},
+		{"float64 +Inf", num(func(n *Number) { n.AsFloat64(math.Inf(1)) }), false, false},
+		{"float64 NaN", num(func(n *Number) { n.AsFloat64(math.NaN()) }), false, false},
+		{"float32 0", num(func(n *Number) { n.AsFloat32(0) }), true, true},
+		{"float32 -2.0", num(func(n *Number) { n.AsFloat32(-2.0) }), false, true},
+		{"float32 0.25", num(func(n *Number) { n.AsFloat32(0.25) }), false, false},
+		{"complex128 0", num(func(n *Number) { n.AsComplex128(0) }), true, true},
+		{"complex128 4+0i", num(func(n *Number) { n.AsComplex128(4) }), false, true},
+		{"complex64 4+1i", num(func(n *Number) { n.AsComplex64(complex(4, 1)) }), false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.n.IsZero(); got != tt.zero {
+			t.Errorf("%s: IsZero() = %t; want %t", tt.name, got, tt.zero)
+		}
+		if got := tt.n.IsZero(); got != tt.n.Equal(Number{}) {
+			t.Errorf("%s: IsZero() = %t, but Equal(Number{}) = %t", tt.name, got, !got)
+		}
+		if got := tt.n.IsInteger(); got != tt.integer {
+			t.Errorf("%s: IsInteger() = %t; want %t", tt.name, got, tt.integer)
+		}
+	}
+}
+
+func TestNumberNegAbs(t *testing.T) {
+	i := func(v int64) Number { return num(func(n *Number) { n.AsInt(v) }) }
+	u := func(v uint64) Number { return num(func(n *Number) { n.AsUint(v) }) }
+	f32 := func(v float32) Number { return num(func(n *Number) { n.AsFloat32(v) }) }
+	f64 := func(v float64) Number { return num(func(n *Number) { n.AsFloat64(v) }) }
+	c64 := func(v complex64) Number { return num(func(n *Number) { n.AsComplex64(v) }) }
+	c128 := func(v complex128) Number { return num(func(n *Number) { n.AsComplex128(v) }) }
+	negZero := math.Copysign(0, -1)
+
+	tests := []struct {
+		in, neg, abs Number
+	}{
+		{Number{}, Number{}, Number{}},
+		{i(5), i(-5), i(5)},
+		{i(-5), i(5), i(5)},
+		{i(math.MaxInt64), i(-math.MaxInt64), i(math.MaxInt64)},
+		{i(math.MinInt64), u(1 << 63), u(1 << 63)},
+		{u(0), Number{}, u(0)},
+		{u(7), i(-7), u(7)},
+		{u(math.MaxInt64), i(-math.MaxInt64), u(math.MaxInt64)},
+		{u(1 << 63), i(math.MinInt64), u(1 << 63)},
+		{f32(2.5), f32(-2.5), f32(2.5)},
+		{f32(-2.5), f32(2.5), f32(2.5)},
+		{f64(0), f64(negZero), f64(0)},
+		{f64(negZero), f64(0), f64(0)},
+		{f64(math.Inf(-1)), f64(math.Inf(1)), f64(math.Inf(1))},
+		{c64(complex(3, -4)), c64(complex(-3, 4)), f32(5)},
+		{c128(complex(-3, 4)), c128(complex(3, -4)), f64(5)},
+	}
+	for _, tt := range tests {
+		n := tt.in
+		if err := n.Neg(); err != nil {
+			t.Errorf("Neg(%s): %v", &tt.in, err)
+		}
+		if n != tt.neg {
+			t.Errorf("Neg(%s %s) = %s %s; want %s %s", tt.in.Type(), &tt.in, n.Type(), &n, tt.neg.Type(), &tt.neg)
+		}
+		n = tt.in
+		n.Abs()
+		if n != tt.abs {
+			t.Errorf("Abs(%s %s) = %s %s; want %s %s", tt.in.Type(), &tt.in, n.Type(), &n, tt.abs.Type(), &tt.abs)
+		}
+	}
+
+	// past 1<<63 there is no int64 to negate a uint to
+	n := u(1<<63 + 1)
+	if err := n.Neg(); err != ErrNegOverflow {
+		t.Errorf("Neg(1<<63 + 1): got %v; want ErrNegOverflow", err)
+	}
+	if n != u(1<<63+1) {
+		t.Errorf("a failed Neg changed the Number to %s %s", n.Type(), &n)
+	}
+}
+
+func TestNumberScanValue(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		typ  Type
+		want interface{}
+	}{
+		{nil, Int64Type, nil},
+		{int64(-42), Int64Type, int64(-42)},
+		{uint64(math.MaxUint64), Uint64Type, "18446744073709551615"},
+		{float64(2.5), Float64Type, float64(2.5)},
+		{[]byte("1234"), Int64Type, int64(1234)},
+		{"-0.125", Float64Type, float64(-0.125)},
+		{"18446744073709551615", Uint64Type, "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		var n Number
+		n.AsInt(7) // must be overwritten
+		err := n.Scan(tt.src)
+		if err != nil {
+			t.Errorf("Scan(%#v): %s", tt.src, err)
+			continue
+		}
+		if n.Type() != tt.typ {
+			t.Errorf("Scan(%#v): expected type %s; got %s", tt.src, tt.typ, n.Type())
+		}
+		v, err := n.Value()
+		if err != nil {
+			t.Errorf("Value() after Scan(%#v): %s", tt.src, err)
+			continue
+		}
+		if v != tt.want {
+			t.Errorf("Value() after Scan(%#v): expected %#v; got %#v", tt.src, tt.want, v)
+		}
+	}
+
+	// a NULL goes back as a NULL, but a 0 as a 0
+	var null, zero Number
+	if err := null.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	zero.AsInt(0)
+	if v, err := null.Value(); v != nil || err != nil {
+		t.Errorf("Value() after Scan(nil): got %#v, %v; want a NULL", v, err)
+	}
+	if v, err := zero.Value(); v != int64(0) || err != nil {
+		t.Errorf("Value() of 0: got %#v, %v; want int64(0)", v, err)
+	}
+
+	var n Number
+	if err := n.Scan("not a number"); err == nil {
+		t.Error("expected an error scanning garbage text")
+	}
+	if err := n.Scan(true); err == nil {
+		t.Error("expected an error scanning a bool")
+	}
+}
+
+func TestNumberAppendCompact(t *testing.T) {
+	num := func(set func(n *Number)) Number {
+		var n Number
+		set(&n)
+		return n
+	}
+	tests := []struct {
+		n    Number
+		want []byte
+	}{
+		{Number{}, []byte{0x00}},
+		{num(func(n *Number) { n.AsInt(127) }), []byte{0x7f}},
+		{num(func(n *Number) { n.AsInt(128) }), []byte{0xcc, 0x80}},
+		{num(func(n *Number) { n.AsInt(255) }), []byte{0xcc, 0xff}},
+		{num(func(n *Number) { n.AsInt(256) }), []byte{0xcd, 0x01, 0x00}},
+		{num(func(n *Number) { n.AsInt(-32) }), []byte{0xe0}},
+		{num(func(n *Number) { n.AsInt(-33) }), []byte{0xd0, 0xdf}},
+		{num(func(n *Number) { n.AsInt(-129) }), []byte{0xd1, 0xff, 0x7f}},
+		{num(func(n *Number) { n.AsInt(math.MinInt32) }), []byte{0xd2, 0x80, 0x00, 0x00, 0x00}},
+		{num(func(n *Number) { n.AsUint(1) }), []byte{0x01}},
+		{num(func(n *Number) { n.AsUint(math.MaxUint32 + 1) }), []byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{num(func(n *Number) { n.AsFloat64(3.0) }), []byte{0x03}},
+		{num(func(n *Number) { n.AsFloat32(-1) }), []byte{0xff}},
+		{num(func(n *Number) { n.AsFloat64(1 << 63) }), []byte{0xcf, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{num(func(n *Number) { n.AsFloat64(0.5) }), []byte{0xca, 0x3f, 0x00, 0x00, 0x00}},
+		{num(func(n *Number) { n.AsFloat64(0.1) }), AppendFloat64(nil, 0.1)},
+	}
+	for _, tt := range tests {
+		got := tt.n.AppendCompact(nil)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: expected % x; got % x", tt.n.String(), tt.want, got)
+			continue
+		}
+
+		// the value must survive the trip; since
+		// equal values compact to equal bytes,
+		// compacting it again must be a no-op
+		var out Number
+		rest, err := out.UnmarshalMsg(got)
+		if err != nil {
+			t.Errorf("%s: %s", tt.n.String(), err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d bytes left over", tt.n.String(), len(rest))
+		}
+		if again := out.AppendCompact(nil); !bytes.Equal(again, got) {
+			t.Errorf("%s: read back %s, which compacts to % x", tt.n.String(), out.String(), again)
+		}
+	}
+}
+
+func TestNumberComplex(t *testing.T) {
+	var n Number
+	n.AsComplex128(complex(1.5, -2))
+	c, ok := n.Complex()
+	if !ok || c != complex(1.5, -2) || n.Type() != Complex128Type {
+		t.Errorf("%v in; %v out!", complex(1.5, -2), c)
+	}
+	if _, ok := n.Float(); ok {
+		t.Error("a complex Number reported itself as a float")
+	}
+	if js, _ := n.MarshalJSON(); string(js) != "[1.5,-2]" {
+		t.Errorf("MarshalJSON: got %s", js)
+	}
+	if n.String() != "(1.5-2i)" {
+		t.Errorf("String: got %q", n.String())
+	}
+
+	n.AsComplex64(complex(0.25, 3))
+	c, ok = n.Complex()
+	if !ok || c != complex(0.25, 3) || n.Type() != Complex64Type {
+		t.Errorf("%v in; %v out!", complex64(complex(0.25, 3)), c)
+	}
+
+	// setting another kind of number clears the imaginary part
+	var a, b Number
+	a.AsComplex128(complex(7, 7))
+	a.AsFloat64(7)
+	b.AsFloat64(7)
+	if a != b {
+		t.Errorf("%#v != %#v", a, b)
+	}
+
+	nums := []interface{}{complex64(complex(1, 2)), complex128(complex(-3.5, 1e300))}
+	var dat []byte
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	for _, x := range nums {
+		dat, _ = AppendIntf(dat, x)
+		wr.WriteIntf(x)
+	}
+	wr.Flush()
+
+	rd := NewReader(&buf)
+	var odat []byte
+	var obuf bytes.Buffer
+	owr := NewWriter(&obuf)
+	for _, x := range nums {
+		var m, d Number
+		var err error
+		dat, err = m.UnmarshalMsg(dat)
+		if err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		if err = d.DecodeMsg(rd); err != nil {
+			t.Fatal("decode error:", err)
+		}
+		if m != d {
+			t.Errorf("for %v, got %#v from unmarshal and %#v from decode", x, m, d)
+		}
+		odat, _ = m.MarshalMsg(odat)
+		d.EncodeMsg(owr)
+		if sz := m.Msgsize(); sz != len(mustAppendIntf(x)) {
+			t.Errorf("for %v, Msgsize is %d; wrote %d bytes", x, sz, len(mustAppendIntf(x)))
+		}
+	}
+	owr.Flush()
+
+	var want []byte
+	for _, x := range nums {
+		want, _ = AppendIntf(want, x)
+	}
+	if !bytes.Equal(odat, want) {
+		t.Errorf("marshal: expected % x; got % x", want, odat)
+	}
+	if !bytes.Equal(obuf.Bytes(), want) {
+		t.Errorf("encode: expected % x; got % x", want, obuf.Bytes())
+	}
+
+	if _, err := n.Value(); err == nil {
+		t.Error("expected an error from Value() on a complex Number")
+	}
+}
+
+func mustAppendIntf(x interface{}) []byte {
+	b, err := AppendIntf(nil, x)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNumberUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in  string
+		typ Type
+		str string
+	}{
+		{"42", Int64Type, "42"},
+		{"-42", Int64Type, "-42"},
+		{"18446744073709551615", Uint64Type, "18446744073709551615"},
+		{"3.14", Float64Type, "3.14"},
+		{"1e10", Float64Type, "10000000000"},
+		{" 7 ", Int64Type, "7"},
+		{"[1.5, -2]", Complex128Type, "(1.5-2i)"},
+	}
+	for _, tt := range tests {
+		var n Number
+		if err := n.UnmarshalJSON([]byte(tt.in)); err != nil {
+			t.Errorf("UnmarshalJSON(%s): %s", tt.in, err)
+			continue
+		}
+		if n.Type() != tt.typ || n.String() != tt.str {
+			t.Errorf("UnmarshalJSON(%s): got %s %s; want %s %s", tt.in, n.Type(), n.String(), tt.typ, tt.str)
+		}
+
+		// and back again; a float with an integral
+		// value comes back as an int, so only the
+		// value is compared
+		js, _ := n.MarshalJSON()
+		var m Number
+		if err := m.UnmarshalJSON(js); err != nil || m.String() != n.String() {
+			t.Errorf("%s: MarshalJSON wrote %s, which reads back as %s (%v)", tt.in, js, m.String(), err)
+		}
+	}
+
+	var n Number
+	n.AsInt(5)
+	if err := n.UnmarshalJSON([]byte("null")); err != nil || n.String() != "5" {
+		t.Errorf("null: got %s, %v; want 5 unchanged", n.String(), err)
+	}
+	for _, bad := range []string{`"42"`, "true", "NaN", "{}", "[1]", "1 2", "", "0x10"} {
+		if err := n.UnmarshalJSON([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalJSON(%s): expected an error", bad)
+		}
+	}
+}
+
+func TestNumberMarshalJSONNonFinite(t *testing.T) {
+	defer func(p NonFinitePolicy) { NonFiniteJSON = p }(NonFiniteJSON)
+
+	var inf, nan, cnan Number
+	inf.AsFloat64(math.Inf(1))
+	nan.AsFloat64(math.NaN())
+	cnan.AsComplex128(complex(1, math.NaN()))
+
+	for _, n := range []Number{inf, nan, cnan} {
+		NonFiniteJSON = NonFiniteNull
+		js, err := n.MarshalJSON()
+		if err != nil || string(js) != "null" {
+			t.Errorf("%s: got %s, %v; want null", n.String(), js, err)
+		}
+
+		NonFiniteJSON = NonFiniteError
+		js, err = n.MarshalJSON()
+		if err != ErrNonFiniteJSON {
+			t.Errorf("%s: got %s, %v; want ErrNonFiniteJSON", n.String(), js, err)
+		}
+	}
+
+	// String ignores NonFiniteJSON
+	for _, p := range []NonFinitePolicy{NonFiniteNull, NonFiniteError} {
+		NonFiniteJSON = p
+		for _, tt := range []struct {
+			n    Number
+			want string
+		}{{inf, "+Inf"}, {nan, "NaN"}, {cnan, "(1+NaNi)"}} {
+			if got := tt.n.String(); got != tt.want {
+				t.Errorf("policy %d: String() = %q; want %q", p, got, tt.want)
+			}
+		}
+	}
+
+	for _, n := range []Number{inf, nan} {
+		var back Number
+		if err := back.Scan(n.String()); err != nil {
+			t.Errorf("%s doesn't Scan back: %s", n.String(), err)
+		}
+	}
+}
+
+func TestNumberFloat32Formatting(t *testing.T) {
+	var n Number
+	n.AsFloat32(0.1)
+	if n.String() != "0.1" {
+		t.Errorf("String: got %q; want \"0.1\"", n.String())
+	}
+	if js, _ := n.MarshalJSON(); string(js) != "0.1" {
+		t.Errorf("MarshalJSON: got %s; want 0.1", js)
+	}
+
+	n.AsComplex64(complex(0.1, 0.2))
+	if js, _ := n.MarshalJSON(); string(js) != "[0.1,0.2]" {
+		t.Errorf("MarshalJSON: got %s; want [0.1,0.2]", js)
+	}
+
+	// float64s keep all of their digits
+	tenth := 0.1
+	n.AsFloat64(tenth + 0.2)
+	if n.String() != "0.30000000000000004" {
+		t.Errorf("String: got %q", n.String())
+	}
+}
+
+func TestNumberAppendCompactIsCanonical(t *testing.T) {
+	var i, u, f32, f64 Number
+	i.AsInt(5)
+	u.AsUint(5)
+	f32.AsFloat32(5)
+	f64.AsFloat64(5)
+
+	// MarshalMsg keeps the type, so these differ...
+	bi, _ := i.MarshalMsg(nil)
+	bu, _ := u.MarshalMsg(nil)
+	if bytes.Equal(bi, bu) {
+		t.Errorf("MarshalMsg: AsInt(5) and AsUint(5) both wrote % x", bi)
+	}
+
+	// ...but AppendCompact only keeps the value
+	want := i.AppendCompact(nil)
+	for _, n := range []Number{u, f32, f64} {
+		if got := n.AppendCompact(nil); !bytes.Equal(got, want) {
+			t.Errorf("%s as %s: AppendCompact wrote % x; AsInt(5) wrote % x", n.String(), n.Type(), got, want)
+		}
+	}
+}
+
+func TestNumberCmp(t *testing.T) {
+	num := func(v interface{}) (n Number) {
+		switch v := v.(type) {
+		case int:
+			n.AsInt(int64(v))
+		case int64:
+			n.AsInt(v)
+		case uint64:
+			n.AsUint(v)
+		case float32:
+			n.AsFloat32(v)
+		case float64:
+			n.AsFloat64(v)
+		case complex128:
+			n.AsComplex128(v)
+		}
+		return
+	}
+	nan := math.NaN()
+	big := float64(1 << 53)
+	tests := []struct {
+		a, b interface{}
+		cmp  int
+	}{
+		// int/uint
+		{5, uint64(5), 0},
+		{0, uint64(0), 0},
+		{-1, uint64(0), -1},
+		{int64(math.MaxInt64), uint64(math.MaxInt64), 0},
+		{int64(math.MaxInt64), uint64(math.MaxInt64 + 1), -1},
+		{uint64(math.MaxUint64), int64(math.MaxInt64), 1},
+		{int64(math.MinInt64), uint64(0), -1},
+
+		// float/int
+		{5, 5.0, 0},
+		{5, float32(5), 0},
+		{5, 5.5, -1},
+		{-5, -5.5, 1},
+		{0, math.Copysign(0, -1), 0},
+		{-1, -0.5, -1},
+		{uint64(math.MaxUint64), math.Inf(1), -1},
+		{int64(math.MinInt64), math.Inf(-1), 1},
+		{int64(math.MinInt64), -9223372036854775808.0, 0},
+		{int64(math.MaxInt64), 9223372036854775808.0, -1},
+		{uint64(math.MaxUint64), 18446744073709551616.0, -1},
+		{uint64(1 << 63), 9223372036854775808.0, 0},
+		// these would be equal if the int were converted to a float64
+		{int64(1<<53 + 1), big, 1},
+		{uint64(1<<63 + 1), 9223372036854775808.0, 1},
+
+		// floats
+		{0.5, float32(0.5), 0},
+		{nan, nan, 0},
+		{nan, math.Inf(-1), -1},
+		{5, nan, 1},
+
+		// complex
+		{complex(5, 0), 5, 0},
+		{complex(5, 0), uint64(5), 0},
+		{complex(5, 1), 5, 1},
+		{complex(5, -1), 6.0, -1},
+		{complex(1, 2), complex(1, 3), -1},
+	}
+	for _, tt := range tests {
+		a, b := num(tt.a), num(tt.b)
+		if got := a.Cmp(b); got != tt.cmp {
+			t.Errorf("%s (%s) Cmp %s (%s) = %d; want %d", a.String(), a.Type(), b.String(), b.Type(), got, tt.cmp)
+		}
+		if got := b.Cmp(a); got != -tt.cmp {
+			t.Errorf("%s (%s) Cmp %s (%s) = %d; want %d", b.String(), b.Type(), a.String(), a.Type(), got, -tt.cmp)
+		}
+		nan := a.isNaN() || b.isNaN()
+		if got := a.Equal(b); got != (tt.cmp == 0 && !nan) {
+			t.Errorf("%s (%s) Equal %s (%s) = %t", a.String(), a.Type(), b.String(), b.Type(), got)
+		}
+	}
+
+	// Equal is not ==
+	i, u := num(5), num(uint64(5))
+	if i == u || !i.Equal(u) {
+		t.Error("AsInt(5) and AsUint(5) should be Equal but not ==")
+	}
+}
+
+func TestNumberSetString(t *testing.T) {
+	tests := []struct {
+		in  string
+		typ Type
+		out string
+	}{
+		{"0", Int64Type, "0"},
+		{"-42", Int64Type, "-42"},
+		{"9223372036854775807", Int64Type, "9223372036854775807"},
+		{"9223372036854775808", Uint64Type, "9223372036854775808"},
+		{"18446744073709551615", Uint64Type, "18446744073709551615"},
+		{"1.5", Float64Type, "1.5"},
+		{"-2.5e3", Float64Type, "-2500"},
+		{"1e300", Float64Type, "1" + strings.Repeat("0", 300)},
+		{"18446744073709551616", Float64Type, "18446744073709552000"},
+		{"NaN", Float64Type, "NaN"},
+		{"-Inf", Float64Type, "-Inf"},
+		{"(1+2i)", Complex128Type, "(1+2i)"},
+	}
+	for _, tt := range tests {
+		var n Number
+		if err := n.SetString(tt.in); err != nil {
+			t.Errorf("SetString(%q): %s", tt.in, err)
+			continue
+		}
+		if n.Type() != tt.typ || n.String() != tt.out {
+			t.Errorf("SetString(%q) gave %s %s; want %s %s", tt.in, n.Type(), n.String(), tt.typ, tt.out)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1.2.3", "0x10", "5i", "(1+2i"} {
+		n := Number{}
+		n.AsInt(7)
+		if err := n.SetString(in); err == nil {
+			t.Errorf("SetString(%q) should have failed; got %s", in, n.String())
+		}
+		if i, ok := n.Int(); !ok || i != 7 {
+			t.Errorf("failed SetString(%q) changed the number to %s", in, n.String())
+		}
+	}
+
+	// String and SetString round-trip
+	var in, out Number
+	for _, set := range []func(){
+		func() { in.AsInt(math.MinInt64) },
+		func() { in.AsUint(math.MaxUint64) },
+		func() { in.AsFloat64(0.1) },
+		func() { in.AsFloat64(math.Inf(1)) },
+		func() { in.AsComplex128(complex(-0.25, 1e-9)) },
+	} {
+		set()
+		if err := out.SetString(in.String()); err != nil || out != in {
+			t.Errorf("%s came back from SetString as %s (%v)", in.String(), out.String(), err)
+		}
+	}
+}
+
+func TestNumberUnmarshalMsgWireTypes(t *testing.T) {
+	tests := []struct {
+		bts []byte
+		typ Type
+		val string
+	}{
+		{AppendInt64(nil, 5), Int64Type, "5"},   // positive fixint
+		{AppendInt64(nil, -5), Int64Type, "-5"}, // negative fixint
+		{AppendInt8(nil, -100), Int64Type, "-100"},
+		{AppendInt16(nil, -1000), Int64Type, "-1000"},
+		{AppendInt32(nil, -100000), Int64Type, "-100000"},
+		{AppendInt64(nil, math.MinInt64), Int64Type, "-9223372036854775808"},
+		{AppendUint8(nil, 200), Uint64Type, "200"},
+		{AppendUint16(nil, 60000), Uint64Type, "60000"},
+		{AppendUint32(nil, 4000000000), Uint64Type, "4000000000"},
+		{AppendUint64(nil, math.MaxUint64), Uint64Type, "18446744073709551615"},
+		{AppendFloat32(nil, 1.5), Float32Type, "1.5"},
+		{AppendFloat64(nil, -0.25), Float64Type, "-0.25"},
+		{AppendComplex64(nil, complex(1, 2)), Complex64Type, "(1+2i)"},
+		{AppendComplex128(nil, complex(3, -4)), Complex128Type, "(3-4i)"},
+	}
+	for _, tt := range tests {
+		var n Number
+		left, err := n.UnmarshalMsg(append(tt.bts, 0xc0))
+		if err != nil {
+			t.Errorf("% x: %s", tt.bts, err)
+			continue
+		}
+		if len(left) != 1 {
+			t.Errorf("% x: %d bytes left over; want 1", tt.bts, len(left))
+		}
+		if n.Type() != tt.typ || n.String() != tt.val {
+			t.Errorf("% x: got %s %s; want %s %s", tt.bts, n.Type(), n.String(), tt.typ, tt.val)
+		}
+	}
+}
+
+func TestReadNumber(t *testing.T) {
+	tests := []struct {
+		in  []byte
+		typ Type
+		str string
+	}{
+		{AppendInt64(nil, 3), Int64Type, "3"},
+		{AppendInt64(nil, -3), Int64Type, "-3"},
+		{AppendInt8(nil, -100), Int64Type, "-100"},
+		{AppendInt16(nil, -1000), Int64Type, "-1000"},
+		{AppendInt32(nil, -100000), Int64Type, "-100000"},
+		{AppendInt64(nil, math.MinInt64), Int64Type, "-9223372036854775808"},
+		{AppendUint8(nil, 200), Uint64Type, "200"},
+		{AppendUint16(nil, 60000), Uint64Type, "60000"},
+		{AppendUint32(nil, 4000000000), Uint64Type, "4000000000"},
+		{AppendUint64(nil, math.MaxUint64), Uint64Type, "18446744073709551615"},
+		{AppendFloat32(nil, 1.5), Float32Type, "1.5"},
+		{AppendFloat64(nil, 2.25), Float64Type, "2.25"},
+		{AppendComplex64(nil, complex(1, 2)), Complex64Type, "(1+2i)"},
+		{AppendComplex128(nil, complex(3, 4)), Complex128Type, "(3+4i)"},
+	}
+
+	for i, tt := range tests {
+		n, err := NewReader(bytes.NewReader(tt.in)).ReadNumber()
+		if err != nil {
+			t.Fatalf("case %d: ReadNumber: %s", i, err)
+		}
+		if n.Type() != tt.typ || n.String() != tt.str {
+			t.Errorf("case %d: ReadNumber got %s %s; want %s %s", i, n.Type(), n.String(), tt.typ, tt.str)
+		}
+
+		n, left, err := nbs.ReadNumberBytes(tt.in)
+		if err != nil {
+			t.Fatalf("case %d: ReadNumberBytes: %s", i, err)
+		}
+		if len(left) != 0 {
+			t.Errorf("case %d: ReadNumberBytes left %d bytes", i, len(left))
+		}
+		if n.Type() != tt.typ || n.String() != tt.str {
+			t.Errorf("case %d: ReadNumberBytes got %s %s; want %s %s", i, n.Type(), n.String(), tt.typ, tt.str)
+		}
+	}
+
+	bad := AppendString(nil, "3")
+	if _, err := NewReader(bytes.NewReader(bad)).ReadNumber(); err == nil {
+		t.Error("expected a TypeError from ReadNumber on a string")
+	} else if _, ok := err.(TypeError); !ok {
+		t.Errorf("expected a TypeError from ReadNumber; got %T", err)
+	}
+	if _, left, err := nbs.ReadNumberBytes(bad); err == nil {
+		t.Error("expected a TypeError from ReadNumberBytes on a string")
+	} else if len(left) != len(bad) {
+		t.Errorf("ReadNumberBytes consumed %d bytes on error", len(bad)-len(left))
+	} else if te, ok := err.(TypeError); !ok || te.HasOffset {
+		t.Errorf("expected a TypeError without an offset from ReadNumberBytes; got %#v", err)
+	}
+
+	// a failed DecodeMsg leaves the Number alone
+	var n Number
+	n.AsFloat64(7)
+	if err := n.DecodeMsg(NewReader(bytes.NewReader(bad))); err == nil {
+		t.Error("expected an error from DecodeMsg on a string")
+	}
+	if n.Type() != Float64Type || n.String() != "7" {
+		t.Errorf("failed DecodeMsg changed the Number to %s %s", n.Type(), n.String())
+	}
+}
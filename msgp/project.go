@@ -0,0 +1,135 @@
+package msgp
+
+// CopyNext copies the next object in m
+// to w verbatim, without decoding it.
+// If it is an array or map, the whole
+// array or map is copied.
+func (m *Reader) CopyNext(w *Writer) error {
+	v, o, err := getNextSize(m.R)
+	if err != nil {
+		return err
+	}
+
+	// copy at most one buffer's worth
+	// at a time, so that large strings
+	// and binary blobs don't force the
+	// reader to grow its buffer.
+	chunk := uintptr(m.R.BufferSize())
+	for v > 0 {
+		n := v
+		if n > chunk {
+			n = chunk
+		}
+		p, err := m.R.Next(int(n))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(p)
+		if err != nil {
+			return err
+		}
+		v -= n
+	}
+
+	// for maps and slices, copy elements
+	for x := uintptr(0); x < o; x++ {
+		err = m.CopyNext(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilterKeys reads the next object in r as a
+// map and writes a map to w holding only the
+// key/value pairs for which keep(key) returns true.
+// Kept pairs are copied verbatim; the others
+// are skipped without being decoded. A nil on
+// the wire is copied through as nil.
+func FilterKeys(r *Reader, w *Writer, keep func(key string) bool) error {
+	_, err := filterKeys(r, w, keep, nil)
+	return err
+}
+
+// filterKeys is FilterKeys with a caller-supplied
+// scratch buffer, which is returned for re-use.
+// The kept pairs of one map are staged in scratch
+// because the map header has to be written before
+// them, and we can't know its size in advance.
+func filterKeys(r *Reader, w *Writer, keep func(key string) bool, scratch []byte) ([]byte, error) {
+	var nbs *NilBitsStack
+	if r.IsNil() {
+		err := r.ReadNil()
+		if err != nil {
+			return scratch, err
+		}
+		return scratch, w.WriteNil()
+	}
+	sz, err := r.ReadMapHeader()
+	if err != nil {
+		return scratch, err
+	}
+	scratch = scratch[:0]
+	var kept uint32
+	var key []byte
+	for i := uint32(0); i < sz; i++ {
+		start := len(scratch)
+		err = appendNext(r, &scratch)
+		if err != nil {
+			return scratch, err
+		}
+		key, _, err = nbs.ReadMapKeyZC(scratch[start:])
+		if err != nil {
+			return scratch, err
+		}
+		if !keep(UnsafeString(key)) {
+			scratch = scratch[:start]
+			err = r.Skip()
+			if err != nil {
+				return scratch, err
+			}
+			continue
+		}
+		err = appendNext(r, &scratch)
+		if err != nil {
+			return scratch, err
+		}
+		kept++
+	}
+	err = w.WriteMapHeader(kept)
+	if err != nil {
+		return scratch, err
+	}
+	_, err = w.Write(scratch)
+	return scratch, err
+}
+
+// ProjectArray reads the next object in r as an
+// array of maps and writes to w an array of the
+// same length, in which each map has been reduced
+// to the keys for which keep(key) returns true.
+// This is the "select columns" transform, done
+// one element at a time so that the whole input
+// never has to be held in memory. Since every input
+// element yields exactly one output element, the
+// output array header is known up front and is
+// written before the first element.
+func ProjectArray(r *Reader, w *Writer, keep func(key string) bool) error {
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	err = w.WriteArrayHeader(sz)
+	if err != nil {
+		return err
+	}
+	var scratch []byte
+	for i := uint32(0); i < sz; i++ {
+		scratch, err = filterKeys(r, w, keep, scratch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
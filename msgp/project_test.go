@@ -0,0 +1,144 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProjectArray(t *testing.T) {
+	var in bytes.Buffer
+	w := NewWriter(&in)
+	w.WriteArrayHeader(3)
+	for i := 0; i < 3; i++ {
+		w.WriteMapHeader(4)
+		w.WriteString("id")
+		w.WriteInt64(int64(i))
+		w.WriteString("name")
+		w.WriteString("row")
+		w.WriteString("blob")
+		w.WriteBytes([]byte("skip me"))
+		w.WriteString("tags")
+		w.WriteArrayHeader(2)
+		w.WriteString("a")
+		w.WriteString("b")
+	}
+	w.Flush()
+
+	var out bytes.Buffer
+	pw := NewWriter(&out)
+	keep := func(key string) bool { return key == "id" || key == "tags" }
+	err := ProjectArray(NewReader(&in), pw, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Flush()
+
+	var nbs *NilBitsStack
+	sz, bts, err := nbs.ReadArrayHeaderBytes(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != 3 {
+		t.Fatalf("expected 3 elements; got %d", sz)
+	}
+	for i := 0; i < 3; i++ {
+		var v interface{}
+		v, bts, err = nbs.ReadIntfBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("expected a map; got %T", v)
+		}
+		if len(m) != 2 {
+			t.Errorf("expected 2 keys; got %v", m)
+		}
+		if m["id"] != int64(i) {
+			t.Errorf("expected id %d; got %v", i, m["id"])
+		}
+		if tags, ok := m["tags"].([]interface{}); !ok || len(tags) != 2 {
+			t.Errorf("expected tags to be copied; got %v", m["tags"])
+		}
+	}
+	if len(bts) != 0 {
+		t.Errorf("expected 0 bytes left; found %d", len(bts))
+	}
+}
+
+func TestCopyNext(t *testing.T) {
+	bts := AppendMapHeader(nil, 2)
+	bts = AppendString(bts, "big")
+	bts = AppendBytes(bts, make([]byte, 4096))
+	bts = AppendString(bts, "small")
+	bts = AppendInt64(bts, 5)
+
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	err := NewReaderSize(bytes.NewReader(bts), 64).CopyNext(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if !bytes.Equal(out.Bytes(), bts) {
+		t.Error("CopyNext output differs from its input")
+	}
+}
+
+// TestCopyNextRewrite uses CopyNext the way a router would,
+// replacing one value of a map and passing the rest through.
+func TestCopyNextRewrite(t *testing.T) {
+	nested := func(b []byte) []byte {
+		b = AppendMapHeader(b, 2)
+		b = AppendString(b, "deep")
+		b = AppendMapHeader(b, 1)
+		b = AppendString(b, "list")
+		b = AppendArrayHeader(b, 3)
+		b = AppendInt64(b, 1)
+		b = AppendString(b, "two")
+		b = AppendBytes(b, make([]byte, 300))
+		b = AppendString(b, "flag")
+		return AppendBool(b, true)
+	}
+	in := AppendMapHeader(nil, 2)
+	in = AppendString(in, "status")
+	in = AppendString(in, "old")
+	in = AppendString(in, "body")
+	in = nested(in)
+
+	want := AppendMapHeader(nil, 2)
+	want = AppendString(want, "status")
+	want = AppendString(want, "new")
+	want = AppendString(want, "body")
+	want = nested(want)
+
+	rd := NewReaderSize(bytes.NewReader(in), 64)
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	sz, err := rd.ReadMapHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteMapHeader(sz)
+	for i := uint32(0); i < sz; i++ {
+		key, err := rd.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString(key)
+		if key == "status" {
+			if err = rd.Skip(); err != nil {
+				t.Fatal(err)
+			}
+			w.WriteString("new")
+			continue
+		}
+		if err = rd.CopyNext(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("rewrote to % x; want % x", out.Bytes(), want)
+	}
+}
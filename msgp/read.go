@@ -1,9 +1,12 @@
 package msgp
 
 import (
+	"bytes"
+	"context"
 	"github.com/philhofer/fwd"
 	"io"
 	"math"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -109,9 +112,36 @@ func (t Type) String() string {
 }
 
 func freeR(m *Reader) {
+	m.stats = nil
+	m.src = countReader{}
+	m.maxDepth = 0
+	m.maxMapSize = 0
+	m.maxArraySize = 0
+	m.maxStringSize = 0
+	m.lenientBin = false
+	m.interner = nil
+	m.jsonTags = false
+	m.br.Reset(nil)
+	m.clearNils()
 	readerPool.Put(m)
 }
 
+// clearNils drops any nils that a decode
+// that failed part-way left on the stack
+func (m *Reader) clearNils() {
+	m.AlwaysNil = false
+	m.LifoAlwaysNil = m.LifoAlwaysNil[:0]
+}
+
+// Recycle hands a Reader from NewReader or
+// NewReaderBytes back to the pool they draw
+// from, so that decoding many small messages
+// needn't allocate a Reader for each one. The
+// Reader must not be used after Recycle; any
+// settings (SetMaxDepth, CollectStats, ...) are
+// forgotten.
+func (m *Reader) Recycle() { freeR(m) }
+
 // Unmarshaler is the interface fulfilled
 // by objects that know how to unmarshal
 // themselves from MessagePack.
@@ -137,23 +167,84 @@ func Decode(r io.Reader, d Decodable) error {
 	return err
 }
 
+// DecodeAt decodes 'd' from the object that starts
+// at offset 'off' in 'ra', and returns the number of
+// bytes that object occupied, so that the caller can
+// advance to the next one. This is meant for random
+// access into a file of concatenated records, given
+// an index of their offsets. (The underlying Reader
+// buffers, so DecodeAt may read past the end of the
+// object; those bytes are not counted in 'n'.)
+func DecodeAt(ra io.ReaderAt, off int64, d Decodable) (n int, err error) {
+	rd := NewReader(io.NewSectionReader(ra, off, math.MaxInt64-off))
+	err = d.DecodeMsg(rd)
+	n = rd.offset()
+	freeR(rd)
+	return
+}
+
+// UnmarshalExact unmarshals 'v' from 'b', which
+// must hold exactly one object. Bytes left over
+// after it, a sign of a corrupt or doubly written
+// payload, are reported as ErrTrailingBytes.
+func UnmarshalExact(v Unmarshaler, b []byte) error {
+	left, err := v.UnmarshalMsg(b)
+	if err != nil {
+		return err
+	}
+	if len(left) != 0 {
+		return ErrTrailingBytes{N: len(left)}
+	}
+	return nil
+}
+
+// countReader counts the bytes read through it
+type countReader struct {
+	r io.Reader
+	n int
+
+	// see DecodeMsgContext; once it is done,
+	// reads fail with its error instead of
+	// going to r
+	ctx context.Context
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
 // NewReader returns a *Reader that
 // reads from the provided reader. The
-// reader will be buffered.
+// reader will be buffered. The Reader
+// comes from a pool; see Recycle.
 func NewReader(r io.Reader) *Reader {
 	p := readerPool.Get().(*Reader)
-	if p.R == nil {
-		p.R = fwd.NewReader(r)
-	} else {
-		p.R.Reset(r)
-	}
+	p.Reset(r)
+	return p
+}
+
+// NewReaderBytes returns a *Reader that reads from 'b'.
+// It is the same as calling ResetBytes(b) on a Reader
+// from NewReader.
+func NewReaderBytes(b []byte) *Reader {
+	p := readerPool.Get().(*Reader)
+	p.ResetBytes(b)
 	return p
 }
 
 // NewReaderSize returns a *Reader with a buffer of the given size.
 // (This is vastly preferable to passing the decoder a reader that is already buffered.)
 func NewReaderSize(r io.Reader, sz int) *Reader {
-	return &Reader{R: fwd.NewReaderSize(r, sz)}
+	m := &Reader{src: countReader{r: r}}
+	m.R = fwd.NewReaderSize(&m.src, sz)
+	return m
 }
 
 // Reader wraps an io.Reader and provides
@@ -170,6 +261,34 @@ type Reader struct {
 	R       *fwd.Reader
 	scratch []byte
 
+	// the source of R, which counts the
+	// bytes read so that errors can say
+	// where they happened
+	src countReader
+
+	// the source set by ResetBytes, kept
+	// here so it needn't be allocated
+	br bytes.Reader
+
+	// see CollectStats
+	stats *DecodeStats
+
+	// see SetMaxDepth, SetMaxMapSize,
+	// SetMaxArraySize and SetMaxStringSize
+	maxDepth      int
+	maxMapSize    int
+	maxArraySize  int
+	maxStringSize int
+
+	// see SetLenientBin
+	lenientBin bool
+
+	// see SetInterner
+	interner *Interner
+
+	// see SetJSONTags
+	jsonTags bool
+
 	NilTracker
 }
 
@@ -223,6 +342,22 @@ func (r *NilTracker) PopAlwaysNil() {
 	r.AlwaysNil = a
 }
 
+// NilDepth returns the number of entries on
+// the internal stack, for a later UnwindNils.
+func (r *NilTracker) NilDepth() int {
+	return len(r.LifoAlwaysNil)
+}
+
+// UnwindNils pops the internal stack back down
+// to depth n, as returned by NilDepth. DecodeMsg
+// methods call it when they fail, so that nils
+// pushed before the error don't outlive it.
+func (r *NilTracker) UnwindNils(n int) {
+	for len(r.LifoAlwaysNil) > n {
+		r.PopAlwaysNil()
+	}
+}
+
 // Read implements `io.Reader`
 func (m *Reader) Read(p []byte) (int, error) {
 	if m.AlwaysNil {
@@ -240,8 +375,142 @@ func (m *Reader) ReadFull(p []byte) (int, error) {
 	return m.R.ReadFull(p)
 }
 
-// Reset resets the underlying reader.
-func (m *Reader) Reset(r io.Reader) { m.R.Reset(r) }
+// Reset makes the Reader read from 'r'. Anything
+// buffered from the previous source is dropped, as
+// is any state left over from a decode that failed
+// part-way, so nothing from the last message can
+// turn up in the next one. Settings such as
+// SetMaxDepth and CollectStats are kept.
+func (m *Reader) Reset(r io.Reader) {
+	m.clearNils()
+	m.src = countReader{r: r}
+	if m.R == nil {
+		m.R = fwd.NewReader(&m.src)
+	} else {
+		m.R.Reset(&m.src)
+	}
+}
+
+// ResetBytes makes the Reader read from 'b', so that
+// in-memory data can be decoded with the streaming API.
+// Unlike Reset(bytes.NewReader(b)), this doesn't allocate
+// anything once the Reader has been used, which makes it
+// a good fit for pooled Readers. It is not zero-copy:
+// 'b' still goes through an io.Reader, and is copied
+// into the Reader's buffer a piece at a time, as with
+// any other source. To decode 'b' where it lies, use
+// the UnmarshalMsg methods and the *Bytes functions.
+// The Reader must not be used after 'b' is modified.
+func (m *Reader) ResetBytes(b []byte) {
+	m.br.Reset(b)
+	m.Reset(&m.br)
+}
+
+// offset is the number of bytes consumed
+// since the Reader was last reset, or -1
+// if R was set up without going through
+// NewReader, NewReaderSize or Reset
+func (m *Reader) offset() int {
+	if m.src.r == nil {
+		return -1
+	}
+	return m.src.n - m.R.Buffered()
+}
+
+// badPrefix is the package-level badPrefix
+// for the value at the Reader's position
+func (m *Reader) badPrefix(want Type, lead byte) error {
+	err := badPrefix(want, lead)
+	if t, ok := err.(TypeError); ok {
+		return t.atOffset(m.offset())
+	}
+	return err
+}
+
+// SetMaxDepth sets how deeply maps and arrays may
+// be nested in an object read by Skip, ReadIntf or
+// DecodeEvents before they give up and return
+// ErrMaxDepth. Zero, the default, means
+// MaxNestingDepth.
+func (m *Reader) SetMaxDepth(n int) {
+	m.maxDepth = n
+}
+
+func (m *Reader) depthLimit() int {
+	if m.maxDepth > 0 {
+		return m.maxDepth
+	}
+	return MaxNestingDepth
+}
+
+// SetMaxMapSize sets the largest map that ReadMapHeader
+// will accept; a larger one returns a SizeLimitError.
+// Zero, the default, means DefaultMaxMapSize.
+func (m *Reader) SetMaxMapSize(n int) {
+	m.maxMapSize = n
+}
+
+// SetMaxArraySize sets the largest array that
+// ReadArrayHeader will accept; a larger one returns
+// a SizeLimitError. Zero, the default, means
+// DefaultMaxArraySize.
+func (m *Reader) SetMaxArraySize(n int) {
+	m.maxArraySize = n
+}
+
+// SetMaxStringSize sets the longest str or bin, in
+// bytes, that ReadString, ReadBytes and the like will
+// accept; a longer one returns a SizeLimitError before
+// anything is allocated for it. Zero, the default,
+// means DefaultMaxStringSize.
+func (m *Reader) SetMaxStringSize(n int) {
+	m.maxStringSize = n
+}
+
+// SetLenientBin makes ReadBytes accept a 'str' where it
+// expects a 'bin', as some encoders write byte slices as
+// strings. By default a Reader is strict, and ReadBytes
+// returns a TypeError for anything but a 'bin'.
+func (m *Reader) SetLenientBin(on bool) {
+	m.lenientBin = on
+}
+
+// SetInterner makes ReadString, and with it the
+// generated DecodeMsg methods, take the strings it
+// reads from 'in', so that repeated ones share one
+// copy. Pass nil to go back to allocating each one.
+func (m *Reader) SetInterner(in *Interner) {
+	m.interner = in
+}
+
+// SetJSONTags makes ReadStruct, like the code
+// generator under -json-tags, take the name of a
+// field with no msg tag from its json tag. It is
+// off by default, as it is in the generator.
+func (m *Reader) SetJSONTags(on bool) {
+	m.jsonTags = on
+}
+
+func (m *Reader) stringLimit() int {
+	if m.maxStringSize > 0 {
+		return m.maxStringSize
+	}
+	return DefaultMaxStringSize
+}
+
+func (m *Reader) mapLimit() int {
+	if m.maxMapSize > 0 {
+		return m.maxMapSize
+	}
+	return DefaultMaxMapSize
+}
+
+func (m *Reader) arrayLimit() int {
+	if m.maxArraySize > 0 {
+		return m.maxArraySize
+	}
+	return DefaultMaxArraySize
+}
 
 // Buffered returns the number of bytes currently in the read buffer.
 func (m *Reader) Buffered() int { return m.R.Buffered() }
@@ -273,7 +542,7 @@ func (m *Reader) NextType() (Type, error) {
 			return Complex64Type, nil
 		case Complex128Extension:
 			return Complex128Type, nil
-		case TimeExtension:
+		case TimeExtension, TimestampExtension:
 			return TimeType, nil
 		}
 	}
@@ -281,7 +550,11 @@ func (m *Reader) NextType() (Type, error) {
 }
 
 // IsNil returns whether or not
-// the next byte is a null messagepack byte
+// the next byte is a null messagepack byte.
+// It only peeks at the byte; call ReadNil
+// to consume it. If the byte can't be read,
+// IsNil returns false, and the next read
+// returns the error.
 func (m *Reader) IsNil() bool {
 	if m.AlwaysNil {
 		return true
@@ -290,6 +563,23 @@ func (m *Reader) IsNil() bool {
 	return err == nil && p[0] == mnil
 }
 
+// AtEOF reports whether the underlying reader
+// has no more bytes, as it should after the last
+// object in a stream. It only peeks, so nothing
+// is consumed when there are more bytes. Read
+// errors other than io.EOF are returned.
+func (m *Reader) AtEOF() (bool, error) {
+	_, err := m.R.Peek(1)
+	switch err {
+	case nil:
+		return false, nil
+	case io.EOF:
+		return true, nil
+	default:
+		return false, err
+	}
+}
+
 func (m *Reader) peekNil() bool {
 	p, err := m.R.Peek(1)
 	return err == nil && p[0] == mnil
@@ -340,8 +630,58 @@ func getNextSize(r *fwd.Reader) (uintptr, uintptr, error) {
 
 // Skip skips over the next object, regardless of
 // its type. If it is an array or map, the whole array
-// or map will be skipped.
+// or map will be skipped. Maps and arrays nested more
+// deeply than the Reader allows (see SetMaxDepth)
+// return ErrMaxDepth.
 func (m *Reader) Skip() error {
+	return m.skip(0)
+}
+
+// DecodeMsgContext is d.DecodeMsg(m), except that it
+// gives up once ctx is done and returns ctx.Err().
+// The context is checked before each array or map
+// header and before each read from the underlying
+// io.Reader, so a cancelled decode stops without
+// reading the rest of the stream; a read that is
+// already blocked isn't interrupted, though. After
+// a cancelled decode the Reader's position within
+// the stream is unknown, and it must be Reset
+// before it is used again.
+func (m *Reader) DecodeMsgContext(ctx context.Context, d Decodable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.src.ctx = ctx
+	defer func() { m.src.ctx = nil }()
+	return m.contextErr(d.DecodeMsg(m))
+}
+
+// SkipContext is Skip, except that it gives up once
+// ctx is done and returns ctx.Err(), as described
+// for DecodeMsgContext.
+func (m *Reader) SkipContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.src.ctx = ctx
+	defer func() { m.src.ctx = nil }()
+	return m.contextErr(m.Skip())
+}
+
+// contextErr returns the error of the
+// context set by DecodeMsgContext or
+// SkipContext if it is done, and err
+// otherwise
+func (m *Reader) contextErr(err error) error {
+	if m.src.ctx != nil {
+		if cerr := m.src.ctx.Err(); cerr != nil {
+			return cerr
+		}
+	}
+	return err
+}
+
+func (m *Reader) skip(depth int) error {
 	var (
 		v   uintptr // bytes
 		o   uintptr // objects
@@ -376,8 +716,14 @@ func (m *Reader) Skip() error {
 	}
 
 	// for maps and slices, skip elements
+	if o > 0 && depth >= m.depthLimit() {
+		return ErrMaxDepth
+	}
 	for x := uintptr(0); x < o; x++ {
-		err = m.Skip()
+		if err = m.contextErr(nil); err != nil {
+			return err
+		}
+		err = m.skip(depth + 1)
 		if err != nil {
 			return err
 		}
@@ -389,8 +735,19 @@ func (m *Reader) Skip() error {
 // as a map header and returns the size
 // of the map and the number of bytes written.
 // It will return a TypeError{} if the next
-// object is not a map.
+// object is not a map, and a SizeLimitError
+// if the map is larger than the Reader allows.
+//
+// Each of the sz entries follows as a key and
+// then a value. Keys need not be strings: the
+// code generated for a map[int64]V reads each
+// key with ReadInt64 and each value with the
+// read for V, so a str key on the wire is a
+// TypeError like any other mismatched value.
 func (m *Reader) ReadMapHeader() (sz uint32, err error) {
+	if err = m.contextErr(nil); err != nil {
+		return
+	}
 	if m.checkAndConsumeNil() {
 		return 0, nil
 	}
@@ -404,6 +761,9 @@ func (m *Reader) ReadMapHeader() (sz uint32, err error) {
 	if isfixmap(lead) {
 		sz = uint32(rfixmap(lead))
 		_, err = m.R.Skip(1)
+		if err == nil {
+			err = checkSize(MapType, sz, m.mapLimit())
+		}
 		return
 	}
 	switch lead {
@@ -413,6 +773,7 @@ func (m *Reader) ReadMapHeader() (sz uint32, err error) {
 			return
 		}
 		sz = uint32(big.Uint16(p[1:]))
+		err = checkSize(MapType, sz, m.mapLimit())
 		return
 	case mmap32:
 		p, err = m.R.Next(5)
@@ -420,9 +781,10 @@ func (m *Reader) ReadMapHeader() (sz uint32, err error) {
 			return
 		}
 		sz = big.Uint32(p[1:])
+		err = checkSize(MapType, sz, m.mapLimit())
 		return
 	default:
-		err = badPrefix(MapType, lead)
+		err = m.badPrefix(MapType, lead)
 		return
 	}
 }
@@ -487,11 +849,18 @@ func (m *Reader) ReadMapKeyPtr() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(StrType, sz, m.stringLimit()); err != nil {
+			return nil, err
+		}
+		read = int(sz)
 	default:
-		return nil, badPrefix(StrType, lead)
+		return nil, m.badPrefix(StrType, lead)
 	}
 fill:
+	if err = checkSize(StrType, uint32(read), m.stringLimit()); err != nil {
+		return nil, err
+	}
 	if read == 0 {
 		return nil, ErrShortBytes
 	}
@@ -500,8 +869,13 @@ fill:
 
 // ReadArrayHeader reads the next object as an
 // array header and returns the size of the array
-// and the number of bytes read.
+// and the number of bytes read. It returns a
+// SizeLimitError if the array is larger than
+// the Reader allows.
 func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
+	if err = m.contextErr(nil); err != nil {
+		return
+	}
 	if m.checkAndConsumeNil() {
 		return 0, nil
 	}
@@ -516,6 +890,9 @@ func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
 	if isfixarray(lead) {
 		sz = uint32(rfixarray(lead))
 		_, err = m.R.Skip(1)
+		if err == nil {
+			err = checkSize(ArrayType, sz, m.arrayLimit())
+		}
 		return
 	}
 	switch lead {
@@ -525,6 +902,7 @@ func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
 			return
 		}
 		sz = uint32(big.Uint16(p[1:]))
+		err = checkSize(ArrayType, sz, m.arrayLimit())
 		return
 
 	case marray32:
@@ -533,10 +911,11 @@ func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
 			return
 		}
 		sz = big.Uint32(p[1:])
+		err = checkSize(ArrayType, sz, m.arrayLimit())
 		return
 
 	default:
-		err = badPrefix(ArrayType, lead)
+		err = m.badPrefix(ArrayType, lead)
 		return
 	}
 }
@@ -551,7 +930,7 @@ func (m *Reader) ReadNil() error {
 		return err
 	}
 	if p[0] != mnil {
-		return badPrefix(NilType, p[0])
+		return m.badPrefix(NilType, p[0])
 	}
 	_, err = m.R.Skip(1)
 	return err
@@ -574,7 +953,7 @@ func (m *Reader) checkAndConsumeNil() bool {
 		return false
 	}
 	if p[0] != mnil {
-		return false //, badPrefix(NilType, p[0])
+		return false //, m.badPrefix(NilType, p[0])
 	}
 	_, _ = m.R.Skip(1)
 	return true
@@ -604,7 +983,7 @@ func (m *Reader) ReadFloat64() (f float64, err error) {
 			ef, err := m.ReadFloat32()
 			return float64(ef), err
 		}
-		err = badPrefix(Float64Type, p[0])
+		err = m.badPrefix(Float64Type, p[0])
 		return
 	}
 	f = math.Float64frombits(getMuint64(p))
@@ -624,7 +1003,7 @@ func (m *Reader) ReadFloat32() (f float32, err error) {
 		return
 	}
 	if p[0] != mfloat32 {
-		err = badPrefix(Float32Type, p[0])
+		err = m.badPrefix(Float32Type, p[0])
 		return
 	}
 	f = math.Float32frombits(getMuint32(p))
@@ -647,7 +1026,7 @@ func (m *Reader) ReadBool() (b bool, err error) {
 		b = true
 	case mfalse:
 	default:
-		err = badPrefix(BoolType, p[0])
+		err = m.badPrefix(BoolType, p[0])
 		return
 	}
 	_, err = m.R.Skip(1)
@@ -711,7 +1090,7 @@ func (m *Reader) ReadInt64() (i int64, err error) {
 		return
 
 	default:
-		err = badPrefix(Int64Type, lead)
+		err = m.badPrefix(Int64Type, lead)
 		return
 	}
 }
@@ -829,7 +1208,7 @@ func (m *Reader) ReadUint64() (u uint64, err error) {
 		return
 
 	default:
-		err = badPrefix(Uint64Type, lead)
+		err = m.badPrefix(Uint64Type, lead)
 		return
 
 	}
@@ -916,12 +1295,27 @@ func (m *Reader) ReadByte() (b byte, err error) {
 }
 
 // ReadBytes reads a MessagePack 'bin' object
-// from the reader and returns its value. It may
-// use 'scratch' for storage if it is non-nil.
+// from the reader and returns its value. If
+// 'scratch' has the capacity, the value is read
+// into scratch[:n], reusing its storage; otherwise
+// a new slice is allocated and scratch is left
+// alone. The result always has exactly the length
+// of the bin, so nothing left over in scratch from
+// before is visible through it. A nil on the wire
+// reads as nil. The generated DecodeMsg passes the
+// field's old value as scratch, so a Reader decoding
+// many messages into the same struct needn't allocate
+// for its []byte fields. A 'str' is a TypeError unless
+// SetLenientBin is on.
 func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 	if m.checkAndConsumeNil() {
 		return nil, nil
 	}
+	if m.lenientBin {
+		if t, _ := m.NextType(); t == StrType {
+			return m.ReadStringAsBytes(scratch)
+		}
+	}
 	var p []byte
 	var lead byte
 	p, err = m.R.Peek(2)
@@ -947,7 +1341,10 @@ func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 		}
 		read = int64(big.Uint32(p[1:]))
 	default:
-		err = badPrefix(BinType, lead)
+		err = m.badPrefix(BinType, lead)
+		return
+	}
+	if err = checkSize(BinType, uint32(read), m.stringLimit()); err != nil {
 		return
 	}
 	if int64(cap(scratch)) < read {
@@ -997,7 +1394,7 @@ func (m *Reader) ReadBytesHeader() (sz uint32, err error) {
 		sz = uint32(big.Uint32(p[1:]))
 		return
 	default:
-		err = badPrefix(BinType, p[0])
+		err = m.badPrefix(BinType, p[0])
 		return
 	}
 }
@@ -1040,7 +1437,7 @@ func (m *Reader) ReadExactBytes(into []byte) error {
 		read = int64(big.Uint32(p[1:]))
 		skip = 5
 	default:
-		return badPrefix(BinType, lead)
+		return m.badPrefix(BinType, lead)
 	}
 	if read != int64(len(into)) {
 		return ArrayError{Wanted: uint32(len(into)), Got: uint32(read)}
@@ -1093,16 +1490,22 @@ func (m *Reader) ReadStringAsBytes(scratch []byte) (b []byte, err error) {
 		}
 		read = int64(big.Uint32(p[1:]))
 	default:
-		err = badPrefix(StrType, lead)
+		err = m.badPrefix(StrType, lead)
 		return
 	}
 fill:
+	if err = checkSize(StrType, uint32(read), m.stringLimit()); err != nil {
+		return
+	}
 	if int64(cap(scratch)) < read {
 		b = make([]byte, read)
 	} else {
 		b = scratch[0:read]
 	}
 	_, err = m.R.ReadFull(b)
+	if err == nil && m.stats != nil {
+		m.stats.add(UnsafeString(b))
+	}
 	return
 }
 
@@ -1149,7 +1552,7 @@ func (m *Reader) ReadStringHeader() (sz uint32, err error) {
 		sz = big.Uint32(p[1:])
 		return
 	default:
-		err = badPrefix(StrType, lead)
+		err = m.badPrefix(StrType, lead)
 		return
 	}
 }
@@ -1195,12 +1598,18 @@ func (m *Reader) ReadString() (s string, err error) {
 		}
 		read = int64(big.Uint32(p[1:]))
 	default:
-		err = badPrefix(StrType, lead)
+		err = m.badPrefix(StrType, lead)
 		return
 	}
 fill:
+	if err = checkSize(StrType, uint32(read), m.stringLimit()); err != nil {
+		return
+	}
 	if read == 0 {
 		s, err = "", nil
+		if m.stats != nil {
+			m.stats.add(s)
+		}
 		return
 	}
 	// reading into the memory
@@ -1220,12 +1629,32 @@ fill:
 	// be passed to the underlying reader, and
 	// thus escape analysis *must* conclude that
 	// 'out' escapes.
+	if m.interner != nil && read <= maxInternLen {
+		// short enough to read into scratch,
+		// so that a repeat allocates nothing
+		if cap(m.scratch) < maxInternLen {
+			m.scratch = make([]byte, maxInternLen)
+		}
+		out := m.scratch[:read]
+		_, err = m.R.ReadFull(out)
+		if err != nil {
+			return
+		}
+		s = m.interner.Intern(out)
+		if m.stats != nil {
+			m.stats.add(s)
+		}
+		return
+	}
 	out := make([]byte, read)
 	_, err = m.R.ReadFull(out)
 	if err != nil {
 		return
 	}
 	s = UnsafeString(out)
+	if m.stats != nil {
+		m.stats.add(s)
+	}
 	return
 }
 
@@ -1240,7 +1669,7 @@ func (m *Reader) ReadComplex64() (f complex64, err error) {
 		return
 	}
 	if p[0] != mfixext8 {
-		err = badPrefix(Complex64Type, p[0])
+		err = m.badPrefix(Complex64Type, p[0])
 		return
 	}
 	if int8(p[1]) != Complex64Extension {
@@ -1265,7 +1694,7 @@ func (m *Reader) ReadComplex128() (f complex128, err error) {
 		return
 	}
 	if p[0] != mfixext16 {
-		err = badPrefix(Complex128Type, p[0])
+		err = m.badPrefix(Complex128Type, p[0])
 		return
 	}
 	if int8(p[1]) != Complex128Extension {
@@ -1278,9 +1707,46 @@ func (m *Reader) ReadComplex128() (f complex128, err error) {
 	return
 }
 
+// ReadMapStrStr reads a MessagePack map into a map[string]string.
+// If 'into' is non-nil, its old keys are deleted and it is re-used
+// and returned; otherwise a new map is made. A nil reads as an
+// empty 'into', or a nil map.
+func (m *Reader) ReadMapStrStr(into map[string]string) (map[string]string, error) {
+	for key := range into {
+		delete(into, key)
+	}
+	if m.checkAndConsumeNil() {
+		return into, nil
+	}
+	sz, err := m.ReadMapHeader()
+	if err != nil {
+		return into, err
+	}
+	if into == nil {
+		into = make(map[string]string, Prealloc(sz))
+	}
+	for i := uint32(0); i < sz; i++ {
+		var key, val string
+		key, err = m.ReadString()
+		if err != nil {
+			return into, err
+		}
+		val, err = m.ReadString()
+		if err != nil {
+			return into, err
+		}
+		into[key] = val
+	}
+	return into, nil
+}
+
 // ReadMapStrIntf reads a MessagePack map into a map[string]interface{}.
-// (You must pass a non-nil map into the function.)
+// (You must pass a non-nil map into the function.) The old keys
+// in the map are deleted first.
 func (m *Reader) ReadMapStrIntf(mp map[string]interface{}) (err error) {
+	for key := range mp {
+		delete(mp, key)
+	}
 	if m.checkAndConsumeNil() {
 		return nil
 	}
@@ -1290,9 +1756,6 @@ func (m *Reader) ReadMapStrIntf(mp map[string]interface{}) (err error) {
 	if err != nil {
 		return
 	}
-	for key := range mp {
-		delete(mp, key)
-	}
 	for i := uint32(0); i < sz; i++ {
 		var key string
 		var val interface{}
@@ -1309,36 +1772,127 @@ func (m *Reader) ReadMapStrIntf(mp map[string]interface{}) (err error) {
 	return
 }
 
-// ReadTime reads a time.Time object from the reader.
+// readMapIntf reads a map for ReadIntf. String-keyed maps
+// are the common case, so we start out with a
+// map[string]interface{} and only switch over to a
+// map[interface{}]interface{} once we see some other key.
+func (m *Reader) readMapIntf(depth int) (i interface{}, err error) {
+	var sz uint32
+	sz, err = m.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	if sz > 0 && depth >= m.depthLimit() {
+		return nil, ErrMaxDepth
+	}
+	mp := make(map[string]interface{}, Prealloc(sz))
+	var gen map[interface{}]interface{}
+	for j := uint32(0); j < sz; j++ {
+		var t Type
+		t, err = m.NextType()
+		if err != nil {
+			return
+		}
+		var key, val interface{}
+		if gen == nil && (t == StrType || t == BinType) {
+			var k []byte
+			k, err = m.ReadMapKey(nil)
+			if err != nil {
+				return
+			}
+			val, err = m.readIntf(depth + 1)
+			if err != nil {
+				return
+			}
+			mp[string(k)] = val
+			continue
+		}
+		if gen == nil {
+			gen = make(map[interface{}]interface{}, Prealloc(sz))
+			for k, v := range mp {
+				gen[k] = v
+			}
+		}
+		key, err = m.readIntf(depth + 1)
+		if err != nil {
+			return
+		}
+		key, err = intfMapKey(key)
+		if err != nil {
+			return
+		}
+		val, err = m.readIntf(depth + 1)
+		if err != nil {
+			return
+		}
+		gen[key] = val
+	}
+	if gen != nil {
+		return gen, nil
+	}
+	return mp, nil
+}
+
+// intfMapKey makes a decoded key usable in a
+// map[interface{}]interface{}. 'bin' keys become
+// strings; keys that can't be compared (arrays, maps)
+// are rejected.
+func intfMapKey(key interface{}) (interface{}, error) {
+	switch k := key.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return string(k), nil
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		return nil, &ErrUnsupportedType{T: reflect.TypeOf(key)}
+	}
+	return key, nil
+}
+
+// ReadTime reads a time.Time object from the reader, as
+// written by either WriteTime or WriteTimeExt (that is, in
+// any of the sizes of the standard timestamp extension).
 // The returned time's location will be set to time.Local.
 func (m *Reader) ReadTime() (t time.Time, err error) {
 	if m.checkAndConsumeNil() {
 		return time.Time{}, nil
 	}
 	var p []byte
-	p, err = m.R.Peek(15)
+	p, err = m.R.Peek(3)
 	if err != nil {
 		return
 	}
-	if p[0] != mext8 || p[1] != 12 {
-		err = badPrefix(TimeType, p[0])
+	sz := timestampSize(p)
+	if sz == 0 {
+		err = m.badPrefix(TimeType, p[0])
+		return
+	}
+	p, err = m.R.Peek(sz)
+	if err != nil {
 		return
 	}
-	if int8(p[2]) != TimeExtension {
-		err = errExt(int8(p[2]), TimeExtension)
+	t, err = getTimestamp(p)
+	if err != nil {
 		return
 	}
-	sec, nsec := getUnix(p[3:])
-	t = time.Unix(sec, int64(nsec)).Local()
-	_, err = m.R.Skip(15)
+	_, err = m.R.Skip(sz)
 	return
 }
 
 // ReadIntf reads out the next object as a raw interface{}.
 // Arrays are decoded as []interface{}, and maps are decoded
-// as map[string]interface{}. Integers are decoded as int64
-// and unsigned integers are decoded as uint64.
+// as map[string]interface{}, unless a key on the wire is
+// neither a 'str' nor a 'bin', in which case the map is
+// decoded as map[interface{}]interface{}. Integers are
+// decoded as int64 and unsigned integers are decoded as uint64.
+// Maps and arrays nested more deeply than the Reader allows
+// (see SetMaxDepth) return ErrMaxDepth.
 func (m *Reader) ReadIntf() (i interface{}, err error) {
+	return m.readIntf(0)
+}
+
+func (m *Reader) readIntf(depth int) (i interface{}, err error) {
 	if m.checkAndConsumeNil() {
 		return
 	}
@@ -1400,9 +1954,7 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 		return
 
 	case MapType:
-		mp := make(map[string]interface{})
-		err = m.ReadMapStrIntf(mp)
-		i = mp
+		i, err = m.readMapIntf(depth)
 		return
 
 	case NilType:
@@ -1421,16 +1973,20 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 	case ArrayType:
 		var sz uint32
 		sz, err = m.ReadArrayHeader()
-
 		if err != nil {
 			return
 		}
-		out := make([]interface{}, int(sz))
-		for j := range out {
-			out[j], err = m.ReadIntf()
+		if sz > 0 && depth >= m.depthLimit() {
+			return nil, ErrMaxDepth
+		}
+		out := make([]interface{}, 0, Prealloc(sz))
+		for j := uint32(0); j < sz; j++ {
+			var v interface{}
+			v, err = m.readIntf(depth + 1)
 			if err != nil {
 				return
 			}
+			out = append(out, v)
 		}
 		i = out
 		return
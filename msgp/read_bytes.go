@@ -19,15 +19,20 @@ func NextType(b []byte) Type {
 	}
 	spec := sizes[b[0]]
 	t := spec.typ
-	if t == ExtensionType && len(b) > int(spec.size) {
+	if t == ExtensionType {
+		// the extension type is the second byte of
+		// a fixext, and the last byte of the header
+		// of any other ext
 		var tp int8
-		if spec.extra == constsize {
+		if spec.extra == constsize && len(b) > 1 {
 			tp = int8(b[1])
-		} else {
+		} else if spec.extra != constsize && len(b) >= int(spec.size) {
 			tp = int8(b[spec.size-1])
+		} else {
+			return t
 		}
 		switch tp {
-		case TimeExtension:
+		case TimeExtension, TimestampExtension:
 			return TimeType
 		case Complex128Extension:
 			return Complex128Type
@@ -40,6 +45,81 @@ func NextType(b []byte) Type {
 	return t
 }
 
+// PeekType is like NextType, but reports what
+// keeps it from telling the type: ErrShortBytes
+// if b is cut off within the object's header (its
+// lead byte, the length that follows it, if any,
+// and an extension's type byte), or an
+// InvalidPrefixError for a byte that starts no
+// object. It never reads past the header.
+func PeekType(b []byte) (Type, error) {
+	if len(b) == 0 {
+		return InvalidType, ErrShortBytes
+	}
+	spec := sizes[b[0]]
+	if spec.typ == InvalidType {
+		return InvalidType, InvalidPrefixError(b[0])
+	}
+	hdr := 1
+	switch {
+	case spec.extra < 0:
+		hdr = int(spec.size)
+	case spec.typ == ExtensionType:
+		hdr = 2
+	}
+	if len(b) < hdr {
+		return InvalidType, ErrShortBytes
+	}
+	return NextType(b), nil
+}
+
+// PeekMapHeader returns the number of entries
+// declared by the map header at the front of b,
+// and the length of that header, so b[hdr:] holds
+// the first key; b itself is left as it is. A nil
+// is an empty map with a 1-byte header. Unlike
+// ReadMapHeaderBytes, no size limit is applied.
+// Possible errors:
+// - ErrShortBytes (b cut off within the header)
+// - TypeError{} (not a map)
+func PeekMapHeader(b []byte) (sz uint32, hdr int, err error) {
+	return peekHeader(b, MapType)
+}
+
+// PeekArrayHeader is PeekMapHeader for arrays.
+func PeekArrayHeader(b []byte) (sz uint32, hdr int, err error) {
+	return peekHeader(b, ArrayType)
+}
+
+func peekHeader(b []byte, t Type) (sz uint32, hdr int, err error) {
+	if len(b) == 0 {
+		return 0, 0, ErrShortBytes
+	}
+	lead := b[0]
+	if lead == mnil {
+		return 0, 1, nil
+	}
+	spec := sizes[lead]
+	if spec.typ != t {
+		return 0, 0, badPrefix(t, b[0])
+	}
+	hdr = int(spec.size)
+	if len(b) < hdr {
+		return 0, 0, ErrShortBytes
+	}
+	switch {
+	case hdr == 3:
+		sz = uint32(big.Uint16(b[1:]))
+	case hdr == 5:
+		sz = big.Uint32(b[1:])
+	case t == MapType:
+		sz = uint32(rfixmap(lead))
+	default:
+		sz = uint32(rfixarray(lead))
+	}
+	return sz, hdr, nil
+}
+
 // IsNil returns true if len(b)>0 and
 // the leading byte is a 'nil' MessagePack
 // byte; false otherwise
@@ -180,6 +260,11 @@ func (r *Raw) MarshalJSON() ([]byte, error) {
 // Possible errors:
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not a map)
+// - SizeLimitError (more entries than nbs allows)
+//
+// As with (*Reader).ReadMapHeader, the keys that
+// follow are read with the method for their
+// type, e.g. ReadInt64Bytes for a map[int64]V.
 func (nbs *NilBitsStack) ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
 	if nbs != nil && nbs.AlwaysNil {
 		return 0, b, nil
@@ -198,6 +283,7 @@ func (nbs *NilBitsStack) ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err
 	if isfixmap(lead) {
 		sz = uint32(rfixmap(lead))
 		o = b[1:]
+		err = checkSize(MapType, sz, nbs.mapLimit())
 		return
 	}
 
@@ -209,6 +295,7 @@ func (nbs *NilBitsStack) ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err
 		}
 		sz = uint32(big.Uint16(b[1:]))
 		o = b[3:]
+		err = checkSize(MapType, sz, nbs.mapLimit())
 		return
 
 	case mmap32:
@@ -218,10 +305,11 @@ func (nbs *NilBitsStack) ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err
 		}
 		sz = big.Uint32(b[1:])
 		o = b[5:]
+		err = checkSize(MapType, sz, nbs.mapLimit())
 		return
 
 	default:
-		err = badPrefix(MapType, lead)
+		o, err = b, badPrefix(MapType, b[0])
 		return
 	}
 }
@@ -258,6 +346,7 @@ func (nbs *NilBitsStack) ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
 // Possible errors:
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not an array)
+// - SizeLimitError (more elements than nbs allows)
 func (nbs *NilBitsStack) ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
 	if nbs != nil && nbs.AlwaysNil {
 		return 0, b, nil
@@ -273,6 +362,7 @@ func (nbs *NilBitsStack) ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, er
 	if isfixarray(lead) {
 		sz = uint32(rfixarray(lead))
 		o = b[1:]
+		err = checkSize(ArrayType, sz, nbs.arrayLimit())
 		return
 	}
 
@@ -284,6 +374,7 @@ func (nbs *NilBitsStack) ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, er
 		}
 		sz = uint32(big.Uint16(b[1:]))
 		o = b[3:]
+		err = checkSize(ArrayType, sz, nbs.arrayLimit())
 		return
 
 	case marray32:
@@ -293,10 +384,11 @@ func (nbs *NilBitsStack) ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, er
 		}
 		sz = big.Uint32(b[1:])
 		o = b[5:]
+		err = checkSize(ArrayType, sz, nbs.arrayLimit())
 		return
 
 	default:
-		err = badPrefix(ArrayType, lead)
+		o, err = b, badPrefix(ArrayType, b[0])
 		return
 	}
 }
@@ -352,7 +444,7 @@ func (nbs *NilBitsStack) ReadFloat64Bytes(b []byte) (f float64, o []byte, err er
 			f = float64(tf)
 			return
 		}
-		err = badPrefix(Float64Type, b[0])
+		o, err = b, badPrefix(Float64Type, b[0])
 		return
 	}
 
@@ -380,7 +472,7 @@ func (nbs *NilBitsStack) ReadFloat32Bytes(b []byte) (f float32, o []byte, err er
 	}
 
 	if b[0] != mfloat32 {
-		err = TypeError{Method: Float32Type, Encoded: getType(b[0])}
+		o, err = b, TypeError{Method: Float32Type, Encoded: getType(b[0])}
 		return
 	}
 
@@ -483,7 +575,7 @@ func (nbs *NilBitsStack) ReadInt64Bytes(b []byte) (i int64, o []byte, err error)
 		return
 
 	default:
-		err = badPrefix(Int64Type, lead)
+		o, err = b, badPrefix(Int64Type, b[0])
 		return
 	}
 }
@@ -636,7 +728,7 @@ func (nbs *NilBitsStack) ReadUint64Bytes(b []byte) (u uint64, o []byte, err erro
 		return
 
 	default:
-		err = badPrefix(Uint64Type, lead)
+		o, err = b, badPrefix(Uint64Type, b[0])
 		return
 	}
 }
@@ -740,10 +832,14 @@ func (nbs *NilBitsStack) ReadByteBytes(b []byte) (byte, []byte, error) {
 
 // ReadBytesBytes reads a 'bin' object
 // from 'b' and returns its vaue and
-// the remaining bytes in 'b'.
+// the remaining bytes in 'b'. The value
+// is copied into 'scratch' if it has the
+// capacity, as with (*Reader).ReadBytes,
+// and into a new slice otherwise.
 // Possible errors:
 // - ErrShortBytes (too few bytes)
-// - TypeError{} (not a 'bin' object)
+// - TypeError{} (not a 'bin' object, nor a
+// 'str' under LenientBin)
 func (nbs *NilBitsStack) ReadBytesBytes(b []byte, scratch []byte) (v []byte, o []byte, err error) {
 	if nbs != nil && nbs.AlwaysNil {
 		return nil, b, nil
@@ -751,18 +847,21 @@ func (nbs *NilBitsStack) ReadBytesBytes(b []byte, scratch []byte) (v []byte, o [
 	if len(b) != 0 && b[0] == mnil {
 		return nil, b[1:], nil
 	}
+	if nbs.lenientStr(b) {
+		return nbs.ReadStringAsBytes(b, scratch)
+	}
 
-	return readBytesBytes(b, scratch, false)
+	return readBytesBytes(b, scratch, false, nbs.stringLimit())
 }
 
-func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err error) {
+func readBytesBytes(b []byte, scratch []byte, zc bool, limit int) (v []byte, o []byte, err error) {
 	l := len(b)
 	if l < 1 {
 		return nil, nil, ErrShortBytes
 	}
 
 	lead := b[0]
-	var read int
+	var read uint32
 	switch lead {
 	case mbin8:
 		if l < 2 {
@@ -770,7 +869,7 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 			return
 		}
 
-		read = int(b[1])
+		read = uint32(b[1])
 		b = b[2:]
 
 	case mbin16:
@@ -778,7 +877,7 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 			err = ErrShortBytes
 			return
 		}
-		read = int(big.Uint16(b[1:]))
+		read = uint32(big.Uint16(b[1:]))
 		b = b[3:]
 
 	case mbin32:
@@ -786,16 +885,15 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 			err = ErrShortBytes
 			return
 		}
-		read = int(big.Uint32(b[1:]))
+		read = big.Uint32(b[1:])
 		b = b[5:]
 
 	default:
-		err = badPrefix(BinType, lead)
+		o, err = b, badPrefix(BinType, b[0])
 		return
 	}
 
-	if len(b) < read {
-		err = ErrShortBytes
+	if err = checkBytes(BinType, read, len(b), limit); err != nil {
 		return
 	}
 
@@ -806,7 +904,7 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 		return
 	}
 
-	if cap(scratch) >= read {
+	if cap(scratch) >= int(read) {
 		v = scratch[0:read]
 	} else {
 		v = make([]byte, read)
@@ -821,7 +919,8 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 // points to the same memory as the input slice.
 // Possible errors:
 // - ErrShortBytes (b not long enough)
-// - TypeError{} (object not 'bin')
+// - TypeError{} (object not 'bin', nor a 'str'
+// under LenientBin)
 func (nbs *NilBitsStack) ReadBytesZC(b []byte) (v []byte, o []byte, err error) {
 	if nbs != nil && nbs.AlwaysNil {
 		return nil, b, nil
@@ -829,8 +928,11 @@ func (nbs *NilBitsStack) ReadBytesZC(b []byte) (v []byte, o []byte, err error) {
 	if len(b) != 0 && b[0] == mnil {
 		return nil, b[1:], nil
 	}
+	if nbs.lenientStr(b) {
+		return nbs.ReadStringZC(b)
+	}
 
-	return readBytesBytes(b, nil, true)
+	return readBytesBytes(b, nil, true, nbs.stringLimit())
 }
 
 func (nbs *NilBitsStack) ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
@@ -883,7 +985,7 @@ func (nbs *NilBitsStack) ReadExactBytes(b []byte, into []byte) (o []byte, err er
 		skip = 5
 
 	default:
-		err = badPrefix(BinType, lead)
+		o, err = b, badPrefix(BinType, b[0])
 		return
 	}
 
@@ -916,10 +1018,10 @@ func (nbs *NilBitsStack) ReadStringZC(b []byte) (v []byte, o []byte, err error)
 	}
 
 	lead := b[0]
-	var read int
+	var read uint32
 
 	if isfixstr(lead) {
-		read = int(rfixstr(lead))
+		read = uint32(rfixstr(lead))
 		b = b[1:]
 	} else {
 		switch lead {
@@ -928,7 +1030,7 @@ func (nbs *NilBitsStack) ReadStringZC(b []byte) (v []byte, o []byte, err error)
 				err = ErrShortBytes
 				return
 			}
-			read = int(b[1])
+			read = uint32(b[1])
 			b = b[2:]
 
 		case mstr16:
@@ -936,7 +1038,7 @@ func (nbs *NilBitsStack) ReadStringZC(b []byte) (v []byte, o []byte, err error)
 				err = ErrShortBytes
 				return
 			}
-			read = int(big.Uint16(b[1:]))
+			read = uint32(big.Uint16(b[1:]))
 			b = b[3:]
 
 		case mstr32:
@@ -944,17 +1046,16 @@ func (nbs *NilBitsStack) ReadStringZC(b []byte) (v []byte, o []byte, err error)
 				err = ErrShortBytes
 				return
 			}
-			read = int(big.Uint32(b[1:]))
+			read = big.Uint32(b[1:])
 			b = b[5:]
 
 		default:
-			err = TypeError{Method: StrType, Encoded: getType(lead)}
+			o, err = b, TypeError{Method: StrType, Encoded: getType(lead)}
 			return
 		}
 	}
 
-	if len(b) < read {
-		err = ErrShortBytes
+	if err = checkBytes(StrType, read, len(b), nbs.stringLimit()); err != nil {
 		return
 	}
 
@@ -965,7 +1066,10 @@ func (nbs *NilBitsStack) ReadStringZC(b []byte) (v []byte, o []byte, err error)
 
 // ReadStringBytes reads a 'str' object
 // from 'b' and returns its value and the
-// remaining bytes in 'b'.
+// remaining bytes in 'b'. Under UnsafeZeroCopy
+// the string points into 'b' instead of being
+// a copy, and changes if 'b' is ever written to.
+// An Interner, if set, takes precedence.
 // Possible errors:
 // - ErrShortBytes (b not long enough)
 // - TypeError{} (not 'str' type)
@@ -978,6 +1082,9 @@ func (nbs *NilBitsStack) ReadStringBytes(b []byte) (string, []byte, error) {
 		return "", b[1:], nil
 	}
 	v, o, err := nbs.ReadStringZC(b)
+	if nbs != nil && nbs.Interner != nil && err == nil {
+		return nbs.Interner.Intern(v), o, nil
+	}
 	if nbs != nil && nbs.UnsafeZeroCopy {
 		return UnsafeString(v), o, err
 	}
@@ -1028,7 +1135,7 @@ func (nbs *NilBitsStack) ReadComplex128Bytes(b []byte) (c complex128, o []byte,
 		return
 	}
 	if b[0] != mfixext16 {
-		err = badPrefix(Complex128Type, b[0])
+		o, err = b, badPrefix(Complex128Type, b[0])
 		return
 	}
 	if int8(b[1]) != Complex128Extension {
@@ -1061,7 +1168,7 @@ func (nbs *NilBitsStack) ReadComplex64Bytes(b []byte) (c complex64, o []byte, er
 		return
 	}
 	if b[0] != mfixext8 {
-		err = badPrefix(Complex64Type, b[0])
+		o, err = b, badPrefix(Complex64Type, b[0])
 		return
 	}
 	if b[1] != Complex64Extension {
@@ -1089,21 +1196,24 @@ func (nbs *NilBitsStack) ReadTimeBytes(b []byte) (t time.Time, o []byte, err err
 		return time.Time{}, b[1:], nil
 	}
 
-	if len(b) < 15 {
+	if len(b) < 3 {
 		err = ErrShortBytes
 		return
 	}
-	if b[0] != mext8 || b[1] != 12 {
-		err = badPrefix(TimeType, b[0])
+	sz := timestampSize(b)
+	if sz == 0 {
+		o, err = b, badPrefix(TimeType, b[0])
 		return
 	}
-	if int8(b[2]) != TimeExtension {
-		err = errExt(int8(b[2]), TimeExtension)
+	if len(b) < sz {
+		err = ErrShortBytes
+		return
+	}
+	t, err = getTimestamp(b)
+	if err != nil {
 		return
 	}
-	sec, nsec := getUnix(b[3:])
-	t = time.Unix(sec, int64(nsec)).Local()
-	o = b[15:]
+	o = b[sz:]
 	return
 }
 
@@ -1142,7 +1252,7 @@ func (nbs *NilBitsStack) ReadMapStrIntfBytes(b []byte, old map[string]interface{
 		}
 		v = old
 	} else {
-		v = make(map[string]interface{}, int(sz))
+		v = make(map[string]interface{}, Prealloc(sz))
 	}
 
 	for z := uint32(0); z < sz; z++ {
@@ -1165,9 +1275,107 @@ func (nbs *NilBitsStack) ReadMapStrIntfBytes(b []byte, old map[string]interface{
 	return
 }
 
+// ReadMapStrStrBytes reads a map[string]string
+// out of 'b' and returns the map and remaining bytes.
+// If 'old' is non-nil, its keys are deleted and the
+// values are read into it.
+func (nbs *NilBitsStack) ReadMapStrStrBytes(b []byte, old map[string]string) (v map[string]string, o []byte, err error) {
+	for key := range old {
+		delete(old, key)
+	}
+	if nbs != nil && nbs.AlwaysNil {
+		return old, b, nil
+	}
+	if len(b) != 0 && b[0] == mnil {
+		return old, b[1:], nil
+	}
+
+	var sz uint32
+	sz, o, err = nbs.ReadMapHeaderBytes(b)
+	if err != nil {
+		return old, b, err
+	}
+	v = old
+	if v == nil {
+		v = make(map[string]string, Prealloc(sz))
+	}
+	for z := uint32(0); z < sz; z++ {
+		var key []byte
+		key, o, err = nbs.ReadMapKeyZC(o)
+		if err != nil {
+			return
+		}
+		var val string
+		val, o, err = nbs.ReadStringBytes(o)
+		if err != nil {
+			return
+		}
+		v[string(key)] = val
+	}
+	return
+}
+
+// readMapIntfBytes is the byte-slice counterpart of
+// (*Reader).readMapIntf: it returns a map[string]interface{}
+// unless some key is neither a 'str' nor a 'bin', in which
+// case it returns a map[interface{}]interface{}.
+func (nbs *NilBitsStack) readMapIntfBytes(b []byte) (i interface{}, o []byte, err error) {
+	var sz uint32
+	sz, o, err = nbs.ReadMapHeaderBytes(b)
+	if err != nil {
+		return
+	}
+	mp := make(map[string]interface{}, Prealloc(sz))
+	var gen map[interface{}]interface{}
+	for z := uint32(0); z < sz; z++ {
+		if len(o) < 1 {
+			err = ErrShortBytes
+			return
+		}
+		var key, val interface{}
+		if t := NextType(o); gen == nil && (t == StrType || t == BinType) {
+			var k []byte
+			k, o, err = nbs.ReadMapKeyZC(o)
+			if err != nil {
+				return
+			}
+			val, o, err = nbs.ReadIntfBytes(o)
+			if err != nil {
+				return
+			}
+			mp[string(k)] = val
+			continue
+		}
+		if gen == nil {
+			gen = make(map[interface{}]interface{}, Prealloc(sz))
+			for k, v := range mp {
+				gen[k] = v
+			}
+		}
+		key, o, err = nbs.ReadIntfBytes(o)
+		if err != nil {
+			return
+		}
+		key, err = intfMapKey(key)
+		if err != nil {
+			return
+		}
+		val, o, err = nbs.ReadIntfBytes(o)
+		if err != nil {
+			return
+		}
+		gen[key] = val
+	}
+	if gen != nil {
+		return gen, o, nil
+	}
+	return mp, o, nil
+}
+
 // ReadIntfBytes attempts to read
 // the next object out of 'b' as a raw interface{} and
-// return the remaining bytes.
+// return the remaining bytes. Maps are read as described
+// for (*Reader).ReadIntf.
 func (nbs *NilBitsStack) ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 	if nbs != nil && nbs.AlwaysNil {
 		return nil, b, nil
@@ -1185,7 +1393,7 @@ func (nbs *NilBitsStack) ReadIntfBytes(b []byte) (i interface{}, o []byte, err e
 
 	switch k {
 	case MapType:
-		i, o, err = nbs.ReadMapStrIntfBytes(b, nil)
+		i, o, err = nbs.readMapIntfBytes(b)
 		return
 
 	case ArrayType:
@@ -1194,14 +1402,16 @@ func (nbs *NilBitsStack) ReadIntfBytes(b []byte) (i interface{}, o []byte, err e
 		if err != nil {
 			return
 		}
-		j := make([]interface{}, int(sz))
-		i = j
-		for d := range j {
-			j[d], o, err = nbs.ReadIntfBytes(o)
+		j := make([]interface{}, 0, Prealloc(sz))
+		for d := uint32(0); d < sz; d++ {
+			var v interface{}
+			v, o, err = nbs.ReadIntfBytes(o)
 			if err != nil {
 				return
 			}
+			j = append(j, v)
 		}
+		i = j
 		return
 
 	case Float32Type:
@@ -1307,7 +1517,12 @@ func (nbs *NilBitsStack) ReadIntfBytes(b []byte) (i interface{}, o []byte, err e
 // Possible Errors:
 // - ErrShortBytes (not enough bytes in b)
 // - InvalidPrefixError (bad encoding)
+// - ErrMaxDepth (nested more than MaxNestingDepth deep)
 func Skip(b []byte) ([]byte, error) {
+	return skip(b, 0)
+}
+
+func skip(b []byte, depth int) ([]byte, error) {
 	sz, asz, err := getSize(b)
 	if err != nil {
 		return b, err
@@ -1316,8 +1531,11 @@ func Skip(b []byte) ([]byte, error) {
 		return b, ErrShortBytes
 	}
 	b = b[sz:]
+	if asz > 0 && depth >= MaxNestingDepth {
+		return b, ErrMaxDepth
+	}
 	for asz > 0 {
-		b, err = Skip(b)
+		b, err = skip(b, depth+1)
 		if err != nil {
 			return b, err
 		}
@@ -3,7 +3,9 @@ package msgp
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -98,6 +100,79 @@ func BenchmarkReadArrayHeaderBytes(b *testing.B) {
 	}
 }
 
+func TestPeekHeaders(t *testing.T) {
+	for _, sz := range []uint32{0, 1, 15, 16, 49082, 1 << 20} {
+		for _, tt := range []struct {
+			name string
+			b    []byte
+			peek func([]byte) (uint32, int, error)
+		}{
+			{"map", AppendMapHeader(nil, sz), PeekMapHeader},
+			{"array", AppendArrayHeader(nil, sz), PeekArrayHeader},
+		} {
+			b := append(tt.b, 0xff)
+			got, hdr, err := tt.peek(b)
+			if err != nil {
+				t.Errorf("%s of %d: %v", tt.name, sz, err)
+				continue
+			}
+			if got != sz || hdr != len(tt.b) {
+				t.Errorf("%s of %d: got %d with a %d-byte header; want %d with %d", tt.name, sz, got, hdr, sz, len(tt.b))
+			}
+		}
+	}
+
+	if sz, hdr, err := PeekMapHeader([]byte{mnil}); sz != 0 || hdr != 1 || err != nil {
+		t.Errorf("nil: got %d, %d, %v; want an empty map with a 1-byte header", sz, hdr, err)
+	}
+
+	// cut off within the header
+	short := AppendMapHeader(nil, 49082)
+	for n := 0; n < len(short); n++ {
+		if _, _, err := PeekMapHeader(short[:n]); err != ErrShortBytes {
+			t.Errorf("map16 header cut to %d bytes: got %v; want ErrShortBytes", n, err)
+		}
+	}
+	if _, _, err := PeekArrayHeader([]byte{marray32, 0, 0}); err != ErrShortBytes {
+		t.Errorf("array32 header cut to 3 bytes: got %v; want ErrShortBytes", err)
+	}
+
+	if _, _, err := PeekArrayHeader(AppendMapHeader(nil, 1)); err == nil {
+		t.Error("PeekArrayHeader of a map: expected an error")
+	} else if _, ok := err.(TypeError); !ok {
+		t.Errorf("PeekArrayHeader of a map: got %v; want a TypeError", err)
+	}
+}
+
+func TestPeekType(t *testing.T) {
+	tests := []struct {
+		b   []byte
+		typ Type
+		err error
+	}{
+		{nil, InvalidType, ErrShortBytes},
+		{[]byte{0xc1}, InvalidType, InvalidPrefixError(0xc1)},
+		{[]byte{mmap16}, InvalidType, ErrShortBytes},
+		{[]byte{mmap16, 0}, InvalidType, ErrShortBytes},
+		{[]byte{mmap16, 0, 1}, MapType, nil},
+		{[]byte{mstr8}, InvalidType, ErrShortBytes},
+		{[]byte{mfixext1}, InvalidType, ErrShortBytes},
+		{[]byte{mext8, 16}, InvalidType, ErrShortBytes},
+		{[]byte{mfixext8, byte(TimeExtension)}, TimeType, nil},
+
+		// only the lead byte is needed for these
+		{[]byte{mint64}, Int64Type, nil},
+		{[]byte{mfixstr | 3}, StrType, nil},
+		{AppendMapHeader(nil, 2), MapType, nil},
+	}
+	for _, tt := range tests {
+		typ, err := PeekType(tt.b)
+		if typ != tt.typ || err != tt.err {
+			t.Errorf("PeekType(% x) = %s, %v; want %s, %v", tt.b, typ, err, tt.typ, tt.err)
+		}
+	}
+}
+
 func TestReadNilBytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -111,6 +186,51 @@ func TestReadNilBytes(t *testing.T) {
 	if len(left) != 0 {
 		t.Errorf("expected 0 bytes left; found %d", len(left))
 	}
+
+	// a non-nil is left in place
+	one := AppendInt(nil, 1)
+	if IsNil(one) || nbs.PeekNil(one) {
+		t.Error("1 is not nil")
+	}
+	left, err = nbs.ReadNilBytes(one)
+	if _, ok := err.(TypeError); !ok {
+		t.Fatalf("expected a TypeError; got %v", err)
+	}
+	if len(left) != len(one) {
+		t.Errorf("a failed ReadNilBytes consumed %d bytes", len(one)-len(left))
+	}
+}
+
+func TestReadMapStrStrBytes(t *testing.T) {
+	in := map[string]string{"a": "1", "b": "", "": "empty key"}
+	b := AppendMapStrStr(nil, in)
+	b = AppendNil(b)
+
+	stale := map[string]string{"stale": "x", "a": "old"}
+	out, left, err := nbs.ReadMapStrStrBytes(b, stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("read %v; want %v", out, in)
+	}
+	if reflect.ValueOf(out).Pointer() != reflect.ValueOf(stale).Pointer() {
+		t.Error("expected the map passed in to be re-used")
+	}
+
+	// a nil empties the map passed in
+	out, left, err = nbs.ReadMapStrStrBytes(left, out)
+	if err != nil || len(out) != 0 || len(left) != 0 {
+		t.Errorf("read nil as %v, %v with %d bytes left", out, err, len(left))
+	}
+
+	out, _, err = nbs.ReadMapStrStrBytes(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("read %v; want %v", out, in)
+	}
 }
 
 func BenchmarkReadNilByte(b *testing.B) {
@@ -249,6 +369,30 @@ func TestReadInt64Bytes(t *testing.T) {
 	}
 }
 
+func TestReadNarrowIntOverflowBytes(t *testing.T) {
+	for _, c := range []struct {
+		val  []byte
+		read func([]byte) ([]byte, error)
+		want error
+	}{
+		{AppendInt(nil, 300), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadInt8Bytes(b); return }, IntOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendInt(nil, -1<<15-1), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadInt16Bytes(b); return }, IntOverflow{Value: -1<<15 - 1, FailedBitsize: 16}},
+		{AppendInt(nil, 1<<31), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadInt32Bytes(b); return }, IntOverflow{Value: 1 << 31, FailedBitsize: 32}},
+		{AppendUint(nil, 300), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadUint8Bytes(b); return }, UintOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendUint(nil, 300), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadByteBytes(b); return }, UintOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendUint(nil, 1<<16), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadUint16Bytes(b); return }, UintOverflow{Value: 1 << 16, FailedBitsize: 16}},
+		{AppendUint(nil, 1<<32), func(b []byte) (o []byte, err error) { _, o, err = nbs.ReadUint32Bytes(b); return }, UintOverflow{Value: 1 << 32, FailedBitsize: 32}},
+	} {
+		left, err := c.read(c.val)
+		if err != c.want {
+			t.Errorf("got error %v; want %v", err, c.want)
+		}
+		if len(left) != 0 {
+			t.Errorf("%v: the value was not consumed", c.want)
+		}
+	}
+}
+
 func TestReadUint64Bytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -299,6 +443,60 @@ func TestReadBytesBytes(t *testing.T) {
 	}
 }
 
+func TestReadBytesBytesScratch(t *testing.T) {
+	scratch := []byte("0123456789")
+
+	// shrink: the value goes into scratch
+	out, _, err := nbs.ReadBytesBytes(AppendBytes(nil, []byte("abc")), scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "abc" || &out[0] != &scratch[0] {
+		t.Errorf("a 3-byte bin into a 10-byte scratch gave %q, not scratch[:3]", out)
+	}
+
+	// grow: a new slice, leaving scratch alone
+	long := []byte("abcdefghijklmnop")
+	out, _, err = nbs.ReadBytesBytes(AppendBytes(nil, long), scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, long) || &out[0] == &scratch[0] || string(scratch) != "abc3456789" {
+		t.Errorf("a 16-byte bin into a 10-byte scratch gave %q and left scratch %q", out, scratch)
+	}
+}
+
+func TestReadBytesBytesLenientBin(t *testing.T) {
+	str := AppendString(nil, "abc")
+
+	_, _, err := nbs.ReadBytesBytes(str, nil)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("ReadBytesBytes of a str: got %v; want a TypeError", err)
+	}
+	_, _, err = nbs.ReadBytesZC(str)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("ReadBytesZC of a str: got %v; want a TypeError", err)
+	}
+
+	lenient := &NilBitsStack{LenientBin: true}
+	out, left, err := lenient.ReadBytesBytes(str, nil)
+	if err != nil || string(out) != "abc" || len(left) != 0 {
+		t.Errorf("lenient ReadBytesBytes of a str: got %q, %d left, %v", out, len(left), err)
+	}
+	out, left, err = lenient.ReadBytesZC(str)
+	if err != nil || string(out) != "abc" || len(left) != 0 {
+		t.Errorf("lenient ReadBytesZC of a str: got %q, %d left, %v", out, len(left), err)
+	}
+	out, _, err = lenient.ReadBytesBytes(AppendBytes(nil, []byte("abc")), nil)
+	if err != nil || string(out) != "abc" {
+		t.Errorf("lenient ReadBytesBytes of a bin: got %q, %v", out, err)
+	}
+	_, _, err = lenient.ReadBytesBytes(AppendInt(nil, 3), nil)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("lenient ReadBytesBytes of an int: got %v; want a TypeError", err)
+	}
+}
+
 func TestReadZCBytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -520,3 +718,121 @@ func BenchmarkSkipBytes(b *testing.B) {
 		}
 	}
 }
+
+func TestReadStringBytesSizeLimit(t *testing.T) {
+	// 10 bytes that claim a 4GB str and bin
+	forgedStr := []byte{mstr32, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c', 'd', 'e'}
+	forgedBin := []byte{mbin32, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c', 'd', 'e'}
+
+	wantStr := SizeLimitError{Type: StrType, Size: math.MaxUint32, Limit: DefaultMaxStringSize}
+	wantBin := SizeLimitError{Type: BinType, Size: math.MaxUint32, Limit: DefaultMaxStringSize}
+	if _, _, err := nbs.ReadStringBytes(forgedStr); err != wantStr {
+		t.Errorf("ReadStringBytes of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadStringZC(forgedStr); err != wantStr {
+		t.Errorf("ReadStringZC of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadMapKeyZC(forgedStr); err != wantStr {
+		t.Errorf("ReadMapKeyZC of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadBytesBytes(forgedBin, nil); err != wantBin {
+		t.Errorf("ReadBytesBytes of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadBytesZC(forgedBin); err != wantBin {
+		t.Errorf("ReadBytesZC of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadIntfBytes(forgedStr); err == nil {
+		t.Error("ReadIntfBytes of forged header should fail")
+	}
+
+	// within the limit, but longer than what is left
+	var limited NilBitsStack
+	limited.Init(&RuntimeConfig{MaxStringSize: 8})
+	short := []byte{mstr8, 6, 'a', 'b', 'c'}
+	if _, _, err := limited.ReadStringBytes(short); err != ErrShortBytes {
+		t.Errorf("ReadStringBytes of short string: got %v", err)
+	}
+	if _, _, err := limited.ReadStringBytes(AppendString(nil, "12345678")); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := limited.ReadStringBytes(AppendString(nil, "123456789")); err == nil {
+		t.Error("string of 9 bytes should exceed MaxStringSize of 8")
+	}
+	if _, _, err := limited.ReadBytesBytes(AppendBytes(nil, make([]byte, 9)), nil); err == nil {
+		t.Error("bin of 9 bytes should exceed MaxStringSize of 8")
+	}
+}
+
+func TestReadHeaderBytesSizeLimit(t *testing.T) {
+	forgedMap := []byte{mmap32, 0xff, 0xff, 0xff, 0xff}
+	forgedArray := []byte{marray32, 0xff, 0xff, 0xff, 0xff}
+
+	// the nil *NilBitsStack uses the defaults
+	if _, _, err := nbs.ReadMapHeaderBytes(forgedMap); err != (SizeLimitError{Type: MapType, Size: math.MaxUint32, Limit: DefaultMaxMapSize}) {
+		t.Errorf("ReadMapHeaderBytes of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadArrayHeaderBytes(forgedArray); err != (SizeLimitError{Type: ArrayType, Size: math.MaxUint32, Limit: DefaultMaxArraySize}) {
+		t.Errorf("ReadArrayHeaderBytes of forged header: got %v", err)
+	}
+	if _, _, err := nbs.ReadIntfBytes(forgedArray); err == nil {
+		t.Error("ReadIntfBytes of forged header should fail")
+	}
+
+	var limited NilBitsStack
+	limited.Init(&RuntimeConfig{MaxMapSize: 2, MaxArraySize: 100})
+	if _, _, err := limited.ReadMapHeaderBytes(AppendMapHeader(nil, 2)); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := limited.ReadMapHeaderBytes(AppendMapHeader(nil, 3)); err == nil {
+		t.Error("map of 3 should exceed MaxMapSize of 2")
+	}
+	if _, _, err := limited.ReadArrayHeaderBytes(AppendArrayHeader(nil, 100)); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := limited.ReadArrayHeaderBytes(AppendArrayHeader(nil, 101)); err == nil {
+		t.Error("array of 101 should exceed MaxArraySize of 100")
+	}
+}
+
+func TestTypeErrorOffsetBytes(t *testing.T) {
+	var b []byte
+	b = AppendString(b, "first")
+	b = AppendInt64(b, 1000)
+	at := len(b)
+	b = AppendString(b, "oops")
+
+	_, o, err := nbs.ReadStringBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, o, err = nbs.ReadInt64Bytes(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, left, err := nbs.ReadInt64Bytes(o)
+	if err != (TypeError{Method: Int64Type, Encoded: StrType}) {
+		t.Fatalf("got %#v; want a TypeError with an unknown offset", err)
+	}
+	if len(left) != len(b)-at {
+		t.Fatalf("ReadInt64Bytes consumed %d bytes on error", len(b)-at-len(left))
+	}
+	terr := err
+	err = WithOffset(terr, b, left)
+	if te, ok := err.(TypeError); !ok || !te.HasOffset || te.Offset != at || err.Error() != fmt.Sprintf(`msgp: attempted to decode type "str" with method for "int" at offset %d`, at) {
+		t.Errorf("got %#v (%s)", err, err)
+	}
+
+	// a 'left' from another buffer is no help
+	if err := WithOffset(terr, b, append([]byte(nil), left...)); err != terr {
+		t.Errorf("WithOffset of a copy gave %#v", err)
+	}
+	// and other errors are left alone
+	if err := WithOffset(ErrShortBytes, b, left); err != ErrShortBytes {
+		t.Errorf("WithOffset changed %v", err)
+	}
+
+	// the zero value has no offset
+	if s := (TypeError{}).Error(); strings.Contains(s, "offset") {
+		t.Errorf("TypeError{} says %q", s)
+	}
+}
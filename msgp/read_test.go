@@ -2,12 +2,18 @@ package msgp
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/philhofer/fwd"
 )
 
 func TestSanity(t *testing.T) {
@@ -37,6 +43,15 @@ func TestReadIntf(t *testing.T) {
 			"thing-3": []byte("some inner bytes..."),
 			"thing-4": false,
 		},
+		map[string]interface{}{
+			"nil":   nil,
+			"float": float64(-0.5),
+			"uint":  uint64(1 << 63),
+			"list":  []interface{}{"a", int64(1), true, []interface{}{}},
+			"inner": map[string]interface{}{
+				"deeper": map[string]interface{}{"str": "s"},
+			},
+		},
 	}
 
 	var buf bytes.Buffer
@@ -66,6 +81,30 @@ func TestReadIntf(t *testing.T) {
 
 }
 
+func TestDecodeAt(t *testing.T) {
+	var recs []byte
+	var offs []int64
+	for _, s := range []string{"first", "second record", "third"} {
+		offs = append(offs, int64(len(recs)))
+		recs = AppendMapStrStr(recs, map[string]string{"name": s})
+	}
+
+	var r Raw
+	n, err := DecodeAt(bytes.NewReader(recs), offs[1], &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(n) != offs[2]-offs[1] {
+		t.Errorf("expected to consume %d bytes; got %d", offs[2]-offs[1], n)
+	}
+	if !bytes.Equal([]byte(r), recs[offs[1]:offs[2]]) {
+		t.Errorf("decoded the wrong record: %v", []byte(r))
+	}
+	if got := string(Locate("name", []byte(r))); got != string(AppendString(nil, "second record")) {
+		t.Errorf("unexpected name field %q", got)
+	}
+}
+
 func TestReadMapHeader(t *testing.T) {
 	tests := []struct {
 		Sz uint32
@@ -172,11 +211,91 @@ func TestReadNil(t *testing.T) {
 	rd := NewReader(&buf)
 
 	wr.WriteNil()
+	wr.WriteInt(1)
 	wr.Flush()
+
+	// IsNil only peeks
+	for i := 0; i < 2; i++ {
+		if !rd.IsNil() {
+			t.Fatal("expected IsNil to be true")
+		}
+	}
 	err := rd.ReadNil()
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	// neither IsNil nor a failed ReadNil consume a non-nil
+	if rd.IsNil() {
+		t.Fatal("expected IsNil to be false")
+	}
+	err = rd.ReadNil()
+	if _, ok := err.(TypeError); !ok {
+		t.Fatalf("expected a TypeError; got %v", err)
+	}
+	i, err := rd.ReadInt()
+	if err != nil || i != 1 {
+		t.Fatalf("read %d, %v after the nil; want 1", i, err)
+	}
+	if rd.IsNil() {
+		t.Fatal("expected IsNil to be false at the end")
+	}
+}
+
+func TestReadMapStrStr(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	in := map[string]string{"a": "1", "b": "", "": "empty key"}
+	wr.WriteMapStrStr(in)
+	wr.WriteMapStrIntf(map[string]interface{}{"a": "1", "n": int64(2)})
+	wr.WriteNil()
+	wr.WriteNil()
+	wr.Flush()
+	rd := NewReader(&buf)
+
+	stale := map[string]string{"stale": "x", "a": "old"}
+	out, err := rd.ReadMapStrStr(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("read %v; want %v", out, in)
+	}
+	if reflect.ValueOf(out).Pointer() != reflect.ValueOf(stale).Pointer() {
+		t.Error("expected the map passed in to be re-used")
+	}
+
+	staleIntf := map[string]interface{}{"stale": true}
+	err = rd.ReadMapStrIntf(staleIntf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"a": "1", "n": int64(2)}; !reflect.DeepEqual(staleIntf, want) {
+		t.Errorf("read %v; want %v", staleIntf, want)
+	}
+
+	// a nil empties the map passed in
+	out, err = rd.ReadMapStrStr(out)
+	if err != nil || len(out) != 0 {
+		t.Errorf("read nil as %v, %v", out, err)
+	}
+	staleIntf["stale"] = true
+	err = rd.ReadMapStrIntf(staleIntf)
+	if err != nil || len(staleIntf) != 0 {
+		t.Errorf("read nil as %v, %v", staleIntf, err)
+	}
+
+	// with no map to re-use, one is made
+	buf.Reset()
+	wr.WriteMapStrStr(in)
+	wr.Flush()
+	out, err = rd.ReadMapStrStr(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("read %v; want %v", out, in)
+	}
 }
 
 func BenchmarkReadNil(b *testing.B) {
@@ -333,6 +452,32 @@ func BenchmarkReadInt64(b *testing.B) {
 	}
 }
 
+func TestReadNarrowIntOverflow(t *testing.T) {
+	for _, c := range []struct {
+		val  []byte
+		read func(*Reader) error
+		want error
+	}{
+		{AppendInt(nil, 300), func(r *Reader) (err error) { _, err = r.ReadInt8(); return }, IntOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendInt(nil, -1<<15-1), func(r *Reader) (err error) { _, err = r.ReadInt16(); return }, IntOverflow{Value: -1<<15 - 1, FailedBitsize: 16}},
+		{AppendInt(nil, 1<<31), func(r *Reader) (err error) { _, err = r.ReadInt32(); return }, IntOverflow{Value: 1 << 31, FailedBitsize: 32}},
+		{AppendUint(nil, 300), func(r *Reader) (err error) { _, err = r.ReadUint8(); return }, UintOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendUint(nil, 300), func(r *Reader) (err error) { _, err = r.ReadByte(); return }, UintOverflow{Value: 300, FailedBitsize: 8}},
+		{AppendUint(nil, 1<<16), func(r *Reader) (err error) { _, err = r.ReadUint16(); return }, UintOverflow{Value: 1 << 16, FailedBitsize: 16}},
+		{AppendUint(nil, 1<<32), func(r *Reader) (err error) { _, err = r.ReadUint32(); return }, UintOverflow{Value: 1 << 32, FailedBitsize: 32}},
+	} {
+		// the value is consumed, so reading can go on
+		rd := NewReaderBytes(AppendNil(c.val))
+		err := c.read(rd)
+		if err != c.want {
+			t.Errorf("got error %v; want %v", err, c.want)
+		}
+		if !rd.IsNil() {
+			t.Errorf("%v: the value was not consumed", c.want)
+		}
+	}
+}
+
 func TestReadUint64(t *testing.T) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -409,6 +554,81 @@ func TestReadBytes(t *testing.T) {
 	}
 }
 
+func TestReadBytesScratch(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	rd := NewReader(&buf)
+	read := func(v, scratch []byte) []byte {
+		buf.Reset()
+		rd.Reset(&buf)
+		wr.WriteBytes(v)
+		wr.Flush()
+		out, err := rd.ReadBytes(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, v) {
+			t.Fatalf("%q in; %q out", v, out)
+		}
+		return out
+	}
+
+	// shrink: the value goes into scratch, and
+	// what was left in it is not part of the result
+	scratch := []byte("0123456789")
+	out := read([]byte("abc"), scratch)
+	if len(out) != 3 || &out[0] != &scratch[0] {
+		t.Errorf("a 3-byte bin into a 10-byte scratch gave %q, not scratch[:3]", out)
+	}
+
+	// grow: a new slice, leaving scratch alone
+	out = read([]byte("abcdefghijklmnop"), scratch)
+	if &out[0] == &scratch[0] || string(scratch) != "abc3456789" {
+		t.Errorf("a 16-byte bin into a 10-byte scratch wrote to scratch: %q", scratch)
+	}
+}
+
+func TestReadBytesLenientBin(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+
+	// []byte goes out as a bin, and string as a str
+	wr.WriteBytes([]byte("abc"))
+	wr.WriteString("abc")
+	wr.Flush()
+	if lead := buf.Bytes()[0]; lead != mbin8 {
+		t.Fatalf("WriteBytes wrote prefix %x; want bin8", lead)
+	}
+	rd := NewReader(bytes.NewReader(buf.Bytes()))
+	if typ, err := rd.NextType(); err != nil || typ != BinType {
+		t.Errorf("NextType() = %s, %v; want bin", typ, err)
+	}
+	if _, err := rd.ReadBytes(nil); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := rd.NextType(); err != nil || typ != StrType {
+		t.Errorf("NextType() = %s, %v; want str", typ, err)
+	}
+
+	// strict by default: a str is not a bin
+	_, err := rd.ReadBytes(nil)
+	if _, ok := err.(TypeError); !ok {
+		t.Fatalf("ReadBytes of a str: got %v; want a TypeError", err)
+	}
+
+	rd = NewReader(bytes.NewReader(buf.Bytes()))
+	rd.SetLenientBin(true)
+	for _, want := range []string{"bin", "str"} {
+		out, err := rd.ReadBytes(nil)
+		if err != nil {
+			t.Fatalf("lenient ReadBytes of a %s: %v", want, err)
+		}
+		if string(out) != "abc" {
+			t.Errorf("lenient ReadBytes of a %s: got %q; want \"abc\"", want, out)
+		}
+	}
+}
+
 func benchBytes(size uint32, b *testing.B) {
 	data := make([]byte, 0, size+5)
 	data = AppendBytes(data, RandBytes(int(size)))
@@ -443,6 +663,22 @@ func BenchmarkRead2048Bytes(b *testing.B) {
 	benchBytes(2048, b)
 }
 
+// the same, but without handing
+// the last value back as scratch
+func BenchmarkRead256BytesNoScratch(b *testing.B) {
+	data := AppendBytes(nil, RandBytes(256))
+	rd := NewReader(NewEndlessReader(data, b))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := rd.ReadBytes(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestReadString(t *testing.T) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -685,6 +921,436 @@ func TestSkip(t *testing.T) {
 
 }
 
+func TestSkipNestedMapOfArrays(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+
+	// {"a": [1, [2, "x"], {"b": []}], "c": [nil, true]} then "after"
+	wr.WriteMapHeader(2)
+	wr.WriteString("a")
+	wr.WriteArrayHeader(3)
+	wr.WriteInt(1)
+	wr.WriteArrayHeader(2)
+	wr.WriteInt(2)
+	wr.WriteString("x")
+	wr.WriteMapHeader(1)
+	wr.WriteString("b")
+	wr.WriteArrayHeader(0)
+	wr.WriteString("c")
+	wr.WriteArrayHeader(2)
+	wr.WriteNil()
+	wr.WriteBool(true)
+	wr.WriteString("after")
+	wr.Flush()
+	bts := buf.Bytes()
+
+	rd := NewReader(bytes.NewReader(bts))
+	if err := rd.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := rd.ReadString()
+	if err != nil || s != "after" {
+		t.Errorf("after Skip, read %q, %v; want \"after\"", s, err)
+	}
+
+	rest, err := Skip(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, AppendString(nil, "after")) {
+		t.Errorf("Skip left %x", rest)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		rd.ResetBytes(bts)
+		rd.Skip()
+	})
+	if allocs != 0 {
+		t.Errorf("Skip allocated %v times", allocs)
+	}
+}
+
+func TestSkipMaxDepth(t *testing.T) {
+	nest := func(n int) []byte {
+		var b []byte
+		for i := 0; i < n; i++ {
+			b = AppendArrayHeader(b, 1)
+		}
+		return AppendNil(b)
+	}
+
+	ok := nest(MaxNestingDepth)
+	if err := NewReaderBytes(ok).Skip(); err != nil {
+		t.Errorf("Reader.Skip at MaxNestingDepth: %v", err)
+	}
+	if _, err := Skip(ok); err != nil {
+		t.Errorf("Skip at MaxNestingDepth: %v", err)
+	}
+
+	deep := nest(MaxNestingDepth + 1)
+	if err := NewReaderBytes(deep).Skip(); err != ErrMaxDepth {
+		t.Errorf("Reader.Skip past MaxNestingDepth: got %v; want ErrMaxDepth", err)
+	}
+	if _, err := Skip(deep); err != ErrMaxDepth {
+		t.Errorf("Skip past MaxNestingDepth: got %v; want ErrMaxDepth", err)
+	}
+}
+
+// cancelAfter calls cancel once n bytes
+// have been read from r
+type cancelAfter struct {
+	r      io.Reader
+	n      int
+	read   int
+	cancel func()
+}
+
+func (c *cancelAfter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	if c.read >= c.n {
+		c.cancel()
+	}
+	return n, err
+}
+
+type decodeFunc func(*Reader) error
+
+func (f decodeFunc) DecodeMsg(m *Reader) error { return f(m) }
+
+func TestDecodeMsgContext(t *testing.T) {
+	const count = 100000
+	data := AppendArrayHeader(nil, count)
+	for i := 0; i < count; i++ {
+		data = AppendInt64(data, int64(i))
+	}
+	var got []int64
+	readInts := decodeFunc(func(m *Reader) error {
+		sz, err := m.ReadArrayHeader()
+		if err != nil {
+			return err
+		}
+		got = make([]int64, 0, sz)
+		for i := uint32(0); i < sz; i++ {
+			v, err := m.ReadInt64()
+			if err != nil {
+				return err
+			}
+			got = append(got, v)
+		}
+		return nil
+	})
+
+	// cancelled partway: the decode stops early
+	// and the rest of the stream is left unread
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &cancelAfter{r: bytes.NewReader(data), n: 8192, cancel: cancel}
+	rd := NewReader(src)
+	err := rd.DecodeMsgContext(ctx, readInts)
+	if err != context.Canceled {
+		t.Fatalf("DecodeMsgContext: got %v; want context.Canceled", err)
+	}
+	if len(got) == count || src.read == len(data) {
+		t.Errorf("DecodeMsgContext decoded %d of %d ints, reading %d of %d bytes; want it stopped early",
+			len(got), count, src.read, len(data))
+	}
+
+	// skipping stops the same way
+	ctx, cancel = context.WithCancel(context.Background())
+	src = &cancelAfter{r: bytes.NewReader(data), n: 8192, cancel: cancel}
+	rd.Reset(src)
+	err = rd.SkipContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("SkipContext: got %v; want context.Canceled", err)
+	}
+	if src.read == len(data) {
+		t.Errorf("SkipContext read all %d bytes; want it stopped early", len(data))
+	}
+
+	// a context that is already done reads nothing
+	src = &cancelAfter{r: bytes.NewReader(data), n: len(data), cancel: func() {}}
+	rd.Reset(src)
+	err = rd.DecodeMsgContext(ctx, readInts)
+	if err != context.Canceled || src.read != 0 {
+		t.Errorf("DecodeMsgContext with a done context: got %v after reading %d bytes", err, src.read)
+	}
+
+	// nor is it kept past that call
+	err = readInts.DecodeMsg(rd)
+	if err != nil || len(got) != count {
+		t.Errorf("DecodeMsg after DecodeMsgContext: got %v after %d ints", err, len(got))
+	}
+
+	// otherwise it is DecodeMsg
+	rd.Reset(bytes.NewReader(data))
+	err = rd.DecodeMsgContext(context.Background(), readInts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != count || got[count-1] != count-1 {
+		t.Errorf("DecodeMsgContext decoded %d ints; want %d", len(got), count)
+	}
+}
+
+func TestReadIntfMaxDepth(t *testing.T) {
+	nest := func(n int) []byte {
+		var b []byte
+		for i := 0; i < n; i++ {
+			if i%2 == 0 {
+				b = AppendArrayHeader(b, 1)
+			} else {
+				b = AppendMapHeader(b, 1)
+				b = AppendString(b, "k")
+			}
+		}
+		return AppendNil(b)
+	}
+
+	rd := NewReaderBytes(nest(MaxNestingDepth))
+	if _, err := rd.ReadIntf(); err != nil {
+		t.Errorf("ReadIntf at MaxNestingDepth: %v", err)
+	}
+	rd.ResetBytes(nest(MaxNestingDepth + 1))
+	if _, err := rd.ReadIntf(); err != ErrMaxDepth {
+		t.Errorf("ReadIntf past MaxNestingDepth: got %v; want ErrMaxDepth", err)
+	}
+
+	rd.SetMaxDepth(3)
+	rd.ResetBytes(nest(3))
+	if _, err := rd.ReadIntf(); err != nil {
+		t.Errorf("ReadIntf at a depth of 3: %v", err)
+	}
+	for _, n := range []int{4, 5} {
+		rd.ResetBytes(nest(n))
+		if _, err := rd.ReadIntf(); err != ErrMaxDepth {
+			t.Errorf("ReadIntf at a depth of %d: got %v; want ErrMaxDepth", n, err)
+		}
+		rd.ResetBytes(nest(n))
+		if err := rd.Skip(); err != ErrMaxDepth {
+			t.Errorf("Skip at a depth of %d: got %v; want ErrMaxDepth", n, err)
+		}
+	}
+
+	// an empty map or array at the limit is fine
+	empty := AppendArrayHeader(nil, 1)
+	empty = AppendString(AppendMapHeader(empty, 1), "k")
+	empty = AppendMapHeader(AppendArrayHeader(empty, 1), 0)
+	rd.ResetBytes(empty)
+	if _, err := rd.ReadIntf(); err != nil {
+		t.Errorf("ReadIntf of empty array at the limit: %v", err)
+	}
+}
+
+func TestReadHeaderSizeLimit(t *testing.T) {
+	// 5 bytes that claim 4 billion elements
+	forgedMap := []byte{mmap32, 0xff, 0xff, 0xff, 0xff}
+	forgedArray := []byte{marray32, 0xff, 0xff, 0xff, 0xff}
+
+	rd := NewReaderBytes(forgedMap)
+	_, err := rd.ReadMapHeader()
+	if e, ok := err.(SizeLimitError); !ok || e.Type != MapType || e.Size != math.MaxUint32 || e.Limit != DefaultMaxMapSize {
+		t.Errorf("ReadMapHeader of forged header: got %v", err)
+	}
+	rd.ResetBytes(forgedArray)
+	_, err = rd.ReadArrayHeader()
+	if e, ok := err.(SizeLimitError); !ok || e.Type != ArrayType || e.Size != math.MaxUint32 {
+		t.Errorf("ReadArrayHeader of forged header: got %v", err)
+	}
+	rd.ResetBytes(forgedArray)
+	if _, err = rd.ReadIntf(); err == nil {
+		t.Error("ReadIntf of forged header should fail")
+	}
+
+	// nor may a header just over the default
+	// make ReadIntf allocate for its elements
+	over := AppendArrayHeader(nil, DefaultMaxArraySize+1)
+	rd.ResetBytes(over)
+	if _, err = rd.ReadIntf(); err != (SizeLimitError{Type: ArrayType, Size: DefaultMaxArraySize + 1, Limit: DefaultMaxArraySize}) {
+		t.Errorf("ReadIntf of a header over the limit: got %v", err)
+	}
+
+	// but the defaults leave room for large,
+	// legitimate collections
+	const n = 1<<20 + 1
+	arr := AppendArrayHeader(nil, n)
+	for i := 0; i < n; i++ {
+		arr = AppendInt64(arr, int64(i))
+	}
+	rd.ResetBytes(arr)
+	if sz, err := rd.ReadArrayHeader(); err != nil || sz != n {
+		t.Fatalf("ReadArrayHeader of %d elements: got %d, %v", n, sz, err)
+	}
+	for i := 0; i < n; i++ {
+		if v, err := rd.ReadInt64(); err != nil || v != int64(i) {
+			t.Fatalf("element %d: got %d, %v", i, v, err)
+		}
+	}
+	if sz, _, err := nbs.ReadArrayHeaderBytes(arr); err != nil || sz != n {
+		t.Errorf("ReadArrayHeaderBytes of %d elements: got %d, %v", n, sz, err)
+	}
+	mp := AppendMapHeader(nil, n)
+	for i := 0; i < n; i++ {
+		mp = AppendInt64(AppendInt64(mp, int64(i)), int64(i))
+	}
+	if sz, _, err := nbs.ReadMapHeaderBytes(mp); err != nil || sz != n {
+		t.Errorf("ReadMapHeaderBytes of %d entries: got %d, %v", n, sz, err)
+	}
+
+	rd.SetMaxMapSize(2)
+	rd.SetMaxArraySize(100)
+	for _, tt := range []struct {
+		bts []byte
+		ok  bool
+	}{
+		{AppendMapHeader(nil, 2), true},
+		{AppendMapHeader(nil, 3), false},
+		{AppendMapHeader(nil, 1000), false},
+		{AppendArrayHeader(nil, 100), true},
+		{AppendArrayHeader(nil, 101), false},
+	} {
+		rd.ResetBytes(tt.bts)
+		if NextType(tt.bts) == MapType {
+			_, err = rd.ReadMapHeader()
+		} else {
+			_, err = rd.ReadArrayHeader()
+		}
+		if _, limited := err.(SizeLimitError); limited == tt.ok {
+			t.Errorf("% x: got %v", tt.bts, err)
+		}
+	}
+}
+
+func TestReadHeaderPrealloc(t *testing.T) {
+	// 5 bytes that claim as many elements as
+	// the limits allow, and nothing after them
+	lyingMap := AppendMapHeader(nil, DefaultMaxMapSize)
+	lyingArray := AppendArrayHeader(nil, DefaultMaxArraySize)
+
+	allocated := func(f func() error) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := f(); err == nil {
+			t.Error("expected an error for a header with no elements after it")
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	for name, f := range map[string]func() error{
+		"ReadIntf(array)": func() error { _, err := NewReaderBytes(lyingArray).ReadIntf(); return err },
+		"ReadIntf(map)":   func() error { _, err := NewReaderBytes(lyingMap).ReadIntf(); return err },
+		"ReadMapStrStr":   func() error { _, err := NewReaderBytes(lyingMap).ReadMapStrStr(nil); return err },
+		"ReadIntfBytes(array)": func() error {
+			_, _, err := nbs.ReadIntfBytes(lyingArray)
+			return err
+		},
+		"ReadIntfBytes(map)": func() error {
+			_, _, err := nbs.ReadIntfBytes(lyingMap)
+			return err
+		},
+		"ReadMapStrIntfBytes": func() error {
+			_, _, err := nbs.ReadMapStrIntfBytes(lyingMap, nil)
+			return err
+		},
+		"ReadMapStrStrBytes": func() error {
+			_, _, err := nbs.ReadMapStrStrBytes(lyingMap, nil)
+			return err
+		},
+	} {
+		if n := allocated(f); n > 1<<20 {
+			t.Errorf("%s allocated %d bytes for a 5-byte header", name, n)
+		}
+	}
+}
+
+func TestReadStringSizeLimit(t *testing.T) {
+	// 10 bytes that claim a 4GB str and bin
+	forgedStr := []byte{mstr32, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c', 'd', 'e'}
+	forgedBin := []byte{mbin32, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c', 'd', 'e'}
+
+	rd := NewReaderBytes(forgedStr)
+	_, err := rd.ReadString()
+	if e, ok := err.(SizeLimitError); !ok || e.Type != StrType || e.Size != math.MaxUint32 || e.Limit != DefaultMaxStringSize {
+		t.Errorf("ReadString of forged header: got %v", err)
+	}
+	rd.ResetBytes(forgedStr)
+	if _, err = rd.ReadStringAsBytes(nil); err == nil {
+		t.Error("ReadStringAsBytes of forged header should fail")
+	}
+	rd.ResetBytes(forgedStr)
+	if _, err = rd.ReadMapKeyPtr(); err == nil {
+		t.Error("ReadMapKeyPtr of forged header should fail")
+	}
+	rd.ResetBytes(forgedBin)
+	_, err = rd.ReadBytes(nil)
+	if e, ok := err.(SizeLimitError); !ok || e.Type != BinType || e.Size != math.MaxUint32 {
+		t.Errorf("ReadBytes of forged header: got %v", err)
+	}
+
+	rd.SetMaxStringSize(8)
+	for _, tt := range []struct {
+		bts []byte
+		ok  bool
+	}{
+		{AppendString(nil, "12345678"), true},
+		{AppendString(nil, "123456789"), false},
+		{AppendBytes(nil, make([]byte, 8)), true},
+		{AppendBytes(nil, make([]byte, 9)), false},
+	} {
+		rd.ResetBytes(tt.bts)
+		if NextType(tt.bts) == StrType {
+			_, err = rd.ReadString()
+		} else {
+			_, err = rd.ReadBytes(nil)
+		}
+		if _, limited := err.(SizeLimitError); limited == tt.ok {
+			t.Errorf("% x: got %v", tt.bts, err)
+		}
+	}
+}
+
+func TestTypeErrorOffset(t *testing.T) {
+	var b []byte
+	b = AppendString(b, strings.Repeat("x", 100))
+	b = AppendInt64(b, 1000)
+	at := len(b)
+	b = AppendString(b, "oops")
+
+	// the value is at the same offset whether the
+	// Reader's buffer holds all of b or a bit of it
+	for _, rd := range []*Reader{NewReaderBytes(b), NewReaderSize(bytes.NewReader(b), 16)} {
+		if _, err := rd.ReadString(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rd.ReadInt64(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := rd.ReadInt64()
+		te, ok := err.(TypeError)
+		if !ok || !te.HasOffset || te.Offset != at {
+			t.Errorf("got %#v; want a TypeError at offset %d", err, at)
+		}
+		if !strings.HasSuffix(err.Error(), fmt.Sprintf(" at offset %d", at)) {
+			t.Errorf("error %q doesn't give the offset", err)
+		}
+	}
+
+	// the offset starts over when the Reader is reset
+	rd := NewReaderBytes(b)
+	rd.ReadString()
+	rd.ResetBytes(b)
+	_, err := rd.ReadBool()
+	if te, ok := err.(TypeError); !ok || !te.HasOffset || te.Offset != 0 {
+		t.Errorf("got %#v; want a TypeError at offset 0", err)
+	}
+
+	// a Reader set up by hand doesn't know its offset
+	rd = &Reader{R: fwd.NewReader(bytes.NewReader(b))}
+	_, err = rd.ReadBool()
+	if te, ok := err.(TypeError); !ok || te.HasOffset || strings.Contains(err.Error(), "offset") {
+		t.Errorf("got %#v; want a TypeError without an offset", err)
+	}
+}
+
 func BenchmarkSkip(b *testing.B) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -722,3 +1388,227 @@ func BenchmarkSkip(b *testing.B) {
 		}
 	}
 }
+
+func TestReaderResetBytes(t *testing.T) {
+	var rd Reader // the zero Reader works too
+	for _, s := range []string{"first", "second, and longer", ""} {
+		data := AppendString(AppendMapHeader(nil, 1), s)
+		data = AppendInt64(data, int64(len(s)))
+		rd.ResetBytes(data)
+		sz, err := rd.ReadMapHeader()
+		if err != nil || sz != 1 {
+			t.Fatalf("ReadMapHeader: %d, %v", sz, err)
+		}
+		got, err := rd.ReadString()
+		if err != nil || got != s {
+			t.Fatalf("ReadString: %q, %v; want %q", got, err, s)
+		}
+		n, err := rd.ReadInt64()
+		if err != nil || n != int64(len(s)) {
+			t.Fatalf("ReadInt64: %d, %v", n, err)
+		}
+		err = rd.ReadNil()
+		if err != io.EOF {
+			t.Errorf("expected io.EOF at the end; got %v", err)
+		}
+	}
+}
+
+func TestReaderResetClearsState(t *testing.T) {
+	first := AppendString(AppendString(nil, "first"), "stale")
+	second := AppendString(nil, "second")
+
+	rd := NewReader(bytes.NewReader(first))
+	defer rd.Recycle()
+	if s, err := rd.ReadString(); err != nil || s != "first" {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	if rd.Buffered() == 0 {
+		t.Fatal("expected the rest of the first message to be buffered")
+	}
+
+	// a decode that failed part-way through a nil
+	// struct leaves nils pushed on the stack
+	rd.PushAlwaysNil()
+	rd.Reset(bytes.NewReader(second))
+	if rd.Buffered() != 0 || rd.AlwaysNil || len(rd.LifoAlwaysNil) != 0 {
+		t.Fatalf("Reset left state behind: %d bytes buffered, %s", rd.Buffered(), rd.AlwaysNilString())
+	}
+	if s, err := rd.ReadString(); err != nil || s != "second" {
+		t.Errorf("got %q, %v after Reset; want \"second\"", s, err)
+	}
+	if _, err := rd.ReadString(); err != io.EOF {
+		t.Errorf("got %v; want io.EOF", err)
+	}
+}
+
+func TestRecycleForgetsLenientBin(t *testing.T) {
+	data := AppendString(nil, "abc")
+	rd := NewReaderBytes(data)
+	rd.SetLenientBin(true)
+	if _, err := rd.ReadBytes(nil); err != nil {
+		t.Fatal(err)
+	}
+	rd.Recycle()
+	if rd.lenientBin {
+		t.Error("Recycle kept SetLenientBin(true)")
+	}
+	for i := 0; i < 4; i++ {
+		rd = NewReaderBytes(data)
+		_, err := rd.ReadBytes(nil)
+		if _, ok := err.(TypeError); !ok {
+			t.Errorf("ReadBytes of a str from a pooled Reader: got %v; want a TypeError", err)
+		}
+		rd.Recycle()
+	}
+}
+
+// decodeSmall reads the map[string]string that
+// the Reader benchmarks decode
+func decodeSmall(rd *Reader, scratch []byte) ([]byte, error) {
+	sz, err := rd.ReadMapHeader()
+	for ; err == nil && sz > 0; sz-- {
+		_, err = rd.ReadMapKeyPtr()
+		if err == nil {
+			scratch, err = rd.ReadStringAsBytes(scratch[:0])
+		}
+	}
+	return scratch, err
+}
+
+func BenchmarkDecodeNewReader(b *testing.B) {
+	data := AppendMapStrStr(nil, map[string]string{"a": "hello", "b": "world"})
+	var scratch []byte
+	var err error
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rd := NewReaderSize(bytes.NewReader(data), 256)
+		if scratch, err = decodeSmall(rd, scratch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeRecycledReader(b *testing.B) {
+	data := AppendMapStrStr(nil, map[string]string{"a": "hello", "b": "world"})
+	var scratch []byte
+	var err error
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rd := NewReaderBytes(data)
+		if scratch, err = decodeSmall(rd, scratch); err != nil {
+			b.Fatal(err)
+		}
+		rd.Recycle()
+	}
+}
+
+func benchmarkDecodeFromBytes(b *testing.B, reset func(rd *Reader, data []byte)) {
+	data := AppendMapStrStr(nil, map[string]string{"a": "hello", "b": "world"})
+	rd := NewReader(nil)
+	var scratch []byte
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reset(rd, data)
+		sz, err := rd.ReadMapHeader()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for ; sz > 0; sz-- {
+			_, err = rd.ReadMapKeyPtr()
+			if err != nil {
+				b.Fatal(err)
+			}
+			scratch, err = rd.ReadStringAsBytes(scratch[:0])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeBytesReader(b *testing.B) {
+	benchmarkDecodeFromBytes(b, func(rd *Reader, data []byte) {
+		rd.Reset(bytes.NewReader(data))
+	})
+}
+
+func BenchmarkDecodeResetBytes(b *testing.B) {
+	benchmarkDecodeFromBytes(b, func(rd *Reader, data []byte) {
+		rd.ResetBytes(data)
+	})
+}
+
+func TestUnmarshalExact(t *testing.T) {
+	exact := AppendFloat64(nil, 2.5)
+
+	var n Number
+	if err := UnmarshalExact(&n, exact); err != nil {
+		t.Fatalf("exact: %s", err)
+	}
+	if f, ok := n.Float(); !ok || f != 2.5 {
+		t.Errorf("exact: got %s", n.String())
+	}
+
+	if err := UnmarshalExact(&n, exact[:len(exact)-1]); err != ErrShortBytes {
+		t.Errorf("short: got %v; want ErrShortBytes", err)
+	}
+
+	trailing := append(AppendFloat64(nil, 2.5), mnil, mtrue)
+	err := UnmarshalExact(&n, trailing)
+	if te, ok := err.(ErrTrailingBytes); !ok || te.N != 2 {
+		t.Errorf("trailing: got %v; want ErrTrailingBytes{N: 2}", err)
+	} else if !strings.Contains(err.Error(), "2 trailing bytes") {
+		t.Errorf("trailing: error %q doesn't say how many bytes", err)
+	}
+}
+
+func TestReaderAtEOF(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteInt64(1)
+	wr.WriteString("two")
+	wr.Flush()
+
+	rd := NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		eof, err := rd.AtEOF()
+		if err != nil || eof {
+			t.Fatalf("before object %d: AtEOF() = %v, %v", i, eof, err)
+		}
+		if err := rd.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eof, err := rd.AtEOF()
+	if err != nil || !eof {
+		t.Errorf("after the last object: AtEOF() = %v, %v", eof, err)
+	}
+
+	// a short object leaves no trailing bytes,
+	// but does fail to read
+	rd = NewReader(bytes.NewReader(AppendFloat64(nil, 1)[:3]))
+	if eof, err := rd.AtEOF(); err != nil || eof {
+		t.Errorf("short: AtEOF() = %v, %v", eof, err)
+	}
+	if _, err := rd.ReadFloat64(); err == nil {
+		t.Error("short: expected an error reading the float")
+	}
+
+	rd = NewReader(io.MultiReader(strings.NewReader(""), errorReader{}))
+	if eof, err := rd.AtEOF(); err != errBroken || eof {
+		t.Errorf("broken reader: AtEOF() = %v, %v", eof, err)
+	}
+}
+
+var errBroken = fmt.Errorf("broken reader")
+
+type errorReader struct{}
+
+func (errorReader) Read([]byte) (int, error) { return 0, errBroken }
@@ -0,0 +1,388 @@
+package msgp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	decodableType = reflect.TypeOf((*Decodable)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+)
+
+// ReadInto reads the next object into the value
+// pointed to by 'into', using reflection to find
+// out what is wanted. It is the (slow) complement
+// of WriteIntf, for use when there is no generated
+// code for the destination type. 'into' must be a
+// non-nil pointer to one of the following:
+//  - A bool, float, string, []byte, int, uint, or complex
+//  - A time.Time
+//  - A map whose keys and values are supported types;
+//    keys need not be strings, so a map[int]string
+//    written with WriteIntf reads back as a map[int]string
+//  - An array or slice of supported types
+//  - A pointer to a supported type
+//  - A struct, read as ReadStruct does
+//  - An interface{}, which is filled by ReadIntf
+//  - A type that satisfies the msgp.Decodable interface
+//
+// A nil on the wire sets the destination to its zero value.
+func (m *Reader) ReadInto(into interface{}) error {
+	v := reflect.ValueOf(into)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("msgp: ReadInto needs a non-nil pointer, not %T", into)
+	}
+	return m.readValue(v.Elem())
+}
+
+// ReadStruct reads a map into the struct pointed to
+// by 'into', matching its keys to the struct's fields
+// with reflection, for use when there is no generated
+// code for the struct. A field goes by the name that
+// generated code would give it, as found by FieldTag
+// with the msg tag, falling back on the json tag only
+// if SetJSONTags is on, as under -json-tags. Type clues
+// and zids on the keys, as in "Name__str", are ignored.
+// Keys that match no field are skipped, as are fields
+// tagged "-" and unexported fields, which reflection
+// can't set. An embedded struct is read from a map
+// under the name of its type, which is how generated
+// code writes it, but the keys of its fields are found
+// too, as written under -flatten-embedded.
+func (m *Reader) ReadStruct(into interface{}) error {
+	v := reflect.ValueOf(into)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("msgp: ReadStruct needs a non-nil pointer to a struct, not %T", into)
+	}
+	return m.readValue(v.Elem())
+}
+
+// FieldTag returns the name that the struct tag of a
+// field gives it on the wire, and the options after the
+// name, as the code generator reads them: from the tag
+// under 'key', usually "msg", or, if there is no such
+// tag and jsonFallback is set, just the name from the
+// json tag. An empty name means the field keeps its own
+// name. 'skip' is set if the field is skipped: when the
+// name is "-", or, as encoding/json has it, when the
+// json tag is exactly "-", since json's "-," names the
+// field "-".
+func FieldTag(tag reflect.StructTag, key string, jsonFallback bool) (name string, opts []string, skip bool) {
+	body, ok := tag.Lookup(key)
+	if !ok && jsonFallback {
+		// only the name; json's options mean other things
+		body = tag.Get("json")
+		if body == "-" {
+			return "-", []string{}, true
+		}
+		if i := strings.Index(body, ","); i >= 0 {
+			body = body[:i]
+		}
+		return body, []string{}, false
+	}
+	tags := strings.Split(body, ",")
+	return tags[0], tags[1:], tags[0] == "-"
+}
+
+// UnmarshalInto is the []byte counterpart of
+// (*Reader).ReadInto. It reads the next object in 'b'
+// into the value pointed to by 'into' and returns the
+// remaining bytes.
+func UnmarshalInto(b []byte, into interface{}) ([]byte, error) {
+	o, err := Skip(b)
+	if err != nil {
+		return b, err
+	}
+	rd := NewReaderBytes(b[:len(b)-len(o)])
+	err = rd.ReadInto(into)
+	freeR(rd)
+	if err != nil {
+		return b, err
+	}
+	return o, nil
+}
+
+func (m *Reader) readValue(v reflect.Value) (err error) {
+	if v.CanAddr() && v.Addr().Type().Implements(decodableType) {
+		return v.Addr().Interface().(Decodable).DecodeMsg(m)
+	}
+	if m.IsNil() {
+		err = m.ReadNil()
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		var b bool
+		b, err = m.ReadBool()
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = m.ReadInt64()
+		if err != nil {
+			return
+		}
+		if v.OverflowInt(i) {
+			return IntOverflow{Value: i, FailedBitsize: v.Type().Bits()}
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = m.ReadUint64()
+		if err != nil {
+			return
+		}
+		if v.OverflowUint(u) {
+			return UintOverflow{Value: u, FailedBitsize: v.Type().Bits()}
+		}
+		v.SetUint(u)
+
+	case reflect.Float32:
+		var f float32
+		f, err = m.ReadFloat32()
+		v.SetFloat(float64(f))
+
+	case reflect.Float64:
+		var f float64
+		f, err = m.ReadFloat64()
+		v.SetFloat(f)
+
+	case reflect.Complex64:
+		var c complex64
+		c, err = m.ReadComplex64()
+		v.SetComplex(complex128(c))
+
+	case reflect.Complex128:
+		var c complex128
+		c, err = m.ReadComplex128()
+		v.SetComplex(c)
+
+	case reflect.String:
+		var s string
+		s, err = m.ReadString()
+		v.SetString(s)
+
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &ErrUnsupportedType{T: v.Type()}
+		}
+		var i interface{}
+		i, err = m.ReadIntf()
+		if err != nil {
+			return
+		}
+		if i == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(i))
+		}
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		err = m.readValue(v.Elem())
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var b []byte
+			b, err = m.ReadBytes(v.Bytes())
+			v.SetBytes(b)
+			return
+		}
+		var sz uint32
+		sz, err = m.ReadArrayHeader()
+		if err != nil {
+			return
+		}
+		if v.Cap() >= int(sz) {
+			v.SetLen(int(sz))
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), int(sz), int(sz)))
+		}
+		for i := 0; i < int(sz); i++ {
+			err = m.readValue(v.Index(i))
+			if err != nil {
+				return
+			}
+		}
+
+	case reflect.Array:
+		var sz uint32
+		sz, err = m.ReadArrayHeader()
+		if err != nil {
+			return
+		}
+		if int(sz) != v.Len() {
+			return ArrayError{Wanted: uint32(v.Len()), Got: sz}
+		}
+		for i := 0; i < v.Len(); i++ {
+			err = m.readValue(v.Index(i))
+			if err != nil {
+				return
+			}
+		}
+
+	case reflect.Map:
+		err = m.readMapValue(v)
+
+	case reflect.Struct:
+		if v.Type() == timeType {
+			var t time.Time
+			t, err = m.ReadTime()
+			v.Set(reflect.ValueOf(t))
+			return
+		}
+		err = m.readStruct(v)
+
+	default:
+		return &ErrUnsupportedType{T: v.Type()}
+	}
+	return
+}
+
+// readMapValue reads a map into v, whatever its key type.
+// Each key is decoded with the same rules as any other
+// value, so an integer key on the wire fills an integer
+// key in v, and a mismatch is reported as a TypeError.
+func (m *Reader) readMapValue(v reflect.Value) (err error) {
+	var sz uint32
+	sz, err = m.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	typ := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(typ, int(sz)))
+	} else {
+		for _, key := range v.MapKeys() {
+			v.SetMapIndex(key, reflect.Value{})
+		}
+	}
+	for i := uint32(0); i < sz; i++ {
+		key := reflect.New(typ.Key()).Elem()
+		err = m.readValue(key)
+		if err != nil {
+			return
+		}
+		val := reflect.New(typ.Elem()).Elem()
+		err = m.readValue(val)
+		if err != nil {
+			return
+		}
+		v.SetMapIndex(key, val)
+	}
+	return
+}
+
+// readStruct reads a map into the struct v.
+func (m *Reader) readStruct(v reflect.Value) (err error) {
+	var sz uint32
+	sz, err = m.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for i := uint32(0); i < sz; i++ {
+		var key []byte
+		key, err = m.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		f, ok := structField(v, string(key), m.jsonTags, nil)
+		if !ok {
+			if name, _, _, cerr := Field2Clue(string(key)); cerr == nil {
+				f, ok = structField(v, name, m.jsonTags, nil)
+			}
+		}
+		if ok {
+			err = m.readValue(f)
+		} else {
+			err = m.Skip()
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// structField finds the field of the struct v named
+// 'name' on the wire: one of its own fields, or else
+// one promoted from an embedded struct, allocating an
+// embedded pointer if that is where the field is.
+// 'outer' holds the types already being searched, so
+// that embedded pointers can't send it round in circles.
+func structField(v reflect.Value, name string, jsonTags bool, outer []reflect.Type) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && wireName(f, jsonTags) == name {
+			return v.Field(i), true
+		}
+	}
+	outer = append(outer, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.Anonymous || wireName(f, jsonTags) == "" {
+			continue
+		}
+		et := f.Type
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if et.Kind() != reflect.Struct || et == timeType || hasType(outer, et) {
+			continue
+		}
+		ev := v.Field(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				// only allocate for a match
+				if _, ok := structField(reflect.New(et).Elem(), name, jsonTags, outer); !ok || !ev.CanSet() {
+					continue
+				}
+				ev.Set(reflect.New(et))
+			}
+			ev = ev.Elem()
+		}
+		if fv, ok := structField(ev, name, jsonTags, outer); ok {
+			return fv, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// wireName returns the name of f on the wire,
+// or "" if generated code would skip it; json
+// tags are read only if jsonTags is set.
+func wireName(f reflect.StructField, jsonTags bool) string {
+	name, _, skip := FieldTag(f.Tag, "msg", jsonTags)
+	if skip || strings.HasPrefix(strings.TrimSpace(f.Tag.Get("zid")), "-") {
+		return ""
+	}
+	if name != "" {
+		return name
+	}
+	if f.Anonymous {
+		t := f.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return t.Name()
+	}
+	return f.Name
+}
+
+func hasType(ts []reflect.Type, t reflect.Type) bool {
+	for _, u := range ts {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadIntoIntKeyedMap(t *testing.T) {
+	in := map[int]string{1: "one", -2: "minus two", 300: "three hundred"}
+
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	err := wr.WriteIntf(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	bts := buf.Bytes()
+
+	var out map[int]string
+	err = NewReader(bytes.NewReader(bts)).ReadInto(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("%v in; %v out", in, out)
+	}
+
+	// the byte-slice path should agree
+	var out2 map[int]string
+	left, err := UnmarshalInto(bts, &out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("expected 0 bytes left; found %d", len(left))
+	}
+	if !reflect.DeepEqual(in, out2) {
+		t.Errorf("%v in; %v out", in, out2)
+	}
+
+	// without a typed destination, we should
+	// get a map[interface{}]interface{}
+	i, err := NewReader(bytes.NewReader(bts)).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, ok := i.(map[interface{}]interface{})
+	if !ok {
+		t.Fatalf("expected map[interface{}]interface{}; got %T", i)
+	}
+	if gen[int64(-2)] != "minus two" {
+		t.Errorf("expected gen[-2] to be %q; got %v", "minus two", gen[int64(-2)])
+	}
+
+	i, _, err = (*NilBitsStack)(nil).ReadIntfBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(i, gen) {
+		t.Errorf("ReadIntfBytes gave %v; ReadIntf gave %v", i, gen)
+	}
+}
+
+func TestReadIntoKeyMismatch(t *testing.T) {
+	bts := AppendMapHeader(nil, 1)
+	bts = AppendString(bts, "one")
+	bts = AppendString(bts, "uno")
+
+	var out map[int]string
+	err := NewReader(bytes.NewReader(bts)).ReadInto(&out)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("expected a TypeError; got %v", err)
+	}
+}
+
+type RSBase struct {
+	ID      int64
+	Created string `msg:"created"`
+}
+
+type RSTags struct {
+	Kind string
+}
+
+type rsRecord struct {
+	RSBase
+	*RSTags
+	Name   string `msg:"name"`
+	Alias  string `json:"alias,omitempty"`
+	Secret string `msg:"-"`
+	Score  float64
+	hidden int
+}
+
+func TestReadStruct(t *testing.T) {
+	// the keys as generated code writes them,
+	// with the embedded struct under its name
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteMapHeader(7)
+	wr.WriteString("RSBase__rct")
+	wr.WriteMapHeader(2)
+	wr.WriteString("ID__i64")
+	wr.WriteInt64(7)
+	wr.WriteString("created__str")
+	wr.WriteString("today")
+	wr.WriteString("name__str")
+	wr.WriteString("widget")
+	wr.WriteString("alias")
+	wr.WriteString("gizmo")
+	wr.WriteString("Secret__str")
+	wr.WriteString("exposed")
+	wr.WriteString("Extra__i64")
+	wr.WriteInt64(99)
+	// a promoted field, as under -flatten-embedded
+	wr.WriteString("Kind__str")
+	wr.WriteString("part")
+	wr.WriteString("Score_zid03_f64")
+	wr.WriteFloat64(1.5)
+	wr.Flush()
+
+	var out rsRecord
+	out.hidden = 3
+	rd := NewReader(&buf)
+	rd.SetJSONTags(true)
+	if err := rd.ReadStruct(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := rsRecord{
+		RSBase: RSBase{ID: 7, Created: "today"},
+		RSTags: &RSTags{Kind: "part"},
+		Name:   "widget",
+		Alias:  "gizmo",
+		Score:  1.5,
+		hidden: 3,
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %+v (tags %+v); want %+v", out, out.RSTags, want)
+	}
+	if rd.Buffered() != 0 {
+		t.Errorf("%d bytes left unread", rd.Buffered())
+	}
+
+	// a nil leaves the zero value
+	bts := AppendNil(nil)
+	if _, err := UnmarshalInto(bts, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, rsRecord{}) {
+		t.Errorf("expected a zero rsRecord from nil; got %+v", out)
+	}
+
+	if err := NewReader(&buf).ReadStruct(&out.Name); err == nil {
+		t.Error("expected an error reading a struct into a *string")
+	}
+}
+
+func TestReadStructJSONTags(t *testing.T) {
+	// without -json-tags, generated code
+	// writes Alias under its own name
+	bts := AppendMapHeader(nil, 2)
+	bts = AppendString(bts, "Alias__str")
+	bts = AppendString(bts, "gizmo")
+	bts = AppendString(bts, "alias")
+	bts = AppendString(bts, "ignored")
+
+	var out rsRecord
+	if err := NewReaderBytes(bts).ReadStruct(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Alias != "gizmo" {
+		t.Errorf("Alias = %q by default; want \"gizmo\"", out.Alias)
+	}
+
+	// and with it, under the name in its json tag
+	bts = AppendMapHeader(nil, 2)
+	bts = AppendString(bts, "alias")
+	bts = AppendString(bts, "gizmo")
+	bts = AppendString(bts, "Alias__str")
+	bts = AppendString(bts, "ignored")
+	out = rsRecord{}
+	rd := NewReaderBytes(bts)
+	rd.SetJSONTags(true)
+	if err := rd.ReadStruct(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Alias != "gizmo" {
+		t.Errorf("Alias = %q with SetJSONTags; want \"gizmo\"", out.Alias)
+	}
+}
+
+func TestFieldTag(t *testing.T) {
+	for _, c := range []struct {
+		tag      reflect.StructTag
+		fallback bool
+		name     string
+		opts     []string
+		skip     bool
+	}{
+		{`msg:"a,omitempty"`, false, "a", []string{"omitempty"}, false},
+		{`msg:",readonly" json:"b"`, true, "", []string{"readonly"}, false},
+		{`json:"b,omitempty"`, true, "b", []string{}, false},
+		{`json:"b"`, false, "", []string{}, false},
+		{`msg:"-"`, false, "-", []string{}, true},
+		{`json:"-"`, true, "-", []string{}, true},
+		{`json:"-,"`, true, "-", []string{}, false},
+	} {
+		name, opts, skip := FieldTag(c.tag, "msg", c.fallback)
+		if name != c.name || !reflect.DeepEqual(opts, c.opts) || skip != c.skip {
+			t.Errorf("FieldTag(%s, %v): got %q %q %v; want %q %q %v", c.tag, c.fallback, name, opts, skip, c.name, c.opts, c.skip)
+		}
+	}
+}
@@ -10,4 +10,24 @@ type RuntimeConfig struct {
 	// without re-using any part of a message (or making a copy of strings explicitly with copy()
 	// if you must) then we can avoid all allocations for strings.
 	UnsafeZeroCopy bool
+
+	// MaxMapSize and MaxArraySize are the largest
+	// maps and arrays that will be unmarshaled; zero
+	// means DefaultMaxMapSize and DefaultMaxArraySize.
+	MaxMapSize   int
+	MaxArraySize int
+
+	// MaxStringSize is the longest str or bin, in
+	// bytes, that will be unmarshaled; zero means
+	// DefaultMaxStringSize.
+	MaxStringSize int
+
+	// LenientBin lets a 'str' be unmarshaled into
+	// a []byte; by default only a 'bin' is.
+	LenientBin bool
+
+	// Interner, if set, makes the strings that
+	// are unmarshaled come from it, so that
+	// repeated ones share one copy.
+	Interner *Interner
 }
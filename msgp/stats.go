@@ -0,0 +1,57 @@
+package msgp
+
+// DecodeStats tallies the strings read by a
+// Reader, to help decide whether interning
+// strings with an Interner would be worthwhile
+// for a given kind of traffic. See
+// (*Reader).CollectStats.
+type DecodeStats struct {
+	// Strings is the number of strings read.
+	Strings int
+
+	// Unique is the number of distinct strings read.
+	Unique int
+
+	// Bytes is the total length of the strings read.
+	Bytes int
+
+	// SavedBytes is the number of bytes that would
+	// not have been allocated had every repeat
+	// of a string shared the first copy of it.
+	SavedBytes int
+
+	seen map[string]struct{}
+}
+
+// CollectStats makes the Reader tally every string
+// it reads with ReadString or ReadStringAsBytes into
+// 's', in addition to decoding as usual. Map keys
+// are not counted. Pass nil to stop collecting.
+//
+// Keeping track of unique strings means holding a
+// copy of each one, so this is meant for diagnosis,
+// not for use in production.
+func (m *Reader) CollectStats(s *DecodeStats) {
+	m.stats = s
+}
+
+func (s *DecodeStats) add(str string) {
+	s.Strings++
+	s.Bytes += len(str)
+	if _, ok := s.seen[str]; ok {
+		s.SavedBytes += len(str)
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]struct{})
+	}
+	// str may point into memory
+	// that is about to be re-used
+	s.seen[string([]byte(str))] = struct{}{}
+	s.Unique++
+}
+
+// Reset clears the tallies in 's'.
+func (s *DecodeStats) Reset() {
+	*s = DecodeStats{}
+}
@@ -0,0 +1,62 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeStats(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	words := []string{"red", "green", "red", "blue", "red", "green", ""}
+	en.WriteArrayHeader(uint32(len(words)))
+	for _, w := range words {
+		en.WriteString(w)
+	}
+	en.Flush()
+
+	var stats DecodeStats
+	rd := NewReader(&buf)
+	rd.CollectStats(&stats)
+	sz, err := rd.ReadArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scratch := make([]byte, 0, 16)
+	for i := uint32(0); i < sz; i++ {
+		// mix both read paths; the scratch
+		// buffer is re-used on purpose
+		if i%2 == 0 {
+			_, err = rd.ReadString()
+		} else {
+			_, err = rd.ReadStringAsBytes(scratch)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats.Strings != 7 {
+		t.Errorf("Strings = %d; want 7", stats.Strings)
+	}
+	if stats.Unique != 4 {
+		t.Errorf("Unique = %d; want 4", stats.Unique)
+	}
+	if stats.Bytes != 3+5+3+4+3+5 {
+		t.Errorf("Bytes = %d; want %d", stats.Bytes, 3+5+3+4+3+5)
+	}
+	if stats.SavedBytes != 3+3+5 {
+		t.Errorf("SavedBytes = %d; want %d", stats.SavedBytes, 3+3+5)
+	}
+
+	stats.Reset()
+	rd.CollectStats(nil)
+	buf.Reset()
+	en.WriteString("red")
+	en.Flush()
+	rd.Reset(&buf)
+	rd.ReadString()
+	if stats.Strings != 0 {
+		t.Errorf("strings were counted after CollectStats(nil)")
+	}
+}
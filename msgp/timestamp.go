@@ -0,0 +1,96 @@
+package msgp
+
+import (
+	"time"
+)
+
+// The MessagePack spec's timestamp extension
+// (type -1) comes in three sizes:
+//
+//	fixext4:        32-bit unsigned seconds
+//	fixext8:        30-bit nanoseconds, then 34-bit unsigned seconds
+//	ext8, len 12:   32-bit nanoseconds, then 64-bit signed seconds
+//
+// WriteTime and AppendTime use the older TimeExtension
+// encoding, which is always 15 bytes; ReadTime and
+// ReadTimeBytes read all four.
+
+// TimestampExtension as it appears on the wire
+const tsByte = 0xff
+
+// timestampSize returns the encoded size of the time
+// that starts 'b', or 0 if 'b' doesn't start with one
+// of the encodings above. 'b' must hold at least 3 bytes.
+func timestampSize(b []byte) int {
+	switch b[0] {
+	case mfixext4:
+		return 6
+	case mfixext8:
+		return 10
+	case mext8:
+		if b[1] == 12 {
+			return 15
+		}
+	}
+	return 0
+}
+
+// getTimestamp decodes the time at the start of 'b',
+// which must hold timestampSize(b) bytes
+func getTimestamp(b []byte) (time.Time, error) {
+	var sec int64
+	var nsec uint32
+	switch b[0] {
+	case mfixext4:
+		if int8(b[1]) != TimestampExtension {
+			return time.Time{}, errExt(int8(b[1]), TimestampExtension)
+		}
+		sec = int64(big.Uint32(b[2:]))
+	case mfixext8:
+		if int8(b[1]) != TimestampExtension {
+			return time.Time{}, errExt(int8(b[1]), TimestampExtension)
+		}
+		u := big.Uint64(b[2:])
+		nsec = uint32(u >> 34)
+		sec = int64(u & (1<<34 - 1))
+	default:
+		switch int8(b[2]) {
+		case TimeExtension:
+			s, ns := getUnix(b[3:])
+			sec, nsec = s, uint32(ns)
+		case TimestampExtension:
+			nsec = big.Uint32(b[3:])
+			sec = int64(big.Uint64(b[7:]))
+		default:
+			return time.Time{}, errExt(int8(b[2]), TimeExtension)
+		}
+	}
+	return time.Unix(sec, int64(nsec)).Local(), nil
+}
+
+// putTimestamp writes 't' to 'b' in the smallest
+// timestamp extension that holds it, and returns
+// the number of bytes written. 'b' must have room
+// for TimeSize bytes.
+func putTimestamp(b []byte, t time.Time) int {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec < 1<<32 && nsec == 0:
+		b[0] = mfixext4
+		b[1] = tsByte
+		big.PutUint32(b[2:], uint32(sec))
+		return 6
+	case sec >= 0 && sec < 1<<34:
+		b[0] = mfixext8
+		b[1] = tsByte
+		big.PutUint64(b[2:], uint64(nsec)<<34|uint64(sec))
+		return 10
+	default:
+		b[0] = mext8
+		b[1] = 12
+		b[2] = tsByte
+		big.PutUint32(b[3:], nsec)
+		big.PutUint64(b[7:], uint64(sec))
+		return 15
+	}
+}
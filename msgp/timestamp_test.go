@@ -0,0 +1,85 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimestampExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		size int
+	}{
+		{"epoch", time.Unix(0, 0), 6},
+		{"whole seconds", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), 6},
+		{"sub-second", time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC), 10},
+		{"past 32-bit seconds", time.Date(2200, 6, 1, 0, 0, 0, 0, time.UTC), 10},
+		{"far future", time.Date(3000, 1, 1, 0, 0, 0, 1, time.UTC), 15},
+		{"before 1970", time.Date(1969, 12, 31, 23, 59, 59, 500, time.UTC), 15},
+		{"zero", time.Time{}, 15},
+		{"monotonic", time.Now(), 10},
+	}
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	for _, tt := range tests {
+		bts := AppendTimeExt(nil, tt.t)
+		if len(bts) != tt.size {
+			t.Errorf("%s: AppendTimeExt wrote %d bytes; want %d", tt.name, len(bts), tt.size)
+		}
+		if NextType(bts) != TimeType {
+			t.Errorf("%s: NextType is %s", tt.name, NextType(bts))
+		}
+
+		buf.Reset()
+		if err := wr.WriteTimeExt(tt.t); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("%s: WriteTimeExt wrote % x; AppendTimeExt wrote % x", tt.name, buf.Bytes(), bts)
+		}
+
+		out, left, err := nbs.ReadTimeBytes(append(bts, mnil))
+		if err != nil || len(left) != 1 || !out.Equal(tt.t) {
+			t.Errorf("%s: ReadTimeBytes got %v, %v; want %v", tt.name, out, err, tt.t)
+		}
+		if tt.t.IsZero() != out.IsZero() {
+			t.Errorf("%s: IsZero changed", tt.name)
+		}
+
+		rd := NewReaderBytes(bts)
+		if typ, _ := rd.NextType(); typ != TimeType {
+			t.Errorf("%s: Reader.NextType is %s", tt.name, typ)
+		}
+		out, err = rd.ReadTime()
+		if err != nil || !out.Equal(tt.t) {
+			t.Errorf("%s: ReadTime got %v, %v; want %v", tt.name, out, err, tt.t)
+		}
+		// the monotonic clock reading is
+		// stripped, so == works after Round(0)
+		if out != tt.t.Round(0).Local() {
+			t.Errorf("%s: ReadTime got %#v; want %#v", tt.name, out, tt.t.Round(0).Local())
+		}
+		rd.Recycle()
+
+		v, err := NewReaderBytes(bts).ReadIntf()
+		if got, ok := v.(time.Time); err != nil || !ok || !got.Equal(tt.t) {
+			t.Errorf("%s: ReadIntf got %#v, %v", tt.name, v, err)
+		}
+	}
+
+	// the older encoding is still read
+	old := AppendTime(nil, tests[2].t)
+	if out, _, err := nbs.ReadTimeBytes(old); err != nil || !out.Equal(tests[2].t) {
+		t.Errorf("ReadTimeBytes of WriteTime's encoding: %v, %v", out, err)
+	}
+
+	// a fixext of the right size but the wrong type isn't a time
+	bts := AppendTimeExt(nil, tests[0].t)
+	bts[1] = 7
+	if _, _, err := nbs.ReadTimeBytes(bts); err == nil {
+		t.Error("read a time from extension type 7")
+	}
+}
@@ -1,13 +1,14 @@
 package msgp
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // Sizer is an interface implemented
@@ -42,6 +43,9 @@ func popWriter(w io.Writer) *Writer {
 func pushWriter(wr *Writer) {
 	wr.w = nil
 	wr.wloc = 0
+	wr.pending = wr.pending[:0]
+	wr.err = nil
+	wr.sortKeys = false
 	writerPool.Put(wr)
 }
 
@@ -52,6 +56,14 @@ func pushWriter(wr *Writer) {
 // it will cause undefined behavior.
 func freeW(w *Writer) { pushWriter(w) }
 
+// Recycle hands a Writer from NewWriter back
+// to the pool it came from, so that encoding
+// many small messages needn't allocate a Writer
+// (and its buffer) for each one. Anything not yet
+// flushed is dropped, and the Writer must not be
+// used after Recycle.
+func (mw *Writer) Recycle() { freeW(mw) }
+
 // Require ensures that cap(old)-len(old) >= extra.
 func Require(old []byte, extra int) []byte {
 	l := len(old)
@@ -104,13 +116,35 @@ type Encodable interface {
 // You must call *Writer.Flush() in order
 // to flush all of the buffered data
 // to the underlying writer.
+//
+// Once a write fails, whether the underlying
+// writer returned the error or the value could
+// not be encoded (an unsupported type, say, or
+// a bad HeaderToken), the Writer keeps the
+// error: every later write, and Flush, returns
+// that first error without writing anything,
+// so a failure part way through an object
+// can't be followed by the rest of the object.
 type Writer struct {
 	w    io.Writer
 	buf  []byte
 	wloc int
+
+	// the buffer positions of headers reserved
+	// but not yet filled in; while there are
+	// any, the buffer grows rather than being
+	// flushed
+	pending []int
+
+	// the first error from a write, if any
+	err error
+
+	// see SetSortMapKeys
+	sortKeys bool
 }
 
-// NewWriter returns a new *Writer.
+// NewWriter returns a new *Writer, taken
+// from a pool; see Recycle.
 func NewWriter(w io.Writer) *Writer {
 	if wr, ok := w.(*Writer); ok {
 		return wr
@@ -145,14 +179,24 @@ func Encode(w io.Writer, e Encodable) error {
 }
 
 func (mw *Writer) flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
 	if mw.wloc == 0 {
 		return nil
 	}
+	if len(mw.pending) > 0 {
+		// a reserved header still points into
+		// the buffer, so keep it all and make room
+		mw.grow(len(mw.buf))
+		return nil
+	}
 	n, err := mw.w.Write(mw.buf[:mw.wloc])
 	if err != nil {
 		if n > 0 {
 			mw.wloc = copy(mw.buf, mw.buf[n:mw.wloc])
 		}
+		mw.err = err
 		return err
 	}
 	mw.wloc = 0
@@ -160,9 +204,44 @@ func (mw *Writer) flush() error {
 }
 
 // Flush flushes all of the buffered
-// data to the underlying writer.
+// data to the underlying writer. Nothing
+// is flushed while a header reserved with
+// ReserveArrayHeader or ReserveMapHeader
+// has yet to be filled in. If an earlier
+// write failed, Flush returns its error.
 func (mw *Writer) Flush() error { return mw.flush() }
 
+// Error returns the first error that a write
+// returned, or nil if there has been none
+// since NewWriter or Reset.
+func (mw *Writer) Error() error { return mw.err }
+
+// Fail makes err the Writer's error, as if a
+// write had returned it, unless the Writer
+// already has one, and returns err. EncodeMsg
+// methods call it when they stop part way
+// through an object for a reason of their own,
+// such as an unknown enum value, so that a
+// later Flush doesn't write what they began.
+func (mw *Writer) Fail(err error) error {
+	if err != nil && mw.err == nil {
+		mw.err = err
+	}
+	return err
+}
+
+// grow enlarges the buffer so that
+// at least n more bytes fit in it.
+func (mw *Writer) grow(n int) {
+	sz := 2 * len(mw.buf)
+	if sz < mw.wloc+n {
+		sz = mw.wloc + n
+	}
+	buf := make([]byte, sz)
+	copy(buf, mw.buf[:mw.wloc])
+	mw.buf = buf
+}
+
 // Buffered returns the number bytes in the write buffer
 func (mw *Writer) Buffered() int { return len(mw.buf) - mw.wloc }
 
@@ -176,6 +255,9 @@ func (mw *Writer) bufsize() int { return len(mw.buf) }
 //
 // NOTE: this is a hot code path
 func (mw *Writer) require(n int) (int, error) {
+	if mw.err != nil {
+		return 0, mw.err
+	}
 	c := len(mw.buf)
 	wl := mw.wloc
 	if c-wl < n {
@@ -189,6 +271,9 @@ func (mw *Writer) require(n int) (int, error) {
 }
 
 func (mw *Writer) Append(b ...byte) error {
+	if mw.err != nil {
+		return mw.err
+	}
 	if mw.avail() < len(b) {
 		err := mw.flush()
 		if err != nil {
@@ -203,6 +288,9 @@ func (mw *Writer) Append(b ...byte) error {
 //
 // NOTE: this is a hot code path
 func (mw *Writer) push(b byte) error {
+	if mw.err != nil {
+		return mw.err
+	}
 	if mw.wloc == len(mw.buf) {
 		if err := mw.flush(); err != nil {
 			return err
@@ -215,6 +303,9 @@ func (mw *Writer) push(b byte) error {
 
 func (mw *Writer) prefix8(b byte, u uint8) error {
 	const need = 2
+	if mw.err != nil {
+		return mw.err
+	}
 	if len(mw.buf)-mw.wloc < need {
 		if err := mw.flush(); err != nil {
 			return err
@@ -227,6 +318,9 @@ func (mw *Writer) prefix8(b byte, u uint8) error {
 
 func (mw *Writer) prefix16(b byte, u uint16) error {
 	const need = 3
+	if mw.err != nil {
+		return mw.err
+	}
 	if len(mw.buf)-mw.wloc < need {
 		if err := mw.flush(); err != nil {
 			return err
@@ -239,6 +333,9 @@ func (mw *Writer) prefix16(b byte, u uint16) error {
 
 func (mw *Writer) prefix32(b byte, u uint32) error {
 	const need = 5
+	if mw.err != nil {
+		return mw.err
+	}
 	if len(mw.buf)-mw.wloc < need {
 		if err := mw.flush(); err != nil {
 			return err
@@ -251,6 +348,9 @@ func (mw *Writer) prefix32(b byte, u uint32) error {
 
 func (mw *Writer) prefix64(b byte, u uint64) error {
 	const need = 9
+	if mw.err != nil {
+		return mw.err
+	}
 	if len(mw.buf)-mw.wloc < need {
 		if err := mw.flush(); err != nil {
 			return err
@@ -264,13 +364,21 @@ func (mw *Writer) prefix64(b byte, u uint64) error {
 // Write implements io.Writer, and writes
 // data directly to the buffer.
 func (mw *Writer) Write(p []byte) (int, error) {
+	if mw.err != nil {
+		return 0, mw.err
+	}
 	l := len(p)
 	if mw.avail() < l {
 		if err := mw.flush(); err != nil {
 			return 0, err
 		}
-		if l > len(mw.buf) {
-			return mw.w.Write(p)
+		if l > mw.avail() {
+			if len(mw.pending) == 0 {
+				n, err := mw.w.Write(p)
+				mw.err = err
+				return n, err
+			}
+			mw.grow(l)
 		}
 	}
 	mw.wloc += copy(mw.buf[mw.wloc:], p)
@@ -279,25 +387,45 @@ func (mw *Writer) Write(p []byte) (int, error) {
 
 // implements io.WriteString
 func (mw *Writer) writeString(s string) error {
+	if mw.err != nil {
+		return mw.err
+	}
 	l := len(s)
 	if mw.avail() < l {
 		if err := mw.flush(); err != nil {
 			return err
 		}
-		if l > len(mw.buf) {
-			_, err := io.WriteString(mw.w, s)
-			return err
+		if l > mw.avail() {
+			if len(mw.pending) == 0 {
+				_, err := io.WriteString(mw.w, s)
+				mw.err = err
+				return err
+			}
+			mw.grow(l)
 		}
 	}
 	mw.wloc += copy(mw.buf[mw.wloc:], s)
 	return nil
 }
 
-// Reset changes the underlying writer used by the Writer
+// SetSortMapKeys makes WriteMapStrStr, WriteMapStrIntf
+// and WriteIntf write the entries of maps with string
+// keys in byte order of their keys, rather than in Go's
+// random map order, so that the same map is always
+// encoded to the same bytes. It costs a sort per map.
+// The setting survives Reset, but not Recycle.
+func (mw *Writer) SetSortMapKeys(on bool) {
+	mw.sortKeys = on
+}
+
+// Reset changes the underlying writer used by the Writer,
+// dropping anything that hasn't been flushed
 func (mw *Writer) Reset(w io.Writer) {
 	mw.buf = mw.buf[:cap(mw.buf)]
 	mw.w = w
 	mw.wloc = 0
+	mw.pending = mw.pending[:0]
+	mw.err = nil
 }
 
 // WriteMapHeader writes a map header of the given
@@ -326,6 +454,75 @@ func (mw *Writer) WriteArrayHeader(sz uint32) error {
 	}
 }
 
+// A HeaderToken marks an array or map header
+// that was written before its size was known.
+// It holds the header's position in the Writer's
+// buffer, and is only good for one Fill call.
+type HeaderToken struct {
+	pos    int
+	prefix byte
+}
+
+// ReserveArrayHeader writes a placeholder for an
+// array header, to be filled in with FillArrayHeader
+// once the number of elements is known. The header
+// always takes the 5 bytes of an array32, so that any
+// size fits. Until it is filled in, the Writer keeps
+// everything written after it in its buffer.
+func (mw *Writer) ReserveArrayHeader() (HeaderToken, error) {
+	return mw.reserve(marray32)
+}
+
+// ReserveMapHeader is the map counterpart
+// of ReserveArrayHeader.
+func (mw *Writer) ReserveMapHeader() (HeaderToken, error) {
+	return mw.reserve(mmap32)
+}
+
+// FillArrayHeader writes sz into the header
+// reserved by ReserveArrayHeader.
+func (mw *Writer) FillArrayHeader(t HeaderToken, sz uint32) error {
+	return mw.fill(t, marray32, sz)
+}
+
+// FillMapHeader writes sz, the number of
+// key-value pairs, into the header reserved
+// by ReserveMapHeader.
+func (mw *Writer) FillMapHeader(t HeaderToken, sz uint32) error {
+	return mw.fill(t, mmap32, sz)
+}
+
+func (mw *Writer) reserve(prefix byte) (HeaderToken, error) {
+	o, err := mw.require(5)
+	if err != nil {
+		return HeaderToken{}, err
+	}
+	prefixu32(mw.buf[o:], prefix, 0)
+	mw.pending = append(mw.pending, o)
+	return HeaderToken{pos: o, prefix: prefix}, nil
+}
+
+func (mw *Writer) fill(t HeaderToken, prefix byte, sz uint32) error {
+	if mw.err != nil {
+		return mw.err
+	}
+	if t.prefix != prefix {
+		return mw.Fail(ErrBadHeaderToken)
+	}
+	// headers are usually filled innermost
+	// first, so look from the top down
+	i := len(mw.pending) - 1
+	for i >= 0 && mw.pending[i] != t.pos {
+		i--
+	}
+	if i < 0 || mw.buf[t.pos] != prefix {
+		return mw.Fail(ErrBadHeaderToken)
+	}
+	prefixu32(mw.buf[t.pos:], prefix, sz)
+	mw.pending = append(mw.pending[:i], mw.pending[i+1:]...)
+	return nil
+}
+
 // WriteNil writes a nil byte to the buffer
 func (mw *Writer) WriteNil() error {
 	return mw.push(mnil)
@@ -500,6 +697,21 @@ func (mw *Writer) WriteStringFromBytes(str []byte) error {
 	return err
 }
 
+// TruncateString returns the longest prefix of
+// 's' that is at most 'n' bytes long and doesn't
+// end in the middle of a UTF-8 encoded rune.
+// Code generated for a field tagged with
+// msg:",truncate=N" uses it before writing.
+func TruncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // WriteComplex64 writes a complex64 to the writer
 func (mw *Writer) WriteComplex64(f complex64) error {
 	o, err := mw.require(10)
@@ -532,6 +744,24 @@ func (mw *Writer) WriteMapStrStr(mp map[string]string) (err error) {
 	if err != nil {
 		return
 	}
+	if mw.sortKeys {
+		keys := make([]string, 0, len(mp))
+		for key := range mp {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err = mw.WriteString(key)
+			if err != nil {
+				return
+			}
+			err = mw.WriteString(mp[key])
+			if err != nil {
+				return
+			}
+		}
+		return nil
+	}
 	for key, val := range mp {
 		err = mw.WriteString(key)
 		if err != nil {
@@ -551,6 +781,24 @@ func (mw *Writer) WriteMapStrIntf(mp map[string]interface{}) (err error) {
 	if err != nil {
 		return
 	}
+	if mw.sortKeys {
+		keys := make([]string, 0, len(mp))
+		for key := range mp {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err = mw.WriteString(key)
+			if err != nil {
+				return
+			}
+			err = mw.WriteIntf(mp[key])
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
 	for key, val := range mp {
 		err = mw.WriteString(key)
 		if err != nil {
@@ -591,14 +839,37 @@ func (mw *Writer) WriteTime(t time.Time) error {
 	return nil
 }
 
+// WriteTimeExt writes a time.Time object to the wire
+// using the timestamp extension (type -1) defined by
+// the MessagePack spec, which other implementations
+// understand, in the smallest of its three sizes that
+// holds 't': 6 bytes for whole seconds after 1970 that
+// fit in 32 bits, 10 bytes up to the year 2514, and 15
+// bytes otherwise. As with WriteTime, the location is
+// not kept. ReadTime reads either encoding.
+func (mw *Writer) WriteTimeExt(t time.Time) error {
+	o, err := mw.require(TimeSize)
+	if err != nil {
+		return err
+	}
+	n := putTimestamp(mw.buf[o:], t)
+	// give back what require() over-reserved
+	mw.wloc -= TimeSize - n
+	return nil
+}
+
 // WriteIntf writes the concrete type of 'v'.
 // WriteIntf will error if 'v' is not one of the following:
 //  - A bool, float, string, []byte, int, uint, or complex
-//  - A map of supported types (with string keys)
+//  - A map of supported types (keys that aren't strings
+//    are themselves written with WriteIntf)
 //  - An array or slice of supported types
 //  - A pointer to a supported type
-//  - A type that satisfies the msgp.Encodable interface
+//  - A type that satisfies the msgp.Encodable or
+//    msgp.Marshaler interface
 //  - A type that satisfies the msgp.Extension interface
+// The error for an unsupported type is an
+// *ErrUnsupportedType naming it.
 func (mw *Writer) WriteIntf(v interface{}) error {
 	if v == nil {
 		return mw.WriteNil()
@@ -608,7 +879,14 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 	// preferred interfaces
 
 	case Encodable:
-		return v.EncodeMsg(mw)
+		return mw.Fail(v.EncodeMsg(mw))
+	case Marshaler:
+		b, err := v.MarshalMsg(nil)
+		if err != nil {
+			return mw.Fail(err)
+		}
+		_, err = mw.Write(b)
+		return err
 	case Extension:
 		return mw.WriteExtension(v)
 
@@ -652,13 +930,19 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 		return mw.WriteMapStrStr(v)
 	case map[string]interface{}:
 		return mw.WriteMapStrIntf(v)
+	case []interface{}:
+		err := mw.WriteArrayHeader(uint32(len(v)))
+		for i := 0; err == nil && i < len(v); i++ {
+			err = mw.WriteIntf(v[i])
+		}
+		return err
 	case time.Time:
 		return mw.WriteTime(v)
 	}
 
 	val := reflect.ValueOf(v)
-	if !isSupported(val.Kind()) || !val.IsValid() {
-		return fmt.Errorf("msgp: type %s not supported(1)", val)
+	if !isSupported(val.Kind()) {
+		return mw.Fail(&ErrUnsupportedType{T: val.Type()})
 	}
 
 	switch val.Kind() {
@@ -672,21 +956,33 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 	case reflect.Map:
 		return mw.writeMap(val)
 	}
-	return &ErrUnsupportedType{val.Type()}
+	return mw.Fail(&ErrUnsupportedType{val.Type()})
 }
 
+// writeMap writes a map of any key type. String
+// keys are written as 'str'; other keys (e.g. the
+// keys of a map[int]string) are written with WriteIntf,
+// which ReadIntf and ReadInto know how to read back.
 func (mw *Writer) writeMap(v reflect.Value) (err error) {
-	if v.Elem().Kind() != reflect.String {
-		return errors.New("msgp: map keys must be strings")
+	if !isSupported(v.Type().Key().Kind()) {
+		return mw.Fail(&ErrUnsupportedType{T: v.Type()})
 	}
+	strkeys := v.Type().Key().Kind() == reflect.String
 	ks := v.MapKeys()
+	if strkeys && mw.sortKeys {
+		sort.Slice(ks, func(i, j int) bool { return ks[i].String() < ks[j].String() })
+	}
 	err = mw.WriteMapHeader(uint32(len(ks)))
 	if err != nil {
 		return
 	}
 	for _, key := range ks {
 		val := v.MapIndex(key)
-		err = mw.WriteString(key.String())
+		if strkeys {
+			err = mw.WriteString(key.String())
+		} else {
+			err = mw.WriteIntf(key.Interface())
+		}
 		if err != nil {
 			return
 		}
@@ -720,14 +1016,14 @@ func (mw *Writer) writeSlice(v reflect.Value) (err error) {
 
 func (mw *Writer) writeStruct(v reflect.Value) error {
 	if enc, ok := v.Interface().(Encodable); ok {
-		return enc.EncodeMsg(mw)
+		return mw.Fail(enc.EncodeMsg(mw))
 	}
-	return fmt.Errorf("msgp: unsupported type: %s", v.Type())
+	return mw.Fail(fmt.Errorf("msgp: unsupported type: %s", v.Type()))
 }
 
 func (mw *Writer) writeVal(v reflect.Value) error {
 	if !isSupported(v.Kind()) {
-		return fmt.Errorf("msgp: msgp/enc: type %q not supported(2)", v.Type())
+		return mw.Fail(fmt.Errorf("msgp: msgp/enc: type %q not supported(2)", v.Type()))
 	}
 
 	// shortcut for nil values
@@ -781,7 +1077,7 @@ func (mw *Writer) writeVal(v reflect.Value) error {
 		return mw.writeStruct(v)
 
 	}
-	return fmt.Errorf("msgp: msgp/enc: type %q not supported(3)", v.Type())
+	return mw.Fail(fmt.Errorf("msgp: msgp/enc: type %q not supported(3)", v.Type()))
 }
 
 // is the reflect.Kind encodable?
@@ -795,9 +1091,11 @@ func isSupported(k reflect.Kind) bool {
 }
 
 // GuessSize guesses the size of the underlying
-// value of 'i'. If the underlying value is not
-// a simple builtin (or []byte), GuessSize defaults
-// to 512.
+// value of 'i', for pre-growing a buffer. For the
+// values that WriteIntf can write, including maps,
+// slices and pointers of them, the guess is an
+// upper bound on the encoded size. For anything
+// else, GuessSize defaults to 512.
 func GuessSize(i interface{}) int {
 	if i == nil {
 		return NilSize
@@ -838,7 +1136,43 @@ func GuessSize(i interface{}) int {
 			s += 2*StringPrefixSize + len(key) + len(val)
 		}
 		return s
-	default:
-		return 512
+	case []interface{}:
+		s := ArrayHeaderSize
+		for _, val := range i {
+			s += GuessSize(val)
+		}
+		return s
+	case time.Time:
+		return TimeSize
+	}
+	return guessSizeValue(reflect.ValueOf(i))
+}
+
+// guessSizeValue is GuessSize for the pointers,
+// slices and maps that WriteIntf writes through
+// reflection.
+func guessSizeValue(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return NilSize
+		}
+		return GuessSize(v.Elem().Interface())
+	case reflect.Slice:
+		if v.Type().ConvertibleTo(btsType) {
+			return BytesPrefixSize + v.Len()
+		}
+		s := ArrayHeaderSize
+		for i := 0; i < v.Len(); i++ {
+			s += GuessSize(v.Index(i).Interface())
+		}
+		return s
+	case reflect.Map:
+		s := MapHeaderSize
+		for _, key := range v.MapKeys() {
+			s += GuessSize(key.Interface()) + GuessSize(v.MapIndex(key).Interface())
+		}
+		return s
 	}
+	return 512
 }
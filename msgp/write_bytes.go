@@ -1,6 +1,7 @@
 package msgp
 
 import (
+	"bytes"
 	"math"
 	"reflect"
 	"time"
@@ -294,6 +295,17 @@ func AppendStringFromBytes(b []byte, str []byte) []byte {
 	return o[:n+copy(o[n:], str)]
 }
 
+// AppendRaw appends the MessagePack in 'r' to 'b'
+// as it is, or a nil if 'r' is empty, the same as
+// r.MarshalMsg(b). (*Reader).CopyNext does this
+// for an object on the wire.
+func AppendRaw(b []byte, r Raw) []byte {
+	if len(r) == 0 {
+		return AppendNil(b)
+	}
+	return append(b, r...)
+}
+
 // AppendComplex64 appends a complex64 to the slice as a MessagePack extension
 func AppendComplex64(b []byte, c complex64) []byte {
 	o, n := ensure(b, Complex64Size)
@@ -325,6 +337,15 @@ func AppendTime(b []byte, t time.Time) []byte {
 	return o
 }
 
+// AppendTimeExt appends a time.Time to the slice as
+// the MessagePack spec's timestamp extension; see
+// (*Writer).WriteTimeExt.
+func AppendTimeExt(b []byte, t time.Time) []byte {
+	o, n := ensure(b, TimeSize)
+	n += putTimestamp(o[n:], t)
+	return o[:n]
+}
+
 // AppendMapStrStr appends a map[string]string to the slice
 // as a MessagePack map with 'str'-type keys and values
 func AppendMapStrStr(b []byte, m map[string]string) []byte {
@@ -355,7 +376,9 @@ func AppendMapStrIntf(b []byte, m map[string]interface{}) ([]byte, error) {
 
 // AppendMapStrSomething appends a map[string]* to the slice
 // as a MessagePack map with 'str'-type keys. * must be
-// serializable by AppendIntf().
+// serializable by AppendIntf(). Maps with other key types
+// (e.g. map[int]string) are also accepted; their keys are
+// appended with AppendIntf().
 func AppendMapStrSomething(b []byte, m reflect.Value) ([]byte, error) {
 
 	keys := m.MapKeys()
@@ -364,10 +387,11 @@ func AppendMapStrSomething(b []byte, m reflect.Value) ([]byte, error) {
 		b = AppendMapHeader(b, sz)
 		return b, nil
 	}
+	strkeys := m.Type().Key().Kind() == reflect.String
 	var err error
 	for i, key := range keys {
 		if i == 0 {
-			if key.Type().Kind() != reflect.String {
+			if !isSupported(key.Type().Kind()) {
 				return b, &ErrUnsupportedType{T: m.Type()}
 			}
 			// lazy because we try hard not to write
@@ -375,7 +399,14 @@ func AppendMapStrSomething(b []byte, m reflect.Value) ([]byte, error) {
 			b = AppendMapHeader(b, sz)
 		}
 
-		b = AppendString(b, key.String())
+		if strkeys {
+			b = AppendString(b, key.String())
+		} else {
+			b, err = AppendIntf(b, key.Interface())
+			if err != nil {
+				return b, err
+			}
+		}
 		val := m.MapIndex(key)
 		b, err = AppendIntf(b, val.Interface())
 		if err != nil {
@@ -392,8 +423,11 @@ func AppendMapStrSomething(b []byte, m reflect.Value) ([]byte, error) {
 //  - A map[string]interface{} or map[string]string
 //  - A []T, where T is another supported type
 //  - A *T, where T is another supported type
-//  - A type that satisfieds the msgp.Marshaler interface
+//  - A type that satisfies the msgp.Marshaler or
+//    msgp.Encodable interface
 //  - A type that satisfies the msgp.Extension interface
+// The error for an unsupported type is an
+// *ErrUnsupportedType naming it.
 func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 	if i == nil {
 		return AppendNil(b), nil
@@ -404,6 +438,15 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 	switch i := i.(type) {
 	case Marshaler:
 		return i.MarshalMsg(b)
+	case Encodable:
+		buf := bytes.NewBuffer(b)
+		w := NewWriter(buf)
+		err := i.EncodeMsg(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		freeW(w)
+		return buf.Bytes(), err
 	case Extension:
 		return AppendExtension(b, i)
 	case bool:
@@ -279,6 +279,89 @@ func BenchmarkAppend256String(b *testing.B) { benchappendString(256, b) }
 
 func BenchmarkAppend2048String(b *testing.B) { benchappendString(2048, b) }
 
+func TestAppendRaw(t *testing.T) {
+	inner := AppendMapHeader(nil, 1)
+	inner = AppendString(inner, "list")
+	inner = AppendArrayHeader(inner, 2)
+	inner = AppendInt64(inner, 1)
+	inner = AppendString(inner, "two")
+
+	// splice it into a map being built
+	b := AppendMapHeader(nil, 2)
+	b = AppendString(b, "raw")
+	b = AppendRaw(b, Raw(inner))
+	b = AppendString(b, "none")
+	b = AppendRaw(b, nil)
+
+	want := AppendMapHeader(nil, 2)
+	want = AppendString(want, "raw")
+	want = append(want, inner...)
+	want = AppendString(want, "none")
+	want = AppendNil(want)
+	if !bytes.Equal(b, want) {
+		t.Errorf("AppendRaw gave % x; want % x", b, want)
+	}
+	if m, _ := Raw(inner).MarshalMsg(nil); !bytes.Equal(AppendRaw(nil, Raw(inner)), m) {
+		t.Error("AppendRaw and Raw.MarshalMsg disagree")
+	}
+}
+
+func TestAppendStringFromBytes(t *testing.T) {
+	sizes := []int{0, 1, 31, 32, 225, 256, int(tuint16), int(tuint32)}
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	var bts []byte
+
+	for _, sz := range sizes {
+		raw := RandBytes(sz)
+		s := string(raw)
+
+		buf.Reset()
+		en.WriteString(s)
+		en.Flush()
+		want := append([]byte(nil), buf.Bytes()...)
+
+		buf.Reset()
+		en.WriteStringFromBytes(raw)
+		en.Flush()
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("for %d bytes, WriteStringFromBytes wrote %d bytes and WriteString wrote %d", sz, buf.Len(), len(want))
+		}
+
+		bts = AppendStringFromBytes(bts[0:0], raw)
+		if !bytes.Equal(bts, want) {
+			t.Errorf("for %d bytes, AppendStringFromBytes wrote %d bytes and WriteString wrote %d", sz, len(bts), len(want))
+		}
+	}
+}
+
+func benchappendStringFromBytes(size uint32, b *testing.B) {
+	raw := RandBytes(int(size))
+	buf := make([]byte, 0, len(raw)+5)
+	b.SetBytes(int64(len(raw) + 5))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AppendStringFromBytes(buf[0:0], raw)
+	}
+}
+
+// the conversion a caller needs without AppendStringFromBytes
+func benchappendStringConvert(size uint32, b *testing.B) {
+	raw := RandBytes(int(size))
+	buf := make([]byte, 0, len(raw)+5)
+	b.SetBytes(int64(len(raw) + 5))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AppendString(buf[0:0], string(raw))
+	}
+}
+
+func BenchmarkAppend256StringFromBytes(b *testing.B) { benchappendStringFromBytes(256, b) }
+
+func BenchmarkAppend256StringConvert(b *testing.B) { benchappendStringConvert(256, b) }
+
 func TestAppendBool(t *testing.T) {
 	vs := []bool{true, false}
 	var buf bytes.Buffer
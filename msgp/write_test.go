@@ -2,8 +2,11 @@ package msgp
 
 import (
 	"bytes"
+	"fmt"
 	"math"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -106,6 +109,269 @@ func TestWriteArrayHeader(t *testing.T) {
 	}
 }
 
+func TestReserveMapHeader(t *testing.T) {
+	fields := []struct {
+		Key, Val string
+	}{
+		{"name", "fred"},
+		{"nick", ""},
+		{"town", "bedrock"},
+		{"note", strings.Repeat("x", 100)},
+		{"pet", ""},
+		{"wife", "wilma"},
+	}
+
+	var buf bytes.Buffer
+	// small enough that the buffer has to
+	// grow while the header is pending
+	wr := NewWriterSize(&buf, 18)
+	tok, err := wr.ReserveMapHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n uint32
+	for _, f := range fields {
+		if f.Val == "" {
+			continue // omitempty
+		}
+		if err := wr.WriteString(f.Key); err != nil {
+			t.Fatal(err)
+		}
+		// an array of unknown length inside the map
+		atok, err := wr.ReserveArrayHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.WriteString(f.Val); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.FillArrayHeader(atok, 1); err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("flushed %d bytes before the header was filled in", buf.Len())
+	}
+	if err := wr.FillMapHeader(tok, n); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := NewReader(&buf)
+	sz, err := rd.ReadMapHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != 4 {
+		t.Fatalf("map header says %d pairs; want 4", sz)
+	}
+	for _, f := range fields {
+		if f.Val == "" {
+			continue
+		}
+		k, err := rd.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		asz, err := rd.ReadArrayHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := rd.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != f.Key || asz != 1 || v != f.Val {
+			t.Errorf("got %q: [%d]%q; want %q: [1]%q", k, asz, v, f.Key, f.Val)
+		}
+	}
+	if rd.Buffered() != 0 {
+		t.Errorf("%d bytes left after the last pair", rd.Buffered())
+	}
+
+	// a token is only good for the header it
+	// reserved, and a misused one stops the Writer
+	tok, err = wr.ReserveArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.FillMapHeader(tok, 0); err != ErrBadHeaderToken {
+		t.Errorf("filling an array header as a map: got %v; want ErrBadHeaderToken", err)
+	}
+	if err := wr.FillArrayHeader(tok, 0); err != ErrBadHeaderToken {
+		t.Errorf("filling after a misuse: got %v; want ErrBadHeaderToken", err)
+	}
+	wr.Reset(&buf)
+	tok, err = wr.ReserveArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.FillArrayHeader(tok, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.FillArrayHeader(tok, 0); err != ErrBadHeaderToken {
+		t.Errorf("filling a header twice: got %v; want ErrBadHeaderToken", err)
+	}
+}
+
+func TestFillHeaderTwiceWhileAnotherPending(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	outer, err := wr.ReserveArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := wr.ReserveArrayHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr.WriteInt(1)
+	if err := wr.FillArrayHeader(inner, 1); err != nil {
+		t.Fatal(err)
+	}
+	// outer is still pending, but inner is not
+	if err := wr.FillArrayHeader(inner, 1); err != ErrBadHeaderToken {
+		t.Errorf("filling a header twice: got %v; want ErrBadHeaderToken", err)
+	}
+	// and the stream is abandoned, rather than
+	// flushed with outer's placeholder in it
+	if err := wr.FillArrayHeader(outer, 1); err != ErrBadHeaderToken {
+		t.Errorf("filling after a misuse: got %v; want ErrBadHeaderToken", err)
+	}
+	if err := wr.Flush(); err != ErrBadHeaderToken {
+		t.Errorf("Flush after a misuse: got %v; want ErrBadHeaderToken", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Flush wrote %d bytes after a misuse", buf.Len())
+	}
+}
+
+// limitWriter fails once it has taken n bytes
+type limitWriter struct {
+	n   int
+	buf bytes.Buffer
+}
+
+var errFull = fmt.Errorf("writer is full")
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		l.buf.Write(p[:l.n])
+		n := l.n
+		l.n = 0
+		return n, errFull
+	}
+	l.n -= len(p)
+	return l.buf.Write(p)
+}
+
+func TestWriterStickyError(t *testing.T) {
+	lw := &limitWriter{n: 20}
+	wr := NewWriterSize(lw, 18)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = wr.WriteString("abcdefgh")
+	}
+	if err != errFull {
+		t.Fatalf("expected errFull; got %v", err)
+	}
+	if wr.Error() != errFull {
+		t.Errorf("Error() is %v; want errFull", wr.Error())
+	}
+	written := lw.buf.Len()
+
+	// everything after the failure is refused
+	// with the first error, and nothing more
+	// reaches the underlying writer
+	lw.n = 1000
+	if err := wr.WriteInt64(1); err != errFull {
+		t.Errorf("WriteInt64 after a failure: got %v", err)
+	}
+	if err := wr.WriteBytes(make([]byte, 100)); err != errFull {
+		t.Errorf("WriteBytes after a failure: got %v", err)
+	}
+	if _, err := wr.Write([]byte{1}); err != errFull {
+		t.Errorf("Write after a failure: got %v", err)
+	}
+	if err := wr.Flush(); err != errFull {
+		t.Errorf("Flush after a failure: got %v", err)
+	}
+	if lw.buf.Len() != written {
+		t.Errorf("%d bytes were written after the failure", lw.buf.Len()-written)
+	}
+
+	// Reset clears it
+	var buf bytes.Buffer
+	wr.Reset(&buf)
+	if wr.Error() != nil {
+		t.Errorf("Error() after Reset is %v", wr.Error())
+	}
+	if err := wr.WriteInt64(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if i, err := NewReader(&buf).ReadInt64(); err != nil || i != 1 {
+		t.Errorf("read back %d, %v after Reset; want 1", i, err)
+	}
+}
+
+func TestWriterStickyEncodeError(t *testing.T) {
+	// errors that don't come from the underlying
+	// writer stop the Writer just the same
+	fails := []struct {
+		name string
+		fail func(wr *Writer) error
+	}{
+		{"WriteIntf", func(wr *Writer) error {
+			return wr.WriteIntf(make(chan int))
+		}},
+		{"FillMapHeader", func(wr *Writer) error {
+			tok, err := wr.ReserveArrayHeader()
+			if err != nil {
+				return err
+			}
+			return wr.FillMapHeader(tok, 1)
+		}},
+		{"WriteRawJSON", func(wr *Writer) error {
+			return wr.WriteRawJSON([]byte("{"))
+		}},
+	}
+	for _, f := range fails {
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		if err := wr.WriteMapHeader(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.WriteString("first"); err != nil {
+			t.Fatal(err)
+		}
+		err := f.fail(wr)
+		if err == nil {
+			t.Fatalf("%s: expected an error", f.name)
+		}
+		if wr.Error() != err {
+			t.Errorf("%s: Error() is %v; want %v", f.name, wr.Error(), err)
+		}
+		if err2 := wr.WriteInt64(1); err2 != err {
+			t.Errorf("%s: WriteInt64 after a failure: got %v", f.name, err2)
+		}
+		if err2 := wr.Flush(); err2 != err {
+			t.Errorf("%s: Flush after a failure: got %v", f.name, err2)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%s: Flush wrote %d bytes of the broken map", f.name, buf.Len())
+		}
+	}
+}
+
 func TestReadWriteStringHeader(t *testing.T) {
 	sizes := []uint32{0, 5, 8, 19, 150, tuint16, tuint32}
 	var buf bytes.Buffer
@@ -368,6 +634,31 @@ func BenchmarkWrite256Bytes(b *testing.B) { benchwrBytes(256, b) }
 
 func BenchmarkWrite2048Bytes(b *testing.B) { benchwrBytes(2048, b) }
 
+func benchwrStringFromBytes(size uint32, b *testing.B) {
+	bts := RandBytes(int(size))
+	wr := NewWriter(Nowhere)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wr.WriteStringFromBytes(bts)
+	}
+}
+
+// the conversion a caller needs without WriteStringFromBytes
+func benchwrStringConvert(size uint32, b *testing.B) {
+	bts := RandBytes(int(size))
+	wr := NewWriter(Nowhere)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wr.WriteString(string(bts))
+	}
+}
+
+func BenchmarkWrite256StringFromBytes(b *testing.B) { benchwrStringFromBytes(256, b) }
+
+func BenchmarkWrite256StringConvert(b *testing.B) { benchwrStringConvert(256, b) }
+
 func TestWriteTime(t *testing.T) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -403,3 +694,213 @@ func BenchmarkWriteTime(b *testing.B) {
 		wr.WriteTime(t)
 	}
 }
+
+func TestTruncateString(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"", 3, ""},
+		{"abc", 3, "abc"},
+		{"abcd", 3, "abc"},
+		{"aé", 2, "a"},
+		{"aé", 3, "aé"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+		{"abc", 0, ""},
+	} {
+		if got := TruncateString(c.in, c.n); got != c.want {
+			t.Errorf("TruncateString(%q, %d) = %q; want %q", c.in, c.n, got, c.want)
+		}
+	}
+}
+
+func TestGuessSizeIsAnUpperBound(t *testing.T) {
+	seven := 7
+	var nilp *int
+	long := make([]interface{}, 100)
+	for i := range long {
+		long[i] = strings.Repeat("x", 100)
+	}
+	for _, v := range []interface{}{
+		nil,
+		map[string]interface{}{
+			"list": []interface{}{int64(1), "two", 3.0, nil, true},
+			"map":  map[string]interface{}{"inner": map[string]string{"a": "b"}},
+			"when": time.Unix(1, 2),
+		},
+		[]interface{}{[]interface{}{[]interface{}{}}, []byte("bytes")},
+		map[int]string{1: "one", -1000: "minus a thousand"},
+		[]string{"a", "bb", "ccc"},
+		&seven,
+		nilp,
+		long,
+		map[string]interface{}{"long": long},
+	} {
+		b, err := AppendIntf(nil, v)
+		if err != nil {
+			t.Fatalf("%T: %v", v, err)
+		}
+		if g := GuessSize(v); g < len(b) {
+			t.Errorf("%T: guessed %d bytes, but it takes %d", v, g, len(b))
+		}
+	}
+}
+
+// marshalOnly and encodeOnly each implement
+// just one of the two encoding interfaces
+type marshalOnly string
+
+func (m marshalOnly) MarshalMsg(b []byte) ([]byte, error) { return AppendString(b, string(m)), nil }
+
+type encodeOnly string
+
+func (e encodeOnly) EncodeMsg(w *Writer) error { return w.WriteString(string(e)) }
+
+func TestWriteIntfMatchesAppendIntf(t *testing.T) {
+	in := map[string]interface{}{
+		"ints":  []interface{}{int8(-1), int16(-300), int32(-70000), int64(-1 << 40), -5},
+		"uints": []interface{}{uint8(200), uint16(60000), uint32(1 << 31), uint64(1 << 63), uint(7)},
+		"f32":   float32(1.5),
+		"f64":   2.25,
+		"str":   "fred",
+		"bin":   []byte{1, 2, 3},
+		"bool":  true,
+		"nil":   nil,
+		"inner": map[string]interface{}{
+			"list":    []interface{}{"a", []interface{}{}, map[string]interface{}{}},
+			"marshal": marshalOnly("m"),
+			"encode":  encodeOnly("e"),
+		},
+	}
+	want := map[string]interface{}{
+		"ints":  []interface{}{int64(-1), int64(-300), int64(-70000), int64(-1 << 40), int64(-5)},
+		"uints": []interface{}{uint64(200), uint64(60000), uint64(1 << 31), uint64(1 << 63), uint64(7)},
+		"f32":   float32(1.5),
+		"f64":   2.25,
+		"str":   "fred",
+		"bin":   []byte{1, 2, 3},
+		"bool":  true,
+		"nil":   nil,
+		"inner": map[string]interface{}{
+			"list":    []interface{}{"a", []interface{}{}, map[string]interface{}{}},
+			"marshal": "m",
+			"encode":  "e",
+		},
+	}
+
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	if err := wr.WriteIntf(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := NewReader(bytes.NewReader(buf.Bytes())).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("WriteIntf then ReadIntf: got %#v; want %#v", out, want)
+	}
+
+	// map order differs between the two, so compare what they decode to
+	bts, err := AppendIntf(nil, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = NewReader(bytes.NewReader(bts)).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("AppendIntf then ReadIntf: got %#v; want %#v", out, want)
+	}
+
+	bad := []struct {
+		v    interface{}
+		name string
+	}{
+		{make(chan int), "chan int"},
+		{func() {}, "func()"},
+		{[]interface{}{1, make(chan int)}, "chan int"},
+	}
+	for _, b := range bad {
+		err := NewWriter(Nowhere).WriteIntf(b.v)
+		if _, ok := err.(*ErrUnsupportedType); !ok || !strings.Contains(err.Error(), b.name) {
+			t.Errorf("WriteIntf(%T): got error %v; want an ErrUnsupportedType naming %s", b.v, err, b.name)
+		}
+		_, err = AppendIntf(nil, b.v)
+		if _, ok := err.(*ErrUnsupportedType); !ok || !strings.Contains(err.Error(), b.name) {
+			t.Errorf("AppendIntf(%T): got error %v; want an ErrUnsupportedType naming %s", b.v, err, b.name)
+		}
+	}
+}
+
+func TestWriterSortMapKeys(t *testing.T) {
+	strs := make(map[string]string)
+	intfs := make(map[string]interface{})
+	ints := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("k%02d", 19-i)
+		strs[k] = k
+		intfs[k] = i
+		ints[k] = i
+	}
+
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.SetSortMapKeys(true)
+	encode := func() []byte {
+		buf.Reset()
+		wr.Reset(&buf)
+		if err := wr.WriteMapStrStr(strs); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.WriteMapStrIntf(intfs); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.WriteIntf(ints); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), buf.Bytes()...)
+	}
+
+	first := encode()
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(encode(), first) {
+			t.Fatal("the same maps were written two ways")
+		}
+	}
+
+	var nbs *NilBitsStack
+	bts := first
+	for m := 0; m < 3; m++ {
+		sz, rest, err := nbs.ReadMapHeaderBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var prev string
+		for ; sz > 0; sz-- {
+			var key []byte
+			key, rest, err = nbs.ReadMapKeyZC(rest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(key) <= prev {
+				t.Errorf("map %d: key %q written after %q", m, key, prev)
+			}
+			prev = string(key)
+			rest, err = Skip(rest)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		bts = rest
+	}
+}
@@ -0,0 +1,88 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// checkRecursion returns an error if a type
+// holds itself by value, through struct fields
+// and arrays, as in
+//
+//	type A struct{ B B }
+//	type B struct{ A A }
+//
+// Go rejects such types, and they can't be
+// inlined. Recursion through pointers, slices
+// and maps is fine; it ends at the named type.
+func (f *FileSet) checkRecursion() error {
+	names := make([]string, 0, len(f.Identities))
+	for name := range f.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			i := len(path) - 1
+			for path[i] != name {
+				i--
+			}
+			cycle := append(path[i:len(path):len(path)], name)
+			return fmt.Errorf("invalid recursive type: %s", strings.Join(cycle, " -> "))
+		}
+		el, ok := f.Identities[name]
+		if !ok {
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range valueDeps(el, nil) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueDeps appends the named types that
+// e holds by value to out.
+func valueDeps(e gen.Elem, out []string) []string {
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		if e.Value == gen.IDENT {
+			out = append(out, e.TypeName())
+		}
+	case *gen.Struct:
+		for i := range e.Fields {
+			if !e.Fields[i].Skip {
+				out = valueDeps(e.Fields[i].FieldElem, out)
+			}
+		}
+	case *gen.Array:
+		out = valueDeps(e.Els, out)
+	}
+	return out
+}
@@ -20,9 +20,12 @@ type passDirective func(gen.Method, []string, *gen.Printer) error
 // to add a directive, define a func([]string, *FileSet) error
 // and then add it to this list.
 var directives = map[string]directive{
-	"shim":   applyShim,
-	"ignore": ignore,
-	"tuple":  astuple,
+	"shim":    applyShim,
+	"ignore":  ignore,
+	"tuple":   astuple,
+	"asarray": astuple,
+	"patch":   patch,
+	"enum":    asenum,
 }
 
 var passDirectives = map[string]passDirective{
@@ -98,6 +101,7 @@ func ignore(text []string, f *FileSet) error {
 }
 
 //msgp:tuple {TypeA} {TypeB}...
+//msgp:asarray {TypeA} {TypeB}... is the same
 func astuple(text []string, f *FileSet) error {
 	if len(text) < 2 {
 		return nil
@@ -115,3 +119,60 @@ func astuple(text []string, f *FileSet) error {
 	}
 	return nil
 }
+
+//msgp:patch {TypeA} {TypeB}...
+func patch(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if el, ok := f.Identities[name]; ok {
+			if st, ok := el.(*gen.Struct); ok {
+				st.Patch = true
+				infoln(name)
+			} else {
+				warnf("%s: only structs can be patched\n", name)
+			}
+		}
+	}
+	return nil
+}
+
+//msgp:enum {TypeA} {TypeB}...
+func asenum(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		el, ok := f.Identities[name]
+		if !ok {
+			continue
+		}
+		be, ok := el.(*gen.BaseElem)
+		if !ok || !be.Convert || !isInteger(be.Value) {
+			warnf("%s: only integer types can be enums\n", name)
+			continue
+		}
+		r, ok := f.Enums[name]
+		if !ok {
+			warnf("%s: found no constants of that type\n", name)
+			continue
+		}
+		be.Enum = &gen.Enum{Type: name, Names: r.names, Values: r.values}
+		infoln(name)
+	}
+	return nil
+}
+
+// isInteger reports whether p is one
+// of the signed or unsigned integers.
+func isInteger(p gen.Primitive) bool {
+	switch p {
+	case gen.Uint, gen.Uint8, gen.Uint16, gen.Uint32, gen.Uint64, gen.Byte,
+		gen.Int, gen.Int8, gen.Int16, gen.Int32, gen.Int64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// DumpElems writes the element trees in els to w,
+// one node per line and indented by depth, for
+// debugging the parser: it shows what each field
+// resolved to, whether a concrete base type, an
+// identifier left for its own methods, or a nested
+// slice, array, map, pointer or struct.
+func DumpElems(w io.Writer, els []gen.Elem) error {
+	d := &dumper{w: w}
+	for _, el := range els {
+		d.elem(0, el)
+	}
+	return d.err
+}
+
+type dumper struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dumper) line(depth int, format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, strings.Repeat("  ", depth)+format+"\n", args...)
+}
+
+func (d *dumper) elem(depth int, el gen.Elem) {
+	switch el := el.(type) {
+	case nil:
+		d.line(depth, "<nil>")
+	case *gen.BaseElem:
+		d.base(depth, el)
+	case *gen.Ptr:
+		d.line(depth, "ptr %s", el.TypeName())
+		d.elem(depth+1, el.Value)
+	case *gen.Slice:
+		d.line(depth, "slice %s", el.TypeName())
+		d.elem(depth+1, el.Els)
+	case *gen.Array:
+		d.line(depth, "array %s, size %s", el.TypeName(), el.SizeResolved)
+		d.elem(depth+1, el.Els)
+	case *gen.Map:
+		if el.IsSet {
+			d.line(depth, "set %s, keys %s", el.TypeName(), el.KeyTyp)
+			return
+		}
+		d.line(depth, "map %s, keys %s", el.TypeName(), el.KeyTyp)
+		d.elem(depth+1, el.Value)
+	case *gen.Struct:
+		d.structure(depth, el)
+	default:
+		d.line(depth, "unknown %T", el)
+	}
+}
+
+func (d *dumper) base(depth int, b *gen.BaseElem) {
+	if b.Value == gen.IDENT {
+		d.line(depth, "ident %s", b.TypeName())
+		return
+	}
+	notes := ""
+	if b.Convert {
+		notes += ", converted"
+	}
+	if b.ShimToBase != "" {
+		notes += ", shim " + b.ShimToBase + "/" + b.ShimFromBase
+	}
+	if b.Enum != nil {
+		notes += ", enum"
+	}
+	d.line(depth, "base %s %s%s", b.Value, b.TypeName(), notes)
+}
+
+func (d *dumper) structure(depth int, s *gen.Struct) {
+	// TypeName on an anonymous struct would
+	// spell out all of its fields
+	name := "(anonymous)"
+	if !s.Anonymous {
+		name = s.TypeName()
+	}
+	notes := ""
+	if s.AsTuple {
+		notes += ", tuple"
+	}
+	if s.Inline != nil {
+		notes += ", inline " + s.Extras
+	} else if s.Extras != "" {
+		notes += ", extras " + s.Extras
+	}
+	d.line(depth, "struct %s%s", name, notes)
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if f.Skip {
+			d.line(depth+1, "field %s, skipped", f.FieldName)
+			continue
+		}
+		d.line(depth+1, "field %s %q%s", f.FieldName, f.FieldTagZidClue, fieldNotes(f))
+		d.elem(depth+2, f.FieldElem)
+	}
+}
+
+// fieldNotes lists the options set on f.
+func fieldNotes(f *gen.StructField) string {
+	var notes []string
+	add := func(set bool, note string) {
+		if set {
+			notes = append(notes, note)
+		}
+	}
+	add(f.Embedded, "embedded")
+	add(f.OmitEmpty, "omitempty")
+	add(f.ShowZero, "showzero")
+	add(f.NilWhenZero, "nilwhen=zero")
+	add(f.Required, "required")
+	add(f.ReadOnly, "readonly")
+	add(f.Deprecated, "deprecated")
+	add(f.EnumCheck, "enumcheck")
+	add(f.Truncate > 0, fmt.Sprintf("truncate=%d", f.Truncate))
+	add(f.OneOf != "", "oneof="+f.OneOf)
+	add(f.KeyOrder != "", "keyorder "+f.KeyOrder)
+	if len(notes) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(notes, ", ")
+}
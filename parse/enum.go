@@ -0,0 +1,183 @@
+package parse
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// the range of the constants
+// declared for an enum type,
+// and their names and values
+// in declaration order
+type enumRange struct {
+	min    int64
+	max    int64
+	names  []string
+	values []int64
+}
+
+// getConsts records the range of each typed
+// constant in a const block, so that fields
+// of that type can be checked with enumcheck
+// or written by name with //msgp:enum.
+// Only simple integer expressions are understood:
+// literals, iota, earlier constants of the block,
+// and the usual arithmetic on them. Constants
+// whose values can't be worked out are ignored.
+func (fs *FileSet) getConsts(g *ast.GenDecl) {
+	if g.Tok != token.CONST {
+		return
+	}
+	vals := make(map[string]int64)
+	types := make(map[string]string)
+	var typ string
+	var exprs []ast.Expr
+	for iota, s := range g.Specs {
+		vs, ok := s.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		// a spec without values repeats
+		// the type and expressions of
+		// the previous one
+		if len(vs.Values) > 0 {
+			exprs = vs.Values
+			typ = ""
+			if id, ok := vs.Type.(*ast.Ident); ok {
+				typ = id.Name
+			}
+		}
+		for i, nm := range vs.Names {
+			if i >= len(exprs) {
+				break
+			}
+			v, ok := evalConst(exprs[i], int64(iota), vals)
+			if !ok {
+				continue
+			}
+			vals[nm.Name] = v
+			t := typ
+			if id, ok := exprs[i].(*ast.Ident); ok && t == "" {
+				// an alias, as in Default = Red
+				t = types[id.Name]
+			}
+			if t == "" || nm.Name == "_" {
+				continue
+			}
+			types[nm.Name] = t
+			if fs.Enums == nil {
+				fs.Enums = make(map[string]*enumRange)
+			}
+			r, ok := fs.Enums[t]
+			if !ok {
+				r = &enumRange{min: v, max: v}
+				fs.Enums[t] = r
+			}
+			r.names = append(r.names, nm.Name)
+			r.values = append(r.values, v)
+			if v < r.min {
+				r.min = v
+			}
+			if v > r.max {
+				r.max = v
+			}
+		}
+	}
+}
+
+// evaluate a constant integer expression
+func evalConst(e ast.Expr, iota int64, vals map[string]int64) (int64, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(e.Value, 0, 64)
+		return v, err == nil
+	case *ast.Ident:
+		if e.Name == "iota" {
+			return iota, true
+		}
+		v, ok := vals[e.Name]
+		return v, ok
+	case *ast.ParenExpr:
+		return evalConst(e.X, iota, vals)
+	case *ast.CallExpr:
+		// a conversion, as in Color(iota)
+		if len(e.Args) == 1 {
+			return evalConst(e.Args[0], iota, vals)
+		}
+	case *ast.UnaryExpr:
+		x, ok := evalConst(e.X, iota, vals)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case token.SUB:
+			return -x, true
+		case token.ADD:
+			return x, true
+		}
+	case *ast.BinaryExpr:
+		x, ok := evalConst(e.X, iota, vals)
+		if !ok {
+			return 0, false
+		}
+		y, ok := evalConst(e.Y, iota, vals)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, true
+		case token.SUB:
+			return x - y, true
+		case token.MUL:
+			return x * y, true
+		case token.QUO:
+			if y != 0 {
+				return x / y, true
+			}
+		case token.REM:
+			if y != 0 {
+				return x % y, true
+			}
+		case token.SHL:
+			if y >= 0 && y < 64 {
+				return x << uint(y), true
+			}
+		case token.SHR:
+			if y >= 0 && y < 64 {
+				return x >> uint(y), true
+			}
+		case token.OR:
+			return x | y, true
+		case token.AND:
+			return x & y, true
+		}
+	}
+	return 0, false
+}
+
+// setEnumCheck fills in the enum range of a
+// field tagged `msg:",enumcheck"`, or warns and
+// drops the option if its type has no constants.
+func (fs *FileSet) setEnumCheck(sf *gen.StructField, typ ast.Expr) {
+	id, ok := typ.(*ast.Ident)
+	if !ok {
+		warnf("enumcheck needs a named type, not %s\n", stringify(typ))
+		return
+	}
+	r, ok := fs.Enums[id.Name]
+	if !ok {
+		warnf("enumcheck: found no constants of type %s\n", id.Name)
+		return
+	}
+	sf.EnumCheck = true
+	sf.EnumType = id.Name
+	sf.EnumMin = r.min
+	sf.EnumMax = r.max
+}
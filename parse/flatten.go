@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"sort"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// flattenEmbedded splices the fields of embedded
+// structs into the structs that embed them, so that
+// they are written at the outer level, the way
+// encoding/json treats anonymous fields. Only
+// untagged, non-pointer embeddings of struct types
+// declared in this FileSet are flattened; the rest
+// stay nested under the embedded type's name.
+//
+// When a promoted field has the same tag as one
+// of the outer struct's own fields, the outer field
+// wins; between two embedded structs, the first wins.
+// Under -sort-fields, the flattened fields are
+// sorted by tag again.
+func (f *FileSet) flattenEmbedded() {
+	done := make(map[string]bool)
+	for name := range f.Identities {
+		f.flattenStruct(name, done, make(map[string]bool))
+	}
+}
+
+func (f *FileSet) flattenStruct(name string, done, visiting map[string]bool) {
+	st, ok := f.Identities[name].(*gen.Struct)
+	if !ok || done[name] || visiting[name] {
+		return
+	}
+	visiting[name] = true
+	defer func() { done[name] = true }()
+	pushstate(name)
+	defer popstate()
+
+	if hasZids(st.Fields) {
+		return
+	}
+	taken := make(map[string]bool)
+	for i := range st.Fields {
+		if !st.Fields[i].Skip && !st.Fields[i].Embedded {
+			taken[st.Fields[i].FieldTag] = true
+		}
+	}
+	out := make([]gen.StructField, 0, len(st.Fields))
+	for _, sf := range st.Fields {
+		inner := f.embeddedStruct(&sf)
+		if inner == "" {
+			out = append(out, sf)
+			continue
+		}
+		f.flattenStruct(inner, done, visiting)
+		is := f.Identities[inner].(*gen.Struct)
+		if hasZids(is.Fields) {
+			warnf("%s has zebra ids; leaving it nested\n", inner)
+			out = append(out, sf)
+			continue
+		}
+		for _, pf := range is.Fields {
+			if pf.Skip || taken[pf.FieldTag] {
+				continue
+			}
+			taken[pf.FieldTag] = true
+			pf.FieldName = sf.FieldName + "." + pf.FieldName
+			if pf.KeyOrder != "" {
+				pf.KeyOrder = sf.FieldName + "." + pf.KeyOrder
+			}
+			pf.FieldElem = pf.FieldElem.Copy()
+			out = append(out, pf)
+		}
+	}
+	if f.sortFields(out) {
+		sort.Stable(byFieldTag(out))
+	}
+	st.Fields = out
+}
+
+// embeddedStruct returns the name of the struct type
+// that sf embeds, if sf is to be flattened, or "".
+func (f *FileSet) embeddedStruct(sf *gen.StructField) string {
+	if !sf.Embedded || sf.Skip || sf.FieldTag != sf.FieldName {
+		return ""
+	}
+	b, ok := sf.FieldElem.(*gen.BaseElem)
+	if !ok || b.Value != gen.IDENT {
+		return ""
+	}
+	if _, ok := f.Identities[b.TypeName()].(*gen.Struct); !ok {
+		return ""
+	}
+	return b.TypeName()
+}
+
+func hasZids(fields []gen.StructField) bool {
+	for i := range fields {
+		if fields[i].ZebraId >= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -35,6 +35,29 @@ type FileSet struct {
 	Imports    []*ast.ImportSpec   // imports
 	Cfg        *cfg.GreenConfig
 
+	// unexported types, kept in Specs only so that
+	// exported types can refer to them; they are
+	// inlined into their users, and those inlined
+	// into an exported type (usedHidden) only get
+	// the fieldsNotEmpty method that inlined
+	// structs call.
+	hidden      map[string]bool
+	hiddenElems map[string]gen.Elem
+	usedHidden  map[string]bool
+
+	// types that declare their own msgp methods
+	methods map[string]bool
+
+	// where each type spec was declared
+	declared map[string]token.Pos
+
+	// named slices and maps being parsed in
+	// place of a reference; see expandNamed
+	expanding map[string]bool
+
+	// ranges of typed const blocks, by type name
+	Enums map[string]*enumRange
+
 	ZebraSchemaId int64
 	PackageInfo   *loader.PackageInfo
 	LoadedProg    *loader.Program
@@ -45,22 +68,29 @@ type FileSet struct {
 // File parses a file at the relative path
 // provided and produces a new *FileSet.
 // If you pass in a path to a directory, the entire
-// directory will be parsed.
-// If unexport is false, only exported identifiers are included in the FileSet.
-// If the resulting FileSet would be empty, an error is returned.
+// directory will be parsed, leaving out _test.go files.
+// If unexport is false, only exported identifiers are included in the FileSet;
+// unexported types are still parsed, so that exported types can use them.
+// A file that parses but declares no types to generate
+// code for gives an empty FileSet, not an error; errors
+// are kept for files that fail to parse or load.
 func File(c *cfg.GreenConfig) (*FileSet, error) {
 	ok, isDir := fileOrDir(c.GoFile)
 	if !ok {
 		return nil, fmt.Errorf("error: path '%s' does not exist", c.GoFile)
 	}
 
+	setLogger(c)
 	name := c.GoFile
 	pushstate(name)
 	defer popstate()
 	fs := &FileSet{
 		Specs:      make(map[string]ast.Expr),
+		declared:   make(map[string]token.Pos),
 		Identities: make(map[string]gen.Elem),
 		Cfg:        c,
+		hidden:     make(map[string]bool),
+		expanding:  make(map[string]bool),
 	}
 
 	var filenames []string
@@ -128,6 +158,7 @@ func File(c *cfg.GreenConfig) (*FileSet, error) {
 				gotZebraSchema = true
 			}
 			if !c.Unexported {
+				fs.getHiddenTypeSpecs(fl)
 				ast.FileExports(fl)
 			}
 			fs.getTypeSpecs(fl)
@@ -135,7 +166,7 @@ func File(c *cfg.GreenConfig) (*FileSet, error) {
 		}
 	} else {
 		if len(pkgInfo.Files) != 1 {
-			fmt.Printf("debug: expected single file, but got: len(pkgInfo.Files) = %v\n", len(pkgInfo.Files))
+			fatalf("expected single file, but got: len(pkgInfo.Files) = %v\n", len(pkgInfo.Files))
 			panic("huh?!? what to do with multiple or zero files here?")
 		}
 		f := pkgInfo.Files[0]
@@ -143,21 +174,27 @@ func File(c *cfg.GreenConfig) (*FileSet, error) {
 		fs.getZebraSchemaId(f)
 
 		if !c.Unexported {
+			fs.getHiddenTypeSpecs(f)
 			ast.FileExports(f)
 		}
 		fs.getTypeSpecs(f)
 	}
 
-	if len(fs.Specs) == 0 {
-		return nil, fmt.Errorf("no definitions in %s", name)
-	}
-
 	err = fs.process()
 	if err != nil {
 		return nil, err
 	}
+	err = fs.checkRecursion()
+	if err != nil {
+		return nil, err
+	}
+	if c.FlattenEmbedded {
+		fs.flattenEmbedded()
+	}
 	fs.applyDirectives()
 	fs.propInline()
+	fs.dropHidden()
+	fs.checkIdents()
 
 	return fs, nil
 }
@@ -237,12 +274,15 @@ func (f *FileSet) resolve(ls linkset) {
 // process takes the contents of f.Specs and
 // uses them to populate f.Identities
 func (f *FileSet) process() error {
+	f.unhideHandWritten()
 
 	deferred := make(linkset)
 parse:
 	for name, def := range f.Specs {
 		pushstate(name)
+		f.expanding[name] = true
 		el, err := f.parseExpr(def)
+		delete(f.expanding, name)
 		if err != nil {
 			return err
 		}
@@ -259,6 +299,7 @@ parse:
 			popstate()
 			continue parse
 		}
+		markAnonymous(el, true)
 		el.Alias(name)
 		f.Identities[name] = el
 		popstate()
@@ -270,6 +311,33 @@ parse:
 	return nil
 }
 
+// markAnonymous marks the structs declared inline
+// within a type spec, which have no methods of their
+// own. Named types are still IDENTs at this point,
+// so every struct below the top one is inline.
+func markAnonymous(el gen.Elem, top bool) {
+	switch el := el.(type) {
+	case *gen.Struct:
+		el.Anonymous = !top
+		for i := range el.Fields {
+			if !el.Fields[i].Skip {
+				markAnonymous(el.Fields[i].FieldElem, false)
+			}
+		}
+		if el.Inline != nil {
+			markAnonymous(el.Inline.Value, false)
+		}
+	case *gen.Array:
+		markAnonymous(el.Els, false)
+	case *gen.Slice:
+		markAnonymous(el.Els, false)
+	case *gen.Map:
+		markAnonymous(el.Value, false)
+	case *gen.Ptr:
+		markAnonymous(el.Value, false)
+	}
+}
+
 func strToMethod(s string) gen.Method {
 	switch s {
 	case "encode":
@@ -323,6 +391,7 @@ loop:
 }
 
 func (f *FileSet) PrintTo(p *gen.Printer) error {
+	setLogger(f.Cfg)
 	f.applyDirs(p)
 	names := make([]string, 0, len(f.Identities))
 	for name := range f.Identities {
@@ -339,6 +408,21 @@ func (f *FileSet) PrintTo(p *gen.Printer) error {
 			return err
 		}
 	}
+	names = names[:0]
+	for name := range f.hiddenElems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		el := f.hiddenElems[name]
+		el.SetVarname("z")
+		pushstate(el.TypeName())
+		err := p.PrintOnly(el, gen.FieldsEmpty)
+		popstate()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -348,18 +432,27 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 
 	// collect all imports...
 	fs.Imports = append(fs.Imports, f.Imports...)
+	fs.getMethods(f)
 
 	// check all declarations...
 	for i := range f.Decls {
 
 		switch g := f.Decls[i].(type) {
 		case *ast.GenDecl:
+			fs.getConsts(g)
+
 			// and check the specs...
 			for _, s := range g.Specs {
 
 				// for ast.TypeSpecs....
 				switch ts := s.(type) {
 				case *ast.TypeSpec:
+					if isGeneric(ts) {
+						pushstate(ts.Name.Name)
+						warnln("generic types not supported; skipping this type")
+						popstate()
+						continue
+					}
 					switch ts.Type.(type) {
 
 					// this is the list of parse-able
@@ -370,6 +463,7 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 						*ast.MapType,
 						*ast.Ident:
 						fs.Specs[ts.Name.Name] = ts.Type
+						fs.declared[ts.Name.Name] = ts.Name.Pos()
 
 					}
 
@@ -379,6 +473,78 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 	}
 }
 
+// getHiddenTypeSpecs adds the unexported type specs in f
+// to fs.Specs, marking them hidden. It has to run before
+// ast.FileExports, which drops them. Like the fields of an
+// exported struct, only their exported fields are kept.
+func (fs *FileSet) getHiddenTypeSpecs(f *ast.File) {
+	for _, d := range f.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range g.Specs {
+			ts, ok := s.(*ast.TypeSpec)
+			if !ok || ts.Name.IsExported() || isGeneric(ts) {
+				continue
+			}
+			switch ts.Type.(type) {
+			case *ast.StructType,
+				*ast.ArrayType,
+				*ast.StarExpr,
+				*ast.MapType,
+				*ast.Ident:
+			default:
+				continue
+			}
+			// filter the fields as if the type were exported;
+			// this edits ts.Type in place.
+			shadow := *ts
+			shadow.Name = ast.NewIdent("X")
+			ast.FileExports(&ast.File{Decls: []ast.Decl{&ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{&shadow}}}})
+			fs.Specs[ts.Name.Name] = ts.Type
+			fs.hidden[ts.Name.Name] = true
+		}
+	}
+}
+
+// unhideHandWritten leaves the unexported types
+// that have msgp methods of their own to those
+// methods, as it would an exported type, instead
+// of inlining them.
+func (fs *FileSet) unhideHandWritten() {
+	for name := range fs.hidden {
+		if fs.methods[name] {
+			delete(fs.hidden, name)
+			delete(fs.Specs, name)
+		}
+	}
+}
+
+// isGeneric reports whether ts declares type
+// parameters, as in type Box[T any] struct{ V T }.
+// The generated methods would need a concrete
+// type for each parameter, so such types are
+// skipped.
+func isGeneric(ts *ast.TypeSpec) bool {
+	return ts.TypeParams != nil && ts.TypeParams.NumFields() > 0
+}
+
+// dropHidden moves the hidden types out of
+// fs.Identities once they have been inlined,
+// keeping those that an exported type uses.
+func (fs *FileSet) dropHidden() {
+	fs.hiddenElems = make(map[string]gen.Elem)
+	for name := range fs.hidden {
+		if el, ok := fs.Identities[name]; ok {
+			if fs.usedHidden[name] {
+				fs.hiddenElems[name] = el
+			}
+			delete(fs.Identities, name)
+		}
+	}
+}
+
 func fieldName(f *ast.Field) string {
 	switch len(f.Names) {
 	case 0:
@@ -422,6 +588,21 @@ func (p zidSetSlice) Less(i, j int) bool {
 }
 func (p zidSetSlice) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
+// byFieldTag orders fields by their wire name,
+// for -sort-fields.
+type byFieldTag []gen.StructField
+
+func (p byFieldTag) Len() int           { return len(p) }
+func (p byFieldTag) Less(i, j int) bool { return p[i].FieldTag < p[j].FieldTag }
+func (p byFieldTag) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// sortFields reports whether fields should be
+// sorted by tag: under -sort-fields, unless
+// zids already fix their order.
+func (fs *FileSet) sortFields(fields []gen.StructField) bool {
+	return fs.Cfg != nil && fs.Cfg.SortFields && !hasZids(fields)
+}
+
 func (fs *FileSet) parseFieldList(fl *ast.FieldList) ([]gen.StructField, error) {
 	if fl == nil || fl.NumFields() == 0 {
 		return nil, nil
@@ -447,11 +628,27 @@ func (fs *FileSet) parseFieldList(fl *ast.FieldList) ([]gen.StructField, error)
 		}
 		if len(fds) > 0 {
 			out = append(out, fds...)
+		} else if fs.strict() {
+			err = strictError("field left out")
+			fatalf(err.Error())
+			return nil, err
 		} else {
 			warnln(fmt.Sprintf("ignored. heh, on '%#v'", fs))
 		}
 		popstate()
 	}
+	// two fields under one key would leave the
+	// decoded value up to the order on the wire
+	keys := make(map[string]string, len(out))
+	for i := range out {
+		if out[i].Skip {
+			continue
+		}
+		if prev, ok := keys[out[i].FieldTag]; ok {
+			return nil, fmt.Errorf("fields '%v' and '%v' both use the key '%v'", prev, out[i].FieldName, out[i].FieldTag)
+		}
+		keys[out[i].FieldTag] = out[i].FieldName
+	}
 	// check zidSet sequential from 0, no gaps, no duplicates
 	if hasZid {
 		sort.Sort(zidSetSlice(zidSet))
@@ -477,6 +674,9 @@ func (fs *FileSet) parseFieldList(fl *ast.FieldList) ([]gen.StructField, error)
 		}
 		out = sortedOut
 	}
+	if fs.sortFields(out) {
+		sort.Stable(byFieldTag(out))
+	}
 	return out, nil
 }
 
@@ -491,6 +691,47 @@ func anyMatches(haystack []string, needle string) bool {
 	return false
 }
 
+// optionValue finds a "name=value" option
+// among the msg tag options, returning its value.
+func optionValue(opts []string, name string) (string, bool) {
+	for _, v := range opts {
+		tr := strings.TrimSpace(v)
+		if strings.HasPrefix(tr, name+"=") {
+			return tr[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// strict reports whether -strict was given.
+func (fs *FileSet) strict() bool {
+	return fs.Cfg != nil && fs.Cfg.Strict
+}
+
+// strictError is the error for a field that -strict
+// won't let be left out, prefixed by where it is, as
+// warnings are: the file, the type and the field.
+func strictError(format string, v ...interface{}) error {
+	return fmt.Errorf("%s: %s", strings.Join(logctx, ": "), fmt.Sprintf(format, v...))
+}
+
+// onField describes the field for error messages
+func onField(f *ast.Field) string {
+	if len(f.Names) > 0 {
+		return " on '" + f.Names[0].Name + "'"
+	}
+	return ""
+}
+
+// tagName returns the struct tag key that
+// field names and options are read from.
+func (fs *FileSet) tagName() string {
+	if fs.Cfg == nil || fs.Cfg.TagName == "" {
+		return "msg"
+	}
+	return fs.Cfg.TagName
+}
+
 // translate *ast.Field into []gen.StructField
 func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 	sf := make([]gen.StructField, 1)
@@ -500,15 +741,25 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 	var skip bool
 	var deprecated bool
 	var showzero bool
+	var nilwhenzero bool
+	var enumcheck bool
+	var required bool
+	var readonly bool
+	var extras bool
+	var inline bool
+	var truncate int
+	var oneof string
+	var keyorder bool
+	var keyorderOf string
 	var zebraId int64 = -1
 
 	// parse tag; otherwise field name is field tag
 	if f.Tag != nil {
 		alltags := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
-		body := alltags.Get("msg")
-		tags := strings.Split(body, ",")
+		name, opts, skipTag := msgp.FieldTag(alltags, fs.tagName(), fs.Cfg != nil && fs.Cfg.JSONTagFallback)
+		tags := append([]string{name}, opts...)
 
-		if len(tags) == 2 && tags[1] == "extension" {
+		if len(tags) > 1 && anyMatches(tags[1:], "extension") {
 			extension = true
 		}
 		// must use msg:",omitempty" if no alt name, to
@@ -523,8 +774,45 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 		if len(tags) > 1 && anyMatches(tags[1:], "showzero") {
 			showzero = true
 		}
+		if len(tags) > 1 && anyMatches(tags[1:], "nilwhen=zero") {
+			nilwhenzero = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "enumcheck") {
+			enumcheck = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "required") {
+			required = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "readonly") {
+			readonly = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "extras") {
+			extras = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "inline") {
+			inline = true
+		}
+		if len(tags) > 1 && anyMatches(tags[1:], "keyorder") {
+			keyorder = true
+		}
+		if m, ok := optionValue(tags[1:], "keyorder"); ok {
+			keyorder = true
+			keyorderOf = m
+		}
+		if g, ok := optionValue(tags[1:], "oneof"); ok && g != "" {
+			oneof = g
+		}
+		if n, ok := optionValue(tags[1:], "truncate"); ok {
+			var err error
+			truncate, err = strconv.Atoi(n)
+			if err != nil || truncate <= 0 {
+				err2 := fmt.Errorf("bad `msg` tag option truncate=%s%s: must be a positive number of bytes", n, onField(f))
+				fatalf(err2.Error())
+				return nil, err2
+			}
+		}
 		// ignore "-" fields
-		if tags[0] == "-" {
+		if skipTag {
 			skip = true
 			// can't return early, need to track deprecated zids.
 			//return nil, nil
@@ -532,6 +820,11 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 		if len(tags[0]) > 0 {
 			sf[0].FieldTag = tags[0]
 		}
+		// one name can't be given to several fields,
+		// so each keeps its own; the options still apply.
+		if len(f.Names) > 1 && !skip && tags[0] != "" {
+			warnf("the name %q in the `%s` tag can't be shared by %d fields; each keeps its own name. Declare them separately to rename them.\n", tags[0], fs.tagName(), len(f.Names))
+		}
 
 		// check deprecated
 		dep := alltags.Get("deprecated")
@@ -552,12 +845,8 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 			} else {
 				id, err := strconv.Atoi(zebra)
 				if err != nil {
-					where := ""
-					if len(f.Names) > 0 {
-						where = " on '" + f.Names[0].Name + "'"
-					}
 					err2 := fmt.Errorf("bad `zid` tag%s, could not convert"+
-						" '%v' to non-zero integer: %v", where, zebra, err)
+						" '%v' to non-zero integer: %v", onField(f), zebra, err)
 					fatalf(err2.Error())
 					return nil, err2
 				}
@@ -588,6 +877,63 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 		//fmt.Printf("\n we see nil field %#v\n", f.Names[0])
 		// struct{} type fields, must track for zid checking.
 		// so we can't return early here.
+		if _, ok := f.Type.(*ast.StructType); !ok {
+			if fs.strict() {
+				return nil, strictError("type %s not supported", stringify(f.Type))
+			}
+			warnf("type %s not supported; ignoring this field\n", stringify(f.Type))
+		}
+	}
+
+	if extras {
+		if isExtrasMap(ex) {
+			skip = true
+		} else {
+			warnln("extras needs a field of type map[string]interface{}; ignoring it.")
+			extras = false
+		}
+	}
+
+	if inline {
+		if isInlineMap(ex) {
+			skip = true
+		} else {
+			warnln("inline needs a field of type map[string]T; ignoring it.")
+			inline = false
+		}
+	}
+
+	if truncate > 0 {
+		// named types are checked again once they are
+		// resolved, by truncateOK.
+		if b, ok := ex.(*gen.BaseElem); !ok || (b.Value != gen.String && b.Value != gen.IDENT) {
+			warnln("truncate only applies to string fields; ignoring it.")
+			truncate = 0
+		}
+	}
+
+	if keyorder {
+		if isStringSlice(ex) {
+			skip = true
+		} else {
+			warnln("keyorder needs a field of type []string; ignoring it.")
+			keyorder = false
+		}
+	}
+
+	if oneof != "" {
+		if isNilable(ex) {
+			// only the member that is set gets written
+			omitempty = true
+		} else {
+			warnln("oneof needs a pointer, slice, map or interface{} field; ignoring it.")
+			oneof = ""
+		}
+	}
+
+	if _, isPtr := ex.(*gen.Ptr); nilwhenzero && isPtr {
+		warnln("nilwhen=zero has no effect on pointers; they are already nil when unset.")
+		nilwhenzero = false
 	}
 
 	sf[0].Deprecated = deprecated
@@ -595,23 +941,64 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 	sf[0].ZebraId = zebraId
 	sf[0].Skip = skip
 	sf[0].ShowZero = showzero
+	sf[0].NilWhenZero = nilwhenzero
+	sf[0].Required = required
+	sf[0].ReadOnly = readonly
+	sf[0].Extras = extras
+	sf[0].Inline = inline
+	sf[0].Truncate = truncate
+	sf[0].OneOf = oneof
+	sf[0].IsKeyOrder = keyorder
+	sf[0].KeyOrderOf = keyorderOf
+	if enumcheck {
+		fs.setEnumCheck(&sf[0], f.Type)
+	}
+
+	doc := fieldDoc(f)
+	sf[0].Doc = doc
 
 	// parse field name
 	switch len(f.Names) {
 	case 0:
 		sf[0].FieldName = embedded(f.Type)
+		sf[0].Embedded = true
 	case 1:
 		sf[0].FieldName = f.Names[0].Name
 	default:
 		// this is for a multiple in-line declaration,
 		// e.g. type A struct { One, Two int }
+		first := sf[0]
 		sf = sf[0:0]
 		for _, nm := range f.Names {
+			if skip {
+				sf = append(sf, gen.StructField{
+					FieldTag:   nm.Name,
+					FieldName:  nm.Name,
+					Doc:        doc,
+					Deprecated: deprecated,
+					ZebraId:    zebraId,
+					Skip:       true,
+				})
+				continue
+			}
 			sf = append(sf, gen.StructField{
 				FieldTag:        nm.Name,
 				FieldName:       nm.Name,
+				Doc:             doc,
 				FieldElem:       ex.Copy(),
 				OmitEmpty:       omitempty,
+				ShowZero:        showzero,
+				NilWhenZero:     nilwhenzero,
+				Required:        required,
+				ReadOnly:        readonly,
+				Extras:          extras,
+				Inline:          inline,
+				Truncate:        truncate,
+				OneOf:           oneof,
+				EnumCheck:       first.EnumCheck,
+				EnumType:        first.EnumType,
+				EnumMin:         first.EnumMin,
+				EnumMax:         first.EnumMax,
 				Deprecated:      deprecated,
 				ZebraId:         zebraId,
 				Skip:            skip,
@@ -648,6 +1035,98 @@ func (fs *FileSet) getField(f *ast.Field) ([]gen.StructField, error) {
 	return sf, nil
 }
 
+// is e a map[string]interface{}?
+func isExtrasMap(e gen.Elem) bool {
+	m, ok := e.(*gen.Map)
+	if !ok || m.KeyTyp != "String" || m.IsSet {
+		return false
+	}
+	b, ok := m.Value.(*gen.BaseElem)
+	return ok && b.Value == gen.Intf
+}
+
+// is e a map[string]T?
+func isInlineMap(e gen.Elem) bool {
+	m, ok := e.(*gen.Map)
+	return ok && m.KeyTyp == "String" && !m.IsSet
+}
+
+// is e a []string?
+func isStringSlice(e gen.Elem) bool {
+	sl, ok := e.(*gen.Slice)
+	if !ok {
+		return false
+	}
+	b, ok := sl.Els.(*gen.BaseElem)
+	return ok && b.Value == gen.String && !b.Convert
+}
+
+// linkKeyOrder points each map field that has
+// a msg:",keyorder" field to that field. A keyorder
+// field that has no map to go with is written
+// like any other field.
+func linkKeyOrder(fields []gen.StructField) {
+	for i := range fields {
+		if !fields[i].IsKeyOrder {
+			continue
+		}
+		target := -1
+		for j := range fields {
+			m, ok := fields[j].FieldElem.(*gen.Map)
+			if !ok || fields[j].Skip || m.IsSet || m.KeyTyp != "String" {
+				continue
+			}
+			if fields[i].KeyOrderOf != "" && fields[j].FieldName != fields[i].KeyOrderOf {
+				continue
+			}
+			if target != -1 {
+				// only one may match without a name
+				target = -2
+				break
+			}
+			target = j
+		}
+		if target < 0 {
+			warnf("keyorder field %s needs exactly one map[string]T field to go with, or keyorder=Field to name one; writing it as a plain field\n", fields[i].FieldName)
+			fields[i].IsKeyOrder = false
+			fields[i].Skip = false
+			fields[i].FieldTagZidClue = msgp.Clue2Field(fields[i].FieldTag, fields[i].FieldElem.TypeClue(), fields[i].ZebraId)
+			continue
+		}
+		fields[target].KeyOrder = fields[i].FieldName
+	}
+}
+
+// isNilable reports whether a field of
+// type ex can be compared to nil.
+func isNilable(ex gen.Elem) bool {
+	switch e := ex.(type) {
+	case *gen.Ptr, *gen.Slice, *gen.Map:
+		return true
+	case *gen.BaseElem:
+		return !e.Convert && (e.Value == gen.Bytes || e.Value == gen.Intf)
+	}
+	return false
+}
+
+// fieldDoc returns the doc comment of f and the
+// comment after it on the same line, one after
+// the other, without the comment markers and
+// with each line trimmed
+func fieldDoc(f *ast.Field) string {
+	var lines []string
+	for _, g := range []*ast.CommentGroup{f.Doc, f.Comment} {
+		text := strings.TrimSpace(g.Text())
+		if text == "" {
+			continue
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // extract embedded field name
 //
 // so, for a struct like
@@ -685,14 +1164,84 @@ func stringify(e ast.Expr) string {
 			return "[]" + stringify(e.Elt)
 		}
 		return fmt.Sprintf("[%s]%s", stringify(e.Len), stringify(e.Elt))
+	case *ast.MapType:
+		return fmt.Sprintf("map[%s]%s", stringify(e.Key), stringify(e.Value))
+	case *ast.ChanType:
+		return "chan " + stringify(e.Value)
+	case *ast.FuncType:
+		return "func"
+	case *ast.IndexExpr:
+		return fmt.Sprintf("%s[%s]", stringify(e.X), stringify(e.Index))
+	case *ast.IndexListExpr:
+		args := make([]string, len(e.Indices))
+		for i := range e.Indices {
+			args[i] = stringify(e.Indices[i])
+		}
+		return fmt.Sprintf("%s[%s]", stringify(e.X), strings.Join(args, ", "))
 	case *ast.InterfaceType:
 		if e.Methods == nil || e.Methods.NumFields() == 0 {
 			return "interface{}"
 		}
+		return "interface{...}"
 	}
 	return "<BAD>"
 }
 
+// mapKeyPrims are the primitives that
+// can be used as the key of a map, or
+// of a map[K]struct{} set.
+var mapKeyPrims = map[gen.Primitive]bool{
+	gen.String: true,
+	gen.Bool:   true,
+	gen.Int:    true,
+	gen.Int8:   true,
+	gen.Int16:  true,
+	gen.Int32:  true,
+	gen.Int64:  true,
+	gen.Uint:   true,
+	gen.Uint8:  true,
+	gen.Uint16: true,
+	gen.Uint32: true,
+	gen.Uint64: true,
+	gen.Byte:   true,
+}
+
+// expandNamed parses the spec of the local type
+// 'name' where a field or element refers to it,
+// if that type is a slice or a map, so that the
+// generated code doesn't depend on the named type
+// having methods; it may be ignored, or declared
+// in a file that isn't being generated. Structs,
+// arrays, types with msgp methods of their own,
+// and a type inside its own definition are left
+// as identifiers.
+func (fs *FileSet) expandNamed(name string) (gen.Elem, bool, error) {
+	spec, ok := fs.Specs[name]
+	if !ok || fs.methods[name] || fs.expanding[name] {
+		return nil, false, nil
+	}
+	switch spec := spec.(type) {
+	case *ast.MapType:
+	case *ast.ArrayType:
+		if spec.Len != nil {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+	fs.expanding[name] = true
+	el, err := fs.parseExpr(spec)
+	delete(fs.expanding, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if el == nil {
+		return nil, false, nil
+	}
+	el.Alias(name)
+	return el, true, nil
+}
+
 // recursively translate ast.Expr to gen.Elem; nil means type not supported
 // expected input types:
 // - *ast.MapType (map[T]J)
@@ -706,45 +1255,39 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 	switch e := e.(type) {
 
 	case *ast.MapType:
-		if k, ok := e.Key.(*ast.Ident); ok && k.Name == "string" {
-			in, err := fs.parseExpr(e.Value)
-			panicOn(err)
-			if in != nil {
-				return &gen.Map{Value: in, KeyTyp: "String", KeyDeclTyp: "string"}, nil
-			}
+		key, err := fs.parseExpr(e.Key)
+		if err != nil {
+			return nil, err
 		}
-
-		// support int64/int32/int keys
-		if k, ok := e.Key.(*ast.Ident); ok {
-			in, err := fs.parseExpr(e.Value)
-			if err != nil {
-				fatalf(err.Error())
-			}
-			if in != nil {
-				switch k.Name {
-				case "int64":
-					return &gen.Map{Value: in, KeyTyp: "Int64", KeyDeclTyp: "int64"}, nil
-				case "int32":
-					return &gen.Map{Value: in, KeyTyp: "Int32", KeyDeclTyp: "int32"}, nil
-				case "int":
-					return &gen.Map{Value: in, KeyTyp: "Int", KeyDeclTyp: "int"}, nil
-				}
-			}
+		kb, ok := key.(*gen.BaseElem)
+		if !ok || !mapKeyPrims[kb.Value] {
+			return nil, nil
 		}
 
-		return nil, nil
+		// map[K]struct{} is a set; it goes on
+		// the wire as an array of its keys.
+		if st, ok := e.Value.(*ast.StructType); ok && st.Fields.NumFields() == 0 {
+			return &gen.Map{Value: gen.Ident("struct{}"), KeyTyp: kb.BaseName(), KeyDeclTyp: kb.BaseType(), IsSet: true}, nil
+		}
+		in, err := fs.parseExpr(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		if in == nil {
+			return nil, nil
+		}
+		return &gen.Map{Key: kb, Value: in, KeyTyp: kb.BaseName(), KeyDeclTyp: kb.BaseType()}, nil
 
 	case *ast.Ident:
+		if el, ok, err := fs.expandNamed(e.Name); ok || err != nil {
+			return el, err
+		}
 		b := gen.Ident(e.Name)
 
 		// work to resove this expression
 		// can be done later, once we've resolved
-		// everything else.
-		if b.Value == gen.IDENT {
-			if _, ok := fs.Specs[e.Name]; !ok {
-				warnf("non-local identifier: %s\n", e.Name)
-			}
-		}
+		// everything else; checkIdents warns
+		// about what can't be.
 		return b, nil
 
 	case *ast.ArrayType:
@@ -807,7 +1350,7 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 					}
 				default:
 					// ignore, no package
-					fmt.Printf("ignoring, no package; s.X=%#v\n", s.X)
+					infof("ignoring, no package; s.X=%#v\n", s.X)
 				}
 
 				// get the scope:
@@ -843,6 +1386,10 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := v.(*gen.Ptr); ok {
+			// pointers to pointers are not supported
+			return nil, nil
+		}
 		if v != nil {
 			return &gen.Ptr{Value: v}, nil
 		}
@@ -853,6 +1400,7 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 		if err != nil {
 			return nil, err
 		}
+		linkKeyOrder(fields)
 		skipN := 0
 		for i := range fields {
 			if fields[i].Skip {
@@ -860,7 +1408,20 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 			}
 		}
 		if len(fields) > 0 {
-			return &gen.Struct{Fields: fields, SkipCount: skipN}, nil
+			st := &gen.Struct{Fields: fields, SkipCount: skipN}
+			for i := range fields {
+				if !fields[i].Extras && !fields[i].Inline {
+					continue
+				}
+				if st.Extras != "" {
+					return nil, fmt.Errorf("%s and %s are both catch-all maps; a struct may have only one msg:\",inline\" or msg:\",extras\" field", st.Extras, fields[i].FieldName)
+				}
+				st.Extras = fields[i].FieldName
+				if fields[i].Inline {
+					st.Inline = fields[i].FieldElem.Copy().(*gen.Map)
+				}
+			}
+			return st, nil
 		}
 		return nil, nil
 
@@ -880,33 +1441,48 @@ func (fs *FileSet) parseExpr(e ast.Expr) (gen.Elem, error) {
 }
 
 func infof(s string, v ...interface{}) {
-	pushstate(s)
-	fmt.Printf(strings.Join(logctx, ": "), v...)
-	popstate()
+	logf("info", s, v...)
 }
 
 func infoln(s string) {
-	pushstate(s)
-	fmt.Println(strings.Join(logctx, ": "))
-	popstate()
+	logf("info", "%s", s)
 }
 
 func warnf(s string, v ...interface{}) {
-	pushstate(s)
-	fmt.Printf(strings.Join(logctx, ": "), v...)
-	popstate()
+	logf("warn", s, v...)
 }
 
 func warnln(s string) {
-	pushstate(s)
-	fmt.Println(strings.Join(logctx, ": "))
-	popstate()
+	logf("warn", "%s", s)
 }
 
 func fatalf(s string, v ...interface{}) {
-	pushstate(s)
-	fmt.Printf(strings.Join(logctx, ": "), v...)
-	popstate()
+	logf("fatal", s, v...)
+}
+
+// logger receives the messages from infof, warnf
+// and fatalf; File sets it from GreenConfig.Logger.
+// When it is nil they are printed to stdout.
+var logger cfg.Logger
+
+func setLogger(c *cfg.GreenConfig) {
+	logger = nil
+	if c != nil {
+		logger = c.Logger
+	}
+}
+
+func logf(level string, s string, v ...interface{}) {
+	d := cfg.Diagnostic{
+		Level:   level,
+		Context: append([]string(nil), logctx...),
+		Msg:     strings.TrimSuffix(fmt.Sprintf(s, v...), "\n"),
+	}
+	if logger != nil {
+		logger.Log(d)
+		return
+	}
+	fmt.Println(d.String())
 }
 
 var logctx []string
@@ -971,6 +1547,13 @@ func fileOrDir(name string) (ok, isDir bool) {
 	return true, false
 }
 
+// isSourceFile reports whether fi is a .go file
+// other than a _test.go file.
+func isSourceFile(fi os.FileInfo) bool {
+	name := fi.Name()
+	return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+}
+
 func ListOfGoFilesInDir(path string) (gofiles []string, err error) {
 	fd, err := os.Open(path)
 	if err != nil {
@@ -984,7 +1567,7 @@ func ListOfGoFilesInDir(path string) (gofiles []string, err error) {
 	}
 
 	for _, d := range list {
-		if strings.HasSuffix(d.Name(), ".go") {
+		if isSourceFile(d) {
 			gofiles = append(gofiles, filepath.Join(path, d.Name()))
 		}
 	}
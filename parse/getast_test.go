@@ -1,10 +1,13 @@
 package parse
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	cv "github.com/glycerine/goconvey/convey"
 	"github.com/glycerine/truepack/cfg"
@@ -133,6 +136,28 @@ func testCode(code string, out []byte) error {
 	return err
 }
 
+// parseCode writes code to a temporary file and parses
+// it with 'load', File or FileNoLoad, and the settings
+// in c, filling in c.GoFile and c.Out.
+func parseCode(load func(*cfg.GreenConfig) (*FileSet, error), code string, c cfg.GreenConfig) (*FileSet, error) {
+	gofile, err := ioutil.TempFile(".", "tmp-test-code")
+	panicOn(err)
+	ofile := gofile.Name() + ".out"
+
+	defer func() {
+		os.Remove(gofile.Name())
+		os.Remove(ofile)
+	}()
+
+	_, err = gofile.WriteString(code)
+	panicOn(err)
+	gofile.Close()
+
+	c.GoFile = gofile.Name()
+	c.Out = ofile
+	return load(&c)
+}
+
 // write out fields in zid order: re-order the
 // field sequence to match the zid-based order.
 // This allows for consistent and reproducible
@@ -211,3 +236,1351 @@ func Test004OrderFieldsByZid(t *testing.T) {
 		cv.So(z[3].zid, cv.ShouldEqual, -1)
 	})
 }
+
+func Test005MapKeysOtherThanString(t *testing.T) {
+
+	cv.Convey("maps with integer and bool keys should be parsed, along with nested maps", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   ByID   map[int64]string\n" +
+			"   Flags  map[uint32]bool\n" +
+			"   Nested map[string]map[string]int\n" +
+			"   Pair   map[[2]int]string\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 4)
+
+		byID := rct.Fields[0].FieldElem.(*gen.Map)
+		cv.So(byID.KeyTyp, cv.ShouldEqual, "Int64")
+		cv.So(byID.KeyDeclTyp, cv.ShouldEqual, "int64")
+		cv.So(byID.Key.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Int64)
+		cv.So(byID.Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.String)
+
+		flags := rct.Fields[1].FieldElem.(*gen.Map)
+		cv.So(flags.KeyTyp, cv.ShouldEqual, "Uint32")
+		cv.So(flags.KeyDeclTyp, cv.ShouldEqual, "uint32")
+		cv.So(flags.Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Bool)
+
+		nested := rct.Fields[2].FieldElem.(*gen.Map)
+		cv.So(nested.KeyTyp, cv.ShouldEqual, "String")
+		inner := nested.Value.(*gen.Map)
+		cv.So(inner.KeyTyp, cv.ShouldEqual, "String")
+		cv.So(inner.Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Int)
+
+		// unsupported key types still drop the field
+		cv.So(rct.Fields[3].Skip, cv.ShouldBeTrue)
+	})
+}
+
+func Test006MapValuesParsedRecursively(t *testing.T) {
+
+	cv.Convey("map values of any supported type are parsed, and an unsupported one only drops its own field", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Inner struct { A int }\n" +
+			"type Flint struct {\n" +
+			"   Bytes    map[string][]byte\n" +
+			"   Ptrs     map[string]*Inner\n" +
+			"   Chans    map[string]chan int\n" +
+			"   Two, Fns map[string]func()\n" +
+			"   Floats   map[string]float64\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 6)
+
+		bytes := rct.Fields[0].FieldElem.(*gen.Map)
+		cv.So(bytes.Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Bytes)
+
+		ptrs := rct.Fields[1].FieldElem.(*gen.Map)
+		_, isPtr := ptrs.Value.(*gen.Ptr)
+		cv.So(isPtr, cv.ShouldBeTrue)
+
+		cv.So(rct.Fields[2].Skip, cv.ShouldBeTrue)
+		cv.So(rct.Fields[3].Skip, cv.ShouldBeTrue)
+		cv.So(rct.Fields[4].Skip, cv.ShouldBeTrue)
+
+		floats := rct.Fields[5].FieldElem.(*gen.Map)
+		cv.So(floats.Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Float64)
+		cv.So(rct.SkipCount, cv.ShouldEqual, 3)
+	})
+}
+
+func Test007SelectorExprTypes(t *testing.T) {
+
+	cv.Convey("time.Time fields become the time element, and other qualified types are idents", t, func() {
+		code := "\npackage fred\n\n" +
+			"import (\n" +
+			"   \"math/big\"\n" +
+			"   \"time\"\n" +
+			")\n\n" +
+			"type Flint struct {\n" +
+			"   When  time.Time\n" +
+			"   Times []time.Time\n" +
+			"   Big   big.Int\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 3)
+		cv.So(rct.SkipCount, cv.ShouldEqual, 0)
+
+		when := rct.Fields[0].FieldElem.(*gen.BaseElem)
+		cv.So(when.Value, cv.ShouldEqual, gen.Time)
+		cv.So(when.TypeName(), cv.ShouldEqual, "time.Time")
+
+		times := rct.Fields[1].FieldElem.(*gen.Slice)
+		cv.So(times.Els.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Time)
+
+		big := rct.Fields[2].FieldElem.(*gen.BaseElem)
+		cv.So(big.Value, cv.ShouldEqual, gen.IDENT)
+		cv.So(big.TypeName(), cv.ShouldEqual, "big.Int")
+	})
+}
+
+func Test008DefinedBasicTypes(t *testing.T) {
+
+	cv.Convey("named types defined on a basic type are encoded as that type", t, func() {
+		code := "\npackage fred\n\n" +
+			"type ID uint64\n" +
+			"type Name string\n" +
+			"type Inner struct { A int }\n" +
+			"type Flint struct {\n" +
+			"   Who   ID\n" +
+			"   Alias Name\n" +
+			"   In    Inner\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		who := rct.Fields[0].FieldElem.(*gen.BaseElem)
+		cv.So(who.Value, cv.ShouldEqual, gen.Uint64)
+		cv.So(who.Convert, cv.ShouldBeTrue)
+		cv.So(who.TypeName(), cv.ShouldEqual, "ID")
+
+		alias := rct.Fields[1].FieldElem.(*gen.BaseElem)
+		cv.So(alias.Value, cv.ShouldEqual, gen.String)
+		cv.So(alias.Convert, cv.ShouldBeTrue)
+		cv.So(alias.TypeName(), cv.ShouldEqual, "Name")
+
+		// struct types are inlined, not converted
+		_, isStruct := rct.Fields[2].FieldElem.(*gen.Struct)
+		cv.So(isStruct, cv.ShouldBeTrue)
+	})
+}
+
+func Test009OmitEmptyTagOption(t *testing.T) {
+
+	cv.Convey("the omitempty option is recognized after a name, after an empty name, and absent", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Barney string `msg:\"barney,omitempty\"`\n" +
+			"   Wilma  string `msg:\",omitempty\"`\n" +
+			"   Fred   string `msg:\"fred\"`\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		cv.So(rct.Fields[0].FieldTag, cv.ShouldEqual, "barney")
+		cv.So(rct.Fields[0].OmitEmpty, cv.ShouldBeTrue)
+
+		cv.So(rct.Fields[1].FieldTag, cv.ShouldEqual, "Wilma")
+		cv.So(rct.Fields[1].OmitEmpty, cv.ShouldBeTrue)
+
+		cv.So(rct.Fields[2].FieldTag, cv.ShouldEqual, "fred")
+		cv.So(rct.Fields[2].OmitEmpty, cv.ShouldBeFalse)
+	})
+}
+
+func Test010ConfigurableTagName(t *testing.T) {
+
+	cv.Convey("with TagName set to \"codec\", codec tags name and skip fields the way msg tags do by default", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Barney string `codec:\"barney,omitempty\" msg:\"ignored\"`\n" +
+			"   Wilma  string `codec:\"-\"`\n" +
+			"   Fred   string `msg:\"-\"`\n" +
+			"   Dino   string\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			TagName: "codec",
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		cv.So(rct.Fields[0].FieldTag, cv.ShouldEqual, "barney")
+		cv.So(rct.Fields[0].OmitEmpty, cv.ShouldBeTrue)
+		cv.So(rct.Fields[0].Skip, cv.ShouldBeFalse)
+
+		cv.So(rct.Fields[1].FieldTag, cv.ShouldEqual, "-")
+		cv.So(rct.Fields[1].Skip, cv.ShouldBeTrue)
+
+		// msg tags are not consulted at all
+		cv.So(rct.Fields[2].FieldTag, cv.ShouldEqual, "Fred")
+		cv.So(rct.Fields[2].Skip, cv.ShouldBeFalse)
+
+		cv.So(rct.Fields[3].FieldTag, cv.ShouldEqual, "Dino")
+	})
+}
+
+type recordingLogger struct {
+	diags []cfg.Diagnostic
+}
+
+func (r *recordingLogger) Log(d cfg.Diagnostic) {
+	r.diags = append(r.diags, d)
+}
+
+func Test011DiagnosticsGoToTheConfiguredLogger(t *testing.T) {
+
+	cv.Convey("with a Logger set, the warning about an unsupported field is handed to it and nothing is printed", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Barney string\n" +
+			"   Pipe   chan int\n" +
+			"}\n"
+
+		rec := &recordingLogger{}
+		stdout := os.Stdout
+		r, w, err := os.Pipe()
+		panicOn(err)
+		os.Stdout = w
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		os.Stdout = stdout
+		w.Close()
+		printed, _ := ioutil.ReadAll(r)
+		r.Close()
+
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(string(printed), cv.ShouldEqual, "")
+		cv.So(fs.Identities["Flint"].(*gen.Struct).Fields[1].Skip, cv.ShouldBeTrue)
+
+		var found bool
+		for _, d := range rec.diags {
+			if d.Level == "warn" && d.Msg == "type chan int not supported; ignoring this field" {
+				found = true
+				cv.So(d.Context[len(d.Context)-2:], cv.ShouldResemble, []string{"Flint", "Pipe"})
+			}
+		}
+		cv.So(found, cv.ShouldBeTrue)
+	})
+}
+
+func Test012DirectoryResolvesTypesAcrossFiles(t *testing.T) {
+
+	cv.Convey("parsing a directory resolves types declared in sibling files, and unexported types are inlined but not emitted", t, func() {
+		for _, load := range []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad} {
+			cfg := cfg.GreenConfig{
+				GoFile:  "testdata/crossfile",
+				Encode:  true,
+				Marshal: true,
+			}
+			fs, err := load(&cfg)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(fs.Package, cv.ShouldEqual, "crossfile")
+
+			var names []string
+			for name := range fs.Identities {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			cv.So(names, cv.ShouldResemble, []string{"Base", "Outer"})
+
+			outer := fs.Identities["Outer"].(*gen.Struct)
+			cv.So(len(outer.Fields), cv.ShouldEqual, 3)
+			cv.So(outer.Fields[0].FieldName, cv.ShouldEqual, "Base")
+			cv.So(outer.Fields[0].FieldElem.TypeName(), cv.ShouldEqual, "Base")
+
+			in, ok := outer.Fields[2].FieldElem.(*gen.Struct)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(len(in.Fields), cv.ShouldEqual, 1)
+			cv.So(in.Fields[0].FieldName, cv.ShouldEqual, "Count")
+		}
+	})
+}
+
+func Test013FlattenEmbeddedStructs(t *testing.T) {
+
+	cv.Convey("embedded structs are nested by default, and spliced into the parent with FlattenEmbedded, where the parent's fields win", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Base struct {\n" +
+			"   ID   int\n" +
+			"   Name string\n" +
+			"}\n" +
+			"type Flint struct {\n" +
+			"   Base\n" +
+			"   Name  string\n" +
+			"   Count int\n" +
+			"}\n"
+
+		for _, flatten := range []bool{false, true} {
+			fs, err := parseCode(File, code, cfg.GreenConfig{
+				Encode:          true,
+				Marshal:         true,
+				FlattenEmbedded: flatten,
+			})
+			cv.So(err, cv.ShouldBeNil)
+			rct := fs.Identities["Flint"].(*gen.Struct)
+
+			var names, tags []string
+			for _, f := range rct.Fields {
+				names = append(names, f.FieldName)
+				tags = append(tags, f.FieldTag)
+			}
+			if flatten {
+				cv.So(names, cv.ShouldResemble, []string{"Base.ID", "Name", "Count"})
+				cv.So(tags, cv.ShouldResemble, []string{"ID", "Name", "Count"})
+			} else {
+				cv.So(names, cv.ShouldResemble, []string{"Base", "Name", "Count"})
+				cv.So(rct.Fields[0].Embedded, cv.ShouldBeTrue)
+			}
+		}
+	})
+}
+
+func Test014IgnoreDirective(t *testing.T) {
+
+	cv.Convey("types named by //msgp:ignore directives are left out, whether one or several are named per directive", t, func() {
+		code := "\npackage fred\n\n" +
+			"//msgp:ignore Barney Wilma\n" +
+			"//msgp:ignore Dino\n\n" +
+			"type Barney struct { A int }\n" +
+			"type Wilma struct { B int }\n" +
+			"type Dino struct { C int }\n" +
+			"type Flint struct {\n" +
+			"   Pet Dino\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+
+		var names []string
+		for name := range fs.Identities {
+			names = append(names, name)
+		}
+		cv.So(names, cv.ShouldResemble, []string{"Flint"})
+
+		// a field of an ignored type is left to that
+		// type's own (hand-written) methods
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(rct.Fields[0].FieldElem.TypeName(), cv.ShouldEqual, "Dino")
+		_, inlined := rct.Fields[0].FieldElem.(*gen.Struct)
+		cv.So(inlined, cv.ShouldBeFalse)
+	})
+}
+
+func Test015GroupedFieldDeclarations(t *testing.T) {
+
+	cv.Convey("a tag on `A, B, C string` applies its options to each field, but not its name, which draws a warning; `-` skips them all", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A, B, C string\n" +
+			"   D, E    string `msg:\"shared,omitempty\"`\n" +
+			"   F, G    string `msg:\",omitempty\"`\n" +
+			"   H, I    string `msg:\"-\"`\n" +
+			"}\n"
+
+		rec := &recordingLogger{}
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 9)
+
+		for i, name := range []string{"A", "B", "C", "D", "E", "F", "G", "H", "I"} {
+			f := rct.Fields[i]
+			cv.So(f.FieldName, cv.ShouldEqual, name)
+			cv.So(f.FieldTag, cv.ShouldEqual, name)
+			cv.So(f.OmitEmpty, cv.ShouldEqual, i >= 3 && i < 7)
+			cv.So(f.Skip, cv.ShouldEqual, i >= 7)
+		}
+
+		var warned []string
+		for _, d := range rec.diags {
+			if d.Level == "warn" {
+				warned = append(warned, d.Context[len(d.Context)-1])
+			}
+		}
+		cv.So(warned, cv.ShouldResemble, []string{"D (and others)"})
+	})
+}
+
+func Test016InterfaceFields(t *testing.T) {
+
+	cv.Convey("interface{} fields and slices of them are read and written dynamically; fields of a non-empty interface type are skipped", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Any    interface{}\n" +
+			"   Many   []interface{}\n" +
+			"   Reader interface{ Read([]byte) (int, error) }\n" +
+			"}\n"
+
+		rec := &recordingLogger{}
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		any, ok := rct.Fields[0].FieldElem.(*gen.BaseElem)
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(any.Value, cv.ShouldEqual, gen.Intf)
+
+		many, ok := rct.Fields[1].FieldElem.(*gen.Slice)
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(many.Els.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Intf)
+
+		cv.So(rct.Fields[2].Skip, cv.ShouldBeTrue)
+		var warned bool
+		for _, d := range rec.diags {
+			if d.Level == "warn" && d.Msg == "type interface{...} not supported; ignoring this field" {
+				warned = true
+			}
+		}
+		cv.So(warned, cv.ShouldBeTrue)
+	})
+}
+
+func Test017JSONTagFallback(t *testing.T) {
+
+	cv.Convey("with JSONTagFallback, a json tag names or skips a field that has no msg tag, and a msg tag wins over it", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Barney string `json:\"barney,omitempty\"`\n" +
+			"   Wilma  string `json:\"wilma\" msg:\"wilma_msg\"`\n" +
+			"   Fred   string `json:\"-\"`\n" +
+			"   Dino   string `json:\",omitempty\"`\n" +
+			"   Pebbles string\n" +
+			"   Bamm   string `json:\"-,\"`\n" +
+			"}\n"
+
+		for _, fallback := range []bool{false, true} {
+			fs, err := parseCode(File, code, cfg.GreenConfig{
+				Encode:          true,
+				Marshal:         true,
+				JSONTagFallback: fallback,
+			})
+			cv.So(err, cv.ShouldBeNil)
+			rct := fs.Identities["Flint"].(*gen.Struct)
+
+			cv.So(rct.Fields[1].FieldTag, cv.ShouldEqual, "wilma_msg")
+			cv.So(rct.Fields[3].FieldTag, cv.ShouldEqual, "Dino")
+			cv.So(rct.Fields[4].FieldTag, cv.ShouldEqual, "Pebbles")
+			if fallback {
+				cv.So(rct.Fields[0].FieldTag, cv.ShouldEqual, "barney")
+				cv.So(rct.Fields[2].Skip, cv.ShouldBeTrue)
+				// as in encoding/json, "-," names the field "-"
+				cv.So(rct.Fields[5].FieldTag, cv.ShouldEqual, "-")
+				cv.So(rct.Fields[5].Skip, cv.ShouldBeFalse)
+			} else {
+				cv.So(rct.Fields[0].FieldTag, cv.ShouldEqual, "Barney")
+				cv.So(rct.Fields[2].Skip, cv.ShouldBeFalse)
+				cv.So(rct.Fields[5].Skip, cv.ShouldBeFalse)
+			}
+		}
+	})
+}
+
+func Test018RecursiveTypes(t *testing.T) {
+
+	cv.Convey("types that hold each other by value are reported, while recursion through pointers and slices is fine", t, func() {
+		for _, c := range []struct {
+			code string
+			err  string
+			dump map[string]string
+		}{
+			{"type A struct {\n B B\n}\ntype B struct {\n A [2]A\n}\n", "invalid recursive type: A -> B -> A", nil},
+			{"type A struct {\n Inner struct{ Self A }\n}\n", "invalid recursive type: A -> A", nil},
+			{"type A struct {\n B *B\n}\ntype B struct {\n A []A\n}\n", "", map[string]string{
+				"A": "struct A\n  field B \"B__ptr\"\n    ptr *B\n      struct B\n        field A \"A__slc\"\n          slice []A\n            ident A\n",
+				"B": "struct B\n  field A \"A__slc\"\n    slice []A\n      ident A\n",
+			}},
+		} {
+			// the loader behind File would reject the
+			// invalid types itself, so use FileNoLoad
+			fs, err := parseCode(FileNoLoad, "\npackage fred\n\n"+c.code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+			})
+
+			if c.err != "" {
+				cv.So(err, cv.ShouldNotBeNil)
+				cv.So(err.Error(), cv.ShouldEqual, c.err)
+				continue
+			}
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(len(fs.Identities), cv.ShouldEqual, 2)
+			for name, el := range fs.Identities {
+				// A is not inlined into its copy of B,
+				// nor B into its copy of A
+				cv.So(selfInlined(el, nil), cv.ShouldEqual, "")
+				// types are inlined in order of name,
+				// so the trees are the same every run
+				var buf bytes.Buffer
+				cv.So(DumpElems(&buf, []gen.Elem{el}), cv.ShouldBeNil)
+				cv.So(buf.String(), cv.ShouldEqual, c.dump[name])
+			}
+		}
+	})
+}
+
+// selfInlined returns the name of a struct found
+// inlined within a copy of itself under el, or "".
+// 'path' holds the structs el is inside of.
+func selfInlined(el gen.Elem, path []string) string {
+	switch el := el.(type) {
+	case *gen.Struct:
+		if !el.Anonymous {
+			if inPath(path, el.TypeName()) {
+				return el.TypeName()
+			}
+			path = append(path[:len(path):len(path)], el.TypeName())
+		}
+		for i := range el.Fields {
+			if name := selfInlined(el.Fields[i].FieldElem, path); name != "" {
+				return name
+			}
+		}
+	case *gen.Ptr:
+		return selfInlined(el.Value, path)
+	case *gen.Slice:
+		return selfInlined(el.Els, path)
+	case *gen.Array:
+		return selfInlined(el.Els, path)
+	case *gen.Map:
+		return selfInlined(el.Value, path)
+	}
+	return ""
+}
+
+func Test019RuneByteUintptr(t *testing.T) {
+
+	cv.Convey("rune is read as an int32, byte as a byte, and uintptr as a uint64 converted to uintptr, alone or in slices", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   R  rune\n" +
+			"   B  byte\n" +
+			"   P  uintptr\n" +
+			"   Rs []rune\n" +
+			"   Bs []byte\n" +
+			"   Ps []uintptr\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		base := func(e gen.Elem) *gen.BaseElem {
+			if s, ok := e.(*gen.Slice); ok {
+				e = s.Els
+			}
+			return e.(*gen.BaseElem)
+		}
+		for i, want := range []gen.Primitive{gen.Int32, gen.Byte, gen.Uint64, gen.Int32, gen.Bytes, gen.Uint64} {
+			cv.So(base(rct.Fields[i].FieldElem).Value, cv.ShouldEqual, want)
+		}
+		p := base(rct.Fields[2].FieldElem)
+		cv.So(p.Convert, cv.ShouldBeTrue)
+		cv.So(p.FromBase(), cv.ShouldEqual, "uintptr")
+		cv.So(p.ToBase(), cv.ShouldEqual, "uint64")
+		cv.So(base(rct.Fields[5].FieldElem).TypeName(), cv.ShouldEqual, "uintptr")
+	})
+}
+
+func Test020SortFields(t *testing.T) {
+
+	cv.Convey("with SortFields, struct fields come out ordered by their tags instead of their declaration order", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Wilma   string\n" +
+			"   Barney  string `msg:\"zz\"`\n" +
+			"   Fred    string\n" +
+			"   Pebbles struct {\n" +
+			"      Y int\n" +
+			"      X int\n" +
+			"   }\n" +
+			"}\n" +
+			"type Rubble struct {\n" +
+			"   Betty  string `zid:\"0\"`\n" +
+			"   Bamm   string `zid:\"1\"`\n" +
+			"}\n"
+
+		tags := func(st *gen.Struct) []string {
+			var out []string
+			for _, f := range st.Fields {
+				out = append(out, f.FieldTag)
+			}
+			return out
+		}
+		for _, sorted := range []bool{false, true} {
+			fs, err := parseCode(File, code, cfg.GreenConfig{
+				Encode:     true,
+				Marshal:    true,
+				SortFields: sorted,
+			})
+			cv.So(err, cv.ShouldBeNil)
+			rct := fs.Identities["Flint"].(*gen.Struct)
+			if sorted {
+				cv.So(tags(rct), cv.ShouldResemble, []string{"Fred", "Pebbles", "Wilma", "zz"})
+				cv.So(tags(rct.Fields[1].FieldElem.(*gen.Struct)), cv.ShouldResemble, []string{"X", "Y"})
+			} else {
+				cv.So(tags(rct), cv.ShouldResemble, []string{"Wilma", "zz", "Fred", "Pebbles"})
+				cv.So(tags(rct.Fields[3].FieldElem.(*gen.Struct)), cv.ShouldResemble, []string{"Y", "X"})
+			}
+			cv.So(tags(fs.Identities["Rubble"].(*gen.Struct)), cv.ShouldResemble, []string{"Betty", "Bamm"})
+		}
+	})
+}
+
+func Test021PointerAndSliceCompositions(t *testing.T) {
+
+	cv.Convey("slices of pointers and pointers to slices are parsed, and a pointer to a pointer is dropped with a warning", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Inner struct { N int }\n" +
+			"type Flint struct {\n" +
+			"   Elems  []*Inner\n" +
+			"   Slice  *[]Inner\n" +
+			"   Double **Inner\n" +
+			"}\n"
+
+		rec := &recordingLogger{}
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		_, ok := rct.Fields[0].FieldElem.(*gen.Slice).Els.(*gen.Ptr)
+		cv.So(ok, cv.ShouldBeTrue)
+		_, ok = rct.Fields[1].FieldElem.(*gen.Ptr).Value.(*gen.Slice)
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(rct.Fields[2].Skip, cv.ShouldBeTrue)
+
+		var found bool
+		for _, d := range rec.diags {
+			if d.Level == "warn" && d.Msg == "type **Inner not supported; ignoring this field" {
+				found = true
+			}
+		}
+		cv.So(found, cv.ShouldBeTrue)
+	})
+}
+
+func Test022UnresolvedIdentWarning(t *testing.T) {
+
+	cv.Convey("a field whose type is neither generated nor has its own msgp methods gets a warning naming the field and type", t, func() {
+		code := "\npackage fred\n\n" +
+			"//msgp:ignore Skipped\n\n" +
+			"type Flint struct {\n" +
+			"   Known   Inner\n" +
+			"   Custom  *Gadget\n" +
+			"   Missing []Widget\n" +
+			"   Ignored Skipped\n" +
+			"}\n" +
+			"type Inner struct { N int }\n" +
+			"type Skipped struct { N int }\n" +
+			"type Gadget int\n" +
+			"func (g *Gadget) DecodeMsg(dc *msgp.Reader) error { return nil }\n"
+
+		rec := &recordingLogger{}
+		// Widget is undefined, which the loader
+		// would reject, so use FileNoLoad
+		_, err := parseCode(FileNoLoad, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		cv.So(err, cv.ShouldBeNil)
+
+		var warned []string
+		for _, d := range rec.diags {
+			if d.Level == "warn" && strings.HasSuffix(d.Msg, "the generated code will not compile") {
+				warned = append(warned, strings.Join(d.Context[len(d.Context)-2:], ".")+" "+strings.Fields(d.Msg)[1])
+			}
+		}
+		cv.So(warned, cv.ShouldResemble, []string{"Flint.Missing Widget", "Flint.Ignored Skipped"})
+	})
+}
+
+func Test023ExtensionTagOption(t *testing.T) {
+
+	cv.Convey("msg:\",extension\" makes a named type go through the extension path, alongside other options", t, func() {
+		code := "\npackage fred\n\n" +
+			"type UUID [16]byte\n" +
+			"type Flint struct {\n" +
+			"   ID    UUID  `msg:\"id,extension\"`\n" +
+			"   Maybe *UUID `msg:\"maybe,extension,omitempty\"`\n" +
+			"   Plain UUID\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+
+		id := rct.Fields[0].FieldElem.(*gen.BaseElem)
+		cv.So(id.Value, cv.ShouldEqual, gen.Ext)
+		cv.So(id.TypeName(), cv.ShouldEqual, "UUID")
+		cv.So(rct.Fields[0].FieldTag, cv.ShouldEqual, "id")
+
+		cv.So(rct.Fields[1].FieldElem.(*gen.Ptr).Value.(*gen.BaseElem).Value, cv.ShouldEqual, gen.Ext)
+		cv.So(rct.Fields[1].OmitEmpty, cv.ShouldBeTrue)
+
+		_, ok := rct.Fields[2].FieldElem.(*gen.Array)
+		cv.So(ok, cv.ShouldBeTrue)
+	})
+}
+
+func Test024ElemsInDependencyOrder(t *testing.T) {
+
+	cv.Convey("GetElems puts each type after the local types it refers to, and falls back to declaration order with a warning on a cycle", t, func() {
+		code := "\npackage fred\n\n" +
+			"type C struct { B B }\n" +
+			"type Lone struct { N int }\n" +
+			"type B struct { As []*A }\n" +
+			"type A struct { N int }\n"
+
+		cyclic := "\npackage fred\n\n" +
+			"type Y struct { X *X }\n" +
+			"type X struct { Y []Y }\n" +
+			"type Z struct { N int }\n"
+
+		order := func(code string) ([]string, *recordingLogger) {
+			rec := &recordingLogger{}
+			fs, err := parseCode(File, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  rec,
+			})
+			cv.So(err, cv.ShouldBeNil)
+
+			var names []string
+			for _, el := range fs.GetElems() {
+				names = append(names, el.TypeName())
+			}
+			return names, rec
+		}
+
+		names, rec := order(code)
+		cv.So(names, cv.ShouldResemble, []string{"A", "B", "C", "Lone"})
+		for _, d := range rec.diags {
+			cv.So(strings.Contains(d.Msg, "cycle"), cv.ShouldBeFalse)
+		}
+
+		names, rec = order(cyclic)
+		cv.So(names, cv.ShouldResemble, []string{"Y", "X", "Z"})
+		var warned bool
+		for _, d := range rec.diags {
+			if d.Level == "warn" && strings.Contains(d.Msg, "(Y -> X -> Y)") {
+				warned = true
+			}
+		}
+		cv.So(warned, cv.ShouldBeTrue)
+	})
+}
+
+func Test025NothingToGenerateIsNotAnError(t *testing.T) {
+
+	cv.Convey("a file with only functions, or only unexported types, gives an empty FileSet; a broken file gives an error", t, func() {
+		funcsOnly := "\npackage fred\n\n" +
+			"func Double(i int) int { return 2 * i }\n"
+
+		unexportedOnly := "\npackage fred\n\n" +
+			"type flint struct { N int }\n" +
+			"func (f flint) Double() int { return 2 * f.N }\n"
+
+		broken := "\npackage fred\n\n" +
+			"type Flint struct { N int \n"
+
+		parsers := []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad}
+		parseWith := func(parse func(*cfg.GreenConfig) (*FileSet, error), code string) (*FileSet, error) {
+			return parseCode(parse, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  &recordingLogger{},
+			})
+		}
+
+		for _, parse := range parsers {
+			for _, code := range []string{funcsOnly, unexportedOnly} {
+				fs, err := parseWith(parse, code)
+				cv.So(err, cv.ShouldBeNil)
+				cv.So(fs, cv.ShouldNotBeNil)
+				cv.So(fs.Package, cv.ShouldEqual, "fred")
+				cv.So(len(fs.Identities), cv.ShouldEqual, 0)
+				cv.So(fs.GetElems(), cv.ShouldBeNil)
+			}
+
+			fs, err := parseWith(parse, broken)
+			cv.So(err, cv.ShouldNotBeNil)
+			cv.So(fs, cv.ShouldBeNil)
+		}
+	})
+}
+
+func Test026GenericTypesAreSkipped(t *testing.T) {
+
+	cv.Convey("generic types are skipped with a warning, and fields that instantiate them are ignored", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Box[T any] struct { V T }\n" +
+			"type Pair[K comparable, V any] struct { K K; V V }\n" +
+			"type box[T any] struct { V T }\n" +
+			"type Holder struct {\n" +
+			"   N    int\n" +
+			"   Box  Box[int]\n" +
+			"   Pair Pair[string, int]\n" +
+			"}\n"
+
+		for _, parse := range []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad} {
+			rec := &recordingLogger{}
+			fs, err := parseCode(parse, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  rec,
+			})
+			cv.So(err, cv.ShouldBeNil)
+
+			var names []string
+			for name := range fs.Identities {
+				names = append(names, name)
+			}
+			cv.So(names, cv.ShouldResemble, []string{"Holder"})
+			st := fs.Identities["Holder"].(*gen.Struct)
+			var kept []string
+			for _, f := range st.Fields {
+				if !f.Skip {
+					kept = append(kept, f.FieldName)
+				}
+			}
+			cv.So(kept, cv.ShouldResemble, []string{"N"})
+
+			var warned []string
+			for _, d := range rec.diags {
+				if d.Level != "warn" {
+					continue
+				}
+				// the context starts after the file name
+				i := len(d.Context) - 1
+				for i >= 0 && !strings.HasPrefix(filepath.Base(d.Context[i]), "tmp-test-code") {
+					i--
+				}
+				warned = append(warned, strings.Join(d.Context[i+1:], ".")+": "+strings.TrimSpace(d.Msg))
+			}
+			cv.So(warned, cv.ShouldResemble, []string{
+				"Box: generic types not supported; skipping this type",
+				"Pair: generic types not supported; skipping this type",
+				"Holder.Box: type Box[int] not supported; ignoring this field",
+				"Holder.Pair: type Pair[string, int] not supported; ignoring this field",
+			})
+		}
+	})
+}
+
+func Test027DuplicateKeysAreAnError(t *testing.T) {
+
+	cv.Convey("two fields that resolve to the same key are an error naming both; keys that differ only in case are fine", t, func() {
+		colliding := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A    int `msg:\"X\"`\n" +
+			"   B    string\n" +
+			"   X    int\n" +
+			"}\n"
+
+		caseOnly := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A    int `msg:\"x\"`\n" +
+			"   X    int\n" +
+			"   Skip int `msg:\"-\"`\n" +
+			"   B    int `msg:\"Skip\"`\n" +
+			"}\n"
+
+		parse := func(code string) (*FileSet, error) {
+			return parseCode(File, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  &recordingLogger{},
+			})
+		}
+
+		_, err := parse(colliding)
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err.Error(), cv.ShouldEqual, "fields 'A' and 'X' both use the key 'X'")
+
+		fs, err := parse(caseOnly)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(fs.Identities["Flint"].(*gen.Struct).Fields), cv.ShouldEqual, 4)
+	})
+}
+
+func Test028NamedSlicesAndMapsAreExpanded(t *testing.T) {
+
+	cv.Convey("fields of a local named slice or map get the slice or map itself, even if the type is ignored; named structs and self-referring types stay identifiers", t, func() {
+		code := "\npackage fred\n\n" +
+			"//msgp:ignore Tags\n\n" +
+			"type Tags []string\n" +
+			"type Headers map[string]string\n" +
+			"type Deep map[string][]map[string]int\n" +
+			"type Tree map[string]Tree\n" +
+			"type Inner struct {\n" +
+			"   N int\n" +
+			"}\n" +
+			"type Flint struct {\n" +
+			"   T    Tags\n" +
+			"   H    Headers\n" +
+			"   D    Deep\n" +
+			"   R    Tree\n" +
+			"   I    Inner\n" +
+			"}\n"
+
+		for _, load := range []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad} {
+			fs, err := parseCode(load, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  &recordingLogger{},
+			})
+			cv.So(err, cv.ShouldBeNil)
+			_, ok := fs.Identities["Tags"]
+			cv.So(ok, cv.ShouldBeFalse)
+
+			fields := fs.Identities["Flint"].(*gen.Struct).Fields
+			byName := make(map[string]gen.Elem)
+			for i := range fields {
+				byName[fields[i].FieldName] = fields[i].FieldElem
+			}
+
+			sl, ok := byName["T"].(*gen.Slice)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(sl.TypeName(), cv.ShouldEqual, "Tags")
+
+			m, ok := byName["H"].(*gen.Map)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(m.TypeName(), cv.ShouldEqual, "Headers")
+
+			// too complex to inline, but expanded all the same
+			m, ok = byName["D"].(*gen.Map)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(m.TypeName(), cv.ShouldEqual, "Deep")
+
+			// Tree's definition still refers to itself
+			_, ok = byName["R"].(*gen.Map)
+			cv.So(ok, cv.ShouldBeTrue)
+			m, ok = fs.Identities["Tree"].(*gen.Map)
+			cv.So(ok, cv.ShouldBeTrue)
+			b, ok := m.Value.(*gen.BaseElem)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(b.Value, cv.ShouldEqual, gen.IDENT)
+			cv.So(b.TypeName(), cv.ShouldEqual, "Tree")
+
+			// structs are left to propInline, which
+			// copies small ones in, as it always has
+			_, ok = byName["I"].(*gen.Struct)
+			cv.So(ok, cv.ShouldBeTrue)
+		}
+	})
+}
+
+func Test029OneInlineMapPerStruct(t *testing.T) {
+
+	cv.Convey("a map[string]T field tagged inline becomes the struct's catch-all map; a second inline or extras field, even extras after extras, is an error, and inline on anything else is ignored with a warning", t, func() {
+		one := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Name   string\n" +
+			"   Scores map[string]float64 `msg:\",inline\"`\n" +
+			"   Pipe   []int `msg:\",inline\"`\n" +
+			"}\n"
+
+		two := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A map[string]int `msg:\",inline\"`\n" +
+			"   B map[string]int `msg:\",inline\"`\n" +
+			"}\n"
+
+		twoExtras := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A map[string]interface{} `msg:\",extras\"`\n" +
+			"   B map[string]interface{} `msg:\",extras\"`\n" +
+			"}\n"
+
+		withExtras := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   A map[string]interface{} `msg:\",extras\"`\n" +
+			"   B map[string]int `msg:\",inline\"`\n" +
+			"}\n"
+
+		parse := func(code string, rec *recordingLogger) (*FileSet, error) {
+			return parseCode(File, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  rec,
+			})
+		}
+
+		rec := &recordingLogger{}
+		fs, err := parse(one, rec)
+		cv.So(err, cv.ShouldBeNil)
+		st := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(st.Extras, cv.ShouldEqual, "Scores")
+		cv.So(st.Inline, cv.ShouldNotBeNil)
+		cv.So(st.Inline.Value.TypeName(), cv.ShouldEqual, "float64")
+		cv.So(st.Fields[2].Skip, cv.ShouldBeFalse)
+		cv.So(len(rec.diags), cv.ShouldEqual, 1)
+		cv.So(rec.diags[0].Msg, cv.ShouldContainSubstring, "inline needs a field of type map[string]T")
+
+		_, err = parse(two, &recordingLogger{})
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err.Error(), cv.ShouldContainSubstring, "A and B are both catch-all maps")
+
+		_, err = parse(withExtras, &recordingLogger{})
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err.Error(), cv.ShouldContainSubstring, "A and B are both catch-all maps")
+
+		_, err = parse(twoExtras, &recordingLogger{})
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err.Error(), cv.ShouldContainSubstring, "A and B are both catch-all maps")
+	})
+}
+
+func Test030DumpElemsShowsTheResolvedTree(t *testing.T) {
+
+	cv.Convey("DumpElems writes one indented line per node, with field keys and options, base types, identifiers and nested containers", t, func() {
+		code := "\npackage fred\n\n" +
+			"import \"net/url\"\n\n" +
+			"type Flag uint8\n\n" +
+			"type Flint struct {\n" +
+			"   Name  string `msg:\"name,omitempty\"`\n" +
+			"   Grid  [2][]float64\n" +
+			"   Meta  map[string]*Flag\n" +
+			"   Seen  map[string]struct{}\n" +
+			"   Link  url.URL\n" +
+			"   Anon  struct {\n" +
+			"      A int `msg:\",required\"`\n" +
+			"   }\n" +
+			"   Skip  int `msg:\"-\"`\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  &recordingLogger{},
+		})
+		cv.So(err, cv.ShouldBeNil)
+
+		var buf bytes.Buffer
+		err = DumpElems(&buf, []gen.Elem{fs.Identities["Flint"]})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(buf.String(), cv.ShouldEqual, `struct Flint
+  field Name "name__str", omitempty
+    base String string
+  field Grid "Grid__ary"
+    array [2][]float64, size 2
+      slice []float64
+        base Float64 float64
+  field Meta "Meta__map"
+    map map[string]*Flag, keys String
+      ptr *Flag
+        base Uint8 Flag, converted
+  field Seen "Seen__map"
+    set map[string]struct{}, keys String
+  field Link "Link__rct"
+    ident url.URL
+  field Anon "Anon__rct"
+    struct (anonymous)
+      field A "A__int", required
+        base Int int
+  field Skip, skipped
+`)
+	})
+}
+
+func Test031QualifiedIdentsAreLeftToTheirPackage(t *testing.T) {
+
+	cv.Convey("a field whose type is a struct from another package keeps its qualified name as an ident, under pointers, slices and maps too, without an unresolved identifier warning", t, func() {
+		code := "\npackage fred\n\n" +
+			"import \"example.com/other\"\n\n" +
+			"type Flint struct {\n" +
+			"   Cfg  other.Config\n" +
+			"   PCfg *other.Config\n" +
+			"   All  []other.Config\n" +
+			"   ByID map[string]*other.Config\n" +
+			"}\n"
+
+		rec := &recordingLogger{}
+		fs, err := parseCode(FileNoLoad, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  rec,
+		})
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 4)
+
+		isConfig := func(e gen.Elem) {
+			b, ok := e.(*gen.BaseElem)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(b.Value, cv.ShouldEqual, gen.IDENT)
+			cv.So(b.TypeName(), cv.ShouldEqual, "other.Config")
+		}
+		isConfig(rct.Fields[0].FieldElem)
+		isConfig(rct.Fields[1].FieldElem.(*gen.Ptr).Value)
+		isConfig(rct.Fields[2].FieldElem.(*gen.Slice).Els)
+		isConfig(rct.Fields[3].FieldElem.(*gen.Map).Value.(*gen.Ptr).Value)
+		cv.So(rct.Fields[0].FieldTagZidClue, cv.ShouldEqual, "Cfg__rct")
+
+		for _, d := range rec.diags {
+			cv.So(strings.Contains(d.Msg, "unresolved identifier"), cv.ShouldBeFalse)
+		}
+	})
+}
+
+func Test032StrictMakesUnsupportedFieldsAnError(t *testing.T) {
+
+	cv.Convey("a field of an unsupported type is left out with a warning, unless Strict is set, when it is an error naming the type, the field and its type", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   Barney string\n" +
+			"   Pipe   chan int\n" +
+			"}\n"
+
+		parse := func(strict bool, rec *recordingLogger) (*FileSet, error) {
+			return parseCode(File, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Strict:  strict,
+				Logger:  rec,
+			})
+		}
+
+		rec := &recordingLogger{}
+		fs, err := parse(false, rec)
+		cv.So(err, cv.ShouldBeNil)
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(rct.Fields[1].Skip, cv.ShouldBeTrue)
+		warned := false
+		for _, d := range rec.diags {
+			if d.Level == "warn" && strings.Contains(d.Msg, "type chan int not supported") {
+				warned = true
+			}
+		}
+		cv.So(warned, cv.ShouldBeTrue)
+
+		_, err = parse(true, &recordingLogger{})
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err.Error(), cv.ShouldContainSubstring, "Flint: Pipe: type chan int not supported")
+	})
+}
+
+func Test033FieldDocIsCaptured(t *testing.T) {
+
+	cv.Convey("a field's doc comment and line comment are kept in StructField.Doc, without the comment markers", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   // Barney is the name\n" +
+			"   // of the neighbour.\n" +
+			"   Barney string\n" +
+			"\n" +
+			"   Wilma int // in years\n" +
+			"\n" +
+			"   /* Pebbles and Bamm\n" +
+			"      go together. */\n" +
+			"   Pebbles, Bamm bool // both kids\n" +
+			"\n" +
+			"   Dino float64\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  &recordingLogger{},
+		})
+		cv.So(err, cv.ShouldBeNil)
+
+		rct := fs.Identities["Flint"].(*gen.Struct)
+		cv.So(len(rct.Fields), cv.ShouldEqual, 5)
+		cv.So(rct.Fields[0].Doc, cv.ShouldEqual, "Barney is the name\nof the neighbour.")
+		cv.So(rct.Fields[1].Doc, cv.ShouldEqual, "in years")
+		cv.So(rct.Fields[2].Doc, cv.ShouldEqual, "Pebbles and Bamm\ngo together.\nboth kids")
+		cv.So(rct.Fields[3].Doc, cv.ShouldEqual, rct.Fields[2].Doc)
+		cv.So(rct.Fields[4].Doc, cv.ShouldEqual, "")
+	})
+}
+
+func Test034OnlyUsedHiddenTypesAreInlined(t *testing.T) {
+
+	cv.Convey("unexported types are inlined into the exported types that use them, unless they have msgp methods of their own, and only the ones used get fieldsNotEmpty", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Flint struct {\n" +
+			"   In  inner\n" +
+			"   Gad gadget\n" +
+			"}\n" +
+			"type inner struct { N int; Deep deeper }\n" +
+			"type deeper struct { M int }\n" +
+			"type gadget struct { G int }\n" +
+			"func (g *gadget) DecodeMsg(r interface{}) error { return nil }\n" +
+			"type unused struct { U int; Deep deeper }\n"
+
+		for _, load := range []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad} {
+			rec := &recordingLogger{}
+			fs, err := parseCode(load, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  rec,
+			})
+			cv.So(err, cv.ShouldBeNil)
+
+			var names []string
+			for name := range fs.Identities {
+				names = append(names, name)
+			}
+			cv.So(names, cv.ShouldResemble, []string{"Flint"})
+
+			rct := fs.Identities["Flint"].(*gen.Struct)
+			in, ok := rct.Fields[0].FieldElem.(*gen.Struct)
+			cv.So(ok, cv.ShouldBeTrue)
+			_, ok = in.Fields[1].FieldElem.(*gen.Struct)
+			cv.So(ok, cv.ShouldBeTrue)
+
+			// gadget's own methods are called
+			gad, ok := rct.Fields[1].FieldElem.(*gen.BaseElem)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(gad.Value, cv.ShouldEqual, gen.IDENT)
+			cv.So(gad.TypeName(), cv.ShouldEqual, "gadget")
+			var warned []string
+			for _, d := range rec.diags {
+				if d.Level == "warn" {
+					warned = append(warned, d.Msg)
+				}
+			}
+			cv.So(warned, cv.ShouldBeNil)
+
+			var hidden []string
+			for name := range fs.hiddenElems {
+				hidden = append(hidden, name)
+			}
+			sort.Strings(hidden)
+			cv.So(hidden, cv.ShouldResemble, []string{"deeper", "inner"})
+		}
+	})
+}
+
+func Test035InlineMapValuesAreWalked(t *testing.T) {
+
+	cv.Convey("the value type of a msg:\",inline\" map is ordered before its user, and checked for methods", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Outer struct {\n" +
+			"   Name string\n" +
+			"   More map[string]Inner `msg:\",inline\"`\n" +
+			"}\n" +
+			"type Odd struct {\n" +
+			"   More map[string]Elsewhere `msg:\",inline\"`\n" +
+			"}\n" +
+			"type Elsewhere int\n" +
+			"//msgp:ignore Elsewhere\n" +
+			"type Inner struct { N int }\n"
+
+		for _, load := range []func(*cfg.GreenConfig) (*FileSet, error){File, FileNoLoad} {
+			rec := &recordingLogger{}
+			fs, err := parseCode(load, code, cfg.GreenConfig{
+				Encode:  true,
+				Marshal: true,
+				Logger:  rec,
+			})
+			cv.So(err, cv.ShouldBeNil)
+
+			var names []string
+			for _, el := range fs.GetElems() {
+				names = append(names, el.TypeName())
+			}
+			cv.So(names, cv.ShouldResemble, []string{"Inner", "Outer", "Odd"})
+
+			checked := 0
+			for _, d := range rec.diags {
+				if d.Level == "warn" && strings.HasPrefix(d.Msg, "type Elsewhere is not generated here") {
+					checked++
+				}
+			}
+			cv.So(checked, cv.ShouldEqual, 1)
+		}
+	})
+}
+
+func Test036SetsTakeTheSameKeysAsMaps(t *testing.T) {
+
+	cv.Convey("map[K]struct{} is a set for every key type a map accepts, and is left out for any other", t, func() {
+		code := "\npackage fred\n\n" +
+			"type Sets struct {\n" +
+			"   Flags  map[bool]struct{}\n" +
+			"   Small  map[uint8]struct{}\n" +
+			"   Shorts map[int16]struct{}\n" +
+			"   Raw    map[byte]struct{}\n" +
+			"   Floats map[float64]struct{}\n" +
+			"}\n"
+
+		fs, err := parseCode(File, code, cfg.GreenConfig{
+			Encode:  true,
+			Marshal: true,
+			Logger:  &recordingLogger{},
+		})
+		cv.So(err, cv.ShouldBeNil)
+
+		var buf bytes.Buffer
+		err = DumpElems(&buf, []gen.Elem{fs.Identities["Sets"]})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(buf.String(), cv.ShouldEqual, `struct Sets
+  field Flags "Flags__map"
+    set map[bool]struct{}, keys Bool
+  field Small "Small__map"
+    set map[uint8]struct{}, keys Uint8
+  field Shorts "Shorts__map"
+    set map[int16]struct{}, keys Int16
+  field Raw "Raw__map"
+    set map[byte]struct{}, keys Byte
+  field Floats, skipped
+`)
+	})
+}
@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// getMethods records the types in f that declare
+// their own DecodeMsg or UnmarshalMsg method, so
+// that fields of those types can be left to them.
+func (fs *FileSet) getMethods(f *ast.File) {
+	if fs.methods == nil {
+		fs.methods = make(map[string]bool)
+	}
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			continue
+		}
+		if !fs.isMsgpMethod(fn.Name.Name) {
+			continue
+		}
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if id, ok := recv.(*ast.Ident); ok {
+			fs.methods[id.Name] = true
+		}
+	}
+}
+
+func (fs *FileSet) isMsgpMethod(name string) bool {
+	var prefix string
+	if fs.Cfg != nil {
+		prefix = fs.Cfg.MethodPrefix
+	}
+	return name == prefix+"DecodeMsg" || name == prefix+"UnmarshalMsg"
+}
+
+// checkIdents warns about each field whose type is
+// a named type that the generated code will call
+// methods on, but that is neither generated here
+// nor known to have those methods. Without the
+// warning, the mistake shows up as a compile error
+// in the generated code. Types from other packages
+// are only checked when the package was loaded.
+func (fs *FileSet) checkIdents() {
+	names := make([]string, 0, len(fs.Identities))
+	for name := range fs.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pushstate(name)
+		fs.checkElem(fs.Identities[name])
+		popstate()
+	}
+}
+
+func (fs *FileSet) checkElem(e gen.Elem) {
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		if e.Value == gen.IDENT && !fs.knownIdent(e.TypeName()) {
+			warnf("type %s is not generated here and has no DecodeMsg or UnmarshalMsg method; the generated code will not compile\n", e.TypeName())
+		}
+	case *gen.Struct:
+		for i := range e.Fields {
+			if e.Fields[i].Skip {
+				continue
+			}
+			pushstate(e.Fields[i].FieldName)
+			fs.checkElem(e.Fields[i].FieldElem)
+			popstate()
+		}
+		if e.Inline != nil {
+			pushstate(e.Extras)
+			fs.checkElem(e.Inline.Value)
+			popstate()
+		}
+	case *gen.Array:
+		fs.checkElem(e.Els)
+	case *gen.Slice:
+		fs.checkElem(e.Els)
+	case *gen.Map:
+		if !e.IsSet {
+			fs.checkElem(e.Value)
+		}
+	case *gen.Ptr:
+		fs.checkElem(e.Value)
+	}
+}
+
+// knownIdent reports whether the named type is
+// generated in this FileSet or is known to have
+// its own msgp methods.
+func (fs *FileSet) knownIdent(name string) bool {
+	if _, ok := fs.Identities[name]; ok {
+		return true
+	}
+	if fs.hidden[name] || fs.methods[name] {
+		return true
+	}
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return false
+	}
+	pkg, ok := fs.QuickPack[name[:dot]]
+	if !ok || pkg == nil || pkg.Pkg == nil {
+		// not loaded; assume it is fine
+		return true
+	}
+	obj := pkg.Pkg.Scope().Lookup(name[dot+1:])
+	if obj == nil {
+		return false
+	}
+	ms := types.NewMethodSet(types.NewPointer(obj.Type()))
+	for i := 0; i < ms.Len(); i++ {
+		if fs.isMsgpMethod(ms.At(i).Obj().Name()) {
+			return true
+		}
+	}
+	return false
+}
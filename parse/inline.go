@@ -2,6 +2,9 @@ package parse
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/glycerine/truepack/gen"
 )
 
@@ -81,43 +84,82 @@ func (f *FileSet) nextShim(ref *gen.Elem, id string, be *gen.BaseElem) {
 	}
 }
 
-// propInline identifies and inlines candidates
+// propInline identifies and inlines candidates.
+// Inlining a type makes it more complex, which can
+// keep it from being inlined in turn, so the types
+// are visited in order of name for the outcome to
+// be the same on every run.
 func (f *FileSet) propInline() {
-	for name, el := range f.Identities {
+	names := make([]string, 0, len(f.Identities))
+	for name := range f.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		el := f.Identities[name]
 		pushstate(name)
 		switch el := el.(type) {
 		case *gen.Struct:
 			for i := range el.Fields {
 				if !el.Fields[i].Skip {
-					f.nextInline(&el.Fields[i].FieldElem, name)
+					f.nextInline(&el.Fields[i].FieldElem, []string{name})
 				}
 			}
+			if el.Inline != nil {
+				f.nextInline(&el.Inline.Value, []string{name})
+			}
 		case *gen.Array:
-			f.nextInline(&el.Els, name)
+			f.nextInline(&el.Els, []string{name})
 		case *gen.Slice:
-			f.nextInline(&el.Els, name)
+			f.nextInline(&el.Els, []string{name})
 		case *gen.Map:
-			f.nextInline(&el.Value, name)
+			f.nextInline(&el.Value, []string{name})
 		case *gen.Ptr:
-			f.nextInline(&el.Value, name)
+			f.nextInline(&el.Value, []string{name})
 		}
 		popstate()
 	}
 }
 
+// truncateOK reports whether a msg:",truncate=N"
+// option on sf, if any, is on a string.
+func truncateOK(sf *gen.StructField) bool {
+	if sf.Truncate == 0 {
+		return true
+	}
+	b, ok := sf.FieldElem.(*gen.BaseElem)
+	return ok && b.Value == gen.String
+}
+
+func inPath(path []string, name string) bool {
+	for _, p := range path {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
 const fatalloop = `detected infinite recursion in inlining loop!
 Please file a bug at github.com/glycerine/truepack/issues!
 Thanks!
 `
 
-func (f *FileSet) nextInline(ref *gen.Elem, root string) {
+// nextInline inlines the named types under ref. path
+// holds the names of the types being expanded, outermost
+// first, so that a type is never inlined into itself.
+func (f *FileSet) nextInline(ref *gen.Elem, path []string) {
 	switch el := (*ref).(type) {
 	case *gen.BaseElem:
-		// ensure that we're not inlining
-		// a type into itself
 		typ := el.TypeName()
-		if el.Value == gen.IDENT && typ != root {
-			if node, ok := f.Identities[typ]; ok && node.Complexity() < maxComplex {
+		if el.Value == gen.IDENT && inPath(path, typ) {
+			if f.hidden[typ] {
+				warnf("unexported type %s refers to itself, so it needs methods of its own; use -unexported\n", typ)
+			}
+		} else if el.Value == gen.IDENT {
+			// hidden types get no methods of their
+			// own, so they are inlined however big
+			if node, ok := f.Identities[typ]; ok && (node.Complexity() < maxComplex || f.hidden[typ]) {
 				infof("inlining %s\n", typ)
 
 				// This should never happen; it will cause
@@ -126,29 +168,50 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 					panic(fatalloop)
 				}
 
+				if f.hidden[typ] && !f.hidden[path[0]] {
+					if f.usedHidden == nil {
+						f.usedHidden = make(map[string]bool)
+					}
+					f.usedHidden[typ] = true
+				}
 				*ref = node.Copy()
-				f.nextInline(ref, node.TypeName())
-			} else if !ok && !el.Resolved() {
+				f.nextInline(ref, append(path[:len(path):len(path)], typ))
+			} else if !ok && !el.Resolved() && !strings.Contains(typ, ".") && !f.methods[typ] {
 				// this is the point at which we're sure that
 				// we've got a type that isn't a primitive,
-				// a library builtin, or a processed type
+				// a library builtin, a processed type, or
+				// one with msgp methods of its own.
+				// A qualified type like other.Config is left
+				// to the methods generated in its own package,
+				// which checkIdents looks for.
 				warnf("unresolved identifier: %s\n", typ)
 			}
 		}
 	case *gen.Struct:
 		for i := range el.Fields {
 			if !el.Fields[i].Skip {
-				f.nextInline(&el.Fields[i].FieldElem, root)
+				f.nextInline(&el.Fields[i].FieldElem, path)
+				if !truncateOK(&el.Fields[i]) {
+					warnf("truncate only applies to string fields; ignoring it on %s\n", el.Fields[i].FieldName)
+					el.Fields[i].Truncate = 0
+				}
 			}
 		}
+		// the msg:",inline" field is Skip, and
+		// its map is read and written from here
+		if el.Inline != nil {
+			f.nextInline(&el.Inline.Value, path)
+		}
 	case *gen.Array:
-		f.nextInline(&el.Els, root)
+		f.nextInline(&el.Els, path)
 	case *gen.Slice:
-		f.nextInline(&el.Els, root)
+		f.nextInline(&el.Els, path)
 	case *gen.Map:
-		f.nextInline(&el.Value, root)
+		if !el.IsSet {
+			f.nextInline(&el.Value, path)
+		}
 	case *gen.Ptr:
-		f.nextInline(&el.Value, root)
+		f.nextInline(&el.Value, path)
 	default:
 		panic(fmt.Sprintf("bad elem type %T/val=%#v", el, el))
 	}
@@ -13,8 +13,9 @@ import (
 // FileNoLoad parses a file at the relative path
 // provided and produces a new *FileSet.
 // If you pass in a path to a directory, the entire
-// directory will be parsed.
-// If unexport is false, only exported identifiers are included in the FileSet.
+// directory will be parsed, leaving out _test.go files.
+// If unexport is false, only exported identifiers are included in the FileSet;
+// unexported types are still parsed, so that exported types can use them.
 // If the resulting FileSet would be empty, an error is returned.
 //
 // FileNoLoad(), in noload.go, is
@@ -37,18 +38,23 @@ func FileNoLoad(c *cfg.GreenConfig) (*FileSet, error) {
 		return nil, fmt.Errorf("error: path '%s' does not exist", c.GoFile)
 	}
 
+	setLogger(c)
 	name := c.GoFile
 	pushstate(name)
 	defer popstate()
 	fs := &FileSet{
 		Specs:      make(map[string]ast.Expr),
+		declared:   make(map[string]token.Pos),
 		Identities: make(map[string]gen.Elem),
 		Cfg:        c,
+		hidden:     make(map[string]bool),
+		expanding:  make(map[string]bool),
 	}
 
 	fset := token.NewFileSet()
+	fs.Fset = fset
 	if isDir {
-		pkgs, err := parser.ParseDir(fset, name, nil, parser.ParseComments)
+		pkgs, err := parser.ParseDir(fset, name, isSourceFile, parser.ParseComments)
 		if err != nil {
 			return nil, err
 		}
@@ -66,6 +72,7 @@ func FileNoLoad(c *cfg.GreenConfig) (*FileSet, error) {
 			fs.Directives = append(fs.Directives, yieldComments(fl.Comments)...)
 			fs.getZebraSchemaId(fl)
 			if !c.Unexported {
+				fs.getHiddenTypeSpecs(fl)
 				ast.FileExports(fl)
 			}
 			fs.getTypeSpecs(fl)
@@ -80,21 +87,27 @@ func FileNoLoad(c *cfg.GreenConfig) (*FileSet, error) {
 		fs.Directives = yieldComments(f.Comments)
 		fs.getZebraSchemaId(f)
 		if !c.Unexported {
+			fs.getHiddenTypeSpecs(f)
 			ast.FileExports(f)
 		}
 		fs.getTypeSpecs(f)
 	}
 
-	if len(fs.Specs) == 0 {
-		return nil, fmt.Errorf("no definitions in %s", name)
-	}
-
 	err := fs.process()
 	if err != nil {
 		return nil, err
 	}
+	err = fs.checkRecursion()
+	if err != nil {
+		return nil, err
+	}
+	if c.FlattenEmbedded {
+		fs.flattenEmbedded()
+	}
 	fs.applyDirectives()
 	fs.propInline()
+	fs.dropHidden()
+	fs.checkIdents()
 
 	return fs, nil
 }
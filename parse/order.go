@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/glycerine/truepack/gen"
+)
+
+// declOrder returns the names in f.Identities
+// in the order they were declared: by file,
+// then by position within the file.
+func (f *FileSet) declOrder() []string {
+	names := make([]string, 0, len(f.Identities))
+	for name := range f.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if f.Fset == nil {
+		return names
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		pi := f.Fset.Position(f.declared[names[i]])
+		pj := f.Fset.Position(f.declared[names[j]])
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	return names
+}
+
+// GetElems returns the elements of f.Identities
+// so that each type comes after the local types
+// it refers to, for output where order matters.
+// PrintTo doesn't use it; it keeps emitting types
+// in name order, so generated files stay stable.
+// Types that don't depend on each other keep
+// their declaration order. If the types refer
+// to each other in a cycle, which Go allows
+// through pointers, slices and maps, a warning
+// is logged and declaration order is used.
+// With no types to generate, it returns nil.
+func (f *FileSet) GetElems() []gen.Elem {
+	if len(f.Identities) == 0 {
+		return nil
+	}
+	decl := f.declOrder()
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	sorted := make([]string, 0, len(decl))
+	var path []string
+	var cycle []string
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch state[name] {
+		case done:
+			return true
+		case visiting:
+			i := len(path) - 1
+			for path[i] != name {
+				i--
+			}
+			cycle = append(path[i:len(path):len(path)], name)
+			return false
+		}
+		el, ok := f.Identities[name]
+		if !ok {
+			return true
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range refDeps(el, true, nil) {
+			if dep != name && !visit(dep) {
+				return false
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		sorted = append(sorted, name)
+		return true
+	}
+	for _, name := range decl {
+		if !visit(name) {
+			warnf("types refer to each other in a cycle (%s); emitting them in declaration order\n", strings.Join(cycle, " -> "))
+			sorted = decl
+			break
+		}
+	}
+
+	els := make([]gen.Elem, len(sorted))
+	for i, name := range sorted {
+		els[i] = f.Identities[name]
+	}
+	return els
+}
+
+// refDeps appends the local types that e
+// refers to in any way to out. Unlike
+// valueDeps, it looks through pointers,
+// slices and maps, and it counts named
+// structs that propInline copied into e.
+func refDeps(e gen.Elem, top bool, out []string) []string {
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		if e.Value == gen.IDENT {
+			out = append(out, e.TypeName())
+		}
+	case *gen.Struct:
+		if !top && !e.Anonymous {
+			return append(out, e.TypeName())
+		}
+		for i := range e.Fields {
+			if !e.Fields[i].Skip {
+				out = refDeps(e.Fields[i].FieldElem, false, out)
+			}
+		}
+		if e.Inline != nil {
+			out = refDeps(e.Inline.Value, false, out)
+		}
+	case *gen.Array:
+		out = refDeps(e.Els, false, out)
+	case *gen.Slice:
+		out = refDeps(e.Els, false, out)
+	case *gen.Map:
+		out = refDeps(e.Key, false, out)
+		out = refDeps(e.Value, false, out)
+	case *gen.Ptr:
+		out = refDeps(e.Value, false, out)
+	}
+	return out
+}
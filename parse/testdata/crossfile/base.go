@@ -0,0 +1,6 @@
+package crossfile
+
+type Base struct {
+	ID      int64
+	Created string
+}
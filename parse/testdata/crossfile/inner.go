@@ -0,0 +1,6 @@
+package crossfile
+
+type inner struct {
+	Count   int
+	private string
+}
@@ -0,0 +1,9 @@
+package crossfile
+
+// Outer embeds Base, from base.go, and holds
+// an inner, from inner.go, which is unexported.
+type Outer struct {
+	Base
+	Name string
+	In   inner
+}
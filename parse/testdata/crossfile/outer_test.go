@@ -0,0 +1 @@
+package crossfile_test
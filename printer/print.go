@@ -89,7 +89,9 @@ func generate(f *parse.FileSet, mode gen.Method, cfg *cfg.GreenConfig) (*bytes.B
 	outbuf := bytes.NewBuffer(make([]byte, 0, 4096))
 	writePkgHeader(outbuf, f.Package)
 
-	myImports := []string{"fmt"}
+	// goimports drops whichever of these go unused;
+	// sort is needed by -sort-map-keys.
+	myImports := []string{"fmt", "sort"}
 	myImports = append(myImports, "github.com/glycerine/truepack/msgp")
 	for _, imp := range f.Imports {
 		if imp.Name != nil {